@@ -105,11 +105,12 @@ func (pcs *PeerConfigState) Update(
 		}
 	}
 	if !quiet {
+		pl := log.With(log.Peer(peer.PublicKey.String()), log.PeerName(name))
 		// don't log the first boot as a reboot
 		if bootChanged && !firstBoot {
-			log.Info("Peer %s is now %s (rebooted)", name, pcs.Describe(now))
+			pl.Info("Peer %s is now %s (rebooted)", name, pcs.Describe(now))
 		} else if changed {
-			log.Info("Peer %s is now %s", name, pcs.Describe(now))
+			pl.Info("Peer %s is now %s", name, pcs.Describe(now))
 		}
 	}
 	return pcs
@@ -164,6 +165,12 @@ func (pcs *PeerConfigState) IsAlive() bool {
 	return pcs != nil && pcs.lastAlive
 }
 
+// Contacted returns whether we have ever tried an endpoint for the peer, or
+// completed a handshake with it
+func (pcs *PeerConfigState) Contacted() bool {
+	return pcs != nil && (len(pcs.endpointLastUsed) != 0 || !pcs.lastHandshake.IsZero())
+}
+
 // AliveSince gives the time since which the peer has been healthy and alive,
 // or a _very_ far future value if it is not healthy and alive.
 func (pcs *PeerConfigState) AliveSince() time.Time {
@@ -182,6 +189,16 @@ func (pcs *PeerConfigState) AliveUntil() time.Time {
 	return time.Time{}
 }
 
+// BootID gives the boot id of the peer from its last alive fact, or nil if
+// it is not known
+func (pcs *PeerConfigState) BootID() *uuid.UUID {
+	if pcs == nil || pcs.lastBootID == nil {
+		return nil
+	}
+	ret := *pcs.lastBootID
+	return &ret
+}
+
 // TryGetMetadata fetches the value of the given member metadata attribute,
 // if it is known.
 func (pcs *PeerConfigState) TryGetMetadata(attr fact.MemberAttribute) (string, bool) {
@@ -204,6 +221,15 @@ func (pcs *PeerConfigState) IsBasic() bool {
 
 const endpointInterval = device.RekeyTimeout + device.KeepaliveTimeout
 
+// EndpointLastUsed gives the last time the given endpoint value was tried for
+// the peer, or the zero value if it has never been tried
+func (pcs *PeerConfigState) EndpointLastUsed(ep fact.Value) time.Time {
+	if pcs == nil {
+		return time.Time{}
+	}
+	return pcs.endpointLastUsed[string(util.MustBytes(ep.MarshalBinary()))]
+}
+
 // TimeForNextEndpoint returns if we should try another endpoint for the peer
 // (or if we should wait for the current endpoint to test out)
 func (pcs *PeerConfigState) TimeForNextEndpoint() bool {
@@ -251,7 +277,7 @@ func (pcs *PeerConfigState) NextEndpoint(
 		switch pf.Attribute {
 		case fact.AttributeEndpointV4, fact.AttributeEndpointV6:
 			if filter != nil && !filter(pf) {
-				log.Debug("skipping peer %s endpoint %s", peerName, pf.Value)
+				log.Endpoint.With(log.PeerName(peerName), log.Attribute(pf.Attribute.Name())).Debug("skipping peer %s endpoint %s", peerName, pf.Value)
 				continue
 			}
 			// this logic relies on the zero value of a Time being very far in the past
@@ -625,6 +625,35 @@ func TestPeerConfigState_IsAlive(t *testing.T) {
 	}
 }
 
+func TestPeerConfigState_Contacted(t *testing.T) {
+	type fields struct {
+		lastHandshake    time.Time
+		endpointLastUsed map[string]time.Time
+	}
+	tests := []struct {
+		name   string
+		fields *fields
+		want   bool
+	}{
+		{"nil", nil, false},
+		{"never", &fields{time.Time{}, map[string]time.Time{}}, false},
+		{"tried endpoint", &fields{time.Time{}, map[string]time.Time{"x": time.Now()}}, true},
+		{"handshake", &fields{time.Now(), map[string]time.Time{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pcs *PeerConfigState
+			if tt.fields != nil {
+				pcs = &PeerConfigState{
+					lastHandshake:    tt.fields.lastHandshake,
+					endpointLastUsed: tt.fields.endpointLastUsed,
+				}
+			}
+			assert.Equal(t, tt.want, pcs.Contacted())
+		})
+	}
+}
+
 func TestPeerConfigState_AliveSince(t *testing.T) {
 	now := time.Now()
 
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/pflag"
+
+	"github.com/fastcat/wirelink/config"
+)
+
+// checkConfigCmd looks for mistakes in the config that wirelink would accept,
+// but which would make it behave in confusing ways
+type checkConfigCmd struct {
+	strict bool
+}
+
+var _ lenientSubcommand = &checkConfigCmd{}
+
+func newCheckConfigCmd() subcommand {
+	return &checkConfigCmd{}
+}
+
+func (c *checkConfigCmd) lenient() {}
+
+func (c *checkConfigCmd) Usage() string {
+	return "[flags]"
+}
+
+func (c *checkConfigCmd) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&c.strict, "strict", false, "Fail if there are any warnings, not just errors")
+}
+
+func (c *checkConfigCmd) Run(ctx *subcommandContext) error {
+	if len(ctx.flags.Args()) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", ctx.flags.Args())
+	}
+	checker := &config.Checker{LookupIP: net.LookupIP}
+	if ctx.env != nil {
+		ifaces, err := ctx.env.Interfaces()
+		if err != nil {
+			return fmt.Errorf("unable to list network interfaces: %w", err)
+		}
+		checker.Interfaces = ifaces
+	}
+	diags := checker.Check(ctx.vcfg)
+
+	counts := make(map[config.Severity]int)
+	for _, d := range diags {
+		counts[d.Severity]++
+		fmt.Fprintf(ctx.stdout, "%s: %s\n", d.Severity, d.Message)
+		if d.Hint != "" {
+			fmt.Fprintf(ctx.stdout, "  hint: %s\n", d.Hint)
+		}
+	}
+	source := ctx.vcfg.ConfigFileUsed()
+	if source == "" {
+		source = "the config"
+	}
+	if len(diags) == 0 {
+		fmt.Fprintf(ctx.stdout, "No problems found in %s\n", source)
+		return nil
+	}
+	fmt.Fprintf(ctx.stdout, "Found %d errors, %d warnings, %d notes in %s\n",
+		counts[config.SeverityError], counts[config.SeverityWarning], counts[config.SeverityInfo], source)
+	if counts[config.SeverityError] != 0 || c.strict && counts[config.SeverityWarning] != 0 {
+		return fmt.Errorf("%s has problems", source)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	netmocks "github.com/fastcat/wirelink/internal/networking/mocks"
+	"github.com/fastcat/wirelink/internal/testutils"
+)
+
+func TestCheckConfigCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		args      []string
+		assertion require.ErrorAssertionFunc
+		contains  []string
+	}{
+		{
+			"clean",
+			"reportifaces: [eth*]\n",
+			nil,
+			require.NoError,
+			[]string{"No problems found in "},
+		},
+		{
+			"unknown key",
+			"control_socket: /tmp/x\n",
+			nil,
+			require.Error,
+			[]string{`error: unknown setting "control_socket"`, `hint: did you mean "control-socket"?`, "Found 1 errors, 0 warnings, 0 notes"},
+		},
+		{
+			"warning",
+			"reportifaces: [wlan*]\n",
+			nil,
+			require.NoError,
+			[]string{`warning: ReportIfaces glob "wlan*"`, "Found 0 errors, 1 warnings"},
+		},
+		{
+			"strict warning",
+			"reportifaces: [wlan*]\n",
+			[]string{"--strict"},
+			require.Error,
+			[]string{`warning: ReportIfaces glob "wlan*"`},
+		},
+		{
+			"extra args",
+			"",
+			[]string{"foo"},
+			require.Error,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("WIREVLINK_CONFIG_PATH", dir)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "wirevlink.wg0.yaml"), []byte(tt.config), 0o600))
+
+			env := &netmocks.Environment{}
+			env.Test(t)
+			env.WithSimpleInterfaces(map[string]net.IPNet{
+				"wg0":  testutils.MakeIPv4Net(10, 0, 0, 1, 24),
+				"eth0": testutils.MakeIPv4Net(192, 168, 0, 2, 24),
+			})
+			env.WithKnownInterfaces()
+
+			args := append([]string{"wirevlink", "check-config"}, tt.args...)
+			w := New(args)
+			var out bytes.Buffer
+			w.stdout = &out
+			require.NoError(t, w.Init(env))
+			require.True(t, w.Runnable())
+			tt.assertion(t, w.Run())
+			for _, c := range tt.contains {
+				assert.Contains(t, out.String(), c)
+			}
+		})
+	}
+}
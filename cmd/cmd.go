@@ -4,13 +4,22 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"sync"
 	"syscall"
 
+	"golang.org/x/sync/errgroup"
+
 	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/control"
+	"github.com/fastcat/wirelink/dns"
 	"github.com/fastcat/wirelink/internal"
 	"github.com/fastcat/wirelink/internal/networking"
+	"github.com/fastcat/wirelink/internal/systemd"
 	"github.com/fastcat/wirelink/log"
+	"github.com/fastcat/wirelink/metrics"
 	"github.com/fastcat/wirelink/server"
 )
 
@@ -22,19 +31,47 @@ type WirelinkCmd struct {
 	Server         *server.LinkServer
 	disableSignals bool // for synctest mainly
 	signals        chan os.Signal
+	stdin          io.Reader
+	stdout         io.Writer
+	// quietLogLevel is the level to return to when toggling debug logging off
+	quietLogLevel log.Level
+	// reloadMu serializes config reloads, which may come from signals or from
+	// the peer directory watcher
+	reloadMu sync.Mutex
+
+	// children are the per-interface commands when running several interfaces
+	// in one process, in which case Config and Server are nil
+	children []*WirelinkCmd
+	// child marks a per-interface command, which must not start its own
+	// children
+	child bool
+	// env is the shared environment for the children, which is closed once they
+	// are all done with it
+	env networking.Environment
+
+	subName string
+	sub     subcommand
+	subCtx  *subcommandContext
 }
 
 // New creates a new command instance using the given os.Args value
 func New(args []string) *WirelinkCmd {
 	ret := &WirelinkCmd{
-		args: args,
+		args:   args,
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
 	}
+	ret.subName, ret.args = findSubcommand(args)
 
 	return ret
 }
 
 // Init prepares the command instance
 func (w *WirelinkCmd) Init(env networking.Environment) error {
+	if w.subName != "" {
+		return w.initSubcommand(env)
+	}
+
 	var err error
 	w.wgc, err = env.NewWgClient()
 	if err != nil {
@@ -50,6 +87,14 @@ func (w *WirelinkCmd) Init(env networking.Environment) error {
 	if configData == nil {
 		return nil
 	}
+	if len(configData.Ifaces) != 0 && !w.child {
+		// the children each get their own client
+		if err = w.wgc.Close(); err != nil {
+			return fmt.Errorf("unable to close wgctrl: %w", err)
+		}
+		w.wgc = nil
+		return w.initChildren(env, configData.Ifaces)
+	}
 
 	if w.Config, err = configData.Parse(vcfg, w.wgc); err != nil {
 		flags.Usage()
@@ -59,49 +104,335 @@ func (w *WirelinkCmd) Init(env networking.Environment) error {
 		// config dump was requested
 		return nil
 	}
+	w.updateQuietLogLevel()
 
 	w.Server, err = server.Create(env, w.wgc, w.Config)
 	if err != nil {
 		return fmt.Errorf("unable to create server for interface %s: %w", w.Config.Iface, err)
 	}
+	// the parent reports for all its children together
+	if !w.child {
+		w.Server.ReportProgress(newReporter().Part(w.Config.Iface))
+	}
 
 	return nil
 }
 
-// Run invokes the server
-func (w *WirelinkCmd) Run() error {
-	defer w.Server.Close()
-	err := w.Server.Start()
+// newReporter sets up reporting to systemd, if we are running under it
+func newReporter() *systemd.Reporter {
+	notifier, err := systemd.FromEnv()
 	if err != nil {
-		return fmt.Errorf("unable to start server for interface %s: %w", w.Config.Iface, err)
+		log.Error("Unable to setup systemd notifications: %v", err)
 	}
+	return systemd.NewReporter(notifier)
+}
 
-	w.signals = make(chan os.Signal, 5)
-	w.Server.AddHandler(func(ctx context.Context) error {
-		if !w.disableSignals {
-			w.addSignalHandlers()
-		}
-		for {
-			select {
-			case sig := <-w.signals:
-				if sig == syscall.SIGINT || sig == syscall.SIGTERM {
-					log.Info("Received signal %v, stopping", sig)
-					// this will just initiate the shutdown, not block waiting for it
-					w.Server.RequestStop()
-
-					// also give platform handler an opportunity to do things
-					w.handlePlatformSignal(sig)
-				} else if !w.handlePlatformSignal(sig) {
-					log.Error("Received unexpected signal %v, ignoring", sig)
-				}
-			case <-ctx.Done():
-				return nil
+// initChildren prepares a command for each interface, which reads its own
+// config file and runs its own server
+func (w *WirelinkCmd) initChildren(env networking.Environment, ifaces []string) (err error) {
+	defer func() {
+		if err != nil {
+			w.closeChildren()
+		}
+	}()
+	controlSockets := make(map[string]string, len(ifaces))
+	metricsAddresses := make(map[string]string, len(ifaces))
+	dnsAddresses := make(map[string]string, len(ifaces))
+	for i, iface := range ifaces {
+		if iface == "" {
+			return fmt.Errorf("%s must not contain empty interface names", config.IfacesFlag)
+		}
+		if slices.Contains(ifaces[:i], iface) {
+			return fmt.Errorf("interface %s is listed more than once in %s", iface, config.IfacesFlag)
+		}
+		c := New(append(slices.Clone(w.args), "--"+config.IfaceFlag+"="+iface))
+		c.child = true
+		c.stdin, c.stdout = w.stdin, w.stdout
+		if err = c.Init(sharedEnvironment{env}); err != nil {
+			return fmt.Errorf("unable to initialize interface %s: %w", iface, err)
+		}
+		if c.Config == nil {
+			// config dump was requested, the child already printed it
+			if c.wgc != nil {
+				c.wgc.Close()
 			}
+			continue
 		}
-	})
+		w.children = append(w.children, c)
+		if other, ok := controlSockets[c.Config.ControlSocket]; ok {
+			return fmt.Errorf("interfaces %s and %s both use control socket %s", other, iface, c.Config.ControlSocket)
+		} else if c.Config.ControlSocket != "" {
+			controlSockets[c.Config.ControlSocket] = iface
+		}
+		if other, ok := metricsAddresses[c.Config.MetricsAddress]; ok {
+			return fmt.Errorf("interfaces %s and %s both export metrics on %s", other, iface, c.Config.MetricsAddress)
+		} else if c.Config.MetricsAddress != "" {
+			metricsAddresses[c.Config.MetricsAddress] = iface
+		}
+		if other, ok := dnsAddresses[c.Config.DNSAddress]; ok {
+			return fmt.Errorf("interfaces %s and %s both answer DNS queries on %s", other, iface, c.Config.DNSAddress)
+		} else if c.Config.DNSAddress != "" {
+			dnsAddresses[c.Config.DNSAddress] = iface
+		}
+	}
+	if len(w.children) == 0 {
+		// config dump mode
+		return nil
+	}
+	// the service is only ready, and only making progress, if all the
+	// interfaces are
+	reporter := newReporter()
+	for _, c := range w.children {
+		c.Server.ReportProgress(reporter.Part(c.Config.Iface))
+	}
+	w.env = env
+	w.updateQuietLogLevel()
+	return nil
+}
+
+// closeChildren closes the servers of all the children, and then the shared
+// environment
+func (w *WirelinkCmd) closeChildren() {
+	for _, c := range w.children {
+		if c.Server != nil {
+			c.Server.Close()
+		} else if c.wgc != nil {
+			c.wgc.Close()
+		}
+	}
+	w.children = nil
+	if w.env != nil {
+		if err := w.env.Close(); err != nil {
+			log.Error("Unable to close network: %v", err)
+		}
+		w.env = nil
+	}
+}
+
+// each calls fn for every command that runs a server: the children if there
+// are any, else the command itself
+func (w *WirelinkCmd) each(fn func(*WirelinkCmd)) {
+	if w.children == nil {
+		fn(w)
+		return
+	}
+	for _, c := range w.children {
+		fn(c)
+	}
+}
+
+func (w *WirelinkCmd) updateQuietLogLevel() {
+	w.quietLogLevel = log.GetLevel()
+	if w.quietLogLevel == log.LevelDebug {
+		w.quietLogLevel = log.LevelInfo
+	}
+}
+
+// reloadConfig re-reads the configuration the same way Init did, and swaps it
+// into the running server
+func (w *WirelinkCmd) reloadConfig() error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	log.Info("Reloading configuration")
+	flags, vcfg := config.Init(w.args)
+	configData, err := config.Parse(flags, vcfg, w.args)
+	if err != nil {
+		return fmt.Errorf("unable to parse configuration: %w", err)
+	}
+	if configData == nil || configData.Dump {
+		// this shouldn't be possible, as the args haven't changed
+		return fmt.Errorf("configuration requests a non-server mode")
+	}
+	newConfig, err := configData.Parse(vcfg, w.wgc)
+	if err != nil {
+		return fmt.Errorf("unable to load configuration: %w", err)
+	}
+	if err = w.Server.ReloadConfig(newConfig); err != nil {
+		return err
+	}
+	w.Config = newConfig
+	w.updateQuietLogLevel()
+	return nil
+}
+
+// toggleDebug switches debug logging on or off at runtime
+func (w *WirelinkCmd) toggleDebug() {
+	if log.IsDebug() {
+		log.SetLevel(w.quietLogLevel)
+		log.Info("Debug logging disabled")
+	} else {
+		log.SetLevel(log.LevelDebug)
+		log.Info("Debug logging enabled")
+	}
+}
+
+// reloadAll reloads the config of every server, logging any failures
+func (w *WirelinkCmd) reloadAll() {
+	w.each((*WirelinkCmd).tryReload)
+	if w.children != nil {
+		w.updateQuietLogLevel()
+	}
+}
+
+// tryReload reloads the config, logging any failure
+func (w *WirelinkCmd) tryReload() {
+	if err := w.reloadConfig(); err != nil {
+		log.Error("Unable to reload config for interface %s, keeping the old one: %v", w.Config.Iface, err)
+	}
+}
+
+// Runnable returns whether Init prepared something for Run to do, as opposed
+// to handling the request itself, such as for --help or --dump
+func (w *WirelinkCmd) Runnable() bool {
+	return w.Server != nil || w.sub != nil || w.children != nil
+}
+
+// Run invokes the server, or the requested subcommand
+func (w *WirelinkCmd) Run() error {
+	if w.sub != nil {
+		return w.runSubcommand()
+	}
+	if w.children != nil {
+		return w.runChildren()
+	}
+
+	defer w.Server.Close()
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	w.signals = make(chan os.Signal, 5)
+	w.Server.AddHandler(w.handleSignals)
 
 	log.Info("Server running: %s", w.Server.Describe())
 
 	// server.Close is handled by defer above
 	return w.Server.Wait()
 }
+
+// runChildren runs the servers for all the children together, stopping them
+// all if any one of them fails
+func (w *WirelinkCmd) runChildren() error {
+	defer w.closeChildren()
+	for _, c := range w.children {
+		if err := c.start(); err != nil {
+			return err
+		}
+	}
+
+	eg, ctx := errgroup.WithContext(context.Background())
+	for _, c := range w.children {
+		eg.Go(func() error {
+			if err := c.Server.Wait(); err != nil {
+				return fmt.Errorf("server for interface %s failed: %w", c.Config.Iface, err)
+			}
+			return nil
+		})
+	}
+	// the context ends when any server fails, or when they have all stopped,
+	// so this always runs, and must be done before the children are closed
+	stopped := make(chan struct{})
+	context.AfterFunc(ctx, func() {
+		defer close(stopped)
+		w.each(func(c *WirelinkCmd) { c.Server.RequestStop() })
+	})
+
+	w.signals = make(chan os.Signal, 5)
+	signalsDone := make(chan struct{})
+	go func() {
+		defer close(signalsDone)
+		//nolint:errcheck // never fails
+		w.handleSignals(ctx)
+	}()
+
+	for _, c := range w.children {
+		log.Info("Server running: %s", c.Server.Describe())
+	}
+
+	err := eg.Wait()
+	<-signalsDone
+	<-stopped
+	return err
+}
+
+// start starts the server along with its control socket, metrics exporter,
+// and DNS responder
+func (w *WirelinkCmd) start() error {
+	err := w.Server.Start()
+	if err != nil {
+		return fmt.Errorf("unable to start server for interface %s: %w", w.Config.Iface, err)
+	}
+
+	if w.Config.ControlSocket != "" {
+		cs, err := control.Listen(w.Config.ControlSocket, w.Server.ControlHandler())
+		if err != nil {
+			// the control socket is a convenience, don't fail the whole server over it
+			log.Error("Unable to open control socket, continuing without it: %v", err)
+		} else {
+			w.Server.AddHandler(cs.Serve)
+		}
+	}
+
+	if w.Config.MetricsAddress != "" {
+		ms, err := metrics.Listen(w.Config.MetricsAddress, w.Server.Metrics())
+		if err != nil {
+			// like the control socket, metrics are not worth failing the server over
+			log.Error("Unable to export metrics, continuing without them: %v", err)
+		} else {
+			log.Info("Exporting metrics on http://%s%s", ms.Addr(), metrics.Path)
+			w.Server.AddHandler(ms.Serve)
+		}
+	}
+
+	if w.Config.DNSAddress != "" {
+		ds, err := dns.Listen(w.Config.DNSAddress, w.Server.DNSZone)
+		if err != nil {
+			log.Error("Unable to answer DNS queries, continuing without them: %v", err)
+		} else {
+			log.Info("Answering DNS queries for %s on %s", dns.Domain, ds.Addr())
+			w.Server.AddHandler(ds.Serve)
+		}
+	}
+
+	if w.Config.PeersDir != "" {
+		pw, err := config.WatchPeerDir(w.Config.PeersDir)
+		if err != nil {
+			// the peers already read from it still apply, they just won't update
+			log.Error("Unable to watch peer directory, changes will need a reload: %v", err)
+		} else {
+			w.Server.AddHandler(func(ctx context.Context) error {
+				return pw.Watch(ctx, func() {
+					log.Info("Peer directory %s changed", pw.Dir())
+					w.tryReload()
+				})
+			})
+		}
+	}
+
+	return nil
+}
+
+// handleSignals applies received signals to every server until the context
+// ends
+func (w *WirelinkCmd) handleSignals(ctx context.Context) error {
+	if !w.disableSignals {
+		w.addSignalHandlers()
+	}
+	for {
+		select {
+		case sig := <-w.signals:
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				log.Info("Received signal %v, stopping", sig)
+				// this will just initiate the shutdown, not block waiting for it
+				w.each(func(c *WirelinkCmd) { c.Server.RequestStop() })
+
+				// also give platform handler an opportunity to do things
+				w.handlePlatformSignal(sig)
+			} else if !w.handlePlatformSignal(sig) {
+				log.Error("Received unexpected signal %v, ignoring", sig)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
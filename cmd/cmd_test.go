@@ -9,6 +9,7 @@ import (
 	"github.com/fastcat/wirelink/internal/networking"
 	"github.com/fastcat/wirelink/internal/networking/host"
 	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/log"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -120,13 +121,36 @@ func TestWirelinkCmd_Init(t *testing.T) {
 				assert.Nil(t, w.Server)
 			},
 		},
+		{
+			"ctl subcommand",
+			fields{[]string{"ctl", "--iface", wgFake, "--json", "peers"}},
+			args{},
+			nil,
+			require.NoError,
+			func(t *testing.T, w *WirelinkCmd) {
+				assert.Nil(t, w.Config)
+				assert.Nil(t, w.Server)
+				assert.Nil(t, w.wgc)
+				assert.True(t, w.Runnable())
+				assert.Equal(t, "ctl", w.subName)
+				assert.Equal(t, []string{"peers"}, w.subCtx.flags.Args())
+			},
+		},
+		{
+			"ctl subcommand help",
+			fields{[]string{"ctl", "--help"}},
+			args{},
+			nil,
+			require.NoError,
+			func(t *testing.T, w *WirelinkCmd) {
+				assert.False(t, w.Runnable())
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			realArgs := append([]string{programName}, tt.fields.args...)
-			w := &WirelinkCmd{
-				args: realArgs,
-			}
+			w := New(realArgs)
 			defer func() {
 				if w.wgc != nil {
 					w.wgc.Close()
@@ -158,3 +182,15 @@ func TestWirelinkCmd_Init(t *testing.T) {
 		})
 	}
 }
+
+func TestWirelinkCmd_toggleDebug(t *testing.T) {
+	prevLevel := log.GetLevel()
+	defer log.SetLevel(prevLevel)
+
+	w := &WirelinkCmd{quietLogLevel: log.LevelError}
+	log.SetLevel(log.LevelError)
+	w.toggleDebug()
+	assert.True(t, log.IsDebug())
+	w.toggleDebug()
+	assert.Equal(t, log.LevelError, log.GetLevel())
+}
@@ -9,12 +9,18 @@ import (
 )
 
 func (w *WirelinkCmd) addSignalHandlers() {
-	signal.Notify(w.signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
+	signal.Notify(w.signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
 }
 
 func (w *WirelinkCmd) handlePlatformSignal(sig os.Signal) bool {
 	if sig == syscall.SIGUSR1 {
-		w.Server.RequestPrint(false)
+		w.each(func(c *WirelinkCmd) { c.Server.RequestPrint(false) })
+		return true
+	} else if sig == syscall.SIGUSR2 {
+		w.toggleDebug()
+		return true
+	} else if sig == syscall.SIGHUP {
+		w.reloadAll()
 		return true
 	}
 	return false
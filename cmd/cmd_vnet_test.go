@@ -91,30 +91,30 @@ func Test_Cmd_VNet1(t *testing.T) {
 		client2 := addClient(2)
 		defer client2.Close()
 
-		host1cmd := New([]string{"wirevlink", "--iface=wg0", "--router=true", "--debug"})
-		client1cmd := New([]string{"wirevlink", "--iface=wg1", "--router=false", "--debug"})
-		client2cmd := New([]string{"wirevlink", "--iface=wg1", "--router=false", "--debug"})
-		for _, c := range []*WirelinkCmd{host1cmd, client1cmd, client2cmd} {
-			c.disableSignals = true
-		}
-
-		require.NoError(t, host1cmd.Init(host1.Wrap()))
-		require.NoError(t, client1cmd.Init(client1.Wrap()))
-		require.NoError(t, client2cmd.Init(client2.Wrap()))
-
 		// use shortened timing for the tests
 		// in order for things to work properly, we need the chunk period, the fact ttl,
 		// and the expiration quantum to all be integer multiples with quantum < period < ttl
 		chunkPeriod := 3 * time.Second
 		factTTL := 3 * chunkPeriod
+		timing := []string{
+			"--fact-ttl=" + factTTL.String(),
+			"--long-fact-ttl=" + factTTL.String(),
+			"--chunk-period=" + chunkPeriod.String(),
+			// send alive packets aggressively so our connectivity assertions are simple
+			"--alive-period=" + (chunkPeriod / 2).String(),
+		}
 
+		host1cmd := New(append([]string{"wirevlink", "--iface=wg0", "--router=true", "--debug", "--control-socket="}, timing...))
+		client1cmd := New(append([]string{"wirevlink", "--iface=wg1", "--router=false", "--debug", "--control-socket="}, timing...))
+		client2cmd := New(append([]string{"wirevlink", "--iface=wg1", "--router=false", "--debug", "--control-socket="}, timing...))
 		for _, c := range []*WirelinkCmd{host1cmd, client1cmd, client2cmd} {
-			c.Server.FactTTL = factTTL
-			c.Server.ChunkPeriod = chunkPeriod
-			// send alive packets aggressively so our connectivity assertions are simple
-			c.Server.AlivePeriod = chunkPeriod / 2
+			c.disableSignals = true
 		}
 
+		require.NoError(t, host1cmd.Init(host1.Wrap()))
+		require.NoError(t, client1cmd.Init(client1.Wrap()))
+		require.NoError(t, client2cmd.Init(client2.Wrap()))
+
 		c1pub := client1.Interface("wg1").(*vnet.Tunnel).PublicKey()
 		c2pub := client2.Interface("wg1").(*vnet.Tunnel).PublicKey()
 		// hack in configs for peers
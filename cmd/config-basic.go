@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// configBasicCmd asks the running daemon for a wg-quick config for a basic
+// peer, such as a phone, that can't run wirelink itself
+type configBasicCmd struct {
+	privateKey string
+	qr         bool
+	output     string
+	force      bool
+}
+
+func newConfigBasicCmd() subcommand {
+	return &configBasicCmd{}
+}
+
+func (c *configBasicCmd) Usage() string {
+	return "[flags] <peer public key>"
+}
+
+func (c *configBasicCmd) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.privateKey, "private-key", "", "File with the basic peer's private key, to include in the config")
+	flags.BoolVar(&c.qr, "qr", false, "Print the config as a QR code for the terminal (requires --private-key)")
+	flags.StringVarP(&c.output, "output", "o", "-", "File to write the config to, - for stdout")
+	flags.BoolVar(&c.force, "force", false, "Overwrite the output file if it exists")
+}
+
+func (c *configBasicCmd) Run(ctx *subcommandContext) error {
+	if len(ctx.flags.Args()) != 1 {
+		return fmt.Errorf("expected exactly one peer public key, got %v", ctx.flags.Args())
+	}
+	peer, err := wgtypes.ParseKey(ctx.flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid peer key %q: %w", ctx.flags.Arg(0), err)
+	}
+	if c.qr && c.privateKey == "" {
+		return fmt.Errorf("a QR code can't be imported without the private key, use --private-key")
+	}
+	var privateKey string
+	if c.privateKey != "" {
+		content, err := os.ReadFile(c.privateKey)
+		if err != nil {
+			return err
+		}
+		key, err := wgtypes.ParseKey(strings.TrimSpace(string(content)))
+		if err != nil {
+			return fmt.Errorf("unable to parse private key from %s: %w", c.privateKey, err)
+		}
+		if key.PublicKey() != peer {
+			return fmt.Errorf("private key in %s is not for %s", c.privateKey, peer)
+		}
+		privateKey = key.String()
+	}
+
+	client, err := dialControl(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	q, err := client.Basic(peer.String())
+	if err != nil {
+		return err
+	}
+	q.Interface.PrivateKey = privateKey
+
+	var buf bytes.Buffer
+	if err = q.Write(&buf); err != nil {
+		return err
+	}
+	if c.qr {
+		var qrBuf bytes.Buffer
+		if err = writeQR(&qrBuf, buf.String()); err != nil {
+			return err
+		}
+		buf = qrBuf
+	}
+	return writeConfigFile(ctx.stdout, c.output, c.force, buf.Bytes())
+}
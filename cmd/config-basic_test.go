@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/control"
+	"github.com/fastcat/wirelink/internal/testutils"
+)
+
+func TestConfigBasicCmd(t *testing.T) {
+	t.Setenv("WIREVLINK_CONFIG_PATH", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ctl.sock")
+	priv, pub := testutils.MustKeyPair(t)
+	otherPriv, other := testutils.MustKeyPair(t)
+	cs, err := control.Listen(path, basicControlHandler{peer: pub.String()})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cs.Serve(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	keyFile := filepath.Join(dir, "phone.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(priv.String()+"\n"), 0o600))
+	otherKeyFile := filepath.Join(dir, "other.key")
+	require.NoError(t, os.WriteFile(otherKeyFile, []byte(otherPriv.String()+"\n"), 0o600))
+
+	tests := []struct {
+		name      string
+		args      []string
+		assertion require.ErrorAssertionFunc
+		contains  []string
+	}{
+		{"text", []string{pub.String()}, require.NoError, []string{"# PrivateKey = ", "Address = 10.0.0.2/32", "# Name = router", "PersistentKeepalive = 25"}},
+		{"with key", []string{"--private-key", keyFile, pub.String()}, require.NoError, []string{"PrivateKey = " + priv.String()}},
+		{"qr", []string{"--qr", "--private-key", keyFile, pub.String()}, require.NoError, []string{"█", "▀", "▄"}},
+		{"to file", []string{"-o", filepath.Join(dir, "phone.conf"), pub.String()}, require.NoError, []string{"Wrote " + filepath.Join(dir, "phone.conf")}},
+		{"qr without key", []string{"--qr", pub.String()}, require.Error, nil},
+		{"wrong key", []string{"--private-key", otherKeyFile, pub.String()}, require.Error, nil},
+		{"unknown peer", []string{other.String()}, require.Error, nil},
+		{"bad peer", []string{"phone"}, require.Error, nil},
+		{"no peer", nil, require.Error, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"wirevlink", "config", "basic", "--control-socket=" + path}, tt.args...)
+			w := New(args)
+			var out bytes.Buffer
+			w.stdout = &out
+			require.NoError(t, w.Init(nil))
+			require.True(t, w.Runnable())
+			tt.assertion(t, w.Run())
+			for _, c := range tt.contains {
+				assert.Contains(t, out.String(), c)
+			}
+		})
+	}
+}
+
+func TestWriteQR(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, writeQR(&out, "hello"))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	// version 1 codes are 21 modules, plus the quiet zone, two rows per line
+	width := 21 + 2*qrQuietZone
+	assert.Len(t, lines, (width+1)/2)
+	for _, line := range lines {
+		assert.Equal(t, width, len([]rune(line)))
+	}
+	assert.Equal(t, strings.Repeat("█", width), lines[0], "quiet zone should be light")
+}
+
+// basicControlHandler answers Basic requests for a real peer key, where
+// fakeControlHandler only knows a peer called "phone"
+type basicControlHandler struct {
+	fakeControlHandler
+	peer string
+}
+
+func (h basicControlHandler) Basic(peer string) (*config.WgQuick, error) {
+	if peer == h.peer {
+		peer = "phone"
+	}
+	return h.fakeControlHandler.Basic(peer)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"github.com/fastcat/wirelink/config"
+)
+
+// configExportCmd asks the running daemon for what it knows about the network,
+// and writes it out as a config, optionally merged into an existing one
+type configExportCmd struct {
+	merge  string
+	format string
+	output string
+	force  bool
+}
+
+func newConfigExportCmd() subcommand {
+	return &configExportCmd{}
+}
+
+func (c *configExportCmd) Usage() string {
+	return "[flags]"
+}
+
+func (c *configExportCmd) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.merge, "merge", "", "Existing config file to merge the known peers into")
+	flags.StringVar(&c.format, "format", "", "Output format: json or yaml (default from the merge or output file extension, else json)")
+	flags.StringVarP(&c.output, "output", "o", "-", "File or directory to write the config to, - for stdout")
+	flags.BoolVar(&c.force, "force", false, "Overwrite the output file if it exists")
+}
+
+func (c *configExportCmd) Run(ctx *subcommandContext) error {
+	if len(ctx.flags.Args()) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", ctx.flags.Args())
+	}
+	format := c.format
+	if format == "" {
+		if c.merge != "" {
+			format = config.FileFormatForPath(c.merge)
+		} else {
+			format = config.FileFormatForPath(c.output)
+		}
+	}
+	if format != config.FileFormatJSON && format != config.FileFormatYAML {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	var existing []byte
+	if c.merge != "" {
+		var err error
+		if existing, err = os.ReadFile(c.merge); err != nil {
+			return err
+		}
+	}
+
+	client, err := dialControl(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	data, err := client.Config()
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	if c.merge != "" {
+		if content, err = config.MergeFile(existing, format, data); err != nil {
+			return fmt.Errorf("unable to merge into %s: %w", c.merge, err)
+		}
+	} else {
+		var buf bytes.Buffer
+		if err = data.Write(&buf, format); err != nil {
+			return err
+		}
+		content = buf.Bytes()
+	}
+	output := configOutputPath(ctx, c.output, ctx.config.Iface, format)
+	return writeConfigFile(ctx.stdout, output, c.force, content)
+}
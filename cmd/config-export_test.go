@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/control"
+)
+
+func TestConfigExportCmd(t *testing.T) {
+	t.Setenv("WIREVLINK_CONFIG_PATH", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ctl.sock")
+	cs, err := control.Listen(path, fakeControlHandler{})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cs.Serve(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	existing := filepath.Join(dir, "existing.yaml")
+	require.NoError(t, os.WriteFile(existing, []byte("Chatty: true\nPeers:\n  - PublicKey: key\n    Trust: Membership\n"), 0o600))
+
+	tests := []struct {
+		name      string
+		args      []string
+		assertion require.ErrorAssertionFunc
+		contains  []string
+	}{
+		{"stdout", nil, require.NoError, []string{`"PublicKey": "key"`, `"Name": "peer1"`, `"192.0.2.1/32"`}},
+		{"yaml", []string{"--format=yaml"}, require.NoError, []string{"Name: peer1"}},
+		{"merge", []string{"--merge", existing}, require.NoError, []string{"Chatty: true", "Trust: Membership", "Name: peer1", "- 1.2.3.4:5"}},
+		{"to dir", []string{"-o", dir}, require.NoError, []string{"Wrote " + filepath.Join(dir, "wirevlink.wg0.json")}},
+		{"merge missing", []string{"--merge", filepath.Join(dir, "nope.json")}, require.Error, nil},
+		{"bad format", []string{"--format=toml"}, require.Error, nil},
+		{"extra args", []string{"extra"}, require.Error, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"wirevlink", "config", "export", "--control-socket=" + path}, tt.args...)
+			w := New(args)
+			var out bytes.Buffer
+			w.stdout = &out
+			require.NoError(t, w.Init(nil))
+			require.True(t, w.Runnable())
+			tt.assertion(t, w.Run())
+			for _, c := range tt.contains {
+				assert.Contains(t, out.String(), c)
+			}
+		})
+	}
+}
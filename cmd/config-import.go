@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/fastcat/wirelink/config"
+)
+
+// bundleFetchTimeout limits how long `config import` waits for a bundle URL
+const bundleFetchTimeout = 30 * time.Second
+
+// configImportCmd verifies a signed bundle of peers from `config sign`, and
+// merges them into the interface config
+type configImportCmd struct {
+	keys   []string
+	output string
+}
+
+func newConfigImportCmd() subcommand {
+	return &configImportCmd{}
+}
+
+func (c *configImportCmd) Usage() string {
+	return "[flags] <file|url>"
+}
+
+func (c *configImportCmd) AddFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&c.keys, "key", nil, "Public key trusted to sign the bundle, in addition to the configured bundle-keys")
+	flags.StringVarP(&c.output, "output", "o", "", "Config file to merge the peers into, - for stdout (default the interface config)")
+}
+
+func (c *configImportCmd) Run(ctx *subcommandContext) error {
+	if len(ctx.flags.Args()) != 1 {
+		return fmt.Errorf("expected exactly one bundle file or URL, got %v", ctx.flags.Args())
+	}
+	source := ctx.flags.Arg(0)
+
+	var trusted []ed25519.PublicKey
+	for _, k := range append(ctx.config.BundleKeys, c.keys...) {
+		key, err := config.ParseBundleKey(k)
+		if err != nil {
+			return err
+		}
+		trusted = append(trusted, key)
+	}
+	if len(trusted) == 0 {
+		return fmt.Errorf("no trusted keys, use --key or set %s in the config", config.BundleKeysFlag)
+	}
+
+	bundle, err := readBundleSource(source)
+	if err != nil {
+		return err
+	}
+	data, err := bundle.Verify(trusted)
+	if err != nil {
+		return fmt.Errorf("rejecting %s: %w", source, err)
+	}
+
+	output := c.output
+	if output == "" {
+		if output = ctx.vcfg.ConfigFileUsed(); output == "" {
+			output = filepath.Join(
+				ctx.vcfg.GetString(config.ConfigPathFlag),
+				configFileName(ctx, ctx.config.Iface, config.FileFormatJSON),
+			)
+		}
+	}
+	format := config.FileFormatForPath(output)
+	var existing []byte
+	if output != "-" {
+		if existing, err = os.ReadFile(output); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	content, err := config.MergeBundleFile(existing, format, data)
+	if err != nil {
+		return fmt.Errorf("unable to merge into %s: %w", output, err)
+	}
+	if output != "-" {
+		fmt.Fprintf(ctx.stdout, "Verified %d peers from %s, signed %s\n",
+			len(data.Peers), source, data.Created.Format(time.RFC3339))
+	}
+	// the point is to update the existing config, so always overwrite
+	return writeConfigFile(ctx.stdout, output, true, content)
+}
+
+func readBundleSource(source string) (*config.Bundle, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return config.ReadBundle(f)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bundleFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch %s: %s", source, resp.Status)
+	}
+	return config.ReadBundle(resp.Body)
+}
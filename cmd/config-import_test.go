@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/signing"
+)
+
+func TestConfigImportCmd(t *testing.T) {
+	dir := t.TempDir()
+	priv, pub := testutils.MustKeyPair(t)
+	otherPriv, _ := testutils.MustKeyPair(t)
+	key := config.FormatBundleKey(signing.New(priv).PublicSigningKey())
+	otherKey := config.FormatBundleKey(signing.New(otherPriv).PublicSigningKey())
+
+	bundle, err := config.SignBundle(&config.BundleData{Created: time.Now().UTC(), Peers: []config.PeerData{{
+		PublicKey:  pub.String(),
+		Name:       "router",
+		Trust:      "Membership",
+		AllowedIPs: []string{"10.0.0.0/24"},
+	}}}, signing.New(priv))
+	require.NoError(t, err)
+	content, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	bundleFile := filepath.Join(dir, "bundle.json")
+	require.NoError(t, os.WriteFile(bundleFile, content, 0o600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bundle.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		args      []string
+		env       map[string]string
+		existing  string
+		assertion require.ErrorAssertionFunc
+		contains  []string
+		file      []string
+	}{
+		{
+			"file to new config",
+			[]string{"--key", key, bundleFile},
+			nil,
+			"",
+			require.NoError,
+			[]string{"Verified 1 peers", "Wrote "},
+			[]string{`"Name": "router"`, `"Trust": "Membership"`},
+		},
+		{
+			"url with configured key",
+			[]string{srv.URL + "/bundle.json"},
+			map[string]string{"WIREVLINK_BUNDLE_KEYS": otherKey + "," + key},
+			`{"Chatty": true, "Peers": [{"PublicKey": "` + pub.String() + `", "Name": "mine", "Trust": "AllowedIPs"}]}`,
+			require.NoError,
+			[]string{"Verified 1 peers"},
+			// the bundle's trust replaces the existing one
+			[]string{`"Chatty": true`, `"Name": "mine"`, `"Trust": "Membership"`, `"10.0.0.0/24"`},
+		},
+		{
+			"stdout",
+			[]string{"--key", key, "-o", "-", bundleFile},
+			nil,
+			"",
+			require.NoError,
+			[]string{`"Name": "router"`},
+			nil,
+		},
+		{
+			"replayed",
+			[]string{"--key", key, bundleFile},
+			nil,
+			`{"bundle-created": "2999-01-01T00:00:00Z"}`,
+			require.Error,
+			nil,
+			[]string{`"bundle-created": "2999-01-01T00:00:00Z"`},
+		},
+		{"untrusted", []string{"--key", otherKey, bundleFile}, nil, "", require.Error, nil, nil},
+		{"no keys", []string{bundleFile}, nil, "", require.Error, nil, nil},
+		{"bad key", []string{"--key", "nope", bundleFile}, nil, "", require.Error, nil, nil},
+		{"not found", []string{"--key", key, srv.URL + "/nope"}, nil, "", require.Error, nil, nil},
+		{"missing file", []string{"--key", key, filepath.Join(dir, "nope.json")}, nil, "", require.Error, nil, nil},
+		{"no args", []string{"--key", key}, nil, "", require.Error, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir := t.TempDir()
+			t.Setenv("WIREVLINK_CONFIG_PATH", configDir)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			configFile := filepath.Join(configDir, "wirevlink.wg0.json")
+			if tt.existing != "" {
+				require.NoError(t, os.WriteFile(configFile, []byte(tt.existing), 0o600))
+			}
+
+			args := append([]string{"wirevlink", "config", "import"}, tt.args...)
+			w := New(args)
+			var out bytes.Buffer
+			w.stdout = &out
+			require.NoError(t, w.Init(nil))
+			require.True(t, w.Runnable())
+			tt.assertion(t, w.Run())
+			for _, c := range tt.contains {
+				assert.Contains(t, out.String(), c)
+			}
+			if tt.file != nil {
+				data, err := os.ReadFile(configFile)
+				require.NoError(t, err)
+				for _, c := range tt.file {
+					assert.Contains(t, string(data), c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// configInitCmd interactively builds a minimal config for a leaf node, which
+// trusts a single router
+type configInitCmd struct {
+	format string
+	force  bool
+}
+
+func newConfigInitCmd() subcommand {
+	return &configInitCmd{}
+}
+
+func (c *configInitCmd) Usage() string {
+	return "[flags]"
+}
+
+func (c *configInitCmd) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.format, "format", config.FileFormatJSON, "Config file format: json or yaml")
+	flags.BoolVar(&c.force, "force", false, "Overwrite the config file if it exists")
+}
+
+func (c *configInitCmd) Run(ctx *subcommandContext) error {
+	if len(ctx.flags.Args()) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", ctx.flags.Args())
+	}
+	if c.format != config.FileFormatJSON && c.format != config.FileFormatYAML {
+		return fmt.Errorf("unknown format %q", c.format)
+	}
+	p := &prompter{in: bufio.NewScanner(ctx.stdin), out: ctx.stdout}
+
+	iface, err := p.ask("Wireguard interface", ctx.config.Iface, validateIface)
+	if err != nil {
+		return err
+	}
+	output := filepath.Join(ctx.vcfg.GetString(config.ConfigPathFlag), configFileName(ctx, iface, c.format))
+	// check this now instead of making the user answer everything first
+	if _, err := os.Stat(output); err == nil && !c.force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", output)
+	}
+
+	var router config.PeerData
+	if router.PublicKey, err = p.ask("Router public key", "", func(s string) error {
+		_, err := wgtypes.ParseKey(s)
+		return err
+	}); err != nil {
+		return err
+	}
+	endpoint, err := p.ask("Router endpoint (host:port)", "", func(s string) error {
+		_, err := config.ParseEndpoint(s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	router.Endpoints = []string{endpoint}
+	if router.Name, err = p.ask("Router name", "router", nil); err != nil {
+		return err
+	}
+	if router.Trust, err = p.ask("Router trust level", trust.Membership.String(), func(s string) error {
+		if _, err := config.ParseTrust(s); err != nil {
+			return fmt.Errorf("%w, must be one of %s", err, strings.Join(trustNames(), ", "))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	chatty, err := p.askYesNo("Is this node chatty (sends all its facts to every peer)", false)
+	if err != nil {
+		return err
+	}
+
+	// the prompts validated each piece, but check the whole thing the same way
+	// the server will
+	if _, _, err = router.Parse(); err != nil {
+		return err
+	}
+	data := &config.FileData{Chatty: chatty, Peers: []config.PeerData{router}}
+	var buf bytes.Buffer
+	if err = data.Write(&buf, c.format); err != nil {
+		return err
+	}
+	return writeConfigFile(ctx.stdout, output, c.force, buf.Bytes())
+}
+
+func validateIface(s string) error {
+	if s == "" || strings.ContainsAny(s, "/ \t") {
+		return fmt.Errorf("invalid interface name %q", s)
+	}
+	return nil
+}
+
+func trustNames() []string {
+	names := make([]string, 0, len(trust.Names))
+	for l := trust.Untrusted; l <= trust.DelegateTrust; l++ {
+		names = append(names, l.String())
+	}
+	return names
+}
+
+// prompter asks questions on the terminal
+type prompter struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// ask prompts until validate (if not nil) accepts the answer. An empty answer
+// is replaced with the default.
+func (p *prompter) ask(question, def string, validate func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+		if !p.in.Scan() {
+			if err := p.in.Err(); err != nil {
+				return "", err
+			}
+			return "", errors.New("input ended before the config was complete")
+		}
+		answer := strings.TrimSpace(p.in.Text())
+		if answer == "" {
+			answer = def
+		}
+		if validate == nil {
+			return answer, nil
+		}
+		if err := validate(answer); err != nil {
+			fmt.Fprintf(p.out, "  %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+func (p *prompter) askYesNo(question string, def bool) (bool, error) {
+	defString := "n"
+	if def {
+		defString = "y"
+	}
+	yes := []string{"y", "yes"}
+	no := []string{"n", "no"}
+	answer, err := p.ask(question+" (y/n)", defString, func(s string) error {
+		s = strings.ToLower(s)
+		if !slices.Contains(yes, s) && !slices.Contains(no, s) {
+			return errors.New("please answer y or n")
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(yes, strings.ToLower(answer)), nil
+}
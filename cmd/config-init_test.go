@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/internal/testutils"
+)
+
+func TestConfigInitCmd(t *testing.T) {
+	key := testutils.MustKey(t)
+
+	tests := []struct {
+		name      string
+		args      []string
+		input     []string
+		existing  bool
+		assertion require.ErrorAssertionFunc
+		want      *config.ServerData
+		contains  []string
+	}{
+		{
+			"defaults",
+			nil,
+			[]string{"", key.String(), "vpn.example.com:51820", "", "", ""},
+			false,
+			require.NoError,
+			&config.ServerData{Iface: "wg0", Peers: []config.PeerData{{
+				PublicKey: key.String(),
+				Name:      "router",
+				Trust:     "Membership",
+				Endpoints: []string{"vpn.example.com:51820"},
+			}}},
+			[]string{"Wrote "},
+		},
+		{
+			"retries",
+			[]string{"--format=yaml"},
+			[]string{
+				"wg 7", "wg7",
+				"bogus", key.String(),
+				"no-port", "192.0.2.1:51820",
+				"gateway",
+				"Trusty", "AllowedIPs",
+				"maybe", "yes",
+			},
+			false,
+			require.NoError,
+			&config.ServerData{Iface: "wg7", Chatty: true, Peers: []config.PeerData{{
+				PublicKey: key.String(),
+				Name:      "gateway",
+				Trust:     "AllowedIPs",
+				Endpoints: []string{"192.0.2.1:51820"},
+			}}},
+			[]string{"invalid interface name", "invalid trust level 'Trusty', must be one of Untrusted, ", "please answer y or n"},
+		},
+		{"exists", nil, []string{""}, true, require.Error, nil, nil},
+		{"overwrite", []string{"--force"}, []string{"", key.String(), "192.0.2.1:1", "", "", ""}, true, require.NoError, &config.ServerData{
+			Iface: "wg0",
+			Peers: []config.PeerData{{PublicKey: key.String(), Name: "router", Trust: "Membership", Endpoints: []string{"192.0.2.1:1"}}},
+		}, nil},
+		{"eof", nil, []string{"", key.String()}, false, require.Error, nil, nil},
+		{"bad format", []string{"--format=toml"}, nil, false, require.Error, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("WIREVLINK_CONFIG_PATH", dir)
+			if tt.existing {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "wirevlink.wg0.json"), []byte("{}"), 0o600))
+			}
+
+			w := New(append([]string{"wirevlink", "config", "init"}, tt.args...))
+			var out bytes.Buffer
+			w.stdin = strings.NewReader(strings.Join(tt.input, "\n") + "\n")
+			w.stdout = &out
+			require.NoError(t, w.Init(nil))
+			require.True(t, w.Runnable())
+			tt.assertion(t, w.Run())
+			for _, c := range tt.contains {
+				assert.Contains(t, out.String(), c)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			// the written config should be read back by the normal config loading
+			flags, vcfg := config.Init([]string{"wirevlink", "--iface=" + tt.want.Iface})
+			got, err := config.Parse(flags, vcfg, []string{"wirevlink", "--iface=" + tt.want.Iface})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.Chatty, got.Chatty)
+			assert.Equal(t, tt.want.Peers, got.Peers)
+		})
+	}
+}
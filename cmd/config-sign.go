@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/signing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// configSignCmd makes a signed bundle of peers, which leaves can verify and
+// import with `config import`
+type configSignCmd struct {
+	from       string
+	privateKey string
+	showKey    bool
+	output     string
+	force      bool
+}
+
+func newConfigSignCmd() subcommand {
+	return &configSignCmd{}
+}
+
+func (c *configSignCmd) Usage() string {
+	return "[flags]"
+}
+
+func (c *configSignCmd) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.from, "from", "", "Sign the peers in this config file instead of those known to the daemon")
+	flags.StringVar(&c.privateKey, "private-key", "", "File with the wireguard private key to sign with (default from the device)")
+	flags.BoolVar(&c.showKey, "show-key", false, "Print the public key to configure as a bundle key, instead of signing")
+	flags.StringVarP(&c.output, "output", "o", "-", "File to write the bundle to, - for stdout")
+	flags.BoolVar(&c.force, "force", false, "Overwrite the output file if it exists")
+}
+
+func (c *configSignCmd) Run(ctx *subcommandContext) error {
+	if len(ctx.flags.Args()) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", ctx.flags.Args())
+	}
+	signer, err := c.signer(ctx)
+	if err != nil {
+		return err
+	}
+	if c.showKey {
+		_, err = fmt.Fprintln(ctx.stdout, config.FormatBundleKey(signer.PublicSigningKey()))
+		return err
+	}
+
+	var data *config.FileData
+	if c.from != "" {
+		data, err = config.LoadFile(c.from)
+	} else {
+		data, err = c.readDaemon(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	// don't sign anything a leaf would reject
+	for _, p := range data.Peers {
+		if _, _, err = p.Parse(); err != nil {
+			return fmt.Errorf("invalid peer %q: %w", p.PublicKey, err)
+		}
+	}
+
+	bundle, err := config.SignBundle(&config.BundleData{
+		Created: time.Now().UTC(),
+		Peers:   data.Peers,
+	}, signer)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+	return writeConfigFile(ctx.stdout, c.output, c.force, content)
+}
+
+func (c *configSignCmd) signer(ctx *subcommandContext) (*signing.Signer, error) {
+	if c.privateKey != "" {
+		content, err := os.ReadFile(c.privateKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := wgtypes.ParseKey(strings.TrimSpace(string(content)))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse private key from %s: %w", c.privateKey, err)
+		}
+		return signing.New(key), nil
+	}
+
+	wgc, err := ctx.env.NewWgClient()
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize wgctrl: %w", err)
+	}
+	defer wgc.Close()
+	dev, err := wgc.Device(ctx.config.Iface)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read device %s: %w", ctx.config.Iface, err)
+	}
+	return signing.New(dev.PrivateKey), nil
+}
+
+func (c *configSignCmd) readDaemon(ctx *subcommandContext) (*config.FileData, error) {
+	client, err := dialControl(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return client.Config()
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/control"
+	"github.com/fastcat/wirelink/internal/mocks"
+	netmocks "github.com/fastcat/wirelink/internal/networking/mocks"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/signing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestConfigSignCmd(t *testing.T) {
+	t.Setenv("WIREVLINK_CONFIG_PATH", t.TempDir())
+	dir := t.TempDir()
+	priv, pub := testutils.MustKeyPair(t)
+	signer := signing.New(priv)
+	keyFile := filepath.Join(dir, "private.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(priv.String()+"\n"), 0o600))
+	peersFile := filepath.Join(dir, "peers.yaml")
+	require.NoError(t, os.WriteFile(peersFile, []byte("Peers:\n  - PublicKey: "+pub.String()+"\n    Name: router\n"), 0o600))
+	badPeersFile := filepath.Join(dir, "bad.yaml")
+	require.NoError(t, os.WriteFile(badPeersFile, []byte("Peers:\n  - PublicKey: nope\n"), 0o600))
+
+	socket := filepath.Join(dir, "ctl.sock")
+	cs, err := control.Listen(socket, fakeControlHandler{})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cs.Serve(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	tests := []struct {
+		name      string
+		args      []string
+		device    bool
+		assertion require.ErrorAssertionFunc
+		check     func(t *testing.T, out []byte)
+	}{
+		{
+			"show key",
+			[]string{"--private-key", keyFile, "--show-key"},
+			false,
+			require.NoError,
+			func(t *testing.T, out []byte) {
+				assert.Equal(t, config.FormatBundleKey(signer.PublicSigningKey())+"\n", string(out))
+			},
+		},
+		{
+			"show key from device",
+			[]string{"--show-key"},
+			true,
+			require.NoError,
+			func(t *testing.T, out []byte) {
+				assert.Equal(t, config.FormatBundleKey(signer.PublicSigningKey())+"\n", string(out))
+			},
+		},
+		{
+			"sign file",
+			[]string{"--private-key", keyFile, "--from", peersFile},
+			false,
+			require.NoError,
+			func(t *testing.T, out []byte) {
+				b, err := config.ReadBundle(bytes.NewReader(out))
+				require.NoError(t, err)
+				data, err := b.Verify([]ed25519.PublicKey{signer.PublicSigningKey()})
+				require.NoError(t, err)
+				assert.Equal(t, []config.PeerData{{PublicKey: pub.String(), Name: "router"}}, data.Peers)
+			},
+		},
+		{"invalid peer", []string{"--private-key", keyFile, "--from", badPeersFile}, false, require.Error, nil},
+		{"invalid daemon peer", []string{"--private-key", keyFile, "--control-socket=" + socket}, false, require.Error, nil},
+		{"missing key file", []string{"--private-key", filepath.Join(dir, "nope"), "--show-key"}, false, require.Error, nil},
+		{"bad key file", []string{"--private-key", peersFile, "--show-key"}, false, require.Error, nil},
+		{"extra args", []string{"extra"}, false, require.Error, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &netmocks.Environment{}
+			env.Test(t)
+			if tt.device {
+				wgc := &mocks.WgClient{}
+				wgc.Test(t)
+				wgc.On("Device", "wg0").Return(&wgtypes.Device{PrivateKey: priv}, nil)
+				wgc.On("Close").Return(nil)
+				env.On("NewWgClient").Return(wgc, nil)
+				defer wgc.AssertExpectations(t)
+			}
+
+			args := append([]string{"wirevlink", "config", "sign"}, tt.args...)
+			w := New(args)
+			var out bytes.Buffer
+			w.stdout = &out
+			require.NoError(t, w.Init(env))
+			require.True(t, w.Runnable())
+			tt.assertion(t, w.Run())
+			if tt.check != nil {
+				tt.check(t, out.Bytes())
+			}
+			env.AssertExpectations(t)
+		})
+	}
+}
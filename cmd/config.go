@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/fastcat/wirelink/config"
+)
+
+// configGenerateCmd writes a wirelink config listing the peers of an existing
+// wireguard setup, either the live device or a wg-quick config file
+type configGenerateCmd struct {
+	from   string
+	format string
+	output string
+	force  bool
+}
+
+func newConfigGenerateCmd() subcommand {
+	return &configGenerateCmd{}
+}
+
+func (c *configGenerateCmd) Usage() string {
+	return "[flags]"
+}
+
+func (c *configGenerateCmd) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.from, "from", "", "Read peers from this wg-quick config instead of the live device")
+	flags.StringVar(&c.format, "format", "", "Output format: json or yaml (default from the output extension, else json)")
+	flags.StringVarP(&c.output, "output", "o", "-", "File or directory to write the config to, - for stdout")
+	flags.BoolVar(&c.force, "force", false, "Overwrite the output file if it exists")
+}
+
+func (c *configGenerateCmd) Run(ctx *subcommandContext) error {
+	if len(ctx.flags.Args()) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", ctx.flags.Args())
+	}
+	format := c.format
+	if format == "" {
+		format = config.FileFormatForPath(c.output)
+	}
+	if format != config.FileFormatJSON && format != config.FileFormatYAML {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	var data *config.FileData
+	var err error
+	if c.from != "" {
+		data, err = c.readWgQuick()
+	} else {
+		data, err = c.readDevice(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = data.Write(&buf, format); err != nil {
+		return err
+	}
+	output := configOutputPath(ctx, c.output, c.iface(ctx), format)
+	return writeConfigFile(ctx.stdout, output, c.force, buf.Bytes())
+}
+
+// iface picks the interface name for the generated config file. wg-quick
+// names the interface after the config file, so use that unless it was given
+// explicitly.
+func (c *configGenerateCmd) iface(ctx *subcommandContext) string {
+	if c.from != "" && !ctx.flags.Changed(config.IfaceFlag) {
+		return strings.TrimSuffix(filepath.Base(c.from), filepath.Ext(c.from))
+	}
+	return ctx.config.Iface
+}
+
+// configOutputPath resolves an output path that names a directory to the
+// config file for the interface inside it
+func configOutputPath(ctx *subcommandContext, output, iface, format string) string {
+	if output == "-" {
+		return output
+	}
+	if st, err := os.Stat(output); err == nil && st.IsDir() {
+		return filepath.Join(output, configFileName(ctx, iface, format))
+	}
+	return output
+}
+
+// configFileName gives the name under which wirelink looks for the config file
+// for the interface
+func configFileName(ctx *subcommandContext, iface, format string) string {
+	return config.FileBaseName(ctx.args, iface) + "." + format
+}
+
+func (c *configGenerateCmd) readWgQuick() (*config.FileData, error) {
+	f, err := os.Open(c.from)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	q, err := config.ReadWgQuick(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", c.from, err)
+	}
+	return config.GenerateFromWgQuick(q)
+}
+
+func (c *configGenerateCmd) readDevice(ctx *subcommandContext) (*config.FileData, error) {
+	wgc, err := ctx.env.NewWgClient()
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize wgctrl: %w", err)
+	}
+	defer wgc.Close()
+	dev, err := wgc.Device(ctx.config.Iface)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read device %s: %w", ctx.config.Iface, err)
+	}
+	return config.GenerateFromDevice(dev), nil
+}
+
+// writeConfigFile writes the config content to the output path, or to stdout
+// if it is "-". Existing files are only replaced if force is set.
+func writeConfigFile(stdout io.Writer, output string, force bool, content []byte) error {
+	if output == "-" {
+		_, err := stdout.Write(content)
+		return err
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flag |= os.O_EXCL
+	}
+	// configs may hold trust settings, don't let just anyone rewrite them
+	f, err := os.OpenFile(output, flag, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", output)
+	} else if err != nil {
+		return err
+	}
+	if _, err = f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Wrote %s\n", filepath.Clean(output))
+	return nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/internal/mocks"
+	netmocks "github.com/fastcat/wirelink/internal/networking/mocks"
+	"github.com/fastcat/wirelink/internal/testutils"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestConfigGenerateCmd(t *testing.T) {
+	t.Setenv("WIREVLINK_CONFIG_PATH", t.TempDir())
+	routerKey := testutils.MustKey(t)
+	dir := t.TempDir()
+	wgQuick := filepath.Join(dir, "wg1.conf")
+	require.NoError(t, os.WriteFile(wgQuick, []byte(`[Interface]
+PrivateKey = privkey
+
+[Peer]
+# Name = router
+PublicKey = `+routerKey.String()+`
+Endpoint = vpn.example.com:51820
+AllowedIPs = 10.0.0.0/24
+`), 0o600))
+
+	tests := []struct {
+		name      string
+		args      []string
+		device    *wgtypes.Device
+		assertion require.ErrorAssertionFunc
+		contains  []string
+		file      string
+	}{
+		{
+			"from device",
+			nil,
+			&wgtypes.Device{Peers: []wgtypes.Peer{{
+				PublicKey:  routerKey,
+				AllowedIPs: []net.IPNet{{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(24, 32)}},
+			}}},
+			require.NoError,
+			[]string{`"PublicKey": "` + routerKey.String() + `"`, `"Trust": "Membership"`},
+			"",
+		},
+		{
+			"from wg-quick",
+			[]string{"--from", wgQuick, "--format=yaml"},
+			nil,
+			require.NoError,
+			[]string{"Name: router", "- vpn.example.com:51820"},
+			"",
+		},
+		{
+			"to dir",
+			[]string{"--from", wgQuick, "-o", dir},
+			nil,
+			require.NoError,
+			[]string{"Wrote " + filepath.Join(dir, "wirevlink.wg1.json")},
+			filepath.Join(dir, "wirevlink.wg1.json"),
+		},
+		{"no overwrite", []string{"--from", wgQuick, "-o", wgQuick}, nil, require.Error, nil, ""},
+		{"bad format", []string{"--format=toml"}, nil, require.Error, nil, ""},
+		{"missing file", []string{"--from", filepath.Join(dir, "nope.conf")}, nil, require.Error, nil, ""},
+		{"extra args", []string{"extra"}, nil, require.Error, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &netmocks.Environment{}
+			env.Test(t)
+			if tt.device != nil {
+				wgc := &mocks.WgClient{}
+				wgc.Test(t)
+				wgc.On("Device", "wg0").Return(tt.device, nil)
+				wgc.On("Close").Return(nil)
+				env.On("NewWgClient").Return(wgc, nil)
+				defer wgc.AssertExpectations(t)
+			}
+
+			args := append([]string{"wirevlink", "config", "generate"}, tt.args...)
+			w := New(args)
+			var out bytes.Buffer
+			w.stdout = &out
+			require.NoError(t, w.Init(env))
+			require.True(t, w.Runnable())
+			tt.assertion(t, w.Run())
+			for _, c := range tt.contains {
+				assert.Contains(t, out.String(), c)
+			}
+			if tt.file != "" {
+				data, err := os.ReadFile(tt.file)
+				require.NoError(t, err)
+				assert.Contains(t, string(data), `"Name": "router"`)
+			}
+			env.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/control"
+	"github.com/fastcat/wirelink/events"
+)
+
+// ctlCmd queries a running daemon over its control socket
+type ctlCmd struct {
+	json bool
+}
+
+func newCtlCmd() subcommand {
+	return &ctlCmd{}
+}
+
+func (c *ctlCmd) Usage() string {
+	names := make([]string, len(control.Commands))
+	for i, cmd := range control.Commands {
+		names[i] = string(cmd)
+	}
+	types := make([]string, len(events.Types))
+	for i, t := range events.Types {
+		types[i] = string(t)
+	}
+	return fmt.Sprintf(
+		"[flags] [%s]\n\nlog accepts optional changes: [level] [subsystem=on|off ...]\nevents accepts optional types to show: %s\nbasic requires the public key of the basic peer",
+		strings.Join(names, "|"),
+		strings.Join(types, " "),
+	)
+}
+
+func (c *ctlCmd) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&c.json, "json", false, "Print the raw response as JSON")
+}
+
+func (c *ctlCmd) Run(ctx *subcommandContext) error {
+	args := ctx.flags.Args()
+	req := &control.Request{Command: control.CommandStatus}
+	if len(args) > 0 {
+		req.Command = control.Command(args[0])
+		if !slices.Contains(control.Commands, req.Command) {
+			return fmt.Errorf("unrecognized query %q", args[0])
+		}
+		args = args[1:]
+	}
+	switch {
+	case req.Command == control.CommandLog:
+		var err error
+		if req.Log, err = parseLogChanges(args); err != nil {
+			return err
+		}
+	case req.Command == control.CommandEvents:
+		for _, arg := range args {
+			t := events.Type(arg)
+			if !slices.Contains(events.Types, t) {
+				return fmt.Errorf("unrecognized event type %q", arg)
+			}
+			req.Events = append(req.Events, t)
+		}
+	case req.Command == control.CommandBasic:
+		if len(args) != 1 {
+			return fmt.Errorf("basic requires exactly one peer key, got %v", args)
+		}
+		req.Peer = args[0]
+	case len(args) > 0:
+		return fmt.Errorf("unexpected arguments for %s: %v", req.Command, args)
+	}
+
+	client, err := dialControl(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if req.Command == control.CommandEvents {
+		return client.Events(req.Events, func(e *events.Event) error {
+			return c.printEvent(ctx.stdout, e)
+		})
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		enc := json.NewEncoder(ctx.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+	return printCtlResponse(ctx.stdout, req.Command, resp, time.Now())
+}
+
+// printEvent prints a single event from the events stream, either as a line of
+// JSON or as a one-line summary
+func (c *ctlCmd) printEvent(out io.Writer, e *events.Event) error {
+	if c.json {
+		return json.NewEncoder(out).Encode(e)
+	}
+	_, err := fmt.Fprintf(out, "%s %-12s %s\n", e.Time.Format(time.StampMilli), e.Type, e.Message)
+	return err
+}
+
+// parseLogChanges parses arguments for the log query: a level name, and/or
+// subsystem settings of the form `name=on` or `name=off`
+func parseLogChanges(args []string) (*control.LogSettings, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	ret := &control.LogSettings{}
+	for _, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			var enabled bool
+			switch value {
+			case "on":
+				enabled = true
+			case "off":
+				enabled = false
+			default:
+				return nil, fmt.Errorf("subsystem setting must be on or off: %q", arg)
+			}
+			if ret.Subsystems == nil {
+				ret.Subsystems = make(map[string]bool)
+			}
+			ret.Subsystems[name] = enabled
+		} else if ret.Level == "" {
+			ret.Level = arg
+		} else {
+			return nil, fmt.Errorf("multiple log levels given: %s, %s", ret.Level, arg)
+		}
+	}
+	return ret, nil
+}
+
+// dialControl connects to the control socket of the daemon for the configured
+// interface
+func dialControl(ctx *subcommandContext) (*control.Client, error) {
+	path := config.DefaultControlSocket(ctx.config.Iface)
+	if ctx.config.ControlSocket != nil {
+		path = *ctx.config.ControlSocket
+	}
+	if path == "" {
+		return nil, fmt.Errorf("control socket is disabled")
+	}
+	return control.Dial(path)
+}
+
+func printCtlResponse(out io.Writer, command control.Command, resp *control.Response, now time.Time) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	switch command {
+	case control.CommandStatus:
+		s := resp.Status
+		fmt.Fprintf(tw, "%s\n", s.Description)
+		fmt.Fprintf(tw, "public key:\t%s\n", s.PublicKey)
+		fmt.Fprintf(tw, "listening:\t[%s]:%d\n", s.Address, s.Port)
+		fmt.Fprintf(tw, "boot id:\t%s\n", s.BootID)
+	case control.CommandFacts:
+		fmt.Fprintln(tw, "ATTRIBUTE\tSUBJECT\tVALUE\tTTL")
+		for _, f := range resp.Facts {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.3f\n",
+				f.AttributeName,
+				orDefault(f.SubjectName, f.Subject),
+				f.Value,
+				f.Expires.Sub(now).Seconds(),
+			)
+		}
+	case control.CommandPeers:
+		fmt.Fprintln(tw, "PEER\tNAME\tCONFIGURED\tBASIC\tSTATE")
+		for _, p := range resp.Peers {
+			fmt.Fprintf(tw, "%s\t%s\t%v\t%v\t%s\n",
+				p.PublicKey,
+				orDefault(p.Name, "-"),
+				p.Configured,
+				p.Basic,
+				p.State,
+			)
+		}
+	case control.CommandTrust:
+		fmt.Fprintln(tw, "PEER\tNAME\tCONFIGURED\tROUTER\tLEVEL\tACCEPTS")
+		for _, t := range resp.Trust {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%s\t%s\n",
+				t.PublicKey,
+				orDefault(t.Name, "-"),
+				orDefault(t.Configured, "-"),
+				t.Router,
+				orDefault(t.Level, "-"),
+				orDefault(strings.Join(t.Accepts, ","), "-"),
+			)
+		}
+	case control.CommandLog:
+		fmt.Fprintf(tw, "level:\t%s\n", resp.Log.Level)
+		for _, name := range slices.Sorted(maps.Keys(resp.Log.Subsystems)) {
+			state := "off"
+			if resp.Log.Subsystems[name] {
+				state = "on"
+			}
+			fmt.Fprintf(tw, "%s debug:\t%s\n", name, state)
+		}
+	case control.CommandDevice:
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		return printDevice(out, resp.Device, now)
+	case control.CommandConfig:
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		return resp.Config.Write(out, config.FileFormatJSON)
+	case control.CommandBasic:
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		return resp.Basic.Write(out)
+	}
+	return tw.Flush()
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/control"
+	"github.com/fastcat/wirelink/events"
+)
+
+type fakeControlHandler struct{}
+
+func (fakeControlHandler) Status() (*control.Status, error) {
+	return &control.Status{Description: "fake server", PublicKey: "key", Address: "fe80::1", Port: 1}, nil
+}
+
+func (fakeControlHandler) Facts() ([]control.Fact, error) {
+	return []control.Fact{{
+		AttributeName: "EndpointV4",
+		Subject:       "key",
+		SubjectName:   "peer1",
+		Value:         "1.2.3.4:5",
+		Expires:       time.Now().Add(time.Minute),
+	}}, nil
+}
+
+func (fakeControlHandler) Peers() ([]control.Peer, error) {
+	return []control.Peer{{PublicKey: "key", Name: "peer1", State: "healthy and alive"}}, nil
+}
+
+func (fakeControlHandler) Trust() ([]control.TrustEvaluation, error) {
+	return []control.TrustEvaluation{{PublicKey: "key", Level: "Endpoint", Accepts: []string{"EndpointV4", "EndpointV6"}}}, nil
+}
+
+func (fakeControlHandler) Device() (*control.Device, error) {
+	return &control.Device{
+		Name:       "wg0",
+		PublicKey:  "devkey",
+		ListenPort: 51820,
+		Peers: []control.DevicePeer{{
+			PublicKey: "key",
+			Name:      "peer1",
+			State:     "healthy and alive",
+			AllowedIPs: []control.AllowedIP{
+				{CIDR: "192.0.2.1/32", Sources: []string{control.AllowedIPSourceFact}},
+			},
+		}},
+	}, nil
+}
+
+func (fakeControlHandler) Log(change *control.LogSettings) (*control.LogSettings, error) {
+	if change != nil {
+		return change, nil
+	}
+	return &control.LogSettings{Level: "info", Subsystems: map[string]bool{"trust": false}}, nil
+}
+
+func (fakeControlHandler) Config() (*config.FileData, error) {
+	return &config.FileData{Peers: []config.PeerData{{
+		PublicKey:  "key",
+		Name:       "peer1",
+		Endpoints:  []string{"1.2.3.4:5"},
+		AllowedIPs: []string{"192.0.2.1/32"},
+	}}}, nil
+}
+
+func (fakeControlHandler) Basic(peer string) (*config.WgQuick, error) {
+	if peer != "phone" {
+		return nil, fmt.Errorf("%s is not a known basic peer", peer)
+	}
+	return &config.WgQuick{
+		Interface: config.WgQuickInterface{Address: []string{"10.0.0.2/32"}},
+		Peers: []config.WgQuickPeer{{
+			Name:                "router",
+			PublicKey:           "routerkey",
+			Endpoint:            "192.0.2.1:51820",
+			AllowedIPs:          []string{"10.0.0.0/24"},
+			PersistentKeepalive: 25,
+		}},
+	}, nil
+}
+
+// Events sends a single event and then ends the stream
+func (fakeControlHandler) Events() (*events.Subscription, error) {
+	var bus events.Bus
+	sub := bus.Subscribe(1)
+	bus.Publish(events.Event{
+		Type:     events.TypePeerAdded,
+		Peer:     "key",
+		PeerName: "peer1",
+		Message:  "Adding new local peer peer1",
+	})
+	sub.Close()
+	return sub, nil
+}
+
+func TestCtlCmd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	cs, err := control.Listen(path, fakeControlHandler{})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cs.Serve(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	tests := []struct {
+		name      string
+		args      []string
+		assertion require.ErrorAssertionFunc
+		contains  []string
+	}{
+		{"default status", nil, require.NoError, []string{"fake server", "[fe80::1]:1"}},
+		{"facts", []string{"facts"}, require.NoError, []string{"EndpointV4", "peer1", "1.2.3.4:5"}},
+		{"peers", []string{"peers"}, require.NoError, []string{"peer1", "healthy and alive"}},
+		{"trust", []string{"trust"}, require.NoError, []string{"Endpoint", "EndpointV4,EndpointV6"}},
+		{"device", []string{"device"}, require.NoError, []string{"interface: wg0", "192.0.2.1/32 (fact)"}},
+		{"json", []string{"--json", "peers"}, require.NoError, []string{`"Name": "peer1"`}},
+		{"log", []string{"log"}, require.NoError, []string{"info", "trust debug:  off"}},
+		{"log change", []string{"log", "debug", "endpoint=on"}, require.NoError, []string{"debug", "endpoint debug:  on"}},
+		{"events", []string{"events"}, require.NoError, []string{"peer-added", "Adding new local peer peer1"}},
+		{"events filtered", []string{"events", "peer-removed"}, require.NoError, nil},
+		{"events json", []string{"--json", "events", "peer-added"}, require.NoError, []string{`"PeerName":"peer1"`}},
+		{"config", []string{"config"}, require.NoError, []string{`"Name": "peer1"`, `"1.2.3.4:5"`}},
+		{"basic", []string{"basic", "phone"}, require.NoError, []string{"[Peer]\n# Name = router\n", "AllowedIPs = 10.0.0.0/24"}},
+		{"basic unknown", []string{"basic", "laptop"}, require.Error, nil},
+		{"basic no peer", []string{"basic"}, require.Error, nil},
+		{"events bad type", []string{"events", "bogus"}, require.Error, nil},
+		{"log bad change", []string{"log", "endpoint=maybe"}, require.Error, nil},
+		{"extra args", []string{"peers", "extra"}, require.Error, nil},
+		{"bad query", []string{"bogus"}, require.Error, nil},
+		{"too many", []string{"peers", "facts"}, require.Error, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"wirevlink", "ctl", "--control-socket=" + path}, tt.args...)
+			w := New(args)
+			var out bytes.Buffer
+			w.stdout = &out
+			require.NoError(t, w.Init(nil))
+			require.True(t, w.Runnable())
+			tt.assertion(t, w.Run())
+			for _, c := range tt.contains {
+				assert.Contains(t, out.String(), c)
+			}
+		})
+	}
+}
+
+func TestParseLogChanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		want      *control.LogSettings
+		assertion require.ErrorAssertionFunc
+	}{
+		{"none", nil, nil, require.NoError},
+		{"level", []string{"error"}, &control.LogSettings{Level: "error"}, require.NoError},
+		{
+			"level and subsystems",
+			[]string{"trust=on", "info", "packet=off"},
+			&control.LogSettings{Level: "info", Subsystems: map[string]bool{"trust": true, "packet": false}},
+			require.NoError,
+		},
+		{"two levels", []string{"info", "debug"}, nil, require.Error},
+		{"bad toggle", []string{"trust=yes"}, nil, require.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLogChanges(tt.args)
+			tt.assertion(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/fastcat/wirelink/internal/networking"
+)
+
+// sharedEnvironment lets several servers use the same environment, without any
+// one of them closing it out from under the others
+type sharedEnvironment struct {
+	networking.Environment
+}
+
+// Close implements Environment by doing nothing, the owner of the wrapped
+// environment is responsible for closing it
+func (sharedEnvironment) Close() error {
+	return nil
+}
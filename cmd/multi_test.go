@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/internal/networking/vnet"
+	"github.com/fastcat/wirelink/internal/testutils"
+)
+
+func TestWirelinkCmd_multi(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		configDir := t.TempDir()
+		t.Setenv("WIREVLINK_CONFIG_PATH", configDir)
+		k1 := testutils.MustKey(t)
+		k2 := testutils.MustKey(t)
+		writeConfig := func(iface, body string) {
+			require.NoError(t, os.WriteFile(filepath.Join(configDir, "wirevlink."+iface+".json"), []byte(body), 0o600))
+		}
+		writeConfig("wg0", fmt.Sprintf(`{"Peers":[{"PublicKey":%q,"Name":"zero"}]}`, k1))
+		writeConfig("wg1", fmt.Sprintf(`{"Peers":[{"PublicKey":%q,"Name":"one"}],"Chatty":true}`, k2))
+
+		w := vnet.NewWorld()
+		host := w.CreateHost("host")
+		defer host.Close()
+		for i, iface := range []string{"wg0", "wg1"} {
+			wg := host.AddTun(iface)
+			wg.GenerateKeys()
+			wg.Listen(wgPort + i)
+		}
+
+		cmd := New([]string{"wirevlink", "--ifaces=wg0,wg1", "--control-socket="})
+		cmd.disableSignals = true
+		require.NoError(t, cmd.Init(host.Wrap()))
+		assert.True(t, cmd.Runnable())
+		assert.Nil(t, cmd.Server)
+		require.Len(t, cmd.children, 2)
+		wg0, wg1 := cmd.children[0], cmd.children[1]
+		assert.Equal(t, "wg0", wg0.Config.Iface)
+		assert.Equal(t, "zero", wg0.Config.Peers.Name(k1))
+		assert.False(t, wg0.Config.Chatty)
+		assert.Equal(t, "wg1", wg1.Config.Iface)
+		assert.Equal(t, "one", wg1.Config.Peers.Name(k2))
+		assert.True(t, wg1.Config.Chatty)
+		assert.Equal(t, wgPort+1, wg0.Config.Port)
+		assert.Equal(t, wgPort+2, wg1.Config.Port)
+
+		// the config is swapped by reloads on the Run goroutine
+		cfg := func(c *WirelinkCmd) *config.Server {
+			c.reloadMu.Lock()
+			defer c.reloadMu.Unlock()
+			return c.Config
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- cmd.Run() }()
+		synctest.Wait()
+
+		// reloads apply to every interface
+		writeConfig("wg0", fmt.Sprintf(`{"Peers":[{"PublicKey":%q,"Name":"zero again"}]}`, k1))
+		writeConfig("wg1", fmt.Sprintf(`{"Peers":[{"PublicKey":%q,"Name":"one again"}]}`, k2))
+		cmd.signals <- syscall.SIGHUP
+		// wait for the reload to finish
+		synctest.Wait()
+		assert.Equal(t, "zero again", cfg(wg0).Peers.Name(k1))
+		assert.Equal(t, "one again", cfg(wg1).Peers.Name(k2))
+		assert.False(t, cfg(wg1).Chatty)
+
+		// and so does stopping
+		cmd.signals <- syscall.SIGTERM
+		assert.NoError(t, <-done)
+	})
+}
+
+func TestWirelinkCmd_multiNotify(t *testing.T) {
+	t.Setenv("WIREVLINK_CONFIG_PATH", t.TempDir())
+	notifyPath := filepath.Join(t.TempDir(), "notify.sock")
+	notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifyPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer notify.Close()
+	t.Setenv("NOTIFY_SOCKET", notifyPath)
+	t.Setenv("WATCHDOG_USEC", "60000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	read := func() string {
+		require.NoError(t, notify.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buf := make([]byte, 4096)
+		n, err := notify.Read(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	w := vnet.NewWorld()
+	host := w.CreateHost("host")
+	defer host.Close()
+	for i, iface := range []string{"wg0", "wg1"} {
+		wg := host.AddTun(iface)
+		wg.GenerateKeys()
+		wg.Listen(wgPort + i)
+	}
+
+	cmd := New([]string{"wirevlink", "--ifaces=wg0,wg1", "--control-socket="})
+	cmd.disableSignals = true
+	require.NoError(t, cmd.Init(host.Wrap()))
+	done := make(chan error, 1)
+	go func() { done <- cmd.Run() }()
+
+	// one notification for the whole process, once both are running
+	ready := read()
+	assert.Regexp(t, `^READY=1\nSTATUS=wg0: .*; wg1: .*$`, ready)
+	assert.Equal(t, "WATCHDOG=1", read())
+
+	cmd.signals <- syscall.SIGTERM
+	require.NoError(t, <-done)
+	var rest []string
+	for {
+		msg := read()
+		rest = append(rest, msg)
+		if msg == "STOPPING=1" {
+			break
+		}
+	}
+	for _, msg := range rest {
+		assert.NotContains(t, msg, "READY=1", "should only be ready once")
+	}
+}
+
+func TestWirelinkCmd_multiErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		contains string
+	}{
+		{"duplicate iface", []string{"--ifaces=wg0,wg0"}, "more than once"},
+		{"empty iface", []string{"--ifaces=wg0,,wg1"}, "empty interface"},
+		{"shared control socket", []string{"--ifaces=wg0,wg1", "--control-socket=/tmp/wirevlink.sock"}, "both use control socket"},
+		{"shared metrics", []string{"--ifaces=wg0,wg1", "--control-socket=", "--metrics-address=127.0.0.1:0"}, "both export metrics"},
+		{"shared dns", []string{"--ifaces=wg0,wg1", "--control-socket=", "--dns-address=127.0.0.1:0"}, "both answer DNS queries"},
+		{"missing iface", []string{"--ifaces=wg0,wg9", "--control-socket="}, "interface wg9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WIREVLINK_CONFIG_PATH", t.TempDir())
+			w := vnet.NewWorld()
+			host := w.CreateHost("host")
+			defer host.Close()
+			for i, iface := range []string{"wg0", "wg1"} {
+				wg := host.AddTun(iface)
+				wg.GenerateKeys()
+				wg.Listen(wgPort + i)
+			}
+
+			cmd := New(append([]string{"wirevlink"}, tt.args...))
+			err := cmd.Init(host.Wrap())
+			require.Error(t, err)
+			assert.ErrorContains(t, err, tt.contains)
+			assert.Nil(t, cmd.children)
+		})
+	}
+}
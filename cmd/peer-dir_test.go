@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/internal/networking/vnet"
+	"github.com/fastcat/wirelink/internal/testutils"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestWirelinkCmd_peersDir(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("WIREVLINK_CONFIG_PATH", configDir)
+	peersDir := filepath.Join(configDir, "wg0.d")
+	require.NoError(t, os.Mkdir(peersDir, 0o700))
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	require.NoError(t, os.WriteFile(
+		filepath.Join(configDir, "wirevlink.wg0.json"),
+		fmt.Appendf(nil, `{"Peers":[{"PublicKey":%q,"Name":"one"}],"peers-dir":"wg0.d"}`, k1),
+		0o600,
+	))
+
+	w := vnet.NewWorld()
+	host := w.CreateHost("host")
+	defer host.Close()
+	wg := host.AddTun("wg0")
+	wg.GenerateKeys()
+	wg.Listen(wgPort)
+
+	cmd := New([]string{"wirevlink", "--iface=wg0", "--control-socket="})
+	cmd.disableSignals = true
+	require.NoError(t, cmd.Init(host.Wrap()))
+	assert.Equal(t, peersDir, cmd.Config.PeersDir)
+	done := make(chan error, 1)
+	go func() { done <- cmd.Run() }()
+	// give it time to start watching
+	time.Sleep(500 * time.Millisecond)
+
+	peerName := func(k wgtypes.Key) string {
+		cmd.reloadMu.Lock()
+		defer cmd.reloadMu.Unlock()
+		return cmd.Config.Peers.Name(k)
+	}
+	eventuallyNamed := func(k wgtypes.Key, name, msg string) {
+		assert.Eventually(t, func() bool { return peerName(k) == name }, 5*time.Second, 50*time.Millisecond, msg)
+	}
+
+	peerFile := filepath.Join(peersDir, "two.yaml")
+	require.NoError(t, os.WriteFile(peerFile, fmt.Appendf(nil, "publickey: %s\nname: two\n", k2), 0o600))
+	eventuallyNamed(k2, "two", "adding a file should add the peer")
+	assert.Equal(t, "one", peerName(k1))
+
+	require.NoError(t, os.Remove(peerFile))
+	eventuallyNamed(k2, "", "removing a file should remove the peer")
+	assert.Equal(t, "one", peerName(k1))
+
+	cmd.signals <- syscall.SIGTERM
+	assert.NoError(t, <-done)
+}
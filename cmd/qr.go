@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// qrQuietZone is how many modules of blank border to draw around a QR code,
+// scanners need some to find the code
+const qrQuietZone = 2
+
+// writeQR renders the text as a QR code in the terminal. Each character covers
+// two rows of modules using half block characters. Light modules are drawn as
+// blocks, so it reads correctly on the usual light-on-dark terminal.
+func writeQR(w io.Writer, text string) error {
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return err
+	}
+	light := func(x, y int) bool {
+		return !code.Black(x, y)
+	}
+	var b strings.Builder
+	for y := -qrQuietZone; y < code.Size+qrQuietZone; y += 2 {
+		for x := -qrQuietZone; x < code.Size+qrQuietZone; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			// past the bottom edge counts as dark, so odd sizes don't get an extra
+			// half row of border
+			if y+1 >= code.Size+qrQuietZone {
+				bottom = false
+			}
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
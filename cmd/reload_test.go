@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fastcat/wirelink/internal/networking/vnet"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/trust"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWirelinkCmd_reloadConfig(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("WIREVLINK_CONFIG_PATH", configDir)
+	configFile := filepath.Join(configDir, "wirevlink.wg0.json")
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	writeConfig := func(body string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(body), 0o600))
+	}
+
+	w := vnet.NewWorld()
+	host := w.CreateHost("host")
+	defer host.Close()
+	wg := host.AddTun("wg0")
+	wg.GenerateKeys()
+	wg.Listen(wgPort)
+
+	writeConfig(fmt.Sprintf(`{"Peers":[{"PublicKey":%q,"Name":"one"}]}`, k1))
+	cmd := New([]string{"wirevlink", "--iface=wg0", "--control-socket="})
+	require.NoError(t, cmd.Init(host.Wrap()))
+	defer cmd.Server.Close()
+	oldConfig := cmd.Config
+	assert.Equal(t, "one", oldConfig.Peers.Name(k1))
+
+	writeConfig(fmt.Sprintf(
+		`{"Peers":[{"PublicKey":%q,"Name":"one","Trust":"Membership"},{"PublicKey":%q,"Name":"two"}]}`,
+		k1, k2,
+	))
+	require.NoError(t, cmd.reloadConfig())
+	assert.NotSame(t, oldConfig, cmd.Config)
+	assert.Equal(t, trust.Membership, cmd.Config.Peers.Trust(k1, trust.Untrusted))
+	assert.Equal(t, "two", cmd.Config.Peers.Name(k2))
+	assert.Equal(t, oldConfig.Port, cmd.Config.Port)
+
+	// a broken config is rejected and the old one kept
+	writeConfig(`{"Peers":[{"PublicKey":"invalidKey"}]}`)
+	assert.Error(t, cmd.reloadConfig())
+	assert.Equal(t, "two", cmd.Config.Peers.Name(k2))
+}
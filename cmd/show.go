@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/fastcat/wirelink/control"
+)
+
+// showCmd prints the wireguard device state like `wg show`, annotated with
+// what the daemon knows about each peer
+type showCmd struct{}
+
+func newShowCmd() subcommand {
+	return &showCmd{}
+}
+
+func (c *showCmd) Usage() string {
+	return "[flags]"
+}
+
+func (c *showCmd) AddFlags(*pflag.FlagSet) {}
+
+func (c *showCmd) Run(ctx *subcommandContext) error {
+	if len(ctx.flags.Args()) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", ctx.flags.Args())
+	}
+	client, err := dialControl(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	dev, err := client.Device()
+	if err != nil {
+		return err
+	}
+	return printDevice(ctx.stdout, dev, time.Now())
+}
+
+// printDevice formats the device in the style of `wg show`, with the extra
+// wirelink information mixed in
+func printDevice(out io.Writer, dev *control.Device, now time.Time) error {
+	var str strings.Builder
+	fmt.Fprintf(&str, "interface: %s\n", dev.Name)
+	fmt.Fprintf(&str, "  public key: %s\n", dev.PublicKey)
+	str.WriteString("  private key: (hidden)\n")
+	fmt.Fprintf(&str, "  listening port: %d\n", dev.ListenPort)
+	if dev.FirewallMark != 0 {
+		fmt.Fprintf(&str, "  fwmark: 0x%x\n", dev.FirewallMark)
+	}
+
+	for _, p := range dev.Peers {
+		fmt.Fprintf(&str, "\npeer: %s\n", p.PublicKey)
+		if p.Name != "" {
+			fmt.Fprintf(&str, "  name: %s\n", p.Name)
+		}
+		fmt.Fprintf(&str, "  state: %s\n", p.State)
+		fmt.Fprintf(&str, "  trust: %s\n", orDefault(p.Trust, "(none)"))
+		if p.Endpoint != "" {
+			fmt.Fprintf(&str, "  endpoint: %s\n", p.Endpoint)
+		}
+		if len(p.Endpoints) > 0 {
+			str.WriteString("  known endpoints:\n")
+			for _, ep := range p.Endpoints {
+				lastUsed := "never tried"
+				if !ep.LastUsed.IsZero() {
+					lastUsed = "last tried " + formatAgo(now.Sub(ep.LastUsed))
+				}
+				fmt.Fprintf(&str, "    %s (%s, expires in %s)\n",
+					ep.Address, lastUsed, formatDuration(ep.Expires.Sub(now)))
+			}
+		}
+		aips := make([]string, len(p.AllowedIPs))
+		for i, aip := range p.AllowedIPs {
+			aips[i] = aip.CIDR
+			if len(aip.Sources) > 0 {
+				aips[i] += " (" + strings.Join(aip.Sources, "+") + ")"
+			} else {
+				aips[i] += " (device)"
+			}
+		}
+		fmt.Fprintf(&str, "  allowed ips: %s\n", orDefault(strings.Join(aips, ", "), "(none)"))
+		if !p.LastHandshake.IsZero() {
+			fmt.Fprintf(&str, "  latest handshake: %s\n", formatAgo(now.Sub(p.LastHandshake)))
+		}
+		if p.ReceiveBytes != 0 || p.TransmitBytes != 0 {
+			fmt.Fprintf(&str, "  transfer: %s received, %s sent\n",
+				formatBytes(p.ReceiveBytes), formatBytes(p.TransmitBytes))
+		}
+		if p.PersistentKeepalive > 0 {
+			fmt.Fprintf(&str, "  persistent keepalive: every %s\n", formatDuration(p.PersistentKeepalive))
+		}
+	}
+	_, err := io.WriteString(out, str.String())
+	return err
+}
+
+// formatDuration formats a duration in the verbose style `wg show` uses, e.g.
+// "1 minute, 5 seconds"
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return "0 seconds"
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+	var parts []string
+	for _, u := range units {
+		n := d / u.size
+		if n == 0 {
+			continue
+		}
+		d -= n * u.size
+		part := fmt.Sprintf("%d %s", n, u.name)
+		if n != 1 {
+			part += "s"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatAgo(d time.Duration) string {
+	if d < time.Second {
+		return "just now"
+	}
+	return formatDuration(d) + " ago"
+}
+
+// formatBytes formats a byte count in the binary units `wg show` uses
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	suffixes := []string{"KiB", "MiB", "GiB", "TiB"}
+	value := float64(b) / unit
+	i := 0
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", value, suffixes[i])
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/control"
+)
+
+func TestPrintDevice(t *testing.T) {
+	now := time.Now()
+	dev := &control.Device{
+		Name:       "wg0",
+		PublicKey:  "devkey",
+		ListenPort: 51820,
+		Peers: []control.DevicePeer{
+			{
+				PublicKey:     "key1",
+				Name:          "peer1",
+				State:         "healthy and alive (1s -> 2s)",
+				Trust:         "Membership",
+				Endpoint:      "192.0.2.1:51820",
+				LastHandshake: now.Add(-65 * time.Second),
+				ReceiveBytes:  1536,
+				TransmitBytes: 100,
+				Endpoints: []control.EndpointFact{
+					{Address: "192.0.2.1:51820", Expires: now.Add(4 * time.Minute), LastUsed: now.Add(-2 * time.Hour)},
+					{Address: "198.51.100.1:51820", Expires: now.Add(time.Minute)},
+				},
+				AllowedIPs: []control.AllowedIP{
+					{CIDR: "fe80::1/128", Sources: []string{control.AllowedIPSourceAuto}},
+					{CIDR: "10.0.0.1/32", Sources: []string{control.AllowedIPSourceConfig, control.AllowedIPSourceFact}},
+					{CIDR: "10.1.0.0/16"},
+				},
+				PersistentKeepalive: 25 * time.Second,
+			},
+			{
+				PublicKey: "key2",
+				State:     "???",
+			},
+		},
+	}
+	var out bytes.Buffer
+	require.NoError(t, printDevice(&out, dev, now))
+	assert.Equal(t, `interface: wg0
+  public key: devkey
+  private key: (hidden)
+  listening port: 51820
+
+peer: key1
+  name: peer1
+  state: healthy and alive (1s -> 2s)
+  trust: Membership
+  endpoint: 192.0.2.1:51820
+  known endpoints:
+    192.0.2.1:51820 (last tried 2 hours ago, expires in 4 minutes)
+    198.51.100.1:51820 (never tried, expires in 1 minute)
+  allowed ips: fe80::1/128 (auto), 10.0.0.1/32 (config+fact), 10.1.0.0/16 (device)
+  latest handshake: 1 minute, 5 seconds ago
+  transfer: 1.50 KiB received, 100 B sent
+  persistent keepalive: every 25 seconds
+
+peer: key2
+  state: ???
+  trust: (none)
+  allowed ips: (none)
+`, out.String())
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "0 B", formatBytes(0))
+	assert.Equal(t, "1023 B", formatBytes(1023))
+	assert.Equal(t, "1.00 KiB", formatBytes(1024))
+	assert.Equal(t, "1.00 MiB", formatBytes(1024*1024))
+	assert.Equal(t, "2048.00 TiB", formatBytes(2048*1024*1024*1024*1024))
+}
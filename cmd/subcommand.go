@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/internal/networking"
+)
+
+// subcommand is an alternate mode of the command line that does something
+// other than running the server
+type subcommand interface {
+	// Usage describes the positional arguments to the subcommand
+	Usage() string
+	// AddFlags adds any subcommand specific flags. These flags are not bound to
+	// the viper config, and so cannot be set from the config file or environment.
+	AddFlags(flags *pflag.FlagSet)
+	// Run executes the subcommand after the configuration has been parsed
+	Run(ctx *subcommandContext) error
+}
+
+// lenientSubcommand is implemented by subcommands that still run if the config
+// can't be parsed, so that they can explain what is wrong with it
+type lenientSubcommand interface {
+	subcommand
+	lenient()
+}
+
+// subcommandContext carries everything a subcommand might need to run
+type subcommandContext struct {
+	args   []string
+	env    networking.Environment
+	flags  *pflag.FlagSet
+	vcfg   *viper.Viper
+	config *config.ServerData
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// subcommands maps the command line names of the subcommands to factories
+// for them
+var subcommands = map[string]func() subcommand{
+	"ctl":             newCtlCmd,
+	"show":            newShowCmd,
+	"config generate": newConfigGenerateCmd,
+	"config init":     newConfigInitCmd,
+	"config export":   newConfigExportCmd,
+	"config sign":     newConfigSignCmd,
+	"config import":   newConfigImportCmd,
+	"config basic":    newConfigBasicCmd,
+	"check-config":    newCheckConfigCmd,
+}
+
+// findSubcommand checks if the args request a subcommand, and if so returns
+// the subcommand name along with the args with the subcommand name removed.
+func findSubcommand(args []string) (string, []string) {
+	if len(args) < 2 {
+		return "", args
+	}
+	// allow two-word subcommands like `config generate`
+	if len(args) >= 3 {
+		name := args[1] + " " + args[2]
+		if _, ok := subcommands[name]; ok {
+			return name, append([]string{args[0]}, args[3:]...)
+		}
+	}
+	if _, ok := subcommands[args[1]]; ok {
+		return args[1], append([]string{args[0]}, args[2:]...)
+	}
+	return "", args
+}
+
+func (w *WirelinkCmd) initSubcommand(env networking.Environment) error {
+	sub := subcommands[w.subName]()
+	flags, vcfg := config.Init(w.args)
+	sub.AddFlags(flags)
+	_, lenient := sub.(lenientSubcommand)
+	defaultUsage := flags.Usage
+	flags.Usage = func() {
+		// lenient subcommands explain config errors better than the usage does
+		if help, _ := flags.GetBool(config.HelpFlag); lenient && flags.Parsed() && !help {
+			return
+		}
+		fmt.Fprintf(flags.Output(), "%s %s\n", w.subName, sub.Usage())
+		defaultUsage()
+	}
+	configData, err := config.Parse(flags, vcfg, w.args)
+	if err != nil {
+		if !lenient || !flags.Parsed() {
+			return fmt.Errorf("unable to parse configuration: %w", err)
+		}
+		configData = &config.ServerData{Iface: vcfg.GetString(config.IfaceFlag)}
+	}
+	// configData comes back nil if we ran --help or --version
+	if configData == nil {
+		return nil
+	}
+	w.sub = sub
+	w.subCtx = &subcommandContext{
+		args:   w.args,
+		env:    env,
+		flags:  flags,
+		vcfg:   vcfg,
+		config: configData,
+		stdin:  w.stdin,
+		stdout: w.stdout,
+	}
+	return nil
+}
+
+func (w *WirelinkCmd) runSubcommand() error {
+	if err := w.sub.Run(w.subCtx); err != nil {
+		return fmt.Errorf("%s failed: %w", w.subName, err)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fastcat/wirelink/detect"
+	"github.com/fastcat/wirelink/fact"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// BasicKeepalive is the PersistentKeepalive for the routers in configs for
+// basic peers, which are usually mobile devices behind NAT
+const BasicKeepalive = 25
+
+// BasicNetwork is what the local node knows about the network, from which
+// configs for basic peers can be generated
+type BasicNetwork struct {
+	// Device is the local wireguard device
+	Device *wgtypes.Device
+	// LocalRouter is whether the local node is a router, and so should be
+	// included as one
+	LocalRouter bool
+	// LocalNets are the subnets assigned to the local tunnel interface, which
+	// are routed via the local node if it is a router
+	LocalNets []net.IPNet
+	Facts     []*fact.Fact
+	Peers     Peers
+	// Name gives the display name for a peer, or the empty string if it has
+	// none
+	Name func(wgtypes.Key) string
+}
+
+// GenerateBasic makes a wg-quick config for a basic peer, which can't run
+// wirelink itself, that routes the allowed IPs the network knows about via
+// the router peers. The private key of the basic peer is not known, so it is
+// left empty.
+func (n *BasicNetwork) GenerateBasic(basic wgtypes.Key) (*WgQuick, error) {
+	aips := n.allowedIPs()
+	if !n.isBasic(basic) {
+		return nil, fmt.Errorf("%s is not a known basic peer", basic)
+	}
+	if len(aips[basic]) == 0 {
+		return nil, fmt.Errorf("no allowed IPs known for %s", basic)
+	}
+	ret := &WgQuick{Interface: WgQuickInterface{Address: ipNetStrings(aips[basic])}}
+
+	var routers []wgtypes.Key
+	deviceEndpoints := make(map[wgtypes.Key]*net.UDPAddr)
+	for i := range n.Device.Peers {
+		p := &n.Device.Peers[i]
+		if p.PublicKey != basic && detect.IsPeerRouter(p) {
+			routers = append(routers, p.PublicKey)
+			deviceEndpoints[p.PublicKey] = p.Endpoint
+		}
+	}
+	slices.SortFunc(routers, func(a, b wgtypes.Key) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	// the local router goes first
+	if n.LocalRouter {
+		routers = slices.Insert(routers, 0, n.Device.PublicKey)
+		for _, ipn := range n.LocalNets {
+			aips[n.Device.PublicKey] = addIPNet(aips[n.Device.PublicKey], net.IPNet{
+				IP:   ipn.IP.Mask(ipn.Mask),
+				Mask: ipn.Mask,
+			})
+		}
+	}
+	if len(routers) == 0 {
+		return nil, fmt.Errorf("no routers known to route %s via", basic)
+	}
+
+	// wg-quick routes each allowed IP via only one peer, so each router gets its
+	// own allowed IPs, and the first router gets the rest
+	assigned := make(map[string]bool)
+	covered := func(aip net.IPNet) bool {
+		for _, r := range routers {
+			for _, raip := range aips[r] {
+				if contains(raip, aip) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for i, r := range routers {
+		peer := WgQuickPeer{
+			Name:                n.Name(r),
+			PublicKey:           r.String(),
+			Endpoint:            n.endpoint(r, deviceEndpoints[r]),
+			PersistentKeepalive: BasicKeepalive,
+		}
+		var routed []net.IPNet
+		route := func(aip net.IPNet) {
+			if !assigned[aip.String()] {
+				assigned[aip.String()] = true
+				routed = append(routed, aip)
+			}
+		}
+		for _, aip := range aips[r] {
+			route(aip)
+		}
+		if i == 0 {
+			for k, kaips := range aips {
+				if k == basic || slices.Contains(routers, k) {
+					continue
+				}
+				for _, aip := range kaips {
+					if !covered(aip) {
+						route(aip)
+					}
+				}
+			}
+		}
+		peer.AllowedIPs = ipNetStrings(routed)
+		ret.Peers = append(ret.Peers, peer)
+	}
+	return ret, nil
+}
+
+func (n *BasicNetwork) isBasic(key wgtypes.Key) bool {
+	if n.Peers.IsBasic(key) {
+		return true
+	}
+	basic := false
+	for _, f := range n.Facts {
+		if f.Attribute != fact.AttributeMemberMetadata {
+			continue
+		}
+		if ps, ok := f.Subject.(*fact.PeerSubject); !ok || ps.Key != key {
+			continue
+		}
+		f.Value.(*fact.MemberMetadata).ForEach(func(a fact.MemberAttribute, v string) {
+			if a == fact.MemberIsBasic && len(v) != 0 && v[0] != 0 {
+				basic = true
+			}
+		})
+	}
+	return basic
+}
+
+// allowedIPs collects the allowed IPs known for each peer, from facts, the
+// config, and the device
+func (n *BasicNetwork) allowedIPs() map[wgtypes.Key][]net.IPNet {
+	ret := make(map[wgtypes.Key][]net.IPNet)
+	add := func(k wgtypes.Key, aip net.IPNet) {
+		ret[k] = addIPNet(ret[k], aip)
+	}
+	for _, f := range n.Facts {
+		ps, ok := f.Subject.(*fact.PeerSubject)
+		if !ok {
+			continue
+		}
+		if v, ok := f.Value.(*fact.IPNetValue); ok {
+			add(ps.Key, v.IPNet)
+		}
+	}
+	for k := range n.Peers {
+		for _, aip := range n.Peers.AllowedIPs(k) {
+			add(k, aip)
+		}
+	}
+	for _, p := range n.Device.Peers {
+		for _, aip := range p.AllowedIPs {
+			add(p.PublicKey, aip)
+		}
+	}
+	return ret
+}
+
+// endpoint picks the endpoint for a router that a mobile device is most likely
+// to be able to reach: a configured one if there is one, otherwise a public
+// address over a private one, and IPv4 over IPv6
+func (n *BasicNetwork) endpoint(key wgtypes.Key, device *net.UDPAddr) string {
+	if eps := n.Peers.Endpoints(key); len(eps) != 0 {
+		return net.JoinHostPort(eps[0].Host, strconv.Itoa(eps[0].Port))
+	}
+	var candidates []*net.UDPAddr
+	if device != nil {
+		candidates = append(candidates, device)
+	}
+	for _, f := range fact.SortedCopy(n.Facts) {
+		if ps, ok := f.Subject.(*fact.PeerSubject); !ok || ps.Key != key {
+			continue
+		}
+		if v, ok := f.Value.(*fact.IPPortValue); ok {
+			candidates = append(candidates, &net.UDPAddr{IP: v.IP, Port: v.Port})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	best := slices.MinFunc(candidates, func(a, b *net.UDPAddr) int {
+		return endpointRank(a.IP) - endpointRank(b.IP)
+	})
+	return best.String()
+}
+
+func endpointRank(ip net.IP) int {
+	rank := 0
+	if ip.To4() == nil {
+		rank++
+	}
+	if ip.IsPrivate() || !ip.IsGlobalUnicast() {
+		rank += 2
+	}
+	return rank
+}
+
+// addIPNet adds an IPNet to the list if it is not already there. Link-local
+// addresses are skipped, as they only matter to peers running wirelink.
+func addIPNet(list []net.IPNet, aip net.IPNet) []net.IPNet {
+	if aip.IP.IsLinkLocalUnicast() {
+		return list
+	}
+	if slices.ContainsFunc(list, func(e net.IPNet) bool { return e.String() == aip.String() }) {
+		return list
+	}
+	return append(list, aip)
+}
+
+func contains(outer, inner net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+func ipNetStrings(aips []net.IPNet) []string {
+	ret := make([]string, 0, len(aips))
+	for _, aip := range aips {
+		ret = append(ret, aip.String())
+	}
+	slices.Sort(ret)
+	return ret
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/internal/testutils/facts"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestBasicNetwork_GenerateBasic(t *testing.T) {
+	expires := time.Now().Add(time.Minute)
+	local := testutils.MustKey(t)
+	phone := testutils.MustKey(t)
+	leaf := testutils.MustKey(t)
+	router1 := testutils.MustKey(t)
+	router2 := testutils.MustKey(t)
+	if router1.String() > router2.String() {
+		router1, router2 = router2, router1
+	}
+	phoneAIP := testutils.MakeIPv4Net(10, 0, 0, 10, 32)
+	leafAIP := testutils.MakeIPv4Net(10, 0, 0, 20, 32)
+	farAIP := testutils.MakeIPv4Net(10, 9, 0, 1, 32)
+	subnet1 := testutils.MakeIPv4Net(10, 0, 0, 0, 24)
+	subnet2 := testutils.MakeIPv4Net(10, 1, 0, 0, 24)
+	publicEP := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 51820}
+	privateEP := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 51820}
+	v6EP := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51820}
+	names := map[wgtypes.Key]string{router1: "router1", router2: "router2"}
+	name := func(k wgtypes.Key) string { return names[k] }
+
+	basicFacts := []*fact.Fact{
+		facts.MemberMetadataFactFull(&phone, expires, "phone", true),
+		facts.AllowedIPFactFull(phoneAIP, &phone, expires),
+		facts.AllowedIPFactFull(leafAIP, &leaf, expires),
+		facts.AllowedIPFactFull(farAIP, &leaf, expires),
+	}
+	routerPeer := func(k wgtypes.Key, ep *net.UDPAddr, aips ...net.IPNet) wgtypes.Peer {
+		return wgtypes.Peer{PublicKey: k, Endpoint: ep, AllowedIPs: append(aips, autopeer.AutoAddressNet(k))}
+	}
+
+	tests := []struct {
+		name      string
+		network   *BasicNetwork
+		peer      wgtypes.Key
+		want      *WgQuick
+		assertion require.ErrorAssertionFunc
+	}{
+		{
+			"via remote router",
+			&BasicNetwork{
+				Device: &wgtypes.Device{PublicKey: local, Peers: []wgtypes.Peer{
+					routerPeer(router1, privateEP, subnet1),
+				}},
+				Facts: append(basicFacts, facts.EndpointFactFull(publicEP, &router1, expires)),
+				Name:  name,
+			},
+			phone,
+			&WgQuick{
+				Interface: WgQuickInterface{Address: []string{"10.0.0.10/32"}},
+				Peers: []WgQuickPeer{{
+					Name:                "router1",
+					PublicKey:           router1.String(),
+					Endpoint:            publicEP.String(),
+					AllowedIPs:          []string{"10.0.0.0/24", "10.9.0.1/32"},
+					PersistentKeepalive: BasicKeepalive,
+				}},
+			},
+			require.NoError,
+		},
+		{
+			"local router",
+			&BasicNetwork{
+				Device: &wgtypes.Device{PublicKey: local, Peers: []wgtypes.Peer{
+					{PublicKey: phone, AllowedIPs: []net.IPNet{phoneAIP, autopeer.AutoAddressNet(phone)}},
+					{PublicKey: leaf, AllowedIPs: []net.IPNet{leafAIP}},
+				}},
+				LocalRouter: true,
+				LocalNets:   []net.IPNet{testutils.MakeIPv4Net(10, 0, 0, 1, 24), autopeer.AutoAddressNet(local)},
+				Facts: []*fact.Fact{
+					facts.EndpointFactFull(v6EP, &local, expires),
+					facts.EndpointFactFull(privateEP, &local, expires),
+				},
+				Peers: Peers{
+					phone: &Peer{Basic: true},
+					local: &Peer{Endpoints: []PeerEndpoint{{Host: "vpn.example.com", Port: 51820}}},
+				},
+				Name: func(wgtypes.Key) string { return "" },
+			},
+			phone,
+			&WgQuick{
+				Interface: WgQuickInterface{Address: []string{"10.0.0.10/32"}},
+				Peers: []WgQuickPeer{{
+					PublicKey:           local.String(),
+					Endpoint:            "vpn.example.com:51820",
+					AllowedIPs:          []string{"10.0.0.0/24"},
+					PersistentKeepalive: BasicKeepalive,
+				}},
+			},
+			require.NoError,
+		},
+		{
+			"two routers",
+			&BasicNetwork{
+				Device: &wgtypes.Device{PublicKey: local, Peers: []wgtypes.Peer{
+					routerPeer(router2, v6EP, subnet2),
+					routerPeer(router1, privateEP, subnet1),
+				}},
+				Facts: basicFacts,
+				Name:  name,
+			},
+			phone,
+			&WgQuick{
+				Interface: WgQuickInterface{Address: []string{"10.0.0.10/32"}},
+				Peers: []WgQuickPeer{
+					{
+						Name:                "router1",
+						PublicKey:           router1.String(),
+						Endpoint:            privateEP.String(),
+						AllowedIPs:          []string{"10.0.0.0/24", "10.9.0.1/32"},
+						PersistentKeepalive: BasicKeepalive,
+					},
+					{
+						Name:                "router2",
+						PublicKey:           router2.String(),
+						Endpoint:            v6EP.String(),
+						AllowedIPs:          []string{"10.1.0.0/24"},
+						PersistentKeepalive: BasicKeepalive,
+					},
+				},
+			},
+			require.NoError,
+		},
+		{
+			"not basic",
+			&BasicNetwork{
+				Device: &wgtypes.Device{PublicKey: local, Peers: []wgtypes.Peer{routerPeer(router1, nil, subnet1)}},
+				Facts:  basicFacts,
+				Name:   name,
+			},
+			leaf,
+			nil,
+			require.Error,
+		},
+		{
+			"no address",
+			&BasicNetwork{
+				Device: &wgtypes.Device{PublicKey: local, Peers: []wgtypes.Peer{routerPeer(router1, nil, subnet1)}},
+				Facts:  basicFacts[:1],
+				Name:   name,
+			},
+			phone,
+			nil,
+			require.Error,
+		},
+		{
+			"no routers",
+			&BasicNetwork{
+				Device: &wgtypes.Device{PublicKey: local},
+				Facts:  basicFacts,
+				Name:   name,
+			},
+			phone,
+			nil,
+			require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.network.GenerateBasic(tt.peer)
+			tt.assertion(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
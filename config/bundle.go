@@ -0,0 +1,123 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fastcat/wirelink/signing"
+)
+
+// BundleFormat identifies the version of the config bundle format
+const BundleFormat = "wirelink-bundle-v1"
+
+// MaxBundleSize is the largest config bundle that will be read
+const MaxBundleSize = 1024 * 1024
+
+// bundleSignatureContext is prepended to the payload when signing, so that
+// bundle signatures can't be confused with other uses of the key
+const bundleSignatureContext = BundleFormat + "\x00"
+
+// BundleData is the content of a config bundle
+type BundleData struct {
+	Created time.Time
+	Peers   []PeerData
+}
+
+// Bundle is a list of peers signed by a trusted peer, so that it can be
+// distributed over untrusted channels
+type Bundle struct {
+	Format string
+	// Payload is the JSON encoded BundleData. It is kept as bytes so that the
+	// signature doesn't depend on encoding it the same way twice.
+	Payload []byte
+	// Key is the Ed25519 public key of the signer
+	Key       []byte
+	Signature []byte
+}
+
+// SignBundle encodes and signs the bundle data
+func SignBundle(data *BundleData, signer *signing.Signer) (*Bundle, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{
+		Format:    BundleFormat,
+		Payload:   payload,
+		Key:       signer.PublicSigningKey(),
+		Signature: signer.Sign(append([]byte(bundleSignatureContext), payload...)),
+	}, nil
+}
+
+// ReadBundle decodes a bundle, without verifying it
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxBundleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxBundleSize {
+		return nil, fmt.Errorf("bundle is larger than %d bytes", MaxBundleSize)
+	}
+	var ret Bundle
+	if err = json.Unmarshal(data, &ret); err != nil {
+		return nil, fmt.Errorf("unable to decode bundle: %w", err)
+	}
+	if ret.Format != BundleFormat {
+		return nil, fmt.Errorf("unsupported bundle format %q", ret.Format)
+	}
+	return &ret, nil
+}
+
+// Verify checks the bundle was signed by one of the trusted keys, and if so
+// decodes and validates its content
+func (b *Bundle) Verify(trusted []ed25519.PublicKey) (*BundleData, error) {
+	if len(trusted) == 0 {
+		return nil, errors.New("no trusted bundle keys")
+	}
+	var key ed25519.PublicKey
+	for _, k := range trusted {
+		if k.Equal(ed25519.PublicKey(b.Key)) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("bundle signed by untrusted key %s", FormatBundleKey(b.Key))
+	}
+	if !signing.Verify(key, append([]byte(bundleSignatureContext), b.Payload...), b.Signature) {
+		return nil, errors.New("bundle signature is invalid")
+	}
+
+	var ret BundleData
+	if err := json.Unmarshal(b.Payload, &ret); err != nil {
+		return nil, fmt.Errorf("unable to decode bundle payload: %w", err)
+	}
+	for _, p := range ret.Peers {
+		if _, _, err := p.Parse(); err != nil {
+			return nil, fmt.Errorf("invalid peer %q in bundle: %w", p.PublicKey, err)
+		}
+	}
+	return &ret, nil
+}
+
+// FormatBundleKey encodes a bundle signing key for use in config files
+func FormatBundleKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParseBundleKey decodes a bundle signing key from a config file
+func ParseBundleKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle key %q: %w", s, err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid bundle key %q: wrong length %d", s, len(key))
+	}
+	return key, nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/signing"
+)
+
+func TestBundle(t *testing.T) {
+	priv, pub := testutils.MustKeyPair(t)
+	otherPriv, _ := testutils.MustKeyPair(t)
+	signer := signing.New(priv)
+	other := signing.New(otherPriv)
+	data := &BundleData{
+		Created: time.Now().UTC().Truncate(time.Second),
+		Peers: []PeerData{{
+			PublicKey:  pub.String(),
+			Name:       "router",
+			Trust:      "Membership",
+			Endpoints:  []string{"192.0.2.1:51820"},
+			AllowedIPs: []string{"10.0.0.0/24"},
+		}},
+	}
+
+	encode := func(t *testing.T, b *Bundle) []byte {
+		content, err := json.Marshal(b)
+		require.NoError(t, err)
+		return content
+	}
+
+	tests := []struct {
+		name    string
+		mangle  func(t *testing.T, b *Bundle) []byte
+		trusted []ed25519.PublicKey
+		wantErr string
+	}{
+		{"valid", encode, []ed25519.PublicKey{other.PublicSigningKey(), signer.PublicSigningKey()}, ""},
+		{"no keys", encode, nil, "no trusted"},
+		{"untrusted", encode, []ed25519.PublicKey{other.PublicSigningKey()}, "untrusted key"},
+		{
+			"tampered",
+			func(t *testing.T, b *Bundle) []byte {
+				b.Payload = bytes.Replace(b.Payload, []byte("router"), []byte("evil"), 1)
+				return encode(t, b)
+			},
+			[]ed25519.PublicKey{signer.PublicSigningKey()},
+			"signature is invalid",
+		},
+		{
+			"swapped key",
+			func(t *testing.T, b *Bundle) []byte {
+				b.Key = other.PublicSigningKey()
+				return encode(t, b)
+			},
+			[]ed25519.PublicKey{signer.PublicSigningKey(), other.PublicSigningKey()},
+			"signature is invalid",
+		},
+		{
+			"bad format",
+			func(t *testing.T, b *Bundle) []byte {
+				b.Format = "jws"
+				return encode(t, b)
+			},
+			nil,
+			"unsupported bundle format",
+		},
+		{
+			"not json",
+			func(t *testing.T, b *Bundle) []byte { return []byte("{") },
+			nil,
+			"unable to decode",
+		},
+		{
+			"too big",
+			func(t *testing.T, b *Bundle) []byte { return bytes.Repeat([]byte(" "), MaxBundleSize+1) },
+			nil,
+			"larger than",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := SignBundle(data, signer)
+			require.NoError(t, err)
+			b, err = ReadBundle(bytes.NewReader(tt.mangle(t, b)))
+			if err == nil {
+				var got *BundleData
+				got, err = b.Verify(tt.trusted)
+				if err == nil {
+					assert.Equal(t, data, got)
+				}
+			}
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBundle_invalidPeer(t *testing.T) {
+	priv, _ := testutils.MustKeyPair(t)
+	signer := signing.New(priv)
+	b, err := SignBundle(&BundleData{Peers: []PeerData{{PublicKey: "nope"}}}, signer)
+	require.NoError(t, err)
+	_, err = b.Verify([]ed25519.PublicKey{signer.PublicSigningKey()})
+	assert.Error(t, err)
+}
+
+func TestParseBundleKey(t *testing.T) {
+	priv, _ := testutils.MustKeyPair(t)
+	want := signing.New(priv).PublicSigningKey()
+	got, err := ParseBundleKey(FormatBundleKey(want))
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = ParseBundleKey("not base64!")
+	assert.Error(t, err)
+	_, err = ParseBundleKey(strings.Repeat("A", 8))
+	assert.Error(t, err)
+}
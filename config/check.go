@@ -0,0 +1,434 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/fastcat/wirelink/internal/networking"
+	"github.com/fastcat/wirelink/log"
+	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Severity ranks how serious a problem found by Check is
+type Severity int
+
+const (
+	// SeverityInfo is for settings that work, but may not do what was intended
+	SeverityInfo Severity = iota
+	// SeverityWarning is for settings that probably don't do what was intended
+	SeverityWarning
+	// SeverityError is for settings wirelink will refuse to run with
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic is a single problem found by Check
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	// Hint suggests how to fix the problem, if there is an obvious fix
+	Hint string
+}
+
+// Checker looks for config mistakes that Parse doesn't reject, but which
+// cause confusing behavior at runtime, using what it can find out about the
+// host
+type Checker struct {
+	// Interfaces are the network interfaces on the host
+	Interfaces []networking.Interface
+	// LookupIP resolves the hosts in peer endpoints
+	LookupIP func(host string) ([]net.IP, error)
+
+	diags []Diagnostic
+}
+
+// cliOnlySettings are settings that are accepted in the config file, but only
+// make sense on the command line
+var cliOnlySettings = []string{DumpConfigFlag, HelpFlag, VersionFlag}
+
+func (c *Checker) report(severity Severity, hint, format string, args ...any) {
+	c.diags = append(c.diags, Diagnostic{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Hint:     hint,
+	})
+}
+
+// Check validates the config read by the given viper instance, which must
+// have been set up by Init and Parse. Unlike Parse, it doesn't stop at the
+// first problem, and tries to explain how to fix each one.
+func (c *Checker) Check(vcfg *viper.Viper) []Diagnostic {
+	c.diags = nil
+	iface := vcfg.GetString(IfaceFlag)
+	if file := vcfg.ConfigFileUsed(); file == "" {
+		c.report(SeverityInfo, "",
+			"no config file for %s found in %s, only flags and environment variables are used",
+			iface, vcfg.GetString(ConfigPathFlag))
+	} else if !c.checkFile(file) {
+		return c.diags
+	}
+
+	var data ServerData
+	if err := vcfg.Unmarshal(&data); err != nil {
+		c.report(SeverityError, "", "unable to decode config: %v", err)
+		return c.diags
+	}
+	if err := vcfg.UnmarshalExact(&ServerData{}); err != nil && !c.has(SeverityError) {
+		c.report(SeverityError, "", "unable to decode config: %v", err)
+	}
+	c.checkSettings(&data)
+	peerList := data.Peers
+	if data.PeersDir != "" {
+		files, err := LoadPeerDir(resolvePeersDir(data.PeersDir, vcfg.GetString(ConfigPathFlag)))
+		if err != nil {
+			c.report(SeverityError, "", "%s: %v", PeersDirFlag, err)
+		}
+		for _, pf := range files {
+			peerList = append(peerList, pf.PeerData)
+		}
+	}
+	peers := c.checkPeers(peerList)
+	c.checkTrust(peerList, peers)
+
+	var tunnelNets, hostNets []net.IPNet
+	var ifaceNames []string
+	foundTunnel := false
+	for _, i := range c.Interfaces {
+		addrs, err := i.Addrs()
+		if err != nil {
+			c.report(SeverityInfo, "", "unable to read addresses of %s: %v", i.Name(), err)
+		}
+		if i.Name() == iface {
+			foundTunnel = true
+			tunnelNets = append(tunnelNets, addrs...)
+		} else {
+			ifaceNames = append(ifaceNames, i.Name())
+			hostNets = append(hostNets, addrs...)
+		}
+	}
+	c.checkGlobs("ReportIfaces", data.ReportIfaces, ifaceNames)
+	c.checkGlobs("HideIfaces", data.HideIfaces, ifaceNames)
+	if foundTunnel {
+		c.checkEndpoints(peerList, tunnelNets, hostNets)
+	} else {
+		c.report(SeverityInfo, "",
+			"interface %s not found on this host, endpoints can't be checked against its subnets", iface)
+	}
+
+	return c.diags
+}
+
+func (c *Checker) has(severity Severity) bool {
+	return slices.ContainsFunc(c.diags, func(d Diagnostic) bool { return d.Severity == severity })
+}
+
+// checkFile looks at the settings in the config file itself, separately from
+// flags and the environment, and returns false if the file can't be read
+func (c *Checker) checkFile(file string) bool {
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	for _, ext := range viper.SupportedExts {
+		if other := base + "." + ext; other != file {
+			if matches, _ := filepath.Glob(other); len(matches) != 0 {
+				c.report(SeverityWarning, "merge the settings into one file and remove the other",
+					"only %s is read, %s is ignored", file, other)
+			}
+		}
+	}
+
+	fv := viper.New()
+	fv.SetConfigFile(file)
+	if err := fv.ReadInConfig(); err != nil {
+		c.report(SeverityError, "", "unable to read %s: %v", file, err)
+		return false
+	}
+	settings := fv.AllSettings()
+	known := settingNames(reflect.TypeFor[ServerData]())
+	peerKnown := settingNames(reflect.TypeFor[PeerData]())
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		if !slices.Contains(known, key) {
+			c.unknownSetting(key, "", known)
+			continue
+		}
+		switch key {
+		case ConfigPathFlag:
+			c.report(SeverityWarning, "set it in the environment instead",
+				"%s in the config file is ignored, as it is used to find the config file", key)
+		case IfaceFlag:
+			c.report(SeverityWarning, "remove it, the file name already selects the interface",
+				"%s in the config file overrides the interface the file was chosen for", key)
+		case IfacesFlag:
+			c.report(SeverityWarning, "pass it as a command line flag or set it in the environment instead",
+				"%s in the config file is ignored, as each interface has its own config file", key)
+		case "peers":
+			list, _ := settings[key].([]any)
+			for i, p := range list {
+				pm, _ := p.(map[string]any)
+				for _, pk := range slices.Sorted(maps.Keys(pm)) {
+					if !slices.Contains(peerKnown, strings.ToLower(pk)) {
+						c.unknownSetting(pk, fmt.Sprintf("peer #%d", i+1), peerKnown)
+					}
+				}
+			}
+		}
+		if slices.Contains(cliOnlySettings, key) {
+			c.report(SeverityWarning, "pass it as a command line flag when needed",
+				"%s in the config file applies to every run, it is meant for the command line", key)
+		}
+	}
+	return true
+}
+
+func (c *Checker) unknownSetting(key, where string, known []string) {
+	if where != "" {
+		where = " in " + where
+	}
+	hint := ""
+	if s := suggestSetting(key, known); s != "" {
+		hint = fmt.Sprintf("did you mean %q?", s)
+	}
+	c.report(SeverityError, hint, "unknown setting %q%s", key, where)
+}
+
+// checkSettings checks the settings Parse would reject
+func (c *Checker) checkSettings(data *ServerData) {
+	if data.Iface == "" {
+		c.report(SeverityError, "", "%s must not be empty", IfaceFlag)
+	}
+	if data.LogLevel != "" {
+		if _, err := log.ParseLevel(data.LogLevel); err != nil {
+			c.report(SeverityError, "", "%s: %v", LogLevelFlag, err)
+		}
+	}
+	if data.LogFormat != "" {
+		if _, err := log.ParseFormat(data.LogFormat); err != nil {
+			c.report(SeverityError, "", "%s: %v", LogFormatFlag, err)
+		}
+	}
+	for _, name := range data.DebugSubsystems {
+		if _, err := log.ParseSubsystem(name); err != nil {
+			c.report(SeverityError, "", "%s: %v", DebugSubsystemsFlag, err)
+		}
+	}
+	for _, key := range data.BundleKeys {
+		if _, err := ParseBundleKey(key); err != nil {
+			c.report(SeverityError, "", "%s: %v", BundleKeysFlag, err)
+		}
+	}
+	if err := data.timing().Validate(); err != nil {
+		c.report(SeverityError, "", "%v", err)
+	}
+}
+
+// checkPeers validates each peer, returning the ones that are valid
+func (c *Checker) checkPeers(list []PeerData) Peers {
+	peers := make(Peers, len(list))
+	seen := make(map[wgtypes.Key]int, len(list))
+	for i, pd := range list {
+		key, peer, err := pd.Parse()
+		if err != nil {
+			c.report(SeverityError, "", "peer #%d (%s): %v", i+1, peerLabel(pd), err)
+			continue
+		}
+		if first, ok := seen[key]; ok {
+			c.report(SeverityError, "merge the entries into one",
+				"peer #%d (%s) has the same public key as peer #%d",
+				i+1, peerLabel(pd), first+1)
+		} else {
+			seen[key] = i
+		}
+		peers[key] = &peer
+	}
+
+	type peerAIP struct {
+		label string
+		aip   net.IPNet
+	}
+	var aips []peerAIP
+	for key, peer := range peers {
+		for _, aip := range peer.AllowedIPs {
+			aips = append(aips, peerAIP{peerLabel(PeerData{PublicKey: key.String(), Name: peer.Name}), aip})
+		}
+	}
+	// report overlaps in a consistent order
+	slices.SortFunc(aips, func(a, b peerAIP) int {
+		return strings.Compare(a.label+a.aip.String(), b.label+b.aip.String())
+	})
+	for i, a := range aips {
+		for _, b := range aips[i+1:] {
+			if a.label == b.label {
+				continue
+			}
+			aOnes, _ := a.aip.Mask.Size()
+			bOnes, _ := b.aip.Mask.Size()
+			switch {
+			case a.aip.String() == b.aip.String():
+				c.report(SeverityError, "remove it from all but one of them",
+					"AllowedIPs %s is on both %s and %s, wireguard only routes it to one of them",
+					a.aip.String(), a.label, b.label)
+			case aOnes < bOnes && a.aip.Contains(b.aip.IP), bOnes < aOnes && b.aip.Contains(a.aip.IP):
+				wide, narrow := a, b
+				if bOnes < aOnes {
+					wide, narrow = b, a
+				}
+				c.report(SeverityInfo, "this is expected if "+wide.label+" is a router",
+					"AllowedIPs %s on %s is inside %s on %s, traffic for it goes only to %s",
+					narrow.aip.String(), narrow.label, wide.aip.String(), wide.label, narrow.label)
+			}
+		}
+	}
+	return peers
+}
+
+// checkTrust looks for combinations of trust settings that don't work the way
+// they look like they should
+func (c *Checker) checkTrust(list []PeerData, peers Peers) {
+	var explicit []string
+	for _, pd := range list {
+		if pd.Trust != "" {
+			explicit = append(explicit, peerLabel(pd))
+		}
+		if pd.Basic && pd.Trust != "" {
+			c.report(SeverityWarning, "remove the Trust setting",
+				"%s is Basic, so it never sends facts, and its Trust has no effect", peerLabel(pd))
+		}
+		if pd.Basic && pd.FactExchanger {
+			c.report(SeverityWarning, "remove the FactExchanger setting",
+				"%s is Basic, so it can't exchange facts", peerLabel(pd))
+		}
+	}
+	if len(explicit) != 0 && !peers.AnyTrustedAt(trust.Membership) {
+		c.report(SeverityWarning,
+			"give the router(s) Trust: "+trust.Membership.String()+", or remove the Trust settings",
+			"Trust is set for %s, which disables trusting routers automatically, "+
+				"but no peer is trusted at %s, so no peer can add others to the network",
+			strings.Join(explicit, ", "), trust.Membership)
+	}
+}
+
+func (c *Checker) checkGlobs(setting string, globs, ifaceNames []string) {
+	for _, glob := range globs {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			c.report(SeverityError, "", "bad glob %q in %s: %v", glob, setting, err)
+			continue
+		}
+		if !slices.ContainsFunc(ifaceNames, func(name string) bool {
+			matched, _ := filepath.Match(glob, name)
+			return matched
+		}) {
+			c.report(SeverityWarning, "",
+				"%s glob %q matches no network interface on this host (%s)",
+				setting, glob, strings.Join(ifaceNames, ", "))
+		}
+	}
+}
+
+// checkEndpoints looks for endpoints that resolve to addresses that would be
+// reached via the tunnel itself, which wirelink never uses
+func (c *Checker) checkEndpoints(list []PeerData, tunnelNets, hostNets []net.IPNet) {
+	inAny := func(nets []net.IPNet, ip net.IP) *net.IPNet {
+		for i := range nets {
+			if nets[i].Contains(ip) {
+				return &nets[i]
+			}
+		}
+		return nil
+	}
+	for _, pd := range list {
+		for _, ep := range pd.Endpoints {
+			pe, err := ParseEndpoint(ep)
+			if err != nil {
+				// already reported
+				continue
+			}
+			ips, err := c.LookupIP(pe.Host)
+			if err != nil {
+				c.report(SeverityInfo, "", "endpoint %s of %s doesn't resolve: %v", ep, peerLabel(pd), err)
+				continue
+			}
+			for _, ip := range ips {
+				if tn := inAny(tunnelNets, ip); tn != nil && inAny(hostNets, ip) == nil {
+					c.report(SeverityWarning, "use an address that is reachable outside the tunnel",
+						"endpoint %s of %s resolves to %s, inside the tunnel subnet %s, so it will never be used",
+						ep, peerLabel(pd), ip, &net.IPNet{IP: tn.IP.Mask(tn.Mask), Mask: tn.Mask})
+				}
+			}
+		}
+	}
+}
+
+func peerLabel(pd PeerData) string {
+	if pd.Name != "" {
+		return fmt.Sprintf("%s (%s)", pd.Name, pd.PublicKey)
+	}
+	return pd.PublicKey
+}
+
+// settingNames lists the lower case names mapstructure accepts for the fields
+// of a struct type
+func settingNames(t reflect.Type) []string {
+	ret := make([]string, 0, t.NumField())
+	for f := range t.Fields() {
+		name := f.Tag.Get("mapstructure")
+		if name == "" {
+			name = f.Name
+		}
+		ret = append(ret, strings.ToLower(name))
+	}
+	return ret
+}
+
+// suggestSetting finds the known setting name the unknown one was most likely
+// meant to be, if any
+func suggestSetting(key string, known []string) string {
+	normalize := strings.NewReplacer("-", "", "_", "").Replace
+	key = normalize(strings.ToLower(key))
+	best, bestDist := "", 3
+	for _, k := range known {
+		if d := editDistance(key, normalize(k)); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance computes the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	netmocks "github.com/fastcat/wirelink/internal/networking/mocks"
+	"github.com/fastcat/wirelink/internal/testutils"
+)
+
+func TestChecker_Check(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	k3 := testutils.MustKey(t)
+
+	type want struct {
+		severity Severity
+		contains string
+	}
+	tests := []struct {
+		name    string
+		files   map[string]string
+		args    []string
+		want    []want
+		notWant []string
+	}{
+		{
+			"clean",
+			map[string]string{"yaml": `
+peers:
+  - publickey: ` + k1.String() + `
+    trust: Membership
+    endpoints: [192.0.2.1:51820]
+    allowedips: [10.0.0.0/24]
+reportifaces: [eth*]
+`},
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"no file",
+			nil,
+			nil,
+			[]want{{SeverityInfo, "no config file for wg0"}},
+			nil,
+		},
+		{
+			"unreadable file",
+			map[string]string{"json": "{"},
+			nil,
+			[]want{{SeverityError, "unable to read"}},
+			nil,
+		},
+		{
+			"two files",
+			map[string]string{"json": "{}", "yaml": "chatty: true\n"},
+			nil,
+			[]want{{SeverityWarning, "is ignored"}},
+			nil,
+		},
+		{
+			"unknown keys",
+			map[string]string{"yaml": `
+control_socket: /tmp/x
+bogus: 1
+peers:
+  - publickey: ` + k1.String() + `
+    allowedip: [10.0.0.1/32]
+`},
+			nil,
+			[]want{
+				{SeverityError, `unknown setting "control_socket"`},
+				{SeverityError, `unknown setting "bogus"`},
+				{SeverityError, `unknown setting "allowedip" in peer #1`},
+			},
+			[]string{"unable to decode"},
+		},
+		{
+			"ignored keys",
+			map[string]string{"yaml": "config-path: /etc\niface: wg1\nifaces: [wg1, wg2]\ndump: true\n"},
+			nil,
+			[]want{
+				{SeverityWarning, "config-path in the config file is ignored"},
+				{SeverityWarning, "iface in the config file overrides"},
+				{SeverityWarning, "ifaces in the config file is ignored"},
+				{SeverityWarning, "dump in the config file applies to every run"},
+			},
+			nil,
+		},
+		{
+			"bad settings",
+			map[string]string{"yaml": "log-level: loud\nbundle-keys: [nope]\nalive-period: 5m\npeers:\n  - publickey: nope\n"},
+			nil,
+			[]want{
+				{SeverityError, "log-level"},
+				{SeverityError, "bundle-keys"},
+				{SeverityError, "alive-period (5m0s) must be"},
+				{SeverityError, "peer #1 (nope)"},
+			},
+			nil,
+		},
+		{
+			"duplicates and overlaps",
+			map[string]string{"yaml": `
+peers:
+  - publickey: ` + k1.String() + `
+    name: one
+    allowedips: [10.0.0.0/24]
+  - publickey: ` + k2.String() + `
+    name: two
+    allowedips: [10.0.0.2/32, 10.1.0.0/24]
+  - publickey: ` + k3.String() + `
+    allowedips: [10.1.0.0/24]
+  - publickey: ` + k1.String() + `
+    name: one again
+    allowedips: [10.0.0.0/24]
+`},
+			nil,
+			[]want{
+				{SeverityError, "peer #4 (one again (" + k1.String() + ")) has the same public key as peer #1"},
+				{SeverityError, "AllowedIPs 10.1.0.0/24 is on both"},
+				{SeverityInfo, "AllowedIPs 10.0.0.2/32 on two"},
+			},
+			nil,
+		},
+		{
+			"peers dir",
+			map[string]string{"yaml": `
+peers-dir: nope.d
+peers:
+  - publickey: ` + k1.String() + `
+`},
+			nil,
+			[]want{{SeverityError, "peers-dir: unable to read peer directory"}},
+			nil,
+		},
+		{
+			"trust",
+			map[string]string{"yaml": `
+peers:
+  - publickey: ` + k1.String() + `
+    trust: AllowedIPs
+  - publickey: ` + k2.String() + `
+    basic: true
+    trust: Endpoint
+    factexchanger: true
+`},
+			nil,
+			[]want{
+				{SeverityWarning, "no peer is trusted at Membership"},
+				{SeverityWarning, "its Trust has no effect"},
+				{SeverityWarning, "can't exchange facts"},
+			},
+			nil,
+		},
+		{
+			"globs",
+			map[string]string{"yaml": "reportifaces: [wlan*, '[']\nhideifaces: [eth0]\n"},
+			nil,
+			[]want{
+				{SeverityWarning, `ReportIfaces glob "wlan*" matches no network interface`},
+				{SeverityError, `bad glob "["`},
+			},
+			[]string{"HideIfaces"},
+		},
+		{
+			"tunnel endpoints",
+			map[string]string{"yaml": `
+peers:
+  - publickey: ` + k1.String() + `
+    endpoints: [10.0.0.1:51820, 192.0.2.1:51820, 10.0.0.2:51820, unresolvable:1]
+`},
+			nil,
+			[]want{
+				{SeverityWarning, "endpoint 10.0.0.1:51820 of " + k1.String() + " resolves to 10.0.0.1, inside the tunnel subnet 10.0.0.0/24"},
+				{SeverityInfo, "endpoint unresolvable:1"},
+			},
+			[]string{"192.0.2.1", "10.0.0.2"},
+		},
+		{
+			"missing tunnel",
+			nil,
+			[]string{"--iface=wg9"},
+			[]want{{SeverityInfo, "interface wg9 not found"}},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("WIREVLINK_CONFIG_PATH", dir)
+			for ext, content := range tt.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "wirevlink.wg0."+ext), []byte(content), 0o600))
+			}
+			args := append([]string{"wirevlink"}, tt.args...)
+			flags, vcfg := Init(args)
+			flags.SetOutput(&strings.Builder{})
+			// parse errors are expected for some cases, the checker explains them
+			_, _ = Parse(flags, vcfg, args)
+
+			env := &netmocks.Environment{}
+			env.Test(t)
+			env.WithSimpleInterfaces(map[string]net.IPNet{
+				"wg0":  testutils.MakeIPv4Net(10, 0, 0, 1, 24),
+				"eth0": testutils.MakeIPv4Net(192, 168, 0, 2, 24),
+				// this overlaps the tunnel, so addresses in it aren't tunneled
+				"eth1": testutils.MakeIPv4Net(10, 0, 0, 2, 32),
+			})
+			env.WithKnownInterfaces()
+			ifaces, err := env.Interfaces()
+			require.NoError(t, err)
+
+			c := &Checker{
+				Interfaces: ifaces,
+				LookupIP: func(host string) ([]net.IP, error) {
+					if ip := net.ParseIP(host); ip != nil {
+						return []net.IP{ip}, nil
+					}
+					return nil, errors.New("no such host")
+				},
+			}
+			got := c.Check(vcfg)
+			for _, w := range tt.want {
+				assert.True(t, hasDiagnostic(got, w.severity, w.contains), "missing %s %q in %v", w.severity, w.contains, got)
+			}
+			for _, nw := range tt.notWant {
+				for _, d := range got {
+					assert.NotContains(t, d.Message, nw)
+				}
+			}
+			if tt.want == nil {
+				assert.Empty(t, got)
+			}
+		})
+	}
+}
+
+func hasDiagnostic(diags []Diagnostic, severity Severity, contains string) bool {
+	for _, d := range diags {
+		if d.Severity == severity && strings.Contains(d.Message, contains) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSuggestSetting(t *testing.T) {
+	known := []string{"control-socket", "reportifaces", "peers", "publickey"}
+	assert.Equal(t, "control-socket", suggestSetting("control_socket", known))
+	assert.Equal(t, "reportifaces", suggestSetting("ReportIface", known))
+	assert.Equal(t, "peers", suggestSetting("peer", known))
+	assert.Equal(t, "", suggestSetting("bogus", known))
+}
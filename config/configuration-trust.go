@@ -50,7 +50,7 @@ func (c *configEvaluator) TrustLevel(_ *fact.Fact, source net.UDPAddr) *trust.Le
 	pk, ok := c.ipToPeer[util.IPToBytes(source.IP)]
 	if !ok {
 		// having valid peers in the config is fine
-		log.Debug("No configured peer found for source: %v", source)
+		log.Trust.Debug("No configured peer found for source: %v", source)
 		return nil
 	}
 	pc, ok := c.Peers[pk]
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/fastcat/wirelink/fact"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// GenerateFromFacts makes config entries for every peer the facts say is a
+// member of the network, with its name and basic flag from its metadata, and
+// the allowed IPs and endpoints known for it. Trust is never set, as facts
+// don't carry that.
+func GenerateFromFacts(facts []*fact.Fact) *FileData {
+	peers := make(map[wgtypes.Key]*PeerData)
+	members := make(map[wgtypes.Key]bool)
+	for _, f := range facts {
+		ps, ok := f.Subject.(*fact.PeerSubject)
+		if !ok {
+			continue
+		}
+		pd, ok := peers[ps.Key]
+		if !ok {
+			pd = &PeerData{PublicKey: ps.Key.String()}
+			peers[ps.Key] = pd
+		}
+		switch f.Attribute {
+		case fact.AttributeMember:
+			members[ps.Key] = true
+		case fact.AttributeMemberMetadata:
+			members[ps.Key] = true
+			f.Value.(*fact.MemberMetadata).ForEach(func(a fact.MemberAttribute, v string) {
+				switch a {
+				case fact.MemberName:
+					if v != "" {
+						pd.Name = v
+					}
+				case fact.MemberIsBasic:
+					pd.Basic = len(v) != 0 && v[0] != 0
+				}
+			})
+		case fact.AttributeAllowedCidrV4, fact.AttributeAllowedCidrV6:
+			pd.AllowedIPs = appendUnique(pd.AllowedIPs, f.Value.String())
+		case fact.AttributeEndpointV4, fact.AttributeEndpointV6:
+			// IPPortValue.String doesn't bracket IPv6 addresses
+			ipp := f.Value.(*fact.IPPortValue)
+			pd.Endpoints = appendUnique(pd.Endpoints, net.JoinHostPort(ipp.IP.String(), strconv.Itoa(ipp.Port)))
+		}
+	}
+
+	ret := &FileData{Peers: make([]PeerData, 0, len(members))}
+	for k, pd := range peers {
+		if !members[k] {
+			continue
+		}
+		slices.Sort(pd.AllowedIPs)
+		slices.Sort(pd.Endpoints)
+		ret.Peers = append(ret.Peers, *pd)
+	}
+	slices.SortFunc(ret.Peers, func(a, b PeerData) int {
+		return strings.Compare(a.PublicKey, b.PublicKey)
+	})
+	return ret
+}
+
+func appendUnique(list []string, value string) []string {
+	if slices.Contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
+
+// MergeFile merges the peers from data into the content of an existing config
+// file. Settings other than peers are left alone. Peers already in the file
+// keep their settings, and only gain a name if they have none, and any
+// endpoints and allowed IPs they don't yet list. New peers are appended.
+// Formatting and comments in the existing content are not preserved.
+func MergeFile(content []byte, format string, data *FileData) ([]byte, error) {
+	return mergeFile(content, format, data, nil)
+}
+
+// MergeBundleFile is like MergeFile, but for peers from a verified bundle,
+// whose signer decides how they are trusted: the bundle's Trust (if set) and
+// Basic settings replace those of peers already in the file. As that can
+// restore trust that was since revoked, the bundle must be newer than the last
+// one merged into the file, whose creation time is recorded in it.
+func MergeBundleFile(content []byte, format string, data *BundleData) ([]byte, error) {
+	if data.Created.IsZero() {
+		return nil, errors.New("bundle has no creation time")
+	}
+	return mergeFile(content, format, &FileData{Peers: data.Peers}, func(doc map[string]any) error {
+		key := findKey(doc, BundleCreatedFlag)
+		if v, ok := doc[key]; ok && v != nil {
+			last, err := parseBundleCreated(v)
+			if err != nil {
+				return fmt.Errorf("existing config has an invalid %s setting: %w", key, err)
+			}
+			if !data.Created.After(last) {
+				return fmt.Errorf("bundle created %s is not newer than the last one imported, created %s",
+					data.Created.Format(time.RFC3339), last.Format(time.RFC3339))
+			}
+		}
+		doc[key] = data.Created.UTC().Format(time.RFC3339Nano)
+		return nil
+	})
+}
+
+func parseBundleCreated(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		// yaml decodes unquoted timestamps
+		return v, nil
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	default:
+		return time.Time{}, fmt.Errorf("not a timestamp: %v", v)
+	}
+}
+
+// mergeFile merges the peers into the existing content. If fromBundle is not
+// nil, the peers are from a verified bundle, and it is called to check and
+// update the rest of the document before the peers are merged.
+func mergeFile(content []byte, format string, data *FileData, fromBundle func(map[string]any) error) ([]byte, error) {
+	doc := map[string]any{}
+	var err error
+	switch format {
+	case FileFormatJSON:
+		if len(bytes.TrimSpace(content)) != 0 {
+			err = json.Unmarshal(content, &doc)
+		}
+	case FileFormatYAML:
+		err = yaml.Unmarshal(content, &doc)
+	default:
+		return nil, fmt.Errorf("unknown config file format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse existing config: %w", err)
+	} else if doc == nil {
+		// yaml gives us this for an empty file
+		doc = map[string]any{}
+	}
+
+	if fromBundle != nil {
+		if err = fromBundle(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	peersKey := findKey(doc, "Peers")
+	var peers []any
+	if v, ok := doc[peersKey]; ok && v != nil {
+		if peers, ok = v.([]any); !ok {
+			return nil, fmt.Errorf("existing config has a non-list %s setting", peersKey)
+		}
+	}
+	for _, pd := range data.Peers {
+		existing, err := findPeer(peers, pd.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			// round trip through JSON to get the same keys & omissions we use when
+			// writing whole files
+			var m map[string]any
+			if err = roundTrip(&pd, &m); err != nil {
+				return nil, err
+			}
+			peers = append(peers, m)
+			continue
+		}
+		if nameKey := findKey(existing, "Name"); existing[nameKey] == nil || existing[nameKey] == "" {
+			if pd.Name != "" {
+				existing[nameKey] = pd.Name
+			}
+		}
+		if fromBundle != nil {
+			if pd.Trust != "" {
+				existing[findKey(existing, "Trust")] = pd.Trust
+			}
+			if basicKey := findKey(existing, "Basic"); pd.Basic {
+				existing[basicKey] = true
+			} else {
+				delete(existing, basicKey)
+			}
+		}
+		if err = mergeList(existing, "Endpoints", pd.Endpoints); err != nil {
+			return nil, err
+		}
+		if err = mergeList(existing, "AllowedIPs", pd.AllowedIPs); err != nil {
+			return nil, err
+		}
+	}
+	doc[peersKey] = peers
+
+	var buf bytes.Buffer
+	switch format {
+	case FileFormatJSON:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(doc)
+	case FileFormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err = enc.Encode(doc); err == nil {
+			err = enc.Close()
+		}
+	}
+	return buf.Bytes(), err
+}
+
+// findKey finds the key in the map that viper would match to the given name,
+// which is case insensitive, or returns the name if it is not present
+func findKey(m map[string]any, name string) string {
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
+
+func findPeer(peers []any, publicKey string) (map[string]any, error) {
+	for i, p := range peers {
+		m, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("existing config peer %d is not an object", i+1)
+		}
+		if m[findKey(m, "PublicKey")] == publicKey {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+func mergeList(m map[string]any, name string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	key := findKey(m, name)
+	var list []any
+	if v, ok := m[key]; ok && v != nil {
+		if list, ok = v.([]any); !ok {
+			return fmt.Errorf("existing config has a non-list %s setting", key)
+		}
+	}
+	for _, v := range values {
+		if !slices.Contains(list, any(v)) {
+			list = append(list, v)
+		}
+	}
+	m[key] = list
+	return nil
+}
+
+func roundTrip(in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/internal/testutils/facts"
+)
+
+func TestGenerateFromFacts(t *testing.T) {
+	expires := time.Now().Add(time.Minute)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	nonMember := testutils.MustKey(t)
+	ep1 := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51820}
+	ep2 := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51820}
+	aip := net.IPNet{IP: net.IPv4(10, 0, 0, 1).To4(), Mask: net.CIDRMask(32, 32)}
+
+	got := GenerateFromFacts([]*fact.Fact{
+		facts.MemberMetadataFactFull(&k1, expires, "one", true),
+		facts.EndpointFactFull(ep2, &k1, expires),
+		facts.EndpointFactFull(ep1, &k1, expires),
+		facts.AllowedIPFactFull(aip, &k1, expires),
+		facts.AllowedIPFactFull(aip, &k1, expires),
+		facts.MemberFactFull(&k2, expires),
+		facts.EndpointFactFull(ep1, &nonMember, expires),
+		facts.AliveFact(&k2, expires),
+	})
+
+	want := []PeerData{
+		{
+			PublicKey:  k1.String(),
+			Name:       "one",
+			Basic:      true,
+			Endpoints:  []string{ep1.String(), ep2.String()},
+			AllowedIPs: []string{"10.0.0.1/32"},
+		},
+		{PublicKey: k2.String()},
+	}
+	if want[0].PublicKey > want[1].PublicKey {
+		want[0], want[1] = want[1], want[0]
+	}
+	assert.Equal(t, &FileData{Peers: want}, got)
+}
+
+func TestMergeFile(t *testing.T) {
+	data := &FileData{Peers: []PeerData{
+		{
+			PublicKey:  "key1",
+			Name:       "learned",
+			Endpoints:  []string{"192.0.2.1:1", "192.0.2.2:1"},
+			AllowedIPs: []string{"10.0.0.1/32"},
+		},
+		{PublicKey: "key2", Name: "two", AllowedIPs: []string{"10.0.0.2/32"}},
+	}}
+
+	tests := []struct {
+		name      string
+		content   string
+		format    string
+		want      string
+		assertion require.ErrorAssertionFunc
+	}{
+		{
+			"json",
+			`{
+				"router": true,
+				"peers": [{
+					"publickey": "key1",
+					"trust": "Membership",
+					"factexchanger": true,
+					"endpoints": ["192.0.2.1:1"]
+				}]
+			}`,
+			FileFormatJSON,
+			`{
+				"router": true,
+				"peers": [
+					{
+						"publickey": "key1",
+						"Name": "learned",
+						"trust": "Membership",
+						"factexchanger": true,
+						"endpoints": ["192.0.2.1:1", "192.0.2.2:1"],
+						"AllowedIPs": ["10.0.0.1/32"]
+					},
+					{"PublicKey": "key2", "Name": "two", "AllowedIPs": ["10.0.0.2/32"]}
+				]
+			}`,
+			require.NoError,
+		},
+		{
+			"keeps name",
+			`{"Peers": [{"PublicKey": "key1", "Name": "mine"}]}`,
+			FileFormatJSON,
+			`{"Peers": [
+				{"PublicKey": "key1", "Name": "mine", "Endpoints": ["192.0.2.1:1", "192.0.2.2:1"], "AllowedIPs": ["10.0.0.1/32"]},
+				{"PublicKey": "key2", "Name": "two", "AllowedIPs": ["10.0.0.2/32"]}
+			]}`,
+			require.NoError,
+		},
+		{
+			"empty json",
+			"",
+			FileFormatJSON,
+			`{"Peers": [
+				{"PublicKey": "key1", "Name": "learned", "Endpoints": ["192.0.2.1:1", "192.0.2.2:1"], "AllowedIPs": ["10.0.0.1/32"]},
+				{"PublicKey": "key2", "Name": "two", "AllowedIPs": ["10.0.0.2/32"]}
+			]}`,
+			require.NoError,
+		},
+		{
+			"yaml",
+			"Chatty: true\nPeers:\n  - PublicKey: key2\n    Trust: AllowedIPs\n    Basic: true\n",
+			FileFormatYAML,
+			`{
+				"Chatty": true,
+				"Peers": [
+					{"PublicKey": "key2", "Name": "two", "Trust": "AllowedIPs", "Basic": true, "AllowedIPs": ["10.0.0.2/32"]},
+					{"PublicKey": "key1", "Name": "learned", "Endpoints": ["192.0.2.1:1", "192.0.2.2:1"], "AllowedIPs": ["10.0.0.1/32"]}
+				]
+			}`,
+			require.NoError,
+		},
+		{"empty yaml", "", FileFormatYAML, "", require.NoError},
+		{"bad json", "{", FileFormatJSON, "", require.Error},
+		{"peers not a list", `{"Peers": 1}`, FileFormatJSON, "", require.Error},
+		{"peer not an object", `{"Peers": [1]}`, FileFormatJSON, "", require.Error},
+		{"endpoints not a list", `{"Peers": [{"PublicKey": "key1", "Endpoints": "x"}]}`, FileFormatJSON, "", require.Error},
+		{"bad format", "", "toml", "", require.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergeFile([]byte(tt.content), tt.format, data)
+			tt.assertion(t, err)
+			if err != nil || tt.want == "" {
+				return
+			}
+			if tt.format == FileFormatYAML {
+				// compare as JSON to not depend on the YAML encoder's layout
+				var doc map[string]any
+				require.NoError(t, yaml.Unmarshal(got, &doc))
+				got, err = json.Marshal(doc)
+				require.NoError(t, err)
+			}
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestMergeBundleFile(t *testing.T) {
+	data := &FileData{Peers: []PeerData{
+		{PublicKey: "key1", Name: "router", Trust: "Membership", AllowedIPs: []string{"10.0.0.1/32"}},
+		{PublicKey: "key2", Name: "phone", Basic: true},
+		{PublicKey: "key3", Name: "leaf"},
+	}}
+	content := `{"Peers": [
+		{"PublicKey": "key1", "Name": "mine", "Trust": "AllowedIPs", "Basic": true, "FactExchanger": true},
+		{"PublicKey": "key2"},
+		{"PublicKey": "key3", "trust": "Endpoint"}
+	]}`
+
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	bundle := &BundleData{Created: created, Peers: data.Peers}
+
+	got, err := MergeBundleFile([]byte(content), FileFormatJSON, bundle)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bundle-created": "2026-01-02T03:04:05Z", "Peers": [
+		{"PublicKey": "key1", "Name": "mine", "Trust": "Membership", "FactExchanger": true, "AllowedIPs": ["10.0.0.1/32"]},
+		{"PublicKey": "key2", "Name": "phone", "Basic": true},
+		{"PublicKey": "key3", "Name": "leaf", "trust": "Endpoint"}
+	]}`, string(got))
+
+	// the same or an older bundle can't be replayed over it
+	_, err = MergeBundleFile(got, FileFormatJSON, bundle)
+	assert.ErrorContains(t, err, "not newer")
+	_, err = MergeBundleFile(got, FileFormatJSON, &BundleData{Created: created.Add(-time.Hour), Peers: data.Peers})
+	assert.ErrorContains(t, err, "not newer")
+	// but a newer one can
+	got, err = MergeBundleFile(got, FileFormatJSON, &BundleData{Created: created.Add(time.Hour), Peers: data.Peers})
+	require.NoError(t, err)
+	assert.Contains(t, string(got), `"bundle-created": "2026-01-02T04:04:05Z"`)
+
+	_, err = MergeBundleFile([]byte(content), FileFormatJSON, &BundleData{Peers: data.Peers})
+	assert.ErrorContains(t, err, "no creation time")
+	_, err = MergeBundleFile([]byte(`{"bundle-created": "yesterday"}`), FileFormatJSON, bundle)
+	assert.ErrorContains(t, err, "invalid bundle-created")
+
+	// yaml works the same, however the timestamp is written
+	got, err = MergeBundleFile([]byte("Peers: []\n"), FileFormatYAML, bundle)
+	require.NoError(t, err)
+	_, err = MergeBundleFile(got, FileFormatYAML, bundle)
+	assert.ErrorContains(t, err, "not newer")
+	_, err = MergeBundleFile([]byte("bundle-created: 2026-01-02T03:04:05Z\n"), FileFormatYAML, bundle)
+	assert.ErrorContains(t, err, "not newer")
+
+	// plain merges leave the existing settings alone
+	got, err = MergeFile([]byte(content), FileFormatJSON, data)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Peers": [
+		{"PublicKey": "key1", "Name": "mine", "Trust": "AllowedIPs", "Basic": true, "FactExchanger": true, "AllowedIPs": ["10.0.0.1/32"]},
+		{"PublicKey": "key2", "Name": "phone"},
+		{"PublicKey": "key3", "Name": "leaf", "trust": "Endpoint"}
+	]}`, string(got))
+}
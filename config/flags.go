@@ -18,6 +18,10 @@ const (
 	RouterFlag = "router"
 	// IfaceFlag is the name of the flag to set the wireguard interface to use
 	IfaceFlag = "iface"
+	// IfacesFlag is the name of the flag to run one server for each of several
+	// wireguard interfaces in a single process. It is only read from flags and
+	// the environment, as each interface has its own config file.
+	IfacesFlag = "ifaces"
 	// PortFlag is the name of the flag to set the UDP port to listen on inside
 	// the interface for exchanging facts with peers. If unset, it will default to
 	// one more than the port on which the wireguard interface is listening.
@@ -32,8 +36,63 @@ const (
 	ConfigPathFlag = "config-path"
 	// DebugFlag enables debug logging
 	DebugFlag = "debug"
+	// LogLevelFlag is the name of the setting for the minimum level of log
+	// messages to print. DebugFlag overrides this.
+	LogLevelFlag = "log-level"
+	// LogFormatFlag is the name of the setting for how log messages are
+	// written: text, json, or journald
+	LogFormatFlag = "log-format"
+	// DebugSubsystemsFlag is the name of the setting for which subsystems should
+	// log debug messages regardless of the log level
+	DebugSubsystemsFlag = "debug-subsystems"
 	// ChattyFlag is the name of the setting to enable chatty mode
 	ChattyFlag = "chatty"
+	// InterestFlag is the name of the setting to tell routers which peers we
+	// want facts about, instead of getting facts about every peer
+	InterestFlag = "interest"
+	// InterestPeersFlag is the name of the setting for the public keys of peers
+	// we want facts about, in addition to configured peers and ones we have
+	// tried to reach, when InterestFlag is set
+	InterestPeersFlag = "interest-peers"
+	// ControlSocketFlag is the name of the setting for the path of the local
+	// control socket. If unset, a default path based on the interface name will
+	// be used. If set to the empty string, the control socket will be disabled.
+	ControlSocketFlag = "control-socket"
+	// MetricsAddressFlag is the name of the setting for the local address on
+	// which to export Prometheus metrics. If unset, metrics are not exported.
+	MetricsAddressFlag = "metrics-address"
+	// DNSAddressFlag is the name of the setting for the address on which to
+	// answer DNS queries for peer names. If unset, no DNS queries are answered.
+	DNSAddressFlag = "dns-address"
+	// HostsFileFlag is the name of the setting for the path of a hosts file in
+	// which to keep entries for peer names. If unset, no hosts file is updated.
+	HostsFileFlag = "hosts-file"
+	// BundleKeysFlag is the name of the setting for the Ed25519 public keys
+	// trusted to sign config bundles for `config import`
+	BundleKeysFlag = "bundle-keys"
+	// BundleCreatedFlag is the name of the setting recording when the last
+	// bundle imported into a config was signed, so that older bundles can't be
+	// replayed. It is maintained by `config import`, not set by hand.
+	BundleCreatedFlag = "bundle-created"
+	// PeersDirFlag is the name of the setting for a directory of additional
+	// peer config files, one per peer. Relative paths are relative to the config
+	// path.
+	PeersDirFlag = "peers-dir"
+	// FactTTLFlag is the name of the setting for the TTL of locally generated
+	// short-lived facts, such as endpoints and alive facts
+	FactTTLFlag = "fact-ttl"
+	// LongFactTTLFlag is the name of the setting for the TTL of locally
+	// generated long-lived facts, such as membership and allowed IPs
+	LongFactTTLFlag = "long-fact-ttl"
+	// ChunkPeriodFlag is the name of the setting for the max time between
+	// processing chunks of received packets
+	ChunkPeriodFlag = "chunk-period"
+	// AlivePeriodFlag is the name of the setting for how often alive facts are
+	// sent to peers
+	AlivePeriodFlag = "alive-period"
+	// MaxChunkFlag is the name of the setting for the max number of packets to
+	// receive before processing them
+	MaxChunkFlag = "max-chunk"
 )
 
 func programName(args []string) string {
@@ -49,6 +108,12 @@ func programName(args []string) string {
 	return base
 }
 
+// FileBaseName is the name of the config file for the interface, without the
+// extension
+func FileBaseName(args []string, iface string) string {
+	return fmt.Sprintf("%s.%s", programName(args), iface)
+}
+
 func programInfo(args []string) string {
 	return fmt.Sprintf("%s (%s)", programName(args), internal.Version)
 }
@@ -74,6 +139,9 @@ func Init(args []string) (flags *pflag.FlagSet, vcfg *viper.Viper) {
 	vcfg.SetDefault(IfaceFlag, "wg0")
 	flags.StringP(IfaceFlag, "i", "wg0", "Interface on which to operate")
 
+	// no default for ifaces, so the dump output stays clean
+	flags.StringSlice(IfacesFlag, nil, "Interfaces on which to operate, each with its own config file (overrides --iface)")
+
 	vcfg.SetDefault(DumpConfigFlag, false)
 	flags.Bool(DumpConfigFlag, false, "Dump configuration instead of running")
 
@@ -89,9 +157,43 @@ func Init(args []string) (flags *pflag.FlagSet, vcfg *viper.Viper) {
 	vcfg.SetDefault(DebugFlag, false)
 	flags.BoolP(DebugFlag, "d", false, "Enable debug logging output")
 
+	// no defaults for these, so the dump output stays clean
+	flags.String(LogLevelFlag, "", "Minimum log level (debug, info, error)")
+	flags.String(LogFormatFlag, "", "Log output format ("+strings.Join(formatNames(), ", ")+", default text)")
+	flags.StringSlice(DebugSubsystemsFlag, nil, "Subsystems for which to log debug messages ("+strings.Join(subsystemNames(), ", ")+")")
+
 	vcfg.SetDefault(ChattyFlag, false)
 	flags.Bool(ChattyFlag, false, "Enable chatty mode (for fact exchangers)")
 
+	// no defaults for interest settings, so the dump output stays clean
+	flags.Bool(InterestFlag, false, "Only ask routers for facts about peers we want to talk to (for leaves)")
+	flags.StringSlice(InterestPeersFlag, nil, "Public keys of additional peers to ask routers for facts about (with --"+InterestFlag+")")
+
+	// no default for control-socket, so we can tell if it was set to empty
+	flags.String(ControlSocketFlag, "", "Path for the local control socket (default "+DefaultControlSocket("<iface>")+")")
+
+	// no default for metrics-address, so the dump output stays clean
+	flags.String(MetricsAddressFlag, "", "Local address (host:port) on which to export Prometheus metrics (default disabled)")
+
+	// no default for dns-address, so the dump output stays clean
+	flags.String(DNSAddressFlag, "", "Local or tunnel address (host:port) on which to answer DNS queries for peer names (default disabled)")
+
+	// no default for hosts-file, so the dump output stays clean
+	flags.String(HostsFileFlag, "", "Hosts file (e.g. /etc/hosts) in which to keep entries for peer names (default disabled)")
+
+	// no default for peers-dir, so the dump output stays clean
+	flags.String(PeersDirFlag, "", "Directory of additional config files with one peer each")
+
+	// no defaults for the timing, so the dump output stays clean
+	flags.Duration(FactTTLFlag, 0, "TTL of short-lived facts like endpoints (default "+DefaultFactTTL.String()+")")
+	flags.Duration(LongFactTTLFlag, 0, "TTL of long-lived facts like membership and allowed IPs (default "+DefaultLongFactTTL.String()+", or "+FactTTLFlag+" if longer)")
+	flags.Duration(ChunkPeriodFlag, 0, "Max time between processing received packets (default "+DefaultChunkPeriod.String()+")")
+	flags.Duration(AlivePeriodFlag, 0, "How often to tell peers we are alive (default "+DefaultAlivePeriod.String()+")")
+	flags.Int(MaxChunkFlag, 0, fmt.Sprintf("Max packets to receive before processing them (default %d)", DefaultMaxChunk))
+
+	// no default for bundle-keys, so the dump output stays clean
+	flags.StringSlice(BundleKeysFlag, nil, "Public keys trusted to sign config bundles (from config sign --show-key)")
+
 	err := vcfg.BindPFlags(flags)
 	// this should never happen, flags are constant
 	if err != nil {
@@ -129,10 +231,17 @@ func Parse(flags *pflag.FlagSet, vcfg *viper.Viper, args []string) (ret *ServerD
 		return nil, err
 	}
 
+	// the config file is per-interface, so it doesn't get a say in which
+	// interfaces to run
+	var ifaces []string
+	if err = vcfg.UnmarshalKey(IfacesFlag, &ifaces); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", IfacesFlag, err)
+	}
+
 	// setup the config file -- can't do this until after we've parsed the iface flag
 	// in theory the config file can override the iface, but ... that would be bad
 	// this needs to happen _before_ the `router` processing since the config may set that
-	vcfg.SetConfigName(fmt.Sprintf("%s.%s", programName(args), vcfg.GetString(IfaceFlag)))
+	vcfg.SetConfigName(FileBaseName(args, vcfg.GetString(IfaceFlag)))
 	// this is perversely recursive
 	vcfg.AddConfigPath(vcfg.GetString(ConfigPathFlag))
 
@@ -156,6 +265,38 @@ func Parse(flags *pflag.FlagSet, vcfg *viper.Viper, args []string) (ret *ServerD
 	if !vcfg.IsSet(RouterFlag) {
 		ret.Router = nil
 	}
+	if !vcfg.IsSet(ControlSocketFlag) {
+		ret.ControlSocket = nil
+	}
+	if len(ret.DebugSubsystems) == 0 {
+		ret.DebugSubsystems = nil
+	}
+	if len(ret.BundleKeys) == 0 {
+		ret.BundleKeys = nil
+	}
+	if len(ret.InterestPeers) == 0 {
+		ret.InterestPeers = nil
+	}
+	ret.Ifaces = nil
+	if len(ifaces) != 0 {
+		ret.Ifaces = ifaces
+	}
 
 	return ret, err
 }
+
+func formatNames() []string {
+	ret := make([]string, len(log.Formats))
+	for i, f := range log.Formats {
+		ret[i] = string(f)
+	}
+	return ret
+}
+
+func subsystemNames() []string {
+	ret := make([]string, len(log.Subsystems))
+	for i, s := range log.Subsystems {
+		ret[i] = string(s)
+	}
+	return ret
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fastcat/wirelink/internal"
 	"github.com/fastcat/wirelink/internal/testutils"
@@ -94,6 +95,101 @@ func TestParse(t *testing.T) {
 			nil,
 			require.NoError,
 		},
+		{
+			"log settings",
+			[]string{"--log-level=error", "--log-format=json", "--debug-subsystems=trust,endpoint"},
+			nil,
+			&ServerData{Iface: "wg0", LogLevel: "error", LogFormat: "json", DebugSubsystems: []string{"trust", "endpoint"}},
+			nil,
+			require.NoError,
+		},
+		{
+			"metrics address",
+			[]string{"--metrics-address=127.0.0.1:9100"},
+			nil,
+			&ServerData{Iface: "wg0", MetricsAddress: "127.0.0.1:9100"},
+			nil,
+			require.NoError,
+		},
+		{
+			"dns address",
+			[]string{"--dns-address=127.0.0.53:53"},
+			nil,
+			&ServerData{Iface: "wg0", DNSAddress: "127.0.0.53:53"},
+			nil,
+			require.NoError,
+		},
+		{
+			"hosts file",
+			[]string{"--hosts-file=/etc/hosts"},
+			nil,
+			&ServerData{Iface: "wg0", HostsFile: "/etc/hosts"},
+			nil,
+			require.NoError,
+		},
+		{
+			"interest",
+			[]string{"--interest", "--interest-peers=a,b"},
+			nil,
+			&ServerData{Iface: "wg0", Interest: true, InterestPeers: []string{"a", "b"}},
+			nil,
+			require.NoError,
+		},
+		{
+			"bundle keys",
+			[]string{"--bundle-keys=a,b"},
+			nil,
+			&ServerData{Iface: "wg0", BundleKeys: []string{"a", "b"}},
+			nil,
+			require.NoError,
+		},
+		{
+			"ifaces",
+			[]string{"--ifaces=wg0,wg1"},
+			nil,
+			&ServerData{Iface: "wg0", Ifaces: []string{"wg0", "wg1"}},
+			nil,
+			require.NoError,
+		},
+		{
+			"env ifaces",
+			nil,
+			[][]string{envArg("ifaces", "wg1,wg2")},
+			&ServerData{Iface: "wg0", Ifaces: []string{"wg1", "wg2"}},
+			nil,
+			require.NoError,
+		},
+		{
+			"timing",
+			[]string{"--fact-ttl=2m", "--long-fact-ttl=1h", "--chunk-period=10s", "--alive-period=1m", "--max-chunk=50"},
+			nil,
+			&ServerData{
+				Iface:       "wg0",
+				FactTTL:     2 * time.Minute,
+				LongFactTTL: time.Hour,
+				ChunkPeriod: 10 * time.Second,
+				AlivePeriod: time.Minute,
+				MaxChunk:    50,
+			},
+			nil,
+			require.NoError,
+		},
+		{
+			"env timing",
+			nil,
+			[][]string{envArg("fact_ttl", "100s"), envArg("max_chunk", "10")},
+			&ServerData{Iface: "wg0", FactTTL: 100 * time.Second, MaxChunk: 10},
+			nil,
+			require.NoError,
+		},
+		{
+			"env debug subsystems",
+			nil,
+			[][]string{envArg("debug_subsystems", "packet,peerknowledge")},
+			&ServerData{Iface: "wg0", DebugSubsystems: []string{"packet", "peerknowledge"}},
+			nil,
+			require.NoError,
+		},
 		{
 			"router=false",
 			[]string{"--router=false"},
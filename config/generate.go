@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/fastcat/wirelink/detect"
+	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// FileData is the portion of a config file that wirelink can generate
+type FileData struct {
+	Chatty bool       `json:"Chatty,omitempty" yaml:"Chatty,omitempty"`
+	Peers  []PeerData `json:"Peers" yaml:"Peers"`
+}
+
+// Formats in which FileData can be written
+const (
+	FileFormatJSON = "json"
+	FileFormatYAML = "yaml"
+)
+
+// FileFormatForPath picks the file format to use based on the extension of the
+// path, defaulting to JSON
+func FileFormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FileFormatYAML
+	default:
+		return FileFormatJSON
+	}
+}
+
+// Write serializes the data in the given format
+func (d *FileData) Write(w io.Writer, format string) error {
+	switch format {
+	case FileFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case FileFormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown config file format %q", format)
+	}
+}
+
+// LoadFile reads the peers from a config file, in any format viper supports
+func LoadFile(path string) (*FileData, error) {
+	vcfg := viper.New()
+	vcfg.SetConfigFile(path)
+	if err := vcfg.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	ret := &FileData{Chatty: vcfg.GetBool(ChattyFlag)}
+	if err := vcfg.UnmarshalKey("peers", &ret.Peers); err != nil {
+		return nil, fmt.Errorf("unable to parse peers from %s: %w", path, err)
+	}
+	return ret, nil
+}
+
+// GeneratePeerData makes a config entry for a wireguard peer, suggesting
+// Membership trust for peers that look like routers
+func GeneratePeerData(peer *wgtypes.Peer, name string) PeerData {
+	ret := PeerData{
+		PublicKey: peer.PublicKey.String(),
+		Name:      name,
+	}
+	if peer.Endpoint != nil {
+		ret.Endpoints = []string{peer.Endpoint.String()}
+	}
+	for _, aip := range peer.AllowedIPs {
+		ret.AllowedIPs = append(ret.AllowedIPs, aip.String())
+	}
+	if detect.IsPeerRouter(peer) {
+		ret.Trust = trust.Membership.String()
+	}
+	return ret
+}
+
+// GenerateFromDevice makes config entries for all the peers of a live
+// wireguard device. The device has no names for its peers, so none are set.
+func GenerateFromDevice(dev *wgtypes.Device) *FileData {
+	ret := &FileData{Peers: make([]PeerData, 0, len(dev.Peers))}
+	for i := range dev.Peers {
+		ret.Peers = append(ret.Peers, GeneratePeerData(&dev.Peers[i], ""))
+	}
+	return ret
+}
+
+// GenerateFromWgQuick makes config entries for all the peers of a wg-quick
+// config. Endpoints and AllowedIPs are kept as written, as the former may be
+// hostnames, and the latter may use the host bits as documentation.
+func GenerateFromWgQuick(q *WgQuick) (*FileData, error) {
+	ret := &FileData{Peers: make([]PeerData, 0, len(q.Peers))}
+	for _, qp := range q.Peers {
+		var peer wgtypes.Peer
+		var err error
+		if peer.PublicKey, err = wgtypes.ParseKey(qp.PublicKey); err != nil {
+			return nil, fmt.Errorf("bad PublicKey %q: %w", qp.PublicKey, err)
+		}
+		for _, aip := range qp.AllowedIPs {
+			_, ipn, err := net.ParseCIDR(aip)
+			if err != nil {
+				return nil, fmt.Errorf("bad AllowedIP %q for %q: %w", aip, qp.PublicKey, err)
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, *ipn)
+		}
+		pd := GeneratePeerData(&peer, qp.Name)
+		pd.AllowedIPs = qp.AllowedIPs
+		if qp.Endpoint != "" {
+			pd.Endpoints = []string{qp.Endpoint}
+		}
+		ret.Peers = append(ret.Peers, pd)
+	}
+	return ret, nil
+}
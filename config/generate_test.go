@@ -0,0 +1,132 @@
+package config
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestGenerateFromDevice(t *testing.T) {
+	routerKey := testutils.MustKey(t)
+	leafKey := testutils.MustKey(t)
+	dev := &wgtypes.Device{Peers: []wgtypes.Peer{
+		{
+			PublicKey:  routerKey,
+			Endpoint:   &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 51820},
+			AllowedIPs: []net.IPNet{{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(24, 32)}},
+		},
+		{
+			PublicKey:  leafKey,
+			AllowedIPs: []net.IPNet{{IP: net.IPv4(10, 0, 0, 2).To4(), Mask: net.CIDRMask(32, 32)}},
+		},
+	}}
+
+	got := GenerateFromDevice(dev)
+	assert.Equal(t, &FileData{Peers: []PeerData{
+		{
+			PublicKey:  routerKey.String(),
+			Trust:      trust.Membership.String(),
+			Endpoints:  []string{"192.0.2.1:51820"},
+			AllowedIPs: []string{"10.0.0.0/24"},
+		},
+		{
+			PublicKey:  leafKey.String(),
+			AllowedIPs: []string{"10.0.0.2/32"},
+		},
+	}}, got)
+
+	// generated configs should be accepted by the normal parsing
+	for _, pd := range got.Peers {
+		_, _, err := pd.Parse()
+		assert.NoError(t, err)
+	}
+}
+
+func TestGenerateFromWgQuick(t *testing.T) {
+	key := testutils.MustKey(t)
+	got, err := GenerateFromWgQuick(&WgQuick{Peers: []WgQuickPeer{{
+		Name:       "router",
+		PublicKey:  key.String(),
+		Endpoint:   "vpn.example.com:51820",
+		AllowedIPs: []string{"10.0.0.1/24"},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, &FileData{Peers: []PeerData{{
+		PublicKey:  key.String(),
+		Name:       "router",
+		Trust:      trust.Membership.String(),
+		Endpoints:  []string{"vpn.example.com:51820"},
+		AllowedIPs: []string{"10.0.0.1/24"},
+	}}}, got)
+
+	_, err = GenerateFromWgQuick(&WgQuick{Peers: []WgQuickPeer{{PublicKey: "bogus"}}})
+	assert.Error(t, err)
+	_, err = GenerateFromWgQuick(&WgQuick{Peers: []WgQuickPeer{{PublicKey: key.String(), AllowedIPs: []string{"bogus"}}}})
+	assert.Error(t, err)
+}
+
+func TestFileData_Write(t *testing.T) {
+	data := &FileData{Peers: []PeerData{{PublicKey: "key", Name: "peer", AllowedIPs: []string{"10.0.0.1/32"}}}}
+
+	var out strings.Builder
+	require.NoError(t, data.Write(&out, FileFormatJSON))
+	assert.Equal(t, `{
+  "Peers": [
+    {
+      "PublicKey": "key",
+      "Name": "peer",
+      "AllowedIPs": [
+        "10.0.0.1/32"
+      ]
+    }
+  ]
+}
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, data.Write(&out, FileFormatYAML))
+	assert.Equal(t, `Peers:
+  - PublicKey: key
+    Name: peer
+    AllowedIPs:
+      - 10.0.0.1/32
+`, out.String())
+
+	assert.Error(t, data.Write(&out, "toml"))
+}
+
+func TestFileFormatForPath(t *testing.T) {
+	assert.Equal(t, FileFormatJSON, FileFormatForPath("-"))
+	assert.Equal(t, FileFormatJSON, FileFormatForPath("wirelink.wg0.json"))
+	assert.Equal(t, FileFormatYAML, FileFormatForPath("wirelink.wg0.yaml"))
+	assert.Equal(t, FileFormatYAML, FileFormatForPath("wirelink.wg0.YML"))
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "peers.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte("chatty: true\npeers:\n  - publickey: key1\n    allowedips: [10.0.0.1/32]\n"), 0o600))
+	jsonPath := filepath.Join(dir, "peers.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"Peers": [{"PublicKey": "key2", "Name": "two"}]}`), 0o600))
+
+	got, err := LoadFile(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, &FileData{Chatty: true, Peers: []PeerData{{PublicKey: "key1", AllowedIPs: []string{"10.0.0.1/32"}}}}, got)
+
+	got, err = LoadFile(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, &FileData{Peers: []PeerData{{PublicKey: "key2", Name: "two"}}}, got)
+
+	_, err = LoadFile(filepath.Join(dir, "nope.json"))
+	assert.Error(t, err)
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"bytes"
 	"net"
+	"reflect"
+	"slices"
 
 	"github.com/fastcat/wirelink/trust"
 
@@ -75,3 +78,25 @@ func (p Peers) Endpoints(peer wgtypes.Key) []PeerEndpoint {
 	}
 	return nil
 }
+
+// Diff compares the receiver to a newer set of peer configs, returning the keys
+// of peers which were added, removed, or had their configuration changed.
+// Each list is sorted by key.
+func (p Peers) Diff(newPeers Peers) (added, removed, changed []wgtypes.Key) {
+	for k, np := range newPeers {
+		if op, ok := p[k]; !ok {
+			added = append(added, k)
+		} else if !reflect.DeepEqual(op, np) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range p {
+		if _, ok := newPeers[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	for _, l := range [][]wgtypes.Key{added, removed, changed} {
+		slices.SortFunc(l, func(a, b wgtypes.Key) int { return bytes.Compare(a[:], b[:]) })
+	}
+	return added, removed, changed
+}
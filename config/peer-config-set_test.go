@@ -258,3 +258,52 @@ func TestPeers_Endpoints(t *testing.T) {
 		})
 	}
 }
+
+func TestPeers_Diff(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	k3 := testutils.MustKey(t)
+
+	tests := []struct {
+		name        string
+		p           Peers
+		newPeers    Peers
+		wantAdded   []wgtypes.Key
+		wantRemoved []wgtypes.Key
+		wantChanged []wgtypes.Key
+	}{
+		{"nil", nil, nil, nil, nil, nil},
+		{
+			"same",
+			Peers{k1: &Peer{Name: "one", Trust: new(trust.Membership)}},
+			Peers{k1: &Peer{Name: "one", Trust: new(trust.Membership)}},
+			nil, nil, nil,
+		},
+		{
+			"added and removed",
+			Peers{k1: &Peer{Name: "one"}},
+			Peers{k2: &Peer{Name: "two"}},
+			[]wgtypes.Key{k2}, []wgtypes.Key{k1}, nil,
+		},
+		{
+			"re-trusted",
+			Peers{k1: &Peer{Name: "one", Trust: new(trust.Endpoint)}, k3: &Peer{}},
+			Peers{k1: &Peer{Name: "one", Trust: new(trust.Membership)}, k3: &Peer{}},
+			nil, nil, []wgtypes.Key{k1},
+		},
+		{
+			"new allowed ip",
+			Peers{k1: &Peer{}},
+			Peers{k1: &Peer{AllowedIPs: []net.IPNet{testutils.MakeIPv4Net(192, 0, 2, 1, 32)}}},
+			nil, nil, []wgtypes.Key{k1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAdded, gotRemoved, gotChanged := tt.p.Diff(tt.newPeers)
+			assert.Equal(t, tt.wantAdded, gotAdded)
+			assert.Equal(t, tt.wantRemoved, gotRemoved)
+			assert.Equal(t, tt.wantChanged, gotChanged)
+		})
+	}
+}
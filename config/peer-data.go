@@ -10,14 +10,16 @@ import (
 )
 
 // PeerData represents the raw data to configure a peer read from the config file
+// The serialization tags are for writing generated configs, reading is done by
+// viper using the field names.
 type PeerData struct {
-	PublicKey     string
-	Name          string
-	Trust         string
-	FactExchanger bool
-	Endpoints     []string
-	AllowedIPs    []string
-	Basic         bool
+	PublicKey     string   `json:"PublicKey" yaml:"PublicKey"`
+	Name          string   `json:"Name,omitempty" yaml:"Name,omitempty"`
+	Trust         string   `json:"Trust,omitempty" yaml:"Trust,omitempty"`
+	FactExchanger bool     `json:"FactExchanger,omitempty" yaml:"FactExchanger,omitempty"`
+	Endpoints     []string `json:"Endpoints,omitempty" yaml:"Endpoints,omitempty"`
+	AllowedIPs    []string `json:"AllowedIPs,omitempty" yaml:"AllowedIPs,omitempty"`
+	Basic         bool     `json:"Basic,omitempty" yaml:"Basic,omitempty"`
 }
 
 // Parse validates the info in the PeerData and returns the parsed tuple + error
@@ -27,53 +29,21 @@ func (p *PeerData) Parse() (key wgtypes.Key, peer Peer, err error) {
 	}
 	peer.Name = p.Name
 	if p.Trust != "" {
-		val, ok := trust.Values[p.Trust]
-		if !ok {
-			err = fmt.Errorf("invalid trust level '%s'", p.Trust)
+		var val trust.Level
+		if val, err = ParseTrust(p.Trust); err != nil {
 			return key, peer, err
 		}
 		peer.Trust = &val
 	}
 	peer.FactExchanger = p.FactExchanger
 	peer.Endpoints = make([]PeerEndpoint, 0, len(p.Endpoints))
-	// we don't do the DNS resolution here because we want it to refresh
-	// periodically, esp. if we move across a split horizon boundary
-	// we do want to validate the host/port split however
 	for _, ep := range p.Endpoints {
-		var host, portString string
-		var port int
-		if host, portString, err = net.SplitHostPort(ep); err != nil {
-			err = fmt.Errorf("bad endpoint '%s' for '%s'='%s': %w", ep, p.PublicKey, p.Name, err)
+		var pe PeerEndpoint
+		if pe, err = ParseEndpoint(ep); err != nil {
+			err = fmt.Errorf("for '%s'='%s': %w", p.PublicKey, p.Name, err)
 			return key, peer, err
 		}
-		if port, err = net.LookupPort("udp", portString); err != nil {
-			err = fmt.Errorf("bad endpoint port in '%s' for '%s'='%s': %w", ep, p.PublicKey, p.Name, err)
-			return key, peer, err
-		}
-
-		// try to resolve the host, ignoring DNS errors and just looking for parse errors
-		// NOTE: it's actually really hard to get anything other than a DNSError out of LookupIP
-		// anything that doesn't parse as an IP is more or less assumed to be a hostname,
-		// even if it is not actually valid as such (e.g. all numbers), and then a lookup attempted,
-		// and if the lookup fails, we get an DNS error
-		_, err = net.LookupIP(host)
-		if _, ok := err.(*net.DNSError); ok {
-			// ignore DNS errors ... which actually ends up as basically everything except for a
-			// parse error for giving the empty string
-			err = nil
-		} else if err != nil {
-			// this branch is very hard, if not impossible, to reach in a test or in the real world
-			err = fmt.Errorf("bad endpoint host in '%s' for '%s'='%s': %w", ep, p.PublicKey, p.Name, err)
-			return key, peer, err
-		}
-
-		// TODO: can validate host portion is syntactically valid: do a lookup and
-		// ignore host not found errors
-
-		peer.Endpoints = append(peer.Endpoints, PeerEndpoint{
-			Host: host,
-			Port: port,
-		})
+		peer.Endpoints = append(peer.Endpoints, pe)
 	}
 
 	peer.AllowedIPs = make([]net.IPNet, 0, len(p.AllowedIPs))
@@ -95,3 +65,47 @@ func (p *PeerData) Parse() (key wgtypes.Key, peer Peer, err error) {
 
 	return key, peer, err
 }
+
+// ParseTrust looks up a trust level by name
+func ParseTrust(name string) (trust.Level, error) {
+	val, ok := trust.Values[name]
+	if !ok {
+		return val, fmt.Errorf("invalid trust level '%s'", name)
+	}
+	return val, nil
+}
+
+// ParseEndpoint validates a `host:port` endpoint. We don't do the DNS
+// resolution here because we want it to refresh periodically, esp. if we move
+// across a split horizon boundary, we do want to validate the host/port split
+// however.
+func ParseEndpoint(ep string) (pe PeerEndpoint, err error) {
+	var host, portString string
+	var port int
+	if host, portString, err = net.SplitHostPort(ep); err != nil {
+		return pe, fmt.Errorf("bad endpoint '%s': %w", ep, err)
+	}
+	if port, err = net.LookupPort("udp", portString); err != nil {
+		return pe, fmt.Errorf("bad endpoint port in '%s': %w", ep, err)
+	}
+
+	// try to resolve the host, ignoring DNS errors and just looking for parse errors
+	// NOTE: it's actually really hard to get anything other than a DNSError out of LookupIP
+	// anything that doesn't parse as an IP is more or less assumed to be a hostname,
+	// even if it is not actually valid as such (e.g. all numbers), and then a lookup attempted,
+	// and if the lookup fails, we get an DNS error
+	_, err = net.LookupIP(host)
+	if _, ok := err.(*net.DNSError); ok {
+		// ignore DNS errors ... which actually ends up as basically everything except for a
+		// parse error for giving the empty string
+		err = nil
+	} else if err != nil {
+		// this branch is very hard, if not impossible, to reach in a test or in the real world
+		return pe, fmt.Errorf("bad endpoint host in '%s': %w", ep, err)
+	}
+
+	// TODO: can validate host portion is syntactically valid: do a lookup and
+	// ignore host not found errors
+
+	return PeerEndpoint{Host: host, Port: port}, nil
+}
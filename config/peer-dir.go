@@ -0,0 +1,125 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+
+	"github.com/fastcat/wirelink/log"
+)
+
+// PeerDirExts lists the file extensions that are read from a peer directory
+var PeerDirExts = []string{".json", ".yaml", ".yml"}
+
+// peerDirSettle is how long a peer directory must be quiet after a change
+// before it is re-read, so that a file being written isn't read half done
+const peerDirSettle = 500 * time.Millisecond
+
+// PeerFile is a single peer read from a peer directory
+type PeerFile struct {
+	Path string
+	PeerData
+}
+
+// isPeerFile checks if a file name in a peer directory should be read, which
+// excludes hidden files such as editor swap files, and unknown extensions
+func isPeerFile(name string) bool {
+	return !strings.HasPrefix(name, ".") && slices.Contains(PeerDirExts, strings.ToLower(filepath.Ext(name)))
+}
+
+// resolvePeersDir makes a relative peer directory relative to the config path
+func resolvePeersDir(dir, configPath string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(configPath, dir)
+}
+
+// LoadPeerDir reads the peers from a directory with one file per peer, in
+// order of the file names
+func LoadPeerDir(dir string) ([]PeerFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read peer directory: %w", err)
+	}
+	var ret []PeerFile
+	for _, entry := range entries {
+		if entry.IsDir() || !isPeerFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		vcfg := viper.New()
+		vcfg.SetConfigFile(path)
+		if err := vcfg.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		pf := PeerFile{Path: path}
+		if err := vcfg.UnmarshalExact(&pf.PeerData); err != nil {
+			return nil, fmt.Errorf("unable to parse peer from %s: %w", path, err)
+		}
+		ret = append(ret, pf)
+	}
+	return ret, nil
+}
+
+// PeerDirWatcher notices changes to the files in a peer directory
+type PeerDirWatcher struct {
+	dir     string
+	watcher *fsnotify.Watcher
+}
+
+// WatchPeerDir starts watching a peer directory for changes
+func WatchPeerDir(dir string) (*PeerDirWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create file watcher: %w", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("unable to watch peer directory %s: %w", dir, err)
+	}
+	return &PeerDirWatcher{dir: dir, watcher: watcher}, nil
+}
+
+// Dir returns the directory being watched
+func (w *PeerDirWatcher) Dir() string {
+	return w.dir
+}
+
+// Watch calls onChange each time peer files are added, removed, or changed,
+// once things have settled, until the context is cancelled, at which point it
+// stops watching. Errors from the watcher are logged, not returned.
+func (w *PeerDirWatcher) Watch(ctx context.Context, onChange func()) error {
+	defer w.watcher.Close()
+	var settled <-chan time.Time
+	for {
+		select {
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return nil
+			}
+			if e.Op == fsnotify.Chmod || !isPeerFile(filepath.Base(e.Name)) {
+				continue
+			}
+			log.Debug("Peer directory change: %v", e)
+			settled = time.After(peerDirSettle)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Error("Error watching peer directory %s: %v", w.dir, err)
+		case <-settled:
+			settled = nil
+			onChange()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/trust"
+)
+
+func writePeerFile(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+}
+
+func TestLoadPeerDir(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+
+	t.Run("good", func(t *testing.T) {
+		dir := t.TempDir()
+		writePeerFile(t, dir, "b.yaml", "publickey: "+k2.String()+"\nname: two\nallowedips: [10.0.0.2/32]\n")
+		writePeerFile(t, dir, "a.json", `{"PublicKey":"`+k1.String()+`","Name":"one","Trust":"Membership"}`)
+		writePeerFile(t, dir, ".a.json.swp", "garbage")
+		writePeerFile(t, dir, "README.txt", "garbage")
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "sub.json"), 0o700))
+
+		got, err := LoadPeerDir(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []PeerFile{
+			{filepath.Join(dir, "a.json"), PeerData{PublicKey: k1.String(), Name: "one", Trust: "Membership"}},
+			{filepath.Join(dir, "b.yaml"), PeerData{PublicKey: k2.String(), Name: "two", AllowedIPs: []string{"10.0.0.2/32"}}},
+		}, got)
+	})
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		contains string
+	}{
+		{"unreadable", map[string]string{"a.json": "{"}, "unable to read"},
+		{"unknown key", map[string]string{"a.yaml": "publickey: " + k1.String() + "\nallowedip: [10.0.0.1/32]\n"}, "allowedip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writePeerFile(t, dir, name, content)
+			}
+			_, err := LoadPeerDir(dir)
+			require.Error(t, err)
+			assert.ErrorContains(t, err, tt.contains)
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := LoadPeerDir(filepath.Join(t.TempDir(), "nope"))
+		assert.Error(t, err)
+	})
+}
+
+func TestServerData_Parse_peersDir(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	configPath := t.TempDir()
+	dir := filepath.Join(configPath, "wg0.d")
+	require.NoError(t, os.Mkdir(dir, 0o700))
+	writePeerFile(t, dir, "two.yaml", "publickey: "+k2.String()+"\nname: two\ntrust: AllowedIPs\n")
+	vcfg := viper.New()
+	vcfg.Set(ConfigPathFlag, configPath)
+
+	s := &ServerData{
+		Iface:    "wg0",
+		Peers:    []PeerData{{PublicKey: k1.String(), Name: "one"}},
+		PeersDir: "wg0.d",
+	}
+	got, err := s.Parse(vcfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, dir, got.PeersDir)
+	assert.Equal(t, "one", got.Peers.Name(k1))
+	assert.Equal(t, "two", got.Peers.Name(k2))
+	assert.Equal(t, trust.AllowedIPs, got.Peers.Trust(k2, trust.Untrusted))
+
+	// a peer can't be in both places
+	writePeerFile(t, dir, "one.json", `{"PublicKey":"`+k1.String()+`"}`)
+	_, err = s.Parse(vcfg, nil)
+	assert.ErrorContains(t, err, "already configured")
+	require.NoError(t, os.Remove(filepath.Join(dir, "one.json")))
+
+	writePeerFile(t, dir, "bad.json", `{"PublicKey":"nope"}`)
+	_, err = s.Parse(vcfg, nil)
+	assert.ErrorContains(t, err, "bad.json")
+}
+
+func TestPeerDirWatcher_Watch(t *testing.T) {
+	dir := t.TempDir()
+	w, err := WatchPeerDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, dir, w.Dir())
+
+	changes := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Watch(ctx, func() { changes <- struct{}{} }) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	expectChange := func(msg string) {
+		select {
+		case <-changes:
+		case <-time.After(10 * peerDirSettle):
+			assert.Fail(t, "expected a change notification", msg)
+		}
+	}
+	expectQuiet := func(msg string) {
+		select {
+		case <-changes:
+			assert.Fail(t, "unexpected change notification", msg)
+		case <-time.After(3 * peerDirSettle):
+		}
+	}
+
+	// several changes in quick succession are reported once
+	writePeerFile(t, dir, "a.json", "{}")
+	writePeerFile(t, dir, "b.yaml", "{}")
+	expectChange("add")
+	expectQuiet("settled")
+
+	writePeerFile(t, dir, ".a.json.swp", "{}")
+	writePeerFile(t, dir, "notes.txt", "")
+	expectQuiet("ignored files")
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.json")))
+	expectChange("remove")
+}
+
+func TestWatchPeerDir_missing(t *testing.T) {
+	_, err := WatchPeerDir(filepath.Join(t.TempDir(), "nope"))
+	assert.Error(t, err)
+}
@@ -4,6 +4,8 @@ import (
 	"path/filepath"
 
 	"github.com/fastcat/wirelink/log"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // Server describes the configuration for the server, after parsing from various sources
@@ -12,6 +14,13 @@ type Server struct {
 	Port   int
 	Chatty bool
 
+	// Interest is whether to tell routers which peers we want facts about, so
+	// they don't send us facts about the rest
+	Interest bool
+	// InterestPeers are peers we want facts about in addition to the
+	// configured ones and the ones we have tried to reach
+	InterestPeers []wgtypes.Key
+
 	AutoDetectRouter bool
 	IsRouterNow      bool
 
@@ -19,10 +28,38 @@ type Server struct {
 	HideIfaces   []string
 
 	Peers Peers
+	// PeersDir is the directory from which some of the Peers were read, or
+	// empty if there is none
+	PeersDir string
+
+	// ControlSocket is the path for the local control socket, or empty if it is
+	// disabled
+	ControlSocket string
+	// MetricsAddress is the local address on which to export metrics over HTTP,
+	// or empty if it is disabled
+	MetricsAddress string
+	// DNSAddress is the local or tunnel address on which to answer DNS queries
+	// for peer names, or empty if it is disabled
+	DNSAddress string
+	// HostsFile is the path of a hosts file in which to keep entries for peer
+	// names, or empty if it is disabled
+	HostsFile string
+
+	Timing Timing
 
 	Debug bool
 }
 
+// DefaultControlDir is the directory in which control sockets are placed if
+// no explicit path is configured
+const DefaultControlDir = "/run/wirelink"
+
+// DefaultControlSocket returns the control socket path to use for an
+// interface if no explicit path is configured
+func DefaultControlSocket(iface string) string {
+	return filepath.Join(DefaultControlDir, iface+".sock")
+}
+
 // ShouldReportIface checks a given local network interface name against the config
 // for whether we should tell other peers about our configuration on it
 func (s *Server) ShouldReportIface(name string) bool {
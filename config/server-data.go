@@ -5,26 +5,53 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/viper"
 
 	"github.com/fastcat/wirelink/internal"
 	"github.com/fastcat/wirelink/log"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // ServerData represents the raw data from the config for the server,
 // before it is cleaned up into a `Server` config object.
 type ServerData struct {
 	Iface  string
+	Ifaces []string
 	Port   int
 	Router *bool
 	Chatty bool
 
-	Peers []PeerData
+	Interest      bool
+	InterestPeers []string `mapstructure:"interest-peers"`
+
+	Peers    []PeerData
+	PeersDir string `mapstructure:"peers-dir"`
 
 	ReportIfaces []string
 	HideIfaces   []string
 
+	ControlSocket  *string `mapstructure:"control-socket"`
+	MetricsAddress string  `mapstructure:"metrics-address"`
+	DNSAddress     string  `mapstructure:"dns-address"`
+	HostsFile      string  `mapstructure:"hosts-file"`
+
+	LogLevel        string   `mapstructure:"log-level"`
+	LogFormat       string   `mapstructure:"log-format"`
+	DebugSubsystems []string `mapstructure:"debug-subsystems"`
+
+	BundleKeys []string `mapstructure:"bundle-keys"`
+	// BundleCreated is only used by config import, see BundleCreatedFlag
+	BundleCreated string `mapstructure:"bundle-created"`
+
+	FactTTL     time.Duration `mapstructure:"fact-ttl"`
+	LongFactTTL time.Duration `mapstructure:"long-fact-ttl"`
+	ChunkPeriod time.Duration `mapstructure:"chunk-period"`
+	AlivePeriod time.Duration `mapstructure:"alive-period"`
+	MaxChunk    int           `mapstructure:"max-chunk"`
+
 	Debug   bool
 	Dump    bool
 	Help    bool
@@ -36,19 +63,85 @@ type ServerData struct {
 	ConfigPath string `mapstructure:"config-path"`
 }
 
+// timing fills in the defaults for any timing settings that aren't set
+func (s *ServerData) timing() Timing {
+	ret := DefaultTiming()
+	if s.FactTTL != 0 {
+		ret.FactTTL = s.FactTTL
+	}
+	// long-lived facts default to lasting longer, but never less than the rest
+	ret.LongFactTTL = max(ret.LongFactTTL, ret.FactTTL)
+	if s.LongFactTTL != 0 {
+		ret.LongFactTTL = s.LongFactTTL
+	}
+	if s.ChunkPeriod != 0 {
+		ret.ChunkPeriod = s.ChunkPeriod
+	}
+	if s.AlivePeriod != 0 {
+		ret.AlivePeriod = s.AlivePeriod
+	}
+	if s.MaxChunk != 0 {
+		ret.MaxChunk = s.MaxChunk
+	}
+	return ret
+}
+
 // Parse converts the raw configuration data into a ready to use server config.
 func (s *ServerData) Parse(vcfg *viper.Viper, _ internal.WgClient) (ret *Server, err error) {
+	// always apply this, so that removing it on a config reload goes back to the
+	// default
+	logFormat := log.FormatText
+	if s.LogFormat != "" {
+		if logFormat, err = log.ParseFormat(s.LogFormat); err != nil {
+			return nil, err
+		}
+	}
+	if err = log.SetFormat(logFormat); err != nil {
+		return nil, err
+	}
 	// apply this right away, but only as an enable
 	// once debug is on, leave it on (esp. for tests)
 	if s.Debug {
 		log.SetDebug(s.Debug)
+	} else if s.LogLevel != "" {
+		level, err := log.ParseLevel(s.LogLevel)
+		if err != nil {
+			return nil, err
+		}
+		log.SetLevel(level)
+	}
+	for _, name := range s.DebugSubsystems {
+		sub, err := log.ParseSubsystem(name)
+		if err != nil {
+			return nil, err
+		}
+		sub.SetDebug(true)
+	}
+
+	// the server doesn't use these, but catch mistakes early
+	for _, key := range s.BundleKeys {
+		if _, err = ParseBundleKey(key); err != nil {
+			return nil, err
+		}
 	}
 
 	ret = new(Server)
+	ret.Timing = s.timing()
+	if err = ret.Timing.Validate(); err != nil {
+		return nil, err
+	}
 	// TODO: validate Iface is not empty
 	ret.Iface = s.Iface
 	ret.Port = s.Port
 	ret.Chatty = s.Chatty
+	ret.Interest = s.Interest
+	for _, ks := range s.InterestPeers {
+		key, err := wgtypes.ParseKey(ks)
+		if err != nil {
+			return nil, fmt.Errorf("bad key in %s config: '%s': %w", InterestPeersFlag, ks, err)
+		}
+		ret.InterestPeers = append(ret.InterestPeers, key)
+	}
 
 	// validate all the globs
 	// have to pass a non-empty candidate string to actually get error checking
@@ -81,6 +174,36 @@ func (s *ServerData) Parse(vcfg *viper.Viper, _ internal.WgClient) (ret *Server,
 		}
 	}
 
+	if s.PeersDir != "" {
+		ret.PeersDir = resolvePeersDir(s.PeersDir, vcfg.GetString(ConfigPathFlag))
+		files, err := LoadPeerDir(ret.PeersDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, pf := range files {
+			key, peerConf, err := pf.Parse()
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse peer config from %s: %w", pf.Path, err)
+			}
+			if _, ok := ret.Peers[key]; ok {
+				return nil, fmt.Errorf("peer %s in %s is already configured", key, pf.Path)
+			}
+			ret.Peers[key] = &peerConf
+			if !s.Dump {
+				log.Info("Configured peer '%s' from %s: %s", key, filepath.Base(pf.Path), &peerConf)
+			}
+		}
+	}
+
+	if s.ControlSocket == nil {
+		ret.ControlSocket = DefaultControlSocket(s.Iface)
+	} else {
+		ret.ControlSocket = *s.ControlSocket
+	}
+	ret.MetricsAddress = s.MetricsAddress
+	ret.DNSAddress = s.DNSAddress
+	ret.HostsFile = s.HostsFile
+
 	ret.Debug = s.Debug
 
 	if s.Router == nil {
@@ -102,6 +225,56 @@ func (s *ServerData) Parse(vcfg *viper.Viper, _ internal.WgClient) (ret *Server,
 		if s.Router == nil {
 			delete(all, RouterFlag)
 		}
+		if s.ControlSocket == nil {
+			delete(all, ControlSocketFlag)
+		}
+		if s.MetricsAddress == "" {
+			delete(all, MetricsAddressFlag)
+		}
+		if s.DNSAddress == "" {
+			delete(all, DNSAddressFlag)
+		}
+		if s.HostsFile == "" {
+			delete(all, HostsFileFlag)
+		}
+		if s.LogLevel == "" {
+			delete(all, LogLevelFlag)
+		}
+		if s.LogFormat == "" {
+			delete(all, LogFormatFlag)
+		}
+		if len(s.DebugSubsystems) == 0 {
+			delete(all, DebugSubsystemsFlag)
+		}
+		if len(s.BundleKeys) == 0 {
+			delete(all, BundleKeysFlag)
+		}
+		if !s.Interest {
+			delete(all, InterestFlag)
+		}
+		if len(s.InterestPeers) == 0 {
+			delete(all, InterestPeersFlag)
+		}
+		if s.PeersDir == "" {
+			delete(all, PeersDirFlag)
+		}
+		if s.FactTTL == 0 {
+			delete(all, FactTTLFlag)
+		}
+		if s.LongFactTTL == 0 {
+			delete(all, LongFactTTLFlag)
+		}
+		if s.ChunkPeriod == 0 {
+			delete(all, ChunkPeriodFlag)
+		}
+		if s.AlivePeriod == 0 {
+			delete(all, AlivePeriodFlag)
+		}
+		if s.MaxChunk == 0 {
+			delete(all, MaxChunkFlag)
+		}
+		// each interface has its own config, this can't go in any of them
+		delete(all, IfacesFlag)
 		// this still leaves a few settings in the output that wouldn't _normally_
 		// be there, and which might not work fully in a config file:
 		// `config-path`, `debug`, and `iface` at least.
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fastcat/wirelink/internal"
 	"github.com/fastcat/wirelink/internal/testutils"
@@ -17,10 +18,13 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 func TestServerData_Parse(t *testing.T) {
 	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
 	name := fmt.Sprintf("%c%c%c", letter(), letter(), letter())
 	iface := fmt.Sprintf("wg%d", rand.Int31())
 	wan := fmt.Sprintf("eth%d", rand.Int31())
@@ -31,18 +35,30 @@ func TestServerData_Parse(t *testing.T) {
 	basic := boolean()
 
 	type fields struct {
-		Iface        string
-		Port         int
-		Router       *bool
-		Chatty       bool
-		Peers        []PeerData
-		ReportIfaces []string
-		HideIfaces   []string
-		Debug        bool
-		Dump         bool
-		Help         bool
-		Version      bool
-		ConfigPath   string
+		Iface           string
+		Port            int
+		Router          *bool
+		Chatty          bool
+		Interest        bool
+		InterestPeers   []string
+		Peers           []PeerData
+		ReportIfaces    []string
+		HideIfaces      []string
+		Debug           bool
+		Dump            bool
+		Help            bool
+		Version         bool
+		ConfigPath      string
+		ControlSocket   *string
+		MetricsAddress  string
+		DNSAddress      string
+		HostsFile       string
+		LogLevel        string
+		LogFormat       string
+		DebugSubsystems []string
+		BundleKeys      []string
+		FactTTL         time.Duration
+		AlivePeriod     time.Duration
 	}
 	type args struct {
 		vcfg *viper.Viper
@@ -77,6 +93,114 @@ func TestServerData_Parse(t *testing.T) {
 			nil,
 			true,
 		},
+		{
+			"bad log level",
+			fields{
+				Iface:    iface,
+				LogLevel: "loud",
+			},
+			args{nil, nil},
+			nil,
+			true,
+		},
+		{
+			"bad log format",
+			fields{
+				Iface:     iface,
+				LogFormat: "xml",
+			},
+			args{nil, nil},
+			nil,
+			true,
+		},
+		{
+			"bad debug subsystem",
+			fields{
+				Iface:           iface,
+				DebugSubsystems: []string{"everything"},
+			},
+			args{nil, nil},
+			nil,
+			true,
+		},
+		{
+			"bad bundle key",
+			fields{
+				Iface:      iface,
+				BundleKeys: []string{"AAAA"},
+			},
+			args{nil, nil},
+			nil,
+			true,
+		},
+		{
+			"bad interest peer",
+			fields{
+				Iface:         iface,
+				InterestPeers: []string{"AAAA"},
+			},
+			args{nil, nil},
+			nil,
+			true,
+		},
+		{
+			"bad timing",
+			fields{
+				Iface:       iface,
+				AlivePeriod: 5 * time.Minute,
+			},
+			args{nil, nil},
+			nil,
+			true,
+		},
+		{
+			"long fact ttl defaults to longer",
+			fields{
+				Iface:   iface,
+				Port:    port,
+				FactTTL: 2 * time.Minute,
+			},
+			args{nil, nil},
+			&Server{
+				Iface: iface,
+				Port:  port,
+				Timing: Timing{
+					FactTTL:     2 * time.Minute,
+					LongFactTTL: DefaultLongFactTTL,
+					ChunkPeriod: DefaultChunkPeriod,
+					AlivePeriod: DefaultAlivePeriod,
+					MaxChunk:    DefaultMaxChunk,
+				},
+				AutoDetectRouter: true,
+				Peers:            Peers{},
+				ControlSocket:    DefaultControlSocket(iface),
+			},
+			false,
+		},
+		{
+			"long fact ttl follows longer fact ttl",
+			fields{
+				Iface:   iface,
+				Port:    port,
+				FactTTL: 2 * time.Hour,
+			},
+			args{nil, nil},
+			&Server{
+				Iface: iface,
+				Port:  port,
+				Timing: Timing{
+					FactTTL:     2 * time.Hour,
+					LongFactTTL: 2 * time.Hour,
+					ChunkPeriod: DefaultChunkPeriod,
+					AlivePeriod: DefaultAlivePeriod,
+					MaxChunk:    DefaultMaxChunk,
+				},
+				AutoDetectRouter: true,
+				Peers:            Peers{},
+				ControlSocket:    DefaultControlSocket(iface),
+			},
+			false,
+		},
 		{
 			"forced router true",
 			fields{
@@ -88,9 +212,11 @@ func TestServerData_Parse(t *testing.T) {
 			&Server{
 				Iface:            iface,
 				Port:             port,
+				Timing:           DefaultTiming(),
 				AutoDetectRouter: false,
 				IsRouterNow:      true,
 				Peers:            Peers{},
+				ControlSocket:    DefaultControlSocket(iface),
 			},
 			false,
 		},
@@ -105,9 +231,11 @@ func TestServerData_Parse(t *testing.T) {
 			&Server{
 				Iface:            iface,
 				Port:             port,
+				Timing:           DefaultTiming(),
 				AutoDetectRouter: false,
 				IsRouterNow:      false,
 				Peers:            Peers{},
+				ControlSocket:    DefaultControlSocket(iface),
 			},
 			false,
 		},
@@ -129,12 +257,19 @@ func TestServerData_Parse(t *testing.T) {
 		{
 			"good: all the things",
 			fields{
-				Iface:        iface,
-				Port:         port,
-				Router:       nil,
-				Chatty:       chatty,
-				ReportIfaces: []string{wan},
-				HideIfaces:   []string{docker},
+				Iface:         iface,
+				Port:          port,
+				Router:        nil,
+				Chatty:        chatty,
+				Interest:      true,
+				InterestPeers: []string{k2.String()},
+				ReportIfaces:  []string{wan},
+				HideIfaces:    []string{docker},
+				// empty string is how the control socket is disabled
+				ControlSocket:  new(""),
+				MetricsAddress: "[::1]:9100",
+				DNSAddress:     "127.0.0.53:5353",
+				HostsFile:      "/etc/hosts",
 				Peers: []PeerData{
 					{
 						PublicKey:     k1.String(),
@@ -151,11 +286,17 @@ func TestServerData_Parse(t *testing.T) {
 			&Server{
 				Iface:            iface,
 				Port:             port,
+				Timing:           DefaultTiming(),
 				AutoDetectRouter: true,
 				IsRouterNow:      false,
 				Chatty:           chatty,
+				Interest:         true,
+				InterestPeers:    []wgtypes.Key{k2},
 				ReportIfaces:     []string{wan},
 				HideIfaces:       []string{docker},
+				MetricsAddress:   "[::1]:9100",
+				DNSAddress:       "127.0.0.53:5353",
+				HostsFile:        "/etc/hosts",
 				Peers: Peers{
 					k1: &Peer{
 						Name:          name,
@@ -177,18 +318,30 @@ func TestServerData_Parse(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &ServerData{
-				Iface:        tt.fields.Iface,
-				Port:         tt.fields.Port,
-				Router:       tt.fields.Router,
-				Chatty:       tt.fields.Chatty,
-				Peers:        tt.fields.Peers,
-				ReportIfaces: tt.fields.ReportIfaces,
-				HideIfaces:   tt.fields.HideIfaces,
-				Debug:        tt.fields.Debug,
-				Dump:         tt.fields.Dump,
-				Help:         tt.fields.Help,
-				Version:      tt.fields.Version,
-				ConfigPath:   tt.fields.ConfigPath,
+				Iface:           tt.fields.Iface,
+				Port:            tt.fields.Port,
+				Router:          tt.fields.Router,
+				Chatty:          tt.fields.Chatty,
+				Interest:        tt.fields.Interest,
+				InterestPeers:   tt.fields.InterestPeers,
+				Peers:           tt.fields.Peers,
+				ReportIfaces:    tt.fields.ReportIfaces,
+				HideIfaces:      tt.fields.HideIfaces,
+				Debug:           tt.fields.Debug,
+				Dump:            tt.fields.Dump,
+				Help:            tt.fields.Help,
+				Version:         tt.fields.Version,
+				ConfigPath:      tt.fields.ConfigPath,
+				ControlSocket:   tt.fields.ControlSocket,
+				MetricsAddress:  tt.fields.MetricsAddress,
+				DNSAddress:      tt.fields.DNSAddress,
+				HostsFile:       tt.fields.HostsFile,
+				LogLevel:        tt.fields.LogLevel,
+				LogFormat:       tt.fields.LogFormat,
+				DebugSubsystems: tt.fields.DebugSubsystems,
+				BundleKeys:      tt.fields.BundleKeys,
+				FactTTL:         tt.fields.FactTTL,
+				AlivePeriod:     tt.fields.AlivePeriod,
 			}
 			gotRet, err := s.Parse(tt.args.vcfg, tt.args.wgc)
 			if tt.wantErr {
@@ -211,6 +364,7 @@ func TestServerData_Dump(t *testing.T) {
 	}
 	wgIface := fmt.Sprintf("wgFake%d", rand.Int())
 	configPath := "./testdata/"
+	interestKey := testutils.MustKey(t)
 
 	tests := []struct {
 		name     string
@@ -278,6 +432,20 @@ func TestServerData_Dump(t *testing.T) {
 				"port":        0.0, // should be an int but raw json parsing makes it a float here
 			},
 		},
+		{
+			"arg interest",
+			[]string{"--interest", "--interest-peers=" + interestKey.String()},
+			nil,
+			map[string]any{
+				"chatty":         false,
+				"config-path":    configPath,
+				"debug":          false,
+				"iface":          "wg0",
+				"interest":       true,
+				"interest-peers": []any{interestKey.String()},
+				"port":           0.0, // should be an int but raw json parsing makes it a float here
+			},
+		},
 		// TODO: more
 	}
 	for _, tt := range tests {
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fastcat/wirelink/fact"
+)
+
+// Timing holds the settings for how often facts are sent and processed, and
+// how long they last
+type Timing struct {
+	// FactTTL is the TTL applied to locally generated short-lived facts, such as
+	// endpoints and alive facts
+	FactTTL time.Duration
+	// LongFactTTL is the TTL applied to locally generated long-lived facts, such
+	// as membership and allowed IPs, which rarely change
+	LongFactTTL time.Duration
+	// ChunkPeriod is the max time to wait between processing chunks of received
+	// packets and expiring old ones
+	ChunkPeriod time.Duration
+	// AlivePeriod is how often "I'm here" facts are sent to peers
+	AlivePeriod time.Duration
+	// MaxChunk is the max number of packets to receive before processing them
+	MaxChunk int
+}
+
+const (
+	// DefaultFactTTL is the default TTL applied to locally generated facts
+	DefaultFactTTL = 255 * time.Second
+	// DefaultLongFactTTL is the default TTL applied to locally generated
+	// long-lived facts, if it is longer than the fact TTL
+	DefaultLongFactTTL = time.Hour
+	// DefaultChunkPeriod is the default max time to wait between processing
+	// chunks of received packets and expiring old ones
+	DefaultChunkPeriod = 5 * time.Second
+	// DefaultAlivePeriod is the default for how often we send "I'm here" facts
+	// to peers
+	DefaultAlivePeriod = 30 * time.Second
+	// DefaultMaxChunk is the default max number of packets to receive before
+	// processing them
+	DefaultMaxChunk = 100
+
+	// MaxFactTTL is the longest TTL that can be applied to locally generated
+	// facts, as limited by the wire format
+	MaxFactTTL = math.MaxUint16 * time.Second
+	// MinChunkPeriod is the shortest chunk period, as sending facts is given the
+	// chunk period less one second to complete
+	MinChunkPeriod = 2 * time.Second
+)
+
+// DefaultTiming returns the default timing settings
+func DefaultTiming() Timing {
+	return Timing{
+		FactTTL:     DefaultFactTTL,
+		LongFactTTL: DefaultLongFactTTL,
+		ChunkPeriod: DefaultChunkPeriod,
+		AlivePeriod: DefaultAlivePeriod,
+		MaxChunk:    DefaultMaxChunk,
+	}
+}
+
+// Validate checks that the timing settings are consistent with each other
+func (t Timing) Validate() error {
+	if t.FactTTL < time.Second || t.FactTTL > MaxFactTTL {
+		return fmt.Errorf("%s must be between 1s and %v, not %v", FactTTLFlag, MaxFactTTL, t.FactTTL)
+	}
+	if t.LongFactTTL < t.FactTTL || t.LongFactTTL > MaxFactTTL {
+		return fmt.Errorf("%s must be between %s (%v) and %v, not %v",
+			LongFactTTLFlag, FactTTLFlag, t.FactTTL, MaxFactTTL, t.LongFactTTL)
+	}
+	if t.ChunkPeriod < MinChunkPeriod {
+		return fmt.Errorf("%s must be at least %v, not %v", ChunkPeriodFlag, MinChunkPeriod, t.ChunkPeriod)
+	}
+	if t.AlivePeriod <= 0 || t.AlivePeriod >= t.FactTTL {
+		return fmt.Errorf("%s (%v) must be positive and less than %s (%v)",
+			AlivePeriodFlag, t.AlivePeriod, FactTTLFlag, t.FactTTL)
+	}
+	// a peer is only trusted to delete others if its alive fact has more than
+	// 1.5 chunk periods left, and that fact is refreshed every alive period,
+	// but may take up to a chunk period to arrive and another to be processed
+	if minTTL := t.AlivePeriod + t.ChunkPeriod*5/2; t.FactTTL < minTTL {
+		return fmt.Errorf("%s (%v) must be at least %s + 2.5 * %s (%v), so peers stay healthy between alive facts",
+			FactTTLFlag, t.FactTTL, AlivePeriodFlag, ChunkPeriodFlag, minTTL)
+	}
+	if t.MaxChunk < 1 {
+		return fmt.Errorf("%s must be at least 1, not %d", MaxChunkFlag, t.MaxChunk)
+	}
+	return nil
+}
+
+// TTL returns the TTL to apply to locally generated facts with the given
+// attribute: long-lived facts describe the configuration of the network, the
+// rest describe its current state.
+func (t Timing) TTL(attr fact.Attribute) time.Duration {
+	switch attr {
+	case fact.AttributeAllowedCidrV4, fact.AttributeAllowedCidrV6,
+		fact.AttributeMember, fact.AttributeMemberMetadata,
+		fact.AttributeNetworkTiming:
+		// fall back to the short TTL for servers that were set up by hand
+		return max(t.LongFactTTL, t.FactTTL)
+	}
+	return t.FactTTL
+}
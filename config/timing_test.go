@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fastcat/wirelink/fact"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTiming_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(*Timing)
+		contains string
+	}{
+		{"defaults", func(*Timing) {}, ""},
+		{"slow", func(t *Timing) { t.ChunkPeriod = 20 * time.Second; t.AlivePeriod = 2 * time.Minute }, ""},
+		// the acceptance tests use this, it is right at the limit
+		{"fast", func(t *Timing) {
+			t.FactTTL = 9 * time.Second
+			t.ChunkPeriod = 3 * time.Second
+			t.AlivePeriod = 1500 * time.Millisecond
+		}, ""},
+		{"ttl too long", func(t *Timing) { t.FactTTL = 19 * time.Hour }, FactTTLFlag + " must be between 1s"},
+		{"ttl too short", func(t *Timing) { t.FactTTL = time.Millisecond }, FactTTLFlag + " must be between"},
+		{"long ttl", func(t *Timing) { t.LongFactTTL = 18 * time.Hour }, ""},
+		{"long ttl too long", func(t *Timing) { t.LongFactTTL = 19 * time.Hour }, LongFactTTLFlag + " must be between"},
+		{"long ttl too short", func(t *Timing) { t.LongFactTTL = time.Minute }, LongFactTTLFlag + " must be between"},
+		{"chunk too short", func(t *Timing) { t.ChunkPeriod = time.Second }, ChunkPeriodFlag + " must be at least"},
+		{"alive too long", func(t *Timing) { t.AlivePeriod = t.FactTTL }, AlivePeriodFlag},
+		{"alive negative", func(t *Timing) { t.AlivePeriod = -time.Second }, AlivePeriodFlag},
+		{"no headroom", func(t *Timing) { t.ChunkPeriod = 100 * time.Second }, "so peers stay healthy"},
+		{"no chunk", func(t *Timing) { t.MaxChunk = -1 }, MaxChunkFlag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timing := DefaultTiming()
+			tt.modify(&timing)
+			err := timing.Validate()
+			if tt.contains == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.contains)
+			}
+		})
+	}
+}
+
+func TestTiming_TTL(t *testing.T) {
+	timing := Timing{FactTTL: time.Minute, LongFactTTL: time.Hour}
+	assert.Equal(t, time.Minute, timing.TTL(fact.AttributeAlive))
+	assert.Equal(t, time.Minute, timing.TTL(fact.AttributeEndpointV4))
+	assert.Equal(t, time.Minute, timing.TTL(fact.AttributeEndpointV6))
+	assert.Equal(t, time.Hour, timing.TTL(fact.AttributeAllowedCidrV4))
+	assert.Equal(t, time.Hour, timing.TTL(fact.AttributeAllowedCidrV6))
+	assert.Equal(t, time.Hour, timing.TTL(fact.AttributeMember))
+	assert.Equal(t, time.Hour, timing.TTL(fact.AttributeMemberMetadata))
+	assert.Equal(t, time.Hour, timing.TTL(fact.AttributeNetworkTiming))
+
+	// unset long ttl falls back to the short one
+	timing.LongFactTTL = 0
+	assert.Equal(t, time.Minute, timing.TTL(fact.AttributeMemberMetadata))
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WgQuick is the subset of a wg-quick configuration file that wirelink uses
+type WgQuick struct {
+	Interface WgQuickInterface
+	Peers     []WgQuickPeer
+}
+
+// WgQuickInterface is the `[Interface]` section of a wg-quick config
+type WgQuickInterface struct {
+	PrivateKey string
+	Address    []string
+	ListenPort int
+	DNS        []string
+}
+
+// WgQuickPeer is a `[Peer]` section of a wg-quick config. Name is not part of
+// the wg-quick format, it comes from a `# Name = ...` comment in the section.
+type WgQuickPeer struct {
+	Name                string
+	PublicKey           string
+	Endpoint            string
+	AllowedIPs          []string
+	PersistentKeepalive int
+}
+
+// ReadWgQuick parses a wg-quick configuration file. Settings wirelink doesn't
+// use, such as `PostUp` or `PresharedKey`, are ignored.
+func ReadWgQuick(r io.Reader) (*WgQuick, error) {
+	ret := &WgQuick{}
+	var section string
+	var peer *WgQuickPeer
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			if name, ok := parseNameComment(comment); ok && peer != nil {
+				peer.Name = name
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			switch section {
+			case "interface":
+				peer = nil
+			case "peer":
+				ret.Peers = append(ret.Peers, WgQuickPeer{})
+				peer = &ret.Peers[len(ret.Peers)-1]
+			default:
+				return nil, fmt.Errorf("line %d: unknown section %q", lineNum, line)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		// trailing comments are allowed after values
+		value, _, _ = strings.Cut(value, "#")
+		value = strings.TrimSpace(value)
+		var err error
+		switch section {
+		case "interface":
+			err = ret.Interface.set(key, value)
+		case "peer":
+			err = peer.set(key, value)
+		default:
+			err = fmt.Errorf("setting outside of any section")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i := range ret.Peers {
+		if ret.Peers[i].PublicKey == "" {
+			return nil, fmt.Errorf("peer %d has no PublicKey", i+1)
+		}
+	}
+	return ret, nil
+}
+
+// Write serializes the config in wg-quick format. Peer names are written as
+// `# Name = ...` comments, which ReadWgQuick understands. If the private key
+// is not set, a comment is written in its place.
+func (q *WgQuick) Write(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	if q.Interface.PrivateKey != "" {
+		fmt.Fprintf(&b, "PrivateKey = %s\n", q.Interface.PrivateKey)
+	} else {
+		b.WriteString("# PrivateKey = (add the private key for this device)\n")
+	}
+	writeList(&b, "Address", q.Interface.Address)
+	if q.Interface.ListenPort != 0 {
+		fmt.Fprintf(&b, "ListenPort = %d\n", q.Interface.ListenPort)
+	}
+	writeList(&b, "DNS", q.Interface.DNS)
+	for _, p := range q.Peers {
+		b.WriteString("\n[Peer]\n")
+		if p.Name != "" {
+			fmt.Fprintf(&b, "# Name = %s\n", p.Name)
+		}
+		fmt.Fprintf(&b, "PublicKey = %s\n", p.PublicKey)
+		if p.Endpoint != "" {
+			fmt.Fprintf(&b, "Endpoint = %s\n", p.Endpoint)
+		}
+		writeList(&b, "AllowedIPs", p.AllowedIPs)
+		if p.PersistentKeepalive != 0 {
+			fmt.Fprintf(&b, "PersistentKeepalive = %d\n", p.PersistentKeepalive)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeList(b *strings.Builder, key string, values []string) {
+	if len(values) != 0 {
+		fmt.Fprintf(b, "%s = %s\n", key, strings.Join(values, ", "))
+	}
+}
+
+// parseNameComment checks for a `Name = value` or `Name: value` comment
+func parseNameComment(comment string) (string, bool) {
+	comment = strings.TrimSpace(comment)
+	if len(comment) < 4 || !strings.EqualFold(comment[:4], "name") {
+		return "", false
+	}
+	rest := strings.TrimSpace(comment[4:])
+	if value, ok := strings.CutPrefix(rest, "="); ok {
+		return strings.TrimSpace(value), true
+	}
+	if value, ok := strings.CutPrefix(rest, ":"); ok {
+		return strings.TrimSpace(value), true
+	}
+	return "", false
+}
+
+func splitList(value string) []string {
+	var ret []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+func (i *WgQuickInterface) set(key, value string) (err error) {
+	switch key {
+	case "privatekey":
+		i.PrivateKey = value
+	case "address":
+		i.Address = append(i.Address, splitList(value)...)
+	case "listenport":
+		if i.ListenPort, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("bad ListenPort %q: %w", value, err)
+		}
+	case "dns":
+		i.DNS = append(i.DNS, splitList(value)...)
+	}
+	return nil
+}
+
+func (p *WgQuickPeer) set(key, value string) (err error) {
+	switch key {
+	case "publickey":
+		p.PublicKey = value
+	case "endpoint":
+		p.Endpoint = value
+	case "allowedips":
+		p.AllowedIPs = append(p.AllowedIPs, splitList(value)...)
+	case "persistentkeepalive":
+		if value == "off" {
+			p.PersistentKeepalive = 0
+		} else if p.PersistentKeepalive, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("bad PersistentKeepalive %q: %w", value, err)
+		}
+	}
+	return nil
+}
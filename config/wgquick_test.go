@@ -0,0 +1,122 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWgQuick(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      *WgQuick
+		assertion require.ErrorAssertionFunc
+	}{
+		{
+			"full",
+			`# a comment
+[Interface]
+PrivateKey = privkey
+Address = 10.0.0.2/24, fd00::2/64
+ListenPort = 51820
+DNS = 10.0.0.1
+PostUp = something
+
+[Peer]
+# Name = router
+PublicKey = key1
+Endpoint = vpn.example.com:51820 # trailing comment
+AllowedIPs = 10.0.0.0/24
+AllowedIPs = fd00::/64
+PersistentKeepalive = 25
+
+[peer]
+publickey = key2
+# name: laptop
+PersistentKeepalive = off
+`,
+			&WgQuick{
+				Interface: WgQuickInterface{
+					PrivateKey: "privkey",
+					Address:    []string{"10.0.0.2/24", "fd00::2/64"},
+					ListenPort: 51820,
+					DNS:        []string{"10.0.0.1"},
+				},
+				Peers: []WgQuickPeer{
+					{
+						Name:                "router",
+						PublicKey:           "key1",
+						Endpoint:            "vpn.example.com:51820",
+						AllowedIPs:          []string{"10.0.0.0/24", "fd00::/64"},
+						PersistentKeepalive: 25,
+					},
+					{Name: "laptop", PublicKey: "key2"},
+				},
+			},
+			require.NoError,
+		},
+		{"empty", "", &WgQuick{}, require.NoError},
+		{"unknown section", "[Bogus]\n", nil, require.Error},
+		{"no section", "PublicKey = key\n", nil, require.Error},
+		{"not a setting", "[Peer]\nPublicKey\n", nil, require.Error},
+		{"bad port", "[Interface]\nListenPort = x\n", nil, require.Error},
+		{"bad keepalive", "[Peer]\nPublicKey = k\nPersistentKeepalive = x\n", nil, require.Error},
+		{"peer without key", "[Peer]\nEndpoint = 1.2.3.4:5\n", nil, require.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadWgQuick(strings.NewReader(tt.input))
+			tt.assertion(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWgQuick_Write(t *testing.T) {
+	q := &WgQuick{
+		Interface: WgQuickInterface{
+			PrivateKey: "privkey",
+			Address:    []string{"10.0.0.2/32", "fd00::2/128"},
+			DNS:        []string{"10.0.0.1"},
+		},
+		Peers: []WgQuickPeer{
+			{
+				Name:                "router",
+				PublicKey:           "routerkey",
+				Endpoint:            "vpn.example.com:51820",
+				AllowedIPs:          []string{"10.0.0.0/24"},
+				PersistentKeepalive: 25,
+			},
+			{PublicKey: "otherkey", AllowedIPs: []string{"10.1.0.0/24"}},
+		},
+	}
+	var out strings.Builder
+	require.NoError(t, q.Write(&out))
+	assert.Equal(t, `[Interface]
+PrivateKey = privkey
+Address = 10.0.0.2/32, fd00::2/128
+DNS = 10.0.0.1
+
+[Peer]
+# Name = router
+PublicKey = routerkey
+Endpoint = vpn.example.com:51820
+AllowedIPs = 10.0.0.0/24
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = otherkey
+AllowedIPs = 10.1.0.0/24
+`, out.String())
+
+	got, err := ReadWgQuick(strings.NewReader(out.String()))
+	require.NoError(t, err)
+	assert.Equal(t, q, got)
+
+	out.Reset()
+	require.NoError(t, (&WgQuick{}).Write(&out))
+	assert.Equal(t, "[Interface]\n# PrivateKey = (add the private key for this device)\n", out.String())
+}
@@ -0,0 +1,165 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/events"
+)
+
+// Client sends requests to a control Server
+type Client struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	enc     *json.Encoder
+}
+
+// Dial connects to the control socket at the given path
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to control socket %s: %w", path, err)
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, MaxLine)
+	return &Client{
+		conn:    conn,
+		scanner: scanner,
+		enc:     json.NewEncoder(conn),
+	}, nil
+}
+
+// Close closes the connection to the server
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a request and waits for its response. If the server reports an
+// error processing the request, that is returned as an error.
+func (c *Client) Do(req *Request) (*Response, error) {
+	if err := c.enc.Encode(req); err != nil {
+		return nil, fmt.Errorf("unable to send %s request: %w", req.Command, err)
+	}
+	if !c.scanner.Scan() {
+		err := c.scanner.Err()
+		if err == nil {
+			err = errors.New("connection closed")
+		}
+		return nil, fmt.Errorf("unable to read %s response: %w", req.Command, err)
+	}
+	resp := &Response{}
+	if err := json.Unmarshal(c.scanner.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("unable to parse %s response: %w", req.Command, err)
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("%s request failed: %s", req.Command, resp.Error)
+	}
+	return resp, nil
+}
+
+// Status requests the server status
+func (c *Client) Status() (*Status, error) {
+	resp, err := c.Do(&Request{Command: CommandStatus})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+// Facts requests the current set of accepted facts
+func (c *Client) Facts() ([]Fact, error) {
+	resp, err := c.Do(&Request{Command: CommandFacts})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Facts, nil
+}
+
+// Peers requests the state of each known peer
+func (c *Client) Peers() ([]Peer, error) {
+	resp, err := c.Do(&Request{Command: CommandPeers})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Peers, nil
+}
+
+// Trust requests the trust evaluation for each known peer
+func (c *Client) Trust() ([]TrustEvaluation, error) {
+	resp, err := c.Do(&Request{Command: CommandTrust})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Trust, nil
+}
+
+// Device requests the annotated wireguard device state
+func (c *Client) Device() (*Device, error) {
+	resp, err := c.Do(&Request{Command: CommandDevice})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Device, nil
+}
+
+// Log applies the given changes to the log settings, if not nil, and returns
+// the resulting settings
+func (c *Client) Log(change *LogSettings) (*LogSettings, error) {
+	resp, err := c.Do(&Request{Command: CommandLog, Log: change})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Log, nil
+}
+
+// Config requests the accepted facts rendered as config file peer entries
+func (c *Client) Config() (*config.FileData, error) {
+	resp, err := c.Do(&Request{Command: CommandConfig})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Config, nil
+}
+
+// Basic requests a wg-quick config for the given basic peer
+func (c *Client) Basic(peer string) (*config.WgQuick, error) {
+	resp, err := c.Do(&Request{Command: CommandBasic, Peer: peer})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Basic, nil
+}
+
+// Events subscribes to the live stream of state changes, limited to the given
+// types if any are given, and calls fn for each one as it arrives. It returns
+// when fn returns an error, or when the server closes the connection, which
+// is not considered an error.
+func (c *Client) Events(types []events.Type, fn func(*events.Event) error) error {
+	req := &Request{Command: CommandEvents, Events: types}
+	if err := c.enc.Encode(req); err != nil {
+		return fmt.Errorf("unable to send %s request: %w", req.Command, err)
+	}
+	for c.scanner.Scan() {
+		resp := &Response{}
+		if err := json.Unmarshal(c.scanner.Bytes(), resp); err != nil {
+			return fmt.Errorf("unable to parse %s response: %w", req.Command, err)
+		}
+		if resp.Error != "" {
+			return fmt.Errorf("%s request failed: %s", req.Command, resp.Error)
+		}
+		if resp.Event == nil {
+			continue
+		}
+		if err := fn(resp.Event); err != nil {
+			return err
+		}
+	}
+	if err := c.scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read %s response: %w", req.Command, err)
+	}
+	return nil
+}
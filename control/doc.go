@@ -0,0 +1,3 @@
+// Package control provides the local control socket protocol used to query a
+// running wirelink daemon, along with the server and client for it.
+package control
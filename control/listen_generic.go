@@ -0,0 +1,11 @@
+//go:build js || nacl || plan9 || windows || zos
+
+package control
+
+import "net"
+
+// listenUnix creates the socket, relying on the permissions being set after it
+// is created, as there is no umask to set
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
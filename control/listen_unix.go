@@ -0,0 +1,25 @@
+//go:build !js && !nacl && !plan9 && !windows && !zos
+
+package control
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes changes to the process umask, so that concurrent listens
+// don't restore each other's restrictive umask as the original
+var umaskMu sync.Mutex
+
+// listenUnix creates the socket with a restrictive umask, so that there is no
+// window where other users can connect to it before its permissions are set.
+// The umask is process wide, so other files created at the same moment will
+// also be restricted, which is harmless.
+func listenUnix(path string) (net.Listener, error) {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	old := syscall.Umask(0o117)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
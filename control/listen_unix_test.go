@@ -0,0 +1,30 @@
+//go:build !js && !nacl && !plan9 && !windows && !zos
+
+package control
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenUnix_umask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+
+	l, err := listenUnix(path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	// created without access for others, even with a permissive umask
+	info, err := os.Lstat(path)
+	require.NoError(t, err)
+	assert.Zero(t, info.Mode().Perm()&0o117, "mode %v", info.Mode())
+	// and the umask is put back
+	assert.Equal(t, 0, syscall.Umask(0))
+}
@@ -0,0 +1,224 @@
+package control
+
+import (
+	"time"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/events"
+)
+
+// Command identifies what a Request is asking the daemon to do
+type Command string
+
+const (
+	// CommandStatus requests a summary of the server state
+	CommandStatus Command = "status"
+	// CommandFacts requests the current set of accepted facts
+	CommandFacts Command = "facts"
+	// CommandPeers requests the configuration state of each known peer
+	CommandPeers Command = "peers"
+	// CommandTrust requests the trust evaluation for each known peer
+	CommandTrust Command = "trust"
+	// CommandDevice requests the wireguard device state, annotated with what
+	// the server knows about each peer
+	CommandDevice Command = "device"
+	// CommandLog requests the current log settings, optionally changing them
+	// first
+	CommandLog Command = "log"
+	// CommandEvents subscribes to a live stream of state changes. The server
+	// replies with one Response per event until the connection is closed.
+	CommandEvents Command = "events"
+	// CommandConfig requests the accepted facts rendered as config file peer
+	// entries
+	CommandConfig Command = "config"
+	// CommandBasic requests a wg-quick config for a basic peer, which routes
+	// via the known routers
+	CommandBasic Command = "basic"
+)
+
+// MaxLine is the longest request or response line that may be sent over the
+// control socket: responses can be quite large for big networks
+const MaxLine = 16 * 1024 * 1024
+
+// Commands lists all the commands the control server understands, in a
+// consistent order for help output
+var Commands = []Command{
+	CommandStatus,
+	CommandFacts,
+	CommandPeers,
+	CommandTrust,
+	CommandDevice,
+	CommandLog,
+	CommandEvents,
+	CommandConfig,
+	CommandBasic,
+}
+
+// Request is a single query sent by a client over the control socket. Requests
+// and responses are each sent as a single line of JSON.
+type Request struct {
+	Command Command
+	// Log is the settings to change for a CommandLog request, if any
+	Log *LogSettings `json:",omitempty"`
+	// Events limits a CommandEvents stream to the given types, if not empty
+	Events []events.Type `json:",omitempty"`
+	// Peer is the public key of the peer for a CommandBasic request
+	Peer string `json:",omitempty"`
+}
+
+// Response is the reply to a single Request. Which of the data fields is
+// populated depends on the Command in the request. If the request failed,
+// Error will be set and the data fields will be empty.
+type Response struct {
+	Error  string            `json:",omitempty"`
+	Status *Status           `json:",omitempty"`
+	Facts  []Fact            `json:",omitempty"`
+	Peers  []Peer            `json:",omitempty"`
+	Trust  []TrustEvaluation `json:",omitempty"`
+	Device *Device           `json:",omitempty"`
+	Log    *LogSettings      `json:",omitempty"`
+	Event  *events.Event     `json:",omitempty"`
+	Config *config.FileData  `json:",omitempty"`
+	Basic  *config.WgQuick   `json:",omitempty"`
+}
+
+// Status summarizes the state of the server
+type Status struct {
+	Version          string
+	Iface            string
+	PublicKey        string
+	Address          string
+	Port             int
+	Router           bool
+	AutoDetectRouter bool
+	Chatty           bool
+	BootID           string
+	// Description is the same one-line summary the daemon logs at startup
+	Description string
+}
+
+// Fact is the presentation form of a single accepted fact
+type Fact struct {
+	Attribute     string
+	AttributeName string
+	Subject       string
+	SubjectName   string `json:",omitempty"`
+	Value         string
+	Expires       time.Time
+}
+
+// Peer is the presentation form of the configuration state for a single peer
+type Peer struct {
+	PublicKey  string
+	Name       string `json:",omitempty"`
+	Configured bool
+	Healthy    bool
+	Alive      bool
+	Basic      bool
+	AliveUntil time.Time `json:",omitzero"`
+	BootID     string    `json:",omitempty"`
+	// State is the same one-line description the daemon logs when the peer's
+	// health changes
+	State string
+}
+
+// TrustEvaluation describes how much the daemon currently trusts facts sent
+// by a given peer
+type TrustEvaluation struct {
+	PublicKey string
+	Name      string `json:",omitempty"`
+	// Configured is the trust level from the config file, if any
+	Configured string `json:",omitempty"`
+	// Router is whether the peer currently looks like a router
+	Router bool
+	// Level is the effective trust level applied to facts from the peer, or
+	// empty if no evaluator has an opinion and so the facts are ignored
+	Level string `json:",omitempty"`
+	// Accepts lists the fact attributes that would be accepted from this peer
+	// about already known peers
+	Accepts []string `json:",omitempty"`
+}
+
+// Device is the state of the wireguard device, annotated with what the server
+// knows about each peer
+type Device struct {
+	Name         string
+	PublicKey    string
+	ListenPort   int
+	FirewallMark int `json:",omitempty"`
+	Peers        []DevicePeer
+}
+
+// DevicePeer is the state of a single peer on the wireguard device, annotated
+// with what the server knows about it
+type DevicePeer struct {
+	PublicKey string
+	Name      string `json:",omitempty"`
+	// State is the peer health description, as for Peer
+	State string
+	// Trust is the trust level configured for the peer, if any
+	Trust               string `json:",omitempty"`
+	Endpoint            string `json:",omitempty"`
+	AllowedIPs          []AllowedIP
+	LastHandshake       time.Time     `json:",omitzero"`
+	ReceiveBytes        int64         `json:",omitempty"`
+	TransmitBytes       int64         `json:",omitempty"`
+	PersistentKeepalive time.Duration `json:",omitempty"`
+	// Endpoints lists the endpoint facts known for the peer
+	Endpoints []EndpointFact `json:",omitempty"`
+}
+
+// AllowedIP is a single allowed IP range on a peer, along with where the
+// server thinks it came from
+type AllowedIP struct {
+	CIDR string
+	// Sources lists where the allowed IP comes from. It may include
+	// AllowedIPSourceAuto, AllowedIPSourceConfig, and AllowedIPSourceFact, or be
+	// empty if the server doesn't know where it came from.
+	Sources []string `json:",omitempty"`
+}
+
+const (
+	// AllowedIPSourceAuto marks the automatic IPv6-LL address of the peer
+	AllowedIPSourceAuto = "auto"
+	// AllowedIPSourceConfig marks an allowed IP from the static config
+	AllowedIPSourceConfig = "config"
+	// AllowedIPSourceFact marks an allowed IP that matches a received fact
+	AllowedIPSourceFact = "fact"
+)
+
+// EndpointFact is an endpoint fact known for a peer, along with when the server
+// last tried configuring it
+type EndpointFact struct {
+	Address  string
+	Expires  time.Time
+	LastUsed time.Time `json:",omitzero"`
+}
+
+// LogSettings describes the logging configuration. In requests, empty or
+// missing values are left unchanged.
+type LogSettings struct {
+	Level string `json:",omitempty"`
+	// Subsystems maps subsystem names to whether debug messages for them are
+	// enabled regardless of the Level
+	Subsystems map[string]bool `json:",omitempty"`
+}
+
+// Handler is the interface the control server uses to answer requests
+type Handler interface {
+	Status() (*Status, error)
+	Facts() ([]Fact, error)
+	Peers() ([]Peer, error)
+	Trust() ([]TrustEvaluation, error)
+	Device() (*Device, error)
+	// Log applies any changes in the given settings, which may be nil, and
+	// returns the resulting settings
+	Log(change *LogSettings) (*LogSettings, error)
+	// Events subscribes to the stream of state changes. The server will close
+	// the subscription when the client disconnects.
+	Events() (*events.Subscription, error)
+	// Config renders the accepted facts as config file peer entries
+	Config() (*config.FileData, error)
+	// Basic renders a wg-quick config for the given basic peer
+	Basic(peer string) (*config.WgQuick, error)
+}
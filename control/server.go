@@ -0,0 +1,218 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/fastcat/wirelink/events"
+	"github.com/fastcat/wirelink/log"
+)
+
+// Server accepts connections on a local unix socket and answers requests on
+// them using a Handler
+type Server struct {
+	path     string
+	listener net.Listener
+	handler  Handler
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// Listen opens the control socket at the given path. If a stale socket from a
+// previous run is present, it is removed, but if another process is actively
+// listening on it, an error is returned.
+func Listen(path string, handler Handler) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("unable to create control socket directory: %w", err)
+	}
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+	listener, err := listenUnix(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on control socket %s: %w", path, err)
+	}
+	// the socket gives access to a lot of information about the network, don't
+	// let just anyone see it
+	if err := os.Chmod(path, 0o660); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unable to set permissions on control socket %s: %w", path, err)
+	}
+	return &Server{
+		path:     path,
+		listener: listener,
+		handler:  handler,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+func removeStale(path string) error {
+	if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket %s is in use by another process", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("unable to remove stale control socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// Path returns the filesystem path of the control socket
+func (s *Server) Path() string {
+	return s.path
+}
+
+// Serve accepts and handles connections until the context is cancelled, at
+// which point it closes the socket and any open connections. It only returns an
+// error if accepting connections fails for some other reason.
+func (s *Server) Serve(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := context.AfterFunc(ctx, func() {
+		s.listener.Close()
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	defer stop()
+	// unix listeners remove the socket file when closed
+	defer s.listener.Close()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept control connection: %w", err)
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		wg.Go(func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		})
+	}
+}
+
+// handle processes requests from a single connection until it is closed or
+// sends something unparseable
+func (s *Server) handle(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, MaxLine)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req Request
+		var resp *Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = &Response{Error: fmt.Sprintf("invalid request: %v", err)}
+		} else if req.Command == CommandEvents {
+			// the connection is dedicated to the stream from here on
+			s.streamEvents(scanner, enc, req.Events)
+			return
+		} else {
+			resp = s.dispatch(&req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			log.Error("Unable to send control response: %v", err)
+			return
+		}
+	}
+	// tell the client why we are hanging up on it
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		if err := enc.Encode(&Response{Error: fmt.Sprintf("request too large (max %d bytes)", MaxLine)}); err != nil {
+			log.Error("Unable to send control response: %v", err)
+		}
+	}
+}
+
+// streamEvents sends events to the client until it disconnects or the
+// subscription is closed
+func (s *Server) streamEvents(scanner *bufio.Scanner, enc *json.Encoder, types []events.Type) {
+	sub, err := s.handler.Events()
+	if err != nil {
+		if err := enc.Encode(&Response{Error: err.Error()}); err != nil {
+			log.Error("Unable to send control response: %v", err)
+		}
+		return
+	}
+	defer sub.Close()
+
+	// the client isn't expected to send anything more, we just read to notice
+	// when it goes away
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		for scanner.Scan() {
+			// discard
+		}
+	}()
+
+	for {
+		select {
+		case e, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if len(types) != 0 && !slices.Contains(types, e.Type) {
+				continue
+			}
+			if err := enc.Encode(&Response{Event: &e}); err != nil {
+				log.Error("Unable to send control event: %v", err)
+				return
+			}
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(req *Request) *Response {
+	resp := &Response{}
+	var err error
+	switch req.Command {
+	case CommandStatus:
+		resp.Status, err = s.handler.Status()
+	case CommandFacts:
+		resp.Facts, err = s.handler.Facts()
+	case CommandPeers:
+		resp.Peers, err = s.handler.Peers()
+	case CommandTrust:
+		resp.Trust, err = s.handler.Trust()
+	case CommandDevice:
+		resp.Device, err = s.handler.Device()
+	case CommandLog:
+		resp.Log, err = s.handler.Log(req.Log)
+	case CommandConfig:
+		resp.Config, err = s.handler.Config()
+	case CommandBasic:
+		resp.Basic, err = s.handler.Basic(req.Peer)
+	default:
+		err = fmt.Errorf("unrecognized command %q", req.Command)
+	}
+	if err != nil {
+		return &Response{Error: err.Error()}
+	}
+	return resp
+}
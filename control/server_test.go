@@ -0,0 +1,248 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/events"
+)
+
+type fakeHandler struct {
+	status *Status
+	facts  []Fact
+	peers  []Peer
+	trust  []TrustEvaluation
+	device *Device
+	log    *LogSettings
+	config *config.FileData
+	basic  *config.WgQuick
+	peer   string
+	err    error
+
+	bus        events.Bus
+	subscribed chan struct{}
+}
+
+var _ Handler = &fakeHandler{}
+
+func (h *fakeHandler) Status() (*Status, error)          { return h.status, h.err }
+func (h *fakeHandler) Facts() ([]Fact, error)            { return h.facts, h.err }
+func (h *fakeHandler) Peers() ([]Peer, error)            { return h.peers, h.err }
+func (h *fakeHandler) Trust() ([]TrustEvaluation, error) { return h.trust, h.err }
+func (h *fakeHandler) Device() (*Device, error)          { return h.device, h.err }
+func (h *fakeHandler) Config() (*config.FileData, error) { return h.config, h.err }
+
+func (h *fakeHandler) Basic(peer string) (*config.WgQuick, error) {
+	h.peer = peer
+	return h.basic, h.err
+}
+
+func (h *fakeHandler) Log(change *LogSettings) (*LogSettings, error) {
+	if change != nil {
+		h.log = change
+	}
+	return h.log, h.err
+}
+
+func (h *fakeHandler) Events() (*events.Subscription, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+	sub := h.bus.Subscribe(10)
+	if h.subscribed != nil {
+		close(h.subscribed)
+	}
+	return sub, nil
+}
+
+func startServer(t *testing.T, h Handler) string {
+	path := filepath.Join(t.TempDir(), "sub", "test.sock")
+	s, err := Listen(path, h)
+	require.NoError(t, err)
+	assert.Equal(t, path, s.Path())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+		_, err := os.Lstat(path)
+		assert.ErrorIs(t, err, os.ErrNotExist, "socket should be removed on close")
+	})
+	return path
+}
+
+func TestServer_roundTrip(t *testing.T) {
+	h := &fakeHandler{
+		status: &Status{Iface: "wg0", Port: 51821},
+		facts: []Fact{{
+			Attribute:     "e",
+			AttributeName: "EndpointV4",
+			Subject:       "subject",
+			Value:         "1.2.3.4:5",
+			Expires:       time.Unix(1000, 0).UTC(),
+		}},
+		peers: []Peer{{PublicKey: "peer", Name: "name", Healthy: true}},
+		trust: []TrustEvaluation{{PublicKey: "peer", Level: "Membership", Accepts: []string{"Member"}}},
+		device: &Device{
+			Name: "wg0",
+			Peers: []DevicePeer{{
+				PublicKey:  "peer",
+				AllowedIPs: []AllowedIP{{CIDR: "192.0.2.1/32", Sources: []string{AllowedIPSourceConfig}}},
+			}},
+		},
+		config: &config.FileData{Peers: []config.PeerData{{PublicKey: "peer", Name: "name", AllowedIPs: []string{"192.0.2.1/32"}}}},
+		basic: &config.WgQuick{
+			Interface: config.WgQuickInterface{Address: []string{"192.0.2.2/32"}},
+			Peers:     []config.WgQuickPeer{{PublicKey: "router", AllowedIPs: []string{"192.0.2.0/24"}}},
+		},
+	}
+	path := startServer(t, h)
+
+	c, err := Dial(path)
+	require.NoError(t, err)
+	defer c.Close()
+
+	status, err := c.Status()
+	require.NoError(t, err)
+	assert.Equal(t, h.status, status)
+	facts, err := c.Facts()
+	require.NoError(t, err)
+	assert.Equal(t, h.facts, facts)
+	peers, err := c.Peers()
+	require.NoError(t, err)
+	assert.Equal(t, h.peers, peers)
+	trust, err := c.Trust()
+	require.NoError(t, err)
+	assert.Equal(t, h.trust, trust)
+	device, err := c.Device()
+	require.NoError(t, err)
+	assert.Equal(t, h.device, device)
+	cfg, err := c.Config()
+	require.NoError(t, err)
+	assert.Equal(t, h.config, cfg)
+	basic, err := c.Basic("phone")
+	require.NoError(t, err)
+	assert.Equal(t, h.basic, basic)
+	assert.Equal(t, "phone", h.peer)
+	change := &LogSettings{Level: "error", Subsystems: map[string]bool{"trust": true}}
+	logSettings, err := c.Log(change)
+	require.NoError(t, err)
+	assert.Equal(t, change, logSettings)
+	logSettings, err = c.Log(nil)
+	require.NoError(t, err)
+	assert.Equal(t, change, logSettings)
+
+	_, err = c.Do(&Request{Command: "bogus"})
+	assert.ErrorContains(t, err, "unrecognized command")
+}
+
+func TestServer_handlerError(t *testing.T) {
+	path := startServer(t, &fakeHandler{err: errors.New("boom")})
+
+	c, err := Dial(path)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Peers()
+	assert.ErrorContains(t, err, "boom")
+	// connection should still be usable after an error
+	_, err = c.Facts()
+	assert.ErrorContains(t, err, "boom")
+}
+
+func TestServer_tooLarge(t *testing.T) {
+	path := startServer(t, &fakeHandler{})
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+	go func() {
+		// the server hangs up partway through, so this will fail
+		_, _ = conn.Write([]byte(`{"Command":"` + strings.Repeat("x", MaxLine) + "\"}\n"))
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	require.True(t, scanner.Scan())
+	var resp Response
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &resp))
+	assert.Contains(t, resp.Error, "request too large")
+}
+
+func TestListen_stale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+
+	// leave a stale socket file behind
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+	_, err = os.Lstat(path)
+	require.NoError(t, err)
+
+	s, err := Listen(path, &fakeHandler{})
+	require.NoError(t, err)
+
+	// a second server can't steal an active socket
+	_, err = Listen(path, &fakeHandler{})
+	assert.ErrorContains(t, err, "in use")
+
+	require.NoError(t, s.listener.Close())
+}
+
+func TestServer_events(t *testing.T) {
+	h := &fakeHandler{subscribed: make(chan struct{})}
+	path := startServer(t, h)
+
+	c, err := Dial(path)
+	require.NoError(t, err)
+	defer c.Close()
+
+	errStop := errors.New("stop")
+	var got []*events.Event
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Events([]events.Type{events.TypePeerAdded}, func(e *events.Event) error {
+			got = append(got, e)
+			return errStop
+		})
+	}()
+
+	<-h.subscribed
+	// this one should be filtered out
+	h.bus.Publish(events.Event{Type: events.TypePeerRemoved, Peer: "p1"})
+	h.bus.Publish(events.Event{Type: events.TypePeerAdded, Peer: "p2", Message: "added p2"})
+
+	require.ErrorIs(t, <-done, errStop)
+	require.Len(t, got, 1)
+	assert.Equal(t, events.TypePeerAdded, got[0].Type)
+	assert.Equal(t, "p2", got[0].Peer)
+	assert.Equal(t, "added p2", got[0].Message)
+}
+
+func TestServer_eventsError(t *testing.T) {
+	path := startServer(t, &fakeHandler{err: errors.New("nope")})
+
+	c, err := Dial(path)
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.Events(nil, func(e *events.Event) error {
+		require.Fail(t, "should not get events")
+		return nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nope")
+}
@@ -34,7 +34,7 @@ func IsDeviceRouter(dev *wgtypes.Device) bool {
 	otherRouters := false
 	for _, p := range dev.Peers {
 		if IsPeerRouter(&p) {
-			log.Debug("Router autodetect: found router peer %v", p.PublicKey)
+			log.Trust.Debug("Router autodetect: found router peer %v", p.PublicKey)
 			otherRouters = true
 			break
 		}
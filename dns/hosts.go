@@ -0,0 +1,189 @@
+package dns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// hostsMu serializes rewrites of hosts files, as several interfaces may keep
+// their blocks in the same one
+var hostsMu sync.Mutex
+
+// HostsFile keeps a block of entries for the names of peers in a hosts file,
+// delimited by marker comments so the rest of the file is left alone.
+type HostsFile struct {
+	path  string
+	begin string
+	end   string
+	// last is the block most recently written, to avoid rewriting the file
+	// when nothing has changed
+	last []byte
+}
+
+// NewHostsFile creates a HostsFile that keeps the block for the given
+// interface in the hosts file at path. Nothing is written until Update is
+// called.
+func NewHostsFile(path, iface string) *HostsFile {
+	return &HostsFile{
+		path:  path,
+		begin: "# BEGIN wirelink " + iface,
+		end:   "# END wirelink " + iface,
+	}
+}
+
+// Path returns the path of the hosts file
+func (h *HostsFile) Path() string {
+	return h.path
+}
+
+// Update rewrites the block in the hosts file to hold the entries for the
+// zone, if they have changed since the last update
+func (h *HostsFile) Update(zone Zone) error {
+	block := h.block(zone)
+	if h.last != nil && bytes.Equal(block, h.last) {
+		return nil
+	}
+	if err := h.rewrite(block); err != nil {
+		return err
+	}
+	h.last = block
+	return nil
+}
+
+// Remove removes the block from the hosts file
+func (h *HostsFile) Remove() error {
+	if err := h.rewrite(nil); err != nil {
+		return err
+	}
+	h.last = nil
+	return nil
+}
+
+// block formats the hosts file lines for the zone, including the markers.
+// Each single host address gets a line with the fully qualified and the short
+// form of every name of the peer. Link local addresses are left out, as hosts
+// files can't give them the zone they need.
+func (h *HostsFile) block(zone Zone) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(h.begin)
+	buf.WriteByte('\n')
+	for _, host := range zone {
+		var names []string
+		for _, n := range host.Names {
+			if l := Label(n); l != "" && !slices.Contains(names, l) {
+				names = append(names, l+"."+strings.TrimSuffix(Domain, "."), l)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		for _, a := range host.Addrs {
+			if a.IsLinkLocalUnicast() {
+				continue
+			}
+			fmt.Fprintf(&buf, "%s\t%s\n", a, strings.Join(names, " "))
+		}
+	}
+	buf.WriteString(h.end)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// replaceBlock returns the content with the block between the markers
+// replaced, or the block appended if the markers aren't present. A nil block
+// removes the existing one.
+func (h *HostsFile) replaceBlock(content, block []byte) ([]byte, error) {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	start, stop := -1, -1
+	for i, line := range lines {
+		switch string(bytes.TrimRight(line, "\r\n")) {
+		case h.begin:
+			if start < 0 {
+				start = i
+			}
+		case h.end:
+			if start >= 0 && stop < 0 {
+				stop = i
+			}
+		}
+	}
+	if start >= 0 && stop < 0 {
+		return nil, fmt.Errorf("found %q without %q", h.begin, h.end)
+	}
+
+	var ret []byte
+	if start < 0 {
+		ret = content
+		if len(ret) > 0 && ret[len(ret)-1] != '\n' && block != nil {
+			ret = append(ret, '\n')
+		}
+		return append(ret, block...), nil
+	}
+	ret = append(ret, bytes.Join(lines[:start], nil)...)
+	ret = append(ret, block...)
+	return append(ret, bytes.Join(lines[stop+1:], nil)...), nil
+}
+
+// rewrite replaces the block in the file, by writing the new content to a
+// temporary file and renaming it over the original
+func (h *HostsFile) rewrite(block []byte) error {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	mode := os.FileMode(0o644)
+	content, err := os.ReadFile(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		if block == nil {
+			// nothing to remove
+			return nil
+		}
+	} else if err != nil {
+		return fmt.Errorf("unable to read hosts file %s: %w", h.path, err)
+	} else if info, err := os.Stat(h.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	newContent, err := h.replaceBlock(content, block)
+	if err != nil {
+		return fmt.Errorf("unable to update hosts file %s: %w", h.path, err)
+	}
+	if bytes.Equal(newContent, content) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), "."+filepath.Base(h.path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary hosts file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(newContent)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write temporary hosts file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), h.path); err != nil {
+		if !errors.Is(err, syscall.EBUSY) {
+			return fmt.Errorf("unable to replace hosts file %s: %w", h.path, err)
+		}
+		// hosts files in containers are often bind mounts, which can't be
+		// replaced, so the best we can do is rewrite them in place
+		if err = os.WriteFile(h.path, newContent, mode); err != nil {
+			return fmt.Errorf("unable to rewrite hosts file %s: %w", h.path, err)
+		}
+	}
+	return nil
+}
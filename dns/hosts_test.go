@@ -0,0 +1,145 @@
+package dns
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+)
+
+func TestHostsFile_block(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	k3 := testutils.MustKey(t)
+	h := NewHostsFile("hosts", "wg0")
+
+	assert.Equal(t, "# BEGIN wirelink wg0\n# END wirelink wg0\n", string(h.block(nil)))
+
+	zone := Zone{
+		{
+			Key:   k1,
+			Names: []string{"Build Box", "build-box", "builder"},
+			Addrs: []net.IP{net.ParseIP("fe80::1"), net.IPv4(10, 0, 0, 1), net.ParseIP("fd00::1")},
+		},
+		// no name
+		{Key: k2, Addrs: []net.IP{net.IPv4(10, 0, 0, 2)}},
+		// no usable address
+		{Key: k3, Names: []string{"three"}, Addrs: []net.IP{net.ParseIP("fe80::3")}},
+	}
+	assert.Equal(t,
+		"# BEGIN wirelink wg0\n"+
+			"10.0.0.1\tbuild-box.wg build-box builder.wg builder\n"+
+			"fd00::1\tbuild-box.wg build-box builder.wg builder\n"+
+			"# END wirelink wg0\n",
+		string(h.block(zone)),
+	)
+}
+
+func TestHostsFile_replaceBlock(t *testing.T) {
+	h := NewHostsFile("hosts", "wg0")
+	block := []byte("# BEGIN wirelink wg0\n10.0.0.1\tx.wg x\n# END wirelink wg0\n")
+
+	tests := []struct {
+		name    string
+		content string
+		block   []byte
+		want    string
+		wantErr bool
+	}{
+		{"empty", "", block, string(block), false},
+		{"append", "127.0.0.1\tlocalhost\n", block, "127.0.0.1\tlocalhost\n" + string(block), false},
+		{"append no newline", "127.0.0.1\tlocalhost", block, "127.0.0.1\tlocalhost\n" + string(block), false},
+		{
+			"replace",
+			"a\n# BEGIN wirelink wg0\nold\n# END wirelink wg0\nb\n",
+			block,
+			"a\n" + string(block) + "b\n",
+			false,
+		},
+		{
+			"other iface",
+			"# BEGIN wirelink wg1\nother\n# END wirelink wg1\n",
+			block,
+			"# BEGIN wirelink wg1\nother\n# END wirelink wg1\n" + string(block),
+			false,
+		},
+		{
+			"remove",
+			"a\n# BEGIN wirelink wg0\nold\n# END wirelink wg0\nb\n",
+			nil,
+			"a\nb\n",
+			false,
+		},
+		{"remove missing", "a\n", nil, "a\n", false},
+		{"unterminated", "a\n# BEGIN wirelink wg0\nb\n", block, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.replaceBlock([]byte(tt.content), tt.block)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestHostsFile(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	path := filepath.Join(t.TempDir(), "hosts")
+	original := "127.0.0.1\tlocalhost\n"
+	require.NoError(t, os.WriteFile(path, []byte(original), 0o640))
+
+	h := NewHostsFile(path, "wg0")
+	zone := Zone{{Key: k1, Names: []string{"box"}, Addrs: []net.IP{net.IPv4(10, 0, 0, 1)}}}
+	require.NoError(t, h.Update(zone))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original+"# BEGIN wirelink wg0\n10.0.0.1\tbox.wg box\n# END wirelink wg0\n", string(content))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	// an unchanged zone doesn't rewrite the file
+	require.NoError(t, os.WriteFile(path, []byte(original), 0o640))
+	require.NoError(t, h.Update(zone))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, string(content))
+
+	zone[0].Addrs = append(zone[0].Addrs, net.IPv4(10, 0, 0, 2))
+	require.NoError(t, h.Update(zone))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original+"# BEGIN wirelink wg0\n10.0.0.1\tbox.wg box\n10.0.0.2\tbox.wg box\n# END wirelink wg0\n", string(content))
+
+	require.NoError(t, h.Remove())
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, string(content))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files should be cleaned up")
+}
+
+func TestHostsFile_missing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	h := NewHostsFile(path, "wg0")
+
+	require.NoError(t, h.Remove())
+	_, err := os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, h.Update(nil))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "# BEGIN wirelink wg0\n# END wirelink wg0\n", string(content))
+}
@@ -0,0 +1,164 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/fastcat/wirelink/log"
+)
+
+// maxUDPResponse is the largest response that may be sent over UDP to a client
+// that doesn't advertise support for more
+const maxUDPResponse = 512
+
+// Server answers DNS queries over UDP for the names in a Zone
+type Server struct {
+	conn net.PacketConn
+	zone func() Zone
+}
+
+// Listen opens a UDP socket on the given address for answering queries. The
+// zone function is called for each query, so answers follow changes to it.
+func Listen(addr string, zone func() Zone) (*Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for DNS queries on %s: %w", addr, err)
+	}
+	return &Server{conn: conn, zone: zone}, nil
+}
+
+// Addr returns the address on which the server is listening
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Serve answers queries until the context is cancelled, at which point it
+// closes the socket. It only returns an error if serving fails for some other
+// reason.
+func (s *Server) Serve(ctx context.Context) error {
+	defer s.conn.Close()
+	// closing the socket is how the read loop is stopped
+	stop := context.AfterFunc(ctx, func() { s.conn.Close() })
+	defer stop()
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to serve DNS: %w", err)
+		}
+		resp, err := respond(s.zone(), buf[:n])
+		if err != nil {
+			log.Debug("Ignoring bad DNS query from %v: %v", from, err)
+			continue
+		}
+		if _, err = s.conn.WriteTo(resp, from); err != nil {
+			log.Error("Unable to send DNS response to %v: %v", from, err)
+		}
+	}
+}
+
+// respond builds the response to a single query
+func respond(zone Zone, query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse query header: %w", err)
+	}
+	if h.Response {
+		return nil, errors.New("message is a response, not a query")
+	}
+	rh := dnsmessage.Header{
+		ID:               h.ID,
+		Response:         true,
+		OpCode:           h.OpCode,
+		RecursionDesired: h.RecursionDesired,
+	}
+	q, err := p.Question()
+	if h.OpCode != 0 {
+		rh.RCode = dnsmessage.RCodeNotImplemented
+		return build(rh, nil, nil)
+	} else if err != nil {
+		rh.RCode = dnsmessage.RCodeFormatError
+		return build(rh, nil, nil)
+	}
+	questions := []dnsmessage.Question{q}
+
+	if !InZone(q.Name.String()) {
+		// we aren't a recursive resolver
+		rh.RCode = dnsmessage.RCodeRefused
+		return build(rh, questions, nil)
+	}
+	rh.Authoritative = true
+	addrs, found := zone.Lookup(q.Name.String())
+	if !found {
+		rh.RCode = dnsmessage.RCodeNameError
+		return build(rh, questions, nil)
+	}
+	if q.Class != dnsmessage.ClassINET && q.Class != dnsmessage.ClassANY {
+		return build(rh, questions, nil)
+	}
+	var answers []net.IP
+	for _, a := range addrs {
+		v4 := a.To4() != nil
+		if v4 && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL) ||
+			!v4 && (q.Type == dnsmessage.TypeAAAA || q.Type == dnsmessage.TypeALL) {
+			answers = append(answers, a)
+		}
+	}
+	return build(rh, questions, answers)
+}
+
+// build encodes a response, truncating it if it has too many answers to fit
+// in a UDP packet
+func build(h dnsmessage.Header, questions []dnsmessage.Question, answers []net.IP) ([]byte, error) {
+	resp, err := encode(h, questions, answers)
+	if err == nil && len(resp) > maxUDPResponse {
+		h.Truncated = true
+		resp, err = encode(h, questions, nil)
+	}
+	return resp, err
+}
+
+func encode(h dnsmessage.Header, questions []dnsmessage.Question, answers []net.IP) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, maxUDPResponse), h)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, q := range questions {
+		if err := b.Question(q); err != nil {
+			return nil, fmt.Errorf("unable to encode question: %w", err)
+		}
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	for _, a := range answers {
+		rh := dnsmessage.ResourceHeader{
+			Name:  questions[0].Name,
+			Class: dnsmessage.ClassINET,
+			TTL:   uint32(TTL.Seconds()),
+		}
+		var err error
+		if v4 := a.To4(); v4 != nil {
+			r := dnsmessage.AResource{}
+			copy(r.A[:], v4)
+			err = b.AResource(rh, r)
+		} else {
+			r := dnsmessage.AAAAResource{}
+			copy(r.AAAA[:], a.To16())
+			err = b.AAAAResource(rh, r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode answer: %w", err)
+		}
+	}
+	return b.Finish()
+}
@@ -0,0 +1,168 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+)
+
+func query(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	require.NoError(t, b.StartQuestions())
+	require.NoError(t, b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  qtype,
+		Class: dnsmessage.ClassINET,
+	}))
+	msg, err := b.Finish()
+	require.NoError(t, err)
+	return msg
+}
+
+func Test_respond(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	ip4 := net.IPv4(10, 0, 0, 1).To4()
+	ip6 := net.ParseIP("fe80::1")
+	zone := Zone{{Key: k1, Names: []string{"box"}, Addrs: []net.IP{ip4, ip6}}}
+	var many []net.IP
+	for i := range 40 {
+		many = append(many, net.IPv4(10, 0, 1, byte(i)).To4())
+	}
+
+	tests := []struct {
+		name      string
+		zone      Zone
+		query     []byte
+		wantRCode dnsmessage.RCode
+		wantAuth  bool
+		wantTrunc bool
+		want      []dnsmessage.Resource
+	}{
+		{
+			"A",
+			zone,
+			query(t, "box.wg.", dnsmessage.TypeA),
+			dnsmessage.RCodeSuccess, true, false,
+			[]dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{
+					Name:   dnsmessage.MustNewName("box.wg."),
+					Type:   dnsmessage.TypeA,
+					Class:  dnsmessage.ClassINET,
+					TTL:    uint32(TTL.Seconds()),
+					Length: 4,
+				},
+				Body: &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}},
+			}},
+		},
+		{
+			"AAAA",
+			zone,
+			query(t, "box.wg.", dnsmessage.TypeAAAA),
+			dnsmessage.RCodeSuccess, true, false,
+			[]dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{
+					Name:   dnsmessage.MustNewName("box.wg."),
+					Type:   dnsmessage.TypeAAAA,
+					Class:  dnsmessage.ClassINET,
+					TTL:    uint32(TTL.Seconds()),
+					Length: 16,
+				},
+				Body: &dnsmessage.AAAAResource{AAAA: [16]byte(ip6.To16())},
+			}},
+		},
+		{
+			"no data",
+			zone,
+			query(t, "box.wg.", dnsmessage.TypeMX),
+			dnsmessage.RCodeSuccess, true, false,
+			nil,
+		},
+		{
+			"missing",
+			zone,
+			query(t, "nope.wg.", dnsmessage.TypeA),
+			dnsmessage.RCodeNameError, true, false,
+			nil,
+		},
+		{
+			"other zone",
+			zone,
+			query(t, "example.com.", dnsmessage.TypeA),
+			dnsmessage.RCodeRefused, false, false,
+			nil,
+		},
+		{
+			"truncated",
+			Zone{{Key: k1, Names: []string{"box"}, Addrs: many}},
+			query(t, "box.wg.", dnsmessage.TypeA),
+			dnsmessage.RCodeSuccess, true, true,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := respond(tt.zone, tt.query)
+			require.NoError(t, err)
+			var msg dnsmessage.Message
+			require.NoError(t, msg.Unpack(resp))
+			assert.Equal(t, uint16(42), msg.ID)
+			assert.True(t, msg.Response)
+			assert.True(t, msg.RecursionDesired)
+			assert.False(t, msg.RecursionAvailable)
+			assert.Equal(t, tt.wantRCode, msg.RCode)
+			assert.Equal(t, tt.wantAuth, msg.Authoritative)
+			assert.Equal(t, tt.wantTrunc, msg.Truncated)
+			assert.Len(t, msg.Questions, 1)
+			if tt.want == nil {
+				assert.Empty(t, msg.Answers)
+			} else {
+				assert.Equal(t, tt.want, msg.Answers)
+			}
+		})
+	}
+}
+
+func Test_respond_invalid(t *testing.T) {
+	_, err := respond(nil, []byte{1, 2, 3})
+	assert.Error(t, err)
+
+	q := query(t, "box.wg.", dnsmessage.TypeA)
+	// set the response bit
+	q[2] |= 0x80
+	_, err = respond(nil, q)
+	assert.Error(t, err)
+}
+
+func TestServer(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	zone := Zone{{Key: k1, Names: []string{"box"}, Addrs: []net.IP{net.IPv4(10, 0, 0, 1)}}}
+	s, err := Listen("127.0.0.1:0", func() Zone { return zone })
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Write(query(t, "box.wg.", dnsmessage.TypeA))
+	require.NoError(t, err)
+	buf := make([]byte, maxUDPResponse)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(buf[:n]))
+	require.Len(t, msg.Answers, 1)
+	assert.Equal(t, &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}}, msg.Answers[0].Body)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
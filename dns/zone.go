@@ -0,0 +1,108 @@
+// Package dns makes the names of the peers in a wirelink network resolvable,
+// by answering DNS queries for them or by keeping them in a hosts file, so
+// they can be reached by name instead of by address.
+package dns
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Domain is the zone in which peer names are served
+const Domain = "wg."
+
+// MinKeyPrefix is the shortest prefix of a peer's public key that can be
+// used to look it up
+const MinKeyPrefix = 4
+
+// TTL is how long answers may be cached. It is kept short, as peers and their
+// addresses can change at any time.
+const TTL = 30 * time.Second
+
+// Host is a peer that can be looked up in the zone
+type Host struct {
+	Key   wgtypes.Key
+	Names []string
+	Addrs []net.IP
+}
+
+// Zone is the set of hosts served
+type Zone []Host
+
+// Label converts a peer name into a DNS label, by lower casing it and
+// replacing runs of characters other than letters and digits with a dash. It
+// returns the empty string if nothing usable is left.
+func Label(name string) string {
+	var ret strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			if dash && ret.Len() > 0 {
+				ret.WriteByte('-')
+			}
+			dash = false
+			ret.WriteRune(c)
+		} else {
+			dash = true
+		}
+	}
+	if ret.Len() > 63 {
+		return strings.TrimRight(ret.String()[:63], "-")
+	}
+	return ret.String()
+}
+
+// InZone returns whether the given fully qualified name is Domain or a name
+// within it
+func InZone(name string) bool {
+	name = strings.ToLower(name)
+	return name == Domain || strings.HasSuffix(name, "."+Domain)
+}
+
+// Lookup finds the addresses for the given fully qualified name, which must be
+// InZone. Names are matched first against the labels of host names, and then
+// against unique key prefixes. The second return is false if the name doesn't
+// exist in the zone.
+func (z Zone) Lookup(name string) ([]net.IP, bool) {
+	name = strings.ToLower(name)
+	if name == Domain {
+		return nil, true
+	}
+	label, ok := strings.CutSuffix(name, "."+Domain)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return nil, false
+	}
+
+	var ret []net.IP
+	found := false
+	for _, h := range z {
+		for _, n := range h.Names {
+			if Label(n) == label {
+				ret = append(ret, h.Addrs...)
+				found = true
+				break
+			}
+		}
+	}
+	if found || len(label) < MinKeyPrefix {
+		return ret, found
+	}
+
+	var match *Host
+	for i, h := range z {
+		if strings.HasPrefix(strings.ToLower(h.Key.String()), label) {
+			if match != nil {
+				// ambiguous prefix
+				return nil, false
+			}
+			match = &z[i]
+		}
+	}
+	if match == nil {
+		return nil, false
+	}
+	return match.Addrs, true
+}
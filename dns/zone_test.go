@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+)
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"build-box", "build-box"},
+		{"Build Box", "build-box"},
+		{"  laptop (work)  ", "laptop-work"},
+		{"a__b", "a-b"},
+		{"!!!", ""},
+		{"", ""},
+		{strings.Repeat("a", 70), strings.Repeat("a", 63)},
+		{strings.Repeat("a", 62) + " b", strings.Repeat("a", 62)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Label(tt.name))
+		})
+	}
+}
+
+func TestInZone(t *testing.T) {
+	assert.True(t, InZone("wg."))
+	assert.True(t, InZone("host.wg."))
+	assert.True(t, InZone("Host.WG."))
+	assert.False(t, InZone("host.wg"))
+	assert.False(t, InZone("example.com."))
+	assert.False(t, InZone("xwg."))
+}
+
+func TestZone_Lookup(t *testing.T) {
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	// make sure the keys are distinguishable by a short prefix
+	for strings.EqualFold(k1.String()[:MinKeyPrefix], k2.String()[:MinKeyPrefix]) {
+		k2 = testutils.MustKey(t)
+	}
+	ip1 := net.IPv4(10, 0, 0, 1).To4()
+	ip2 := net.ParseIP("fe80::1")
+	ip3 := net.IPv4(10, 0, 0, 2).To4()
+	zone := Zone{
+		{Key: k1, Names: []string{"Build Box"}, Addrs: []net.IP{ip1, ip2}},
+		{Key: k2, Names: []string{"laptop", "alias"}, Addrs: []net.IP{ip3}},
+	}
+	prefix1 := strings.ToLower(k1.String()[:MinKeyPrefix])
+
+	tests := []struct {
+		name      string
+		zone      Zone
+		query     string
+		want      []net.IP
+		wantFound bool
+	}{
+		{"apex", zone, "wg.", nil, true},
+		{"name", zone, "build-box.wg.", []net.IP{ip1, ip2}, true},
+		{"case insensitive", zone, "Build-Box.WG.", []net.IP{ip1, ip2}, true},
+		{"second name", zone, "alias.wg.", []net.IP{ip3}, true},
+		{"missing", zone, "nope.wg.", nil, false},
+		{"subdomain", zone, "x.laptop.wg.", nil, false},
+		{"other zone", zone, "laptop.example.", nil, false},
+		{"key prefix", zone, prefix1 + ".wg.", []net.IP{ip1, ip2}, true},
+		{"short key prefix", zone, prefix1[:MinKeyPrefix-1] + ".wg.", nil, false},
+		{
+			"ambiguous key prefix",
+			Zone{{Key: k1, Addrs: []net.IP{ip1}}, {Key: k1, Addrs: []net.IP{ip3}}},
+			prefix1 + ".wg.",
+			nil,
+			false,
+		},
+		{
+			"duplicate name",
+			Zone{{Key: k1, Names: []string{"x"}, Addrs: []net.IP{ip1}}, {Key: k2, Names: []string{"X"}, Addrs: []net.IP{ip3}}},
+			"x.wg.",
+			[]net.IP{ip1, ip3},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := tt.zone.Lookup(tt.query)
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package events provides a publish/subscribe bus for notable changes in the
+// server state, such as peers changing health, endpoints being tried, or
+// critical facts expiring, so that they can be watched live instead of scraped
+// from the logs.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type identifies what kind of change an Event describes
+type Type string
+
+const (
+	// TypePeerHealth is sent when a peer's healthy or alive state changes
+	TypePeerHealth Type = "peer-health"
+	// TypeEndpoint is sent when we try a new endpoint for a peer
+	TypeEndpoint Type = "endpoint"
+	// TypeAllowedIPsAdd is sent when we add AllowedIPs to a peer
+	TypeAllowedIPsAdd Type = "aip-add"
+	// TypeAllowedIPsReset is sent when we replace the AllowedIPs on a peer
+	TypeAllowedIPsReset Type = "aip-reset"
+	// TypeAllowedIPsRestrict is sent when we restrict a peer to only its
+	// automatic IPv6 link-local address
+	TypeAllowedIPsRestrict Type = "aip-restrict"
+	// TypePeerAdded is sent when we add a new peer to the device
+	TypePeerAdded Type = "peer-added"
+	// TypePeerRemoved is sent when we delete a peer from the device
+	TypePeerRemoved Type = "peer-removed"
+	// TypeFactExpired is sent when a fact that affects connectivity expires
+	TypeFactExpired Type = "fact-expired"
+	// TypeBootID is sent when the local boot id rotates, or when a peer reports
+	// a new boot id (i.e. it rebooted)
+	TypeBootID Type = "bootid"
+)
+
+// Types lists all the event types, in a consistent order for help output
+var Types = []Type{
+	TypePeerHealth,
+	TypeEndpoint,
+	TypeAllowedIPsAdd,
+	TypeAllowedIPsReset,
+	TypeAllowedIPsRestrict,
+	TypePeerAdded,
+	TypePeerRemoved,
+	TypeFactExpired,
+	TypeBootID,
+}
+
+// Event describes a single change. Which of the optional fields are set
+// depends on the Type.
+type Event struct {
+	Time time.Time
+	Type Type
+	// Peer is the public key of the peer the event concerns, if any
+	Peer     string `json:",omitempty"`
+	PeerName string `json:",omitempty"`
+	// Healthy and Alive give the new state for TypePeerHealth. They are
+	// pointers so that a peer going down is distinguishable from other events.
+	Healthy *bool `json:",omitempty"`
+	Alive   *bool `json:",omitempty"`
+	// Endpoint is the endpoint being tried for TypeEndpoint
+	Endpoint string `json:",omitempty"`
+	// AllowedIPs are the ones being added or set for the AllowedIPs events
+	AllowedIPs []string `json:",omitempty"`
+	// Attribute and Fact describe the fact for TypeFactExpired
+	Attribute string `json:",omitempty"`
+	Fact      string `json:",omitempty"`
+	// BootID is the new boot id for TypeBootID
+	BootID string `json:",omitempty"`
+	// Message is a human readable summary of the event, matching what is logged
+	Message string
+}
+
+// Bus distributes published events to all current subscribers. The zero value
+// is ready to use.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives events from a Bus until it is closed
+type Subscription struct {
+	bus     *Bus
+	ch      chan Event
+	dropped atomic.Uint64
+	once    sync.Once
+}
+
+// Subscribe registers a new subscriber, which will buffer up to the given
+// number of events. If the subscriber falls further behind than that, events
+// will be dropped for it rather than blocking the publisher.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	sub := &Subscription{
+		bus: b,
+		ch:  make(chan Event, buffer),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[*Subscription]struct{})
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish sends the event to all current subscribers without blocking. If the
+// event has no Time, it is set to the current time.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// C returns the channel on which events are delivered. It is closed when the
+// subscription is closed.
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns how many events have been discarded because the subscriber
+// was not keeping up
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unregisters the subscription and closes its channel. It is safe to
+// call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		defer s.bus.mu.Unlock()
+		delete(s.bus.subs, s)
+		close(s.ch)
+	})
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	var b Bus
+	// publishing with no subscribers is fine
+	b.Publish(Event{Type: TypeBootID})
+
+	s1 := b.Subscribe(2)
+	s2 := b.Subscribe(2)
+	defer s2.Close()
+
+	now := time.Now()
+	b.Publish(Event{Type: TypePeerAdded, Peer: "p1", Time: now})
+	b.Publish(Event{Type: TypePeerRemoved, Peer: "p2"})
+
+	for _, s := range []*Subscription{s1, s2} {
+		e := <-s.C()
+		assert.Equal(t, TypePeerAdded, e.Type)
+		assert.Equal(t, now, e.Time)
+		e = <-s.C()
+		assert.Equal(t, TypePeerRemoved, e.Type)
+		assert.False(t, e.Time.IsZero(), "should fill in time")
+	}
+
+	s1.Close()
+	s1.Close()
+	_, ok := <-s1.C()
+	assert.False(t, ok, "closed subscription channel should be closed")
+
+	b.Publish(Event{Type: TypeEndpoint})
+	e := <-s2.C()
+	assert.Equal(t, TypeEndpoint, e.Type)
+}
+
+func TestBus_slowSubscriber(t *testing.T) {
+	var b Bus
+	s := b.Subscribe(1)
+	defer s.Close()
+
+	b.Publish(Event{Type: TypePeerAdded})
+	b.Publish(Event{Type: TypePeerRemoved})
+	b.Publish(Event{Type: TypeEndpoint})
+
+	assert.Equal(t, uint64(2), s.Dropped())
+	e := <-s.C()
+	assert.Equal(t, TypePeerAdded, e.Type)
+	select {
+	case e, ok := <-s.C():
+		require.Fail(t, "unexpected event", "%v %v", e, ok)
+	default:
+	}
+}
+
+func TestEvent_JSON(t *testing.T) {
+	down, err := json.Marshal(Event{Type: TypePeerHealth, Healthy: new(false), Alive: new(false)})
+	require.NoError(t, err)
+	assert.Contains(t, string(down), `"Healthy":false`)
+	assert.Contains(t, string(down), `"Alive":false`)
+
+	other, err := json.Marshal(Event{Type: TypePeerAdded})
+	require.NoError(t, err)
+	assert.NotContains(t, string(other), "Healthy")
+	assert.NotContains(t, string(other), "Alive")
+}
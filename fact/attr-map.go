@@ -0,0 +1,162 @@
+package fact
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fastcat/wirelink/log"
+)
+
+// attribute maps are the wire format shared by values that hold a set of
+// single byte keyed attributes, such as MemberMetadata: a uvarint total
+// length, followed by each attribute byte, the uvarint length of its value,
+// and the value bytes.
+
+type stringValidator func(string) error
+
+// validateUvarint checks the value is exactly one uvarint
+func validateUvarint(value string) error {
+	if _, n := binary.Uvarint([]byte(value)); n <= 0 || n != len(value) {
+		return fmt.Errorf("invalid uvarint encoding, len=%d", len(value))
+	}
+	return nil
+}
+
+// marshalAttrMap encodes the attributes in the given order, validating any
+// that have a validator. The kind is used in error and log messages.
+func marshalAttrMap[A ~byte](
+	kind string,
+	attributes map[A]string,
+	order []A,
+	validators map[A]stringValidator,
+) ([]byte, error) {
+	// start the buffer out with enough room for the length bytes that will be
+	// added at the end, plus a guess at the smallest possible size for the
+	// attribute data
+	buf := make([]byte, binary.MaxVarintLen16, binary.MaxVarintLen16+len(attributes)*(1+binary.MaxVarintLen16))
+
+	// temp buffer and size for doing uvarint encodings
+	tmp := make([]byte, binary.MaxVarintLen64)
+	var l int
+
+	for _, a := range order {
+		v := attributes[a]
+		validator := validators[a]
+		if validator != nil {
+			if err := validator(v); err != nil {
+				return nil, fmt.Errorf("invalid %s attribute value: %w", kind, err)
+			}
+		} else {
+			// this is at debug because we re-send stuff we got from elsewhere
+			log.Debug("Encoding unrecognized %s attribute %d", kind, int(a))
+		}
+		buf = append(buf, byte(a))
+		l = binary.PutUvarint(tmp, uint64(len(v)))
+		buf = append(buf, tmp[:l]...)
+		buf = append(buf, v...)
+	}
+
+	l = binary.PutUvarint(tmp, uint64(len(buf)-binary.MaxVarintLen16))
+	if l > binary.MaxVarintLen16 {
+		return nil, fmt.Errorf("%s attributes length overflow: %d -> %d > 65535", kind, len(attributes), l)
+	}
+
+	// place the length bytes so that they abut the start of the data
+	start := binary.MaxVarintLen16 - l
+	copy(buf[start:], tmp[:l])
+
+	return buf[start:], nil
+}
+
+// decodeAttrMap reads an attribute map from the reader, validating any
+// attributes that have a validator, and keeping any that are unrecognized.
+// If an individual attribute fails to decode, the ones decoded before it are
+// returned along with the error.
+func decodeAttrMap[A ~byte](
+	kind string,
+	reader io.Reader,
+	validators map[A]stringValidator,
+) (map[A]string, error) {
+	var br io.ByteReader
+	var ok bool
+	if br, ok = reader.(io.ByteReader); !ok {
+		return nil, errors.New("cannot decode without a ByteReader")
+	}
+	payloadLen, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s length: %w", kind, err)
+	}
+	// TODO: trace the calls to ReadByte from the above, so that we can validate
+	// we don't exceed lengthHint. Not important as we expect lengthHint to be
+	// zero always for these value types
+
+	// check for bogus payload lengths
+	if payloadLen > MaxPayloadLen {
+		return nil, fmt.Errorf("bad payload length: %d > %d", payloadLen, MaxPayloadLen)
+	} else if b, ok := reader.(interface{ Len() int }); ok && payloadLen > uint64(b.Len()) {
+		// generally bytes.Buffer or bytes.Reader
+		return nil, fmt.Errorf("bad payload length: %d > %d", payloadLen, b.Len())
+	}
+
+	payload := make([]byte, payloadLen)
+	if _, err = io.ReadFull(reader, payload); err != nil {
+		return nil, fmt.Errorf("unable to read %s attributes payload: %w", kind, err)
+	}
+
+	attributes := make(map[A]string)
+	for p := 0; p < len(payload); {
+		n, err := decodeAttr(kind, attributes, validators, payload, p)
+		if err != nil {
+			// return what we have decoded so far for diagnostics
+			return attributes, err
+		}
+		payload = payload[n:]
+	}
+
+	return attributes, nil
+}
+
+// decodeAttr attempts to decode the first attribute from payload starting at
+// offset p, and returns the new offset for the remaining bytes and any error
+// encountered. If an error is encountered, the remaining bytes may not be
+// aligned to the start of the next attribute. If no error is encountered,
+// attributes is updated.
+func decodeAttr[A ~byte](
+	kind string,
+	attributes map[A]string,
+	validators map[A]stringValidator,
+	payload []byte,
+	offset int,
+) (int, error) {
+	a := A(payload[0])
+	p := offset + 1
+	if _, ok := attributes[a]; ok {
+		return p, fmt.Errorf("duplicate attribute at payload offset %d: %d", offset, int(a))
+	}
+
+	al, n := binary.Uvarint(payload[p:])
+	if n <= 0 {
+		return p, fmt.Errorf("attribute length encoding error at payload offset %d", p-n)
+	}
+	p += n
+	ep := p + int(al)
+	if al > MaxPayloadLen || ep < p || ep > len(payload) {
+		return p, fmt.Errorf("attribute length overflow at payload offset %d: +%d vs %d", p, al, len(payload))
+	}
+	v := string(payload[p:ep])
+	p = ep
+
+	if validator := validators[a]; validator != nil {
+		if err := validator(v); err != nil {
+			return p, fmt.Errorf("invalid %s attribute value: %w", kind, err)
+		}
+	} else {
+		// not an error, we'll just ignore this value
+		log.Info("Decoding unrecognized %s attribute at payload offset %d: %d", kind, offset, int(a))
+	}
+
+	attributes[a] = v
+	return p, nil
+}
@@ -0,0 +1,164 @@
+package fact
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// MaxDigestBuckets is the most buckets a Digest may have, which keeps it small
+// enough to fit in a packet with room to spare.
+const MaxDigestBuckets = 64
+
+// DigestBucket summarizes the facts in one bucket of a Digest.
+type DigestBucket struct {
+	// Count is the number of facts in the bucket
+	Count int
+	// Hash combines the keys of all the facts in the bucket
+	Hash uint32
+	// MinTTL is the shortest remaining TTL of the facts in the bucket
+	MinTTL time.Duration
+}
+
+// Digest is a compact summary of a set of facts, used by a peer to tell
+// another which of its facts it has. Facts are grouped into buckets by their
+// subject, so that a mismatch only requires the facts about a few subjects to
+// be re-sent.
+type Digest struct {
+	Buckets []DigestBucket
+}
+
+var _ Value = &Digest{}
+
+// DigestBucketCount returns the number of buckets to use for a digest of the
+// given number of facts.
+func DigestBucketCount(facts int) int {
+	if facts <= 1 {
+		return 1
+	}
+	return min(1<<bits.Len(uint(facts-1)), MaxDigestBuckets)
+}
+
+// NewDigest creates an empty Digest with the given number of buckets, which
+// should come from DigestBucketCount.
+func NewDigest(buckets int) *Digest {
+	return &Digest{Buckets: make([]DigestBucket, buckets)}
+}
+
+// Bucket returns the index of the bucket that facts with the given key go into.
+func (d *Digest) Bucket(k Key) int {
+	h := fnv.New32a()
+	h.Write([]byte(k.subject))
+	return int(h.Sum32() & uint32(len(d.Buckets)-1))
+}
+
+// Add includes the fact with the given key and remaining TTL in the digest.
+func (d *Digest) Add(k Key, ttl time.Duration) {
+	h := fnv.New32a()
+	h.Write([]byte{byte(k.Attribute)})
+	h.Write([]byte(k.subject))
+	h.Write([]byte(k.value))
+
+	b := &d.Buckets[d.Bucket(k)]
+	if b.Count == 0 || ttl < b.MinTTL {
+		b.MinTTL = ttl
+	}
+	b.Count++
+	// xor makes the hash independent of the order facts are added
+	b.Hash ^= h.Sum32()
+}
+
+// Mismatched compares a digest received from a peer to the one expected for
+// what we sent it, which must have the same number of buckets, and returns the
+// indexes of the buckets where the peer is missing facts, has different ones,
+// or has ones that will expire more than tolerance sooner than expected.
+func (d *Digest) Mismatched(expected *Digest, tolerance time.Duration) []int {
+	var ret []int
+	for i, e := range expected.Buckets {
+		if i >= len(d.Buckets) {
+			ret = append(ret, i)
+			continue
+		}
+		b := d.Buckets[i]
+		if b.Count != e.Count || b.Hash != e.Hash || b.Count != 0 && b.MinTTL+tolerance < e.MinTTL {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// MarshalBinary implements BinaryEncoder
+func (d *Digest) MarshalBinary() ([]byte, error) {
+	if n := len(d.Buckets); n < 1 || n > MaxDigestBuckets || n&(n-1) != 0 {
+		return nil, fmt.Errorf("invalid digest bucket count: %d", n)
+	}
+	buf := binary.AppendUvarint(nil, uint64(len(d.Buckets)))
+	for _, b := range d.Buckets {
+		buf = binary.AppendUvarint(buf, uint64(b.Count))
+		if b.Count == 0 {
+			continue
+		}
+		buf = binary.BigEndian.AppendUint32(buf, b.Hash)
+		ttl := min(max(b.MinTTL/time.Second, 0), math.MaxUint16)
+		buf = binary.AppendUvarint(buf, uint64(ttl))
+	}
+	return buf, nil
+}
+
+// DecodeFrom implements Decodable
+func (d *Digest) DecodeFrom(_ int, reader io.Reader) error {
+	var br io.ByteReader
+	var ok bool
+	if br, ok = reader.(io.ByteReader); !ok {
+		return errors.New("cannot decode without a ByteReader")
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("unable to read digest bucket count: %w", err)
+	}
+	if n < 1 || n > MaxDigestBuckets || n&(n-1) != 0 {
+		return fmt.Errorf("invalid digest bucket count: %d", n)
+	}
+	buckets := make([]DigestBucket, n)
+	for i := range buckets {
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return fmt.Errorf("unable to read digest bucket %d count: %w", i, err)
+		}
+		if count > MaxPayloadLen {
+			return fmt.Errorf("invalid digest bucket %d count: %d", i, count)
+		}
+		buckets[i].Count = int(count)
+		if count == 0 {
+			continue
+		}
+		var hash [4]byte
+		if _, err = io.ReadFull(reader, hash[:]); err != nil {
+			return fmt.Errorf("unable to read digest bucket %d hash: %w", i, err)
+		}
+		buckets[i].Hash = binary.BigEndian.Uint32(hash[:])
+		ttl, err := binary.ReadUvarint(br)
+		if err != nil {
+			return fmt.Errorf("unable to read digest bucket %d ttl: %w", i, err)
+		}
+		if ttl > math.MaxUint16 {
+			return fmt.Errorf("invalid digest bucket %d ttl: %d", i, ttl)
+		}
+		buckets[i].MinTTL = time.Duration(ttl) * time.Second
+	}
+	d.Buckets = buckets
+	return nil
+}
+
+func (d *Digest) String() string {
+	facts := 0
+	for _, b := range d.Buckets {
+		facts += b.Count
+	}
+	return fmt.Sprintf("%d facts in %d buckets", facts, len(d.Buckets))
+}
@@ -0,0 +1,141 @@
+package fact
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestBucketCount(t *testing.T) {
+	tests := []struct {
+		facts int
+		want  int
+	}{
+		{0, 1},
+		{1, 1},
+		{2, 2},
+		{3, 4},
+		{4, 4},
+		{5, 8},
+		{64, 64},
+		{1000, MaxDigestBuckets},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, DigestBucketCount(tt.facts), "facts=%d", tt.facts)
+	}
+}
+
+func mustDigestKeys(t *testing.T, n int) []Key {
+	ret := make([]Key, n)
+	for i := range ret {
+		ret[i] = KeyOf(&Fact{
+			Attribute: AttributeMemberMetadata,
+			Subject:   &PeerSubject{Key: testutils.MustKey(t)},
+			Value:     (&MemberMetadata{}).With("", false),
+		})
+	}
+	return ret
+}
+
+func TestDigest_Add(t *testing.T) {
+	keys := mustDigestKeys(t, 5)
+	d1 := NewDigest(4)
+	d2 := NewDigest(4)
+	for i := range keys {
+		d1.Add(keys[i], time.Duration(i+1)*time.Minute)
+		d2.Add(keys[len(keys)-1-i], time.Duration(len(keys)-i)*time.Minute)
+	}
+	assert.Equal(t, d1, d2, "order should not matter")
+
+	count := 0
+	for _, b := range d1.Buckets {
+		count += b.Count
+	}
+	assert.Equal(t, len(keys), count)
+	assert.Equal(t, time.Minute, d1.Buckets[d1.Bucket(keys[0])].MinTTL)
+}
+
+func TestDigest_Mismatched(t *testing.T) {
+	keys := mustDigestKeys(t, 3)
+	build := func(ttl time.Duration, keys ...Key) *Digest {
+		d := NewDigest(2)
+		for _, k := range keys {
+			d.Add(k, ttl)
+		}
+		return d
+	}
+	full := build(time.Hour, keys...)
+
+	assert.Empty(t, full.Mismatched(full, 0))
+	assert.Empty(t, build(time.Hour-time.Second, keys...).Mismatched(full, time.Second))
+	assert.Equal(t, []int{full.Bucket(keys[2])}, build(time.Hour, keys[:2]...).Mismatched(build(time.Hour, keys...), 0))
+	stale := build(time.Hour, keys...)
+	stale.Buckets[full.Bucket(keys[0])].MinTTL = time.Minute
+	assert.Equal(t, []int{full.Bucket(keys[0])}, stale.Mismatched(full, time.Second))
+	assert.Equal(t, []int{1}, NewDigest(1).Mismatched(NewDigest(2), 0))
+}
+
+func TestDigest_MarshalBinary(t *testing.T) {
+	d := &Digest{Buckets: []DigestBucket{
+		{},
+		{Count: 2, Hash: 0x01020304, MinTTL: 300 * time.Second},
+	}}
+	data, err := d.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{2, 0, 2, 1, 2, 3, 4, 0xac, 0x02}, data)
+
+	got := &Digest{}
+	require.NoError(t, got.DecodeFrom(0, bytes.NewReader(data)))
+	assert.Equal(t, d, got)
+
+	_, err = (&Digest{Buckets: make([]DigestBucket, 3)}).MarshalBinary()
+	assert.Error(t, err)
+	_, err = (&Digest{}).MarshalBinary()
+	assert.Error(t, err)
+}
+
+func TestDigest_DecodeFrom(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"empty", []byte{1, 0}, assert.NoError},
+		{"no buckets", []byte{0}, assert.Error},
+		{"not a power of two", []byte{3, 0, 0, 0}, assert.Error},
+		{"too many buckets", []byte{128, 1}, assert.Error},
+		{"truncated hash", []byte{1, 1, 1, 2}, assert.Error},
+		{"missing ttl", []byte{1, 1, 1, 2, 3, 4}, assert.Error},
+		{"ttl overflow", []byte{1, 1, 1, 2, 3, 4, 0x80, 0x80, 0x04}, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertion(t, (&Digest{}).DecodeFrom(0, bytes.NewReader(tt.data)))
+		})
+	}
+}
+
+func TestDigest_Fact(t *testing.T) {
+	now := time.Now()
+	d := NewDigest(2)
+	for _, k := range mustDigestKeys(t, 3) {
+		d.Add(k, time.Minute)
+	}
+	f := &Fact{
+		Attribute: AttributeDigest,
+		Subject:   &PeerSubject{Key: testutils.MustKey(t)},
+		Value:     d,
+		Expires:   now.Add(30 * time.Second),
+	}
+	data, err := f.MarshalBinaryNow(now)
+	require.NoError(t, err)
+	got := &Fact{}
+	require.NoError(t, got.DecodeFrom(0, now, bytes.NewBuffer(data)))
+	assert.Equal(t, f, got)
+	assert.Equal(t, "3 facts in 2 buckets", got.Value.String())
+}
@@ -21,6 +21,18 @@ const (
 	AttributeAllowedCidrV6  Attribute = 'A'
 	AttributeMember         Attribute = 'm'
 	AttributeMemberMetadata Attribute = 'M'
+	// AttributeNetworkTiming facts advertise the timing parameters their subject
+	// wants the whole network to use
+	AttributeNetworkTiming Attribute = 'T'
+	// AttributeDigest facts summarize the facts their sender has received from
+	// their subject, so that it can re-send any that were lost
+	AttributeDigest Attribute = 'D'
+	// AttributeRetraction facts tell peers that the source no longer has some
+	// fact, so they should drop it instead of waiting for it to expire
+	AttributeRetraction Attribute = 'R'
+	// AttributeInterest facts tell peers that their subject wants to be sent
+	// facts about the peer in their value
+	AttributeInterest Attribute = 'I'
 	// A signed group is a bit different from other facts
 	// in this case, the subject is actually the source,
 	// and the value is a signed aggregate of other facts.
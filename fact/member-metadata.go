@@ -2,14 +2,15 @@ package fact
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
+	"slices"
 	"sort"
 	"strings"
 	"unicode/utf8"
 
-	"github.com/fastcat/wirelink/log"
 	"github.com/fastcat/wirelink/util"
 )
 
@@ -22,6 +23,14 @@ const (
 	// MemberIsBasic flags if the member is a "basic" member which only runs
 	// wireguard and not wirelink
 	MemberIsBasic MemberAttribute = 'b'
+	// MemberProtocolVersion is the protocol version the member speaks
+	MemberProtocolVersion MemberAttribute = 'v'
+	// MemberMinProtocolVersion is the oldest protocol version the member can
+	// work with
+	MemberMinProtocolVersion MemberAttribute = 'V'
+	// MemberCapabilities is the list of fact attributes the member understands,
+	// one byte each
+	MemberCapabilities MemberAttribute = 'c'
 )
 
 // MaxPayloadLen is the largest payload size we will try to decode to avoid
@@ -36,8 +45,6 @@ type MemberMetadata struct {
 
 var _ Value = &MemberMetadata{}
 
-type stringValidator func(string) error
-
 // memberMetadataValidators provides a lookup table for validating the inner
 // elements of a MemberMetadata value
 var memberMetadataValidators = map[MemberAttribute]stringValidator{
@@ -56,48 +63,16 @@ var memberMetadataValidators = map[MemberAttribute]stringValidator{
 		}
 		return nil
 	},
+	MemberProtocolVersion:    validateUvarint,
+	MemberMinProtocolVersion: validateUvarint,
+	// any bytes are valid capabilities, we just ignore ones we don't know
+	MemberCapabilities: func(string) error { return nil },
 }
 
 // MarshalBinary implements BinaryEncoder
 func (mm *MemberMetadata) MarshalBinary() ([]byte, error) {
-	// start the buffer out with enough room for the length bytes that will be
-	// added at the end, plus a guess at the smallest possible size for the
-	// attribute data
-	buf := make([]byte, binary.MaxVarintLen16, binary.MaxVarintLen16+len(mm.attributes)*(1+binary.MaxVarintLen16))
-
-	// temp buffer and size for doing uvarint encodings
-	tmp := make([]byte, binary.MaxVarintLen64)
-	var l int
-
 	// important to sort the attributes for equality checks to work properly
-	attrs := mm.sortedAttrs()
-	for _, a := range attrs {
-		v := mm.attributes[a]
-		validator := memberMetadataValidators[a]
-		if validator != nil {
-			if err := validator(v); err != nil {
-				return nil, fmt.Errorf("invalid member attribute value: %w", err)
-			}
-		} else {
-			// this is at debug because we re-send stuff we got from elsewhere
-			log.Debug("Encoding unrecognized member attribute %d", int(a))
-		}
-		buf = append(buf, byte(a))
-		l = binary.PutUvarint(tmp, uint64(len(v)))
-		buf = append(buf, tmp[:l]...)
-		buf = append(buf, v...)
-	}
-
-	l = binary.PutUvarint(tmp, uint64(len(buf)-binary.MaxVarintLen16))
-	if l > binary.MaxVarintLen16 {
-		return nil, fmt.Errorf("member attributes length overflow: %d -> %d > 65535", len(mm.attributes), l)
-	}
-
-	// place the length bytes so that they abut the start of the data
-	start := binary.MaxVarintLen16 - l
-	copy(buf[start:], tmp[:l])
-
-	return buf[start:], nil
+	return marshalAttrMap("member", mm.attributes, mm.sortedAttrs(), memberMetadataValidators)
 }
 
 func (mm *MemberMetadata) sortedAttrs() []MemberAttribute {
@@ -120,79 +95,9 @@ func (mm *MemberMetadata) sortedAttrs() []MemberAttribute {
 
 // DecodeFrom implements Decodable
 func (mm *MemberMetadata) DecodeFrom(_ int, reader io.Reader) error {
-	var br io.ByteReader
-	var ok bool
-	if br, ok = reader.(io.ByteReader); !ok {
-		return errors.New("cannot decode without a ByteReader")
-	}
-	payloadLen, err := binary.ReadUvarint(br)
-	if err != nil {
-		return fmt.Errorf("unable to read metadata length: %w", err)
-	}
-	// TODO: trace the calls to ReadByte from the above, so that we can validate
-	// we don't exceed lengthHint. Not important as we expect lengthHint to be
-	// zero always for this value type
-
-	// check for bogus payload lengths
-	if payloadLen > MaxPayloadLen {
-		return fmt.Errorf("bad payload length: %d > %d", payloadLen, MaxPayloadLen)
-	} else if b, ok := reader.(interface{ Len() int }); ok && payloadLen > uint64(b.Len()) {
-		// generally bytes.Buffer or bytes.Reader
-		return fmt.Errorf("bad payload length: %d > %d", payloadLen, b.Len())
-	}
-
-	payload := make([]byte, payloadLen)
-	if _, err = io.ReadFull(reader, payload); err != nil {
-		return fmt.Errorf("unable to read member attributes payload: %w", err)
-	}
-
-	mm.attributes = make(map[MemberAttribute]string)
-	for p := 0; p < len(payload); {
-		n, err := mm.decodeAttr(payload, p)
-		if err != nil {
-			return err
-		}
-		payload = payload[n:]
-	}
-
-	return nil
-}
-
-// decodeAttr attempts to decode the first attribute from payload starting at
-// offset p, and returns the new offset for the remaining bytes and any error
-// encountered. If an error is encountered, the remaining bytes may not be
-// aligned to the start of the next attribute. If no error is encountered,
-// mm.attributes is updated.
-func (mm *MemberMetadata) decodeAttr(payload []byte, offset int) (int, error) {
-	a := MemberAttribute(payload[0])
-	p := offset + 1
-	if _, ok := mm.attributes[a]; ok {
-		return p, fmt.Errorf("duplicate attribute at payload offset %d: %d", offset, int(a))
-	}
-
-	al, n := binary.Uvarint(payload[p:])
-	if n <= 0 {
-		return p, fmt.Errorf("attribute length encoding error at payload offset %d", p-n)
-	}
-	p += n
-	ep := p + int(al)
-	if al > MaxPayloadLen || ep < p || ep > len(payload) {
-		return p, fmt.Errorf("attribute length overflow at payload offset %d: +%d vs %d", p, al, len(payload))
-	}
-	v := string(payload[p:ep])
-	p = ep
-
-	if validator := memberMetadataValidators[a]; validator != nil {
-		if err := validator(v); err != nil {
-			return p, fmt.Errorf("invalid member attribute value: %w", err)
-		}
-	} else {
-		// not an error, we'll just ignore this value
-		log.Info("Decoding unrecognized member attribute at payload offset %d: %d", offset, int(a))
-	}
-
-	mm.attributes[a] = v
-	return p, nil
+	var err error
+	mm.attributes, err = decodeAttrMap("member", reader, memberMetadataValidators)
+	return err
 }
 
 func (mm *MemberMetadata) String() string {
@@ -266,3 +171,41 @@ func (mm *MemberMetadata) With(name string, basic bool) *MemberMetadata {
 	}
 	return &ret
 }
+
+// WithProtocol returns a copy of the member metadata with the protocol
+// version and capabilities set from pi.
+func (mm *MemberMetadata) WithProtocol(pi ProtocolInfo) *MemberMetadata {
+	ret := &MemberMetadata{attributes: make(map[MemberAttribute]string, len(mm.attributes)+3)}
+	maps.Copy(ret.attributes, mm.attributes)
+	ret.attributes[MemberProtocolVersion] = string(binary.AppendUvarint(nil, uint64(pi.Version)))
+	ret.attributes[MemberMinProtocolVersion] = string(binary.AppendUvarint(nil, uint64(pi.MinVersion)))
+	caps := make([]byte, len(pi.Capabilities))
+	for i, a := range pi.Capabilities {
+		caps[i] = byte(a)
+	}
+	ret.attributes[MemberCapabilities] = string(caps)
+	return ret
+}
+
+// Protocol returns the protocol version and capabilities advertised in the
+// member metadata, and whether they were present.
+func (mm *MemberMetadata) Protocol() (ProtocolInfo, bool) {
+	v, ok := mm.attributes[MemberProtocolVersion]
+	if !ok || validateUvarint(v) != nil {
+		return ProtocolInfo{}, false
+	}
+	var ret ProtocolInfo
+	version, _ := binary.Uvarint([]byte(v))
+	ret.Version = int(min(version, math.MaxInt32))
+	if v, ok := mm.attributes[MemberMinProtocolVersion]; ok && validateUvarint(v) == nil {
+		minVersion, _ := binary.Uvarint([]byte(v))
+		ret.MinVersion = int(min(minVersion, math.MaxInt32))
+	}
+	caps := mm.attributes[MemberCapabilities]
+	ret.Capabilities = make([]Attribute, len(caps))
+	for i := range len(caps) {
+		ret.Capabilities[i] = Attribute(caps[i])
+	}
+	slices.Sort(ret.Capabilities)
+	return ret, true
+}
@@ -336,6 +336,41 @@ func TestMemberMetadata_With(t *testing.T) {
 	}
 }
 
+func TestMemberMetadata_WithProtocol(t *testing.T) {
+	base := (&MemberMetadata{}).With("foo", false)
+	pi := ProtocolInfo{
+		Version:      3,
+		MinVersion:   2,
+		Capabilities: []Attribute{AttributeAlive, AttributeEndpointV4},
+	}
+	mm := base.WithProtocol(pi)
+	assert.Equal(t, &MemberMetadata{map[MemberAttribute]string{
+		MemberName:               "foo",
+		MemberIsBasic:            string([]byte{0}),
+		MemberProtocolVersion:    string([]byte{3}),
+		MemberMinProtocolVersion: string([]byte{2}),
+		MemberCapabilities:       "!e",
+	}}, mm)
+	// must not modify the original
+	assert.Len(t, base.attributes, 2)
+
+	got, ok := mm.Protocol()
+	assert.True(t, ok)
+	assert.Equal(t, pi, got)
+
+	// round trip through the wire format
+	data, err := mm.MarshalBinary()
+	require.NoError(t, err)
+	decoded := &MemberMetadata{}
+	require.NoError(t, decoded.DecodeFrom(0, bytes.NewReader(data)))
+	got, ok = decoded.Protocol()
+	assert.True(t, ok)
+	assert.Equal(t, pi, got)
+
+	_, ok = base.Protocol()
+	assert.False(t, ok)
+}
+
 func TestMemberMetadata_Equality(t *testing.T) {
 	// repeat this a bunch because hashes are unpredictable
 	for i := range 50 {
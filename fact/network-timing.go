@@ -0,0 +1,110 @@
+package fact
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TimingAttribute is a single byte identifying one of the network timing
+// parameters.
+type TimingAttribute byte
+
+const (
+	// TimingFactTTL is the TTL peers should apply to the short-lived facts they
+	// generate
+	TimingFactTTL TimingAttribute = 't'
+	// TimingLongFactTTL is the TTL peers should apply to the long-lived facts
+	// they generate
+	TimingLongFactTTL TimingAttribute = 'l'
+	// TimingAlivePeriod is how often peers should send alive facts
+	TimingAlivePeriod TimingAttribute = 'a'
+	// TimingChunkPeriod is how often peers should process received facts
+	TimingChunkPeriod TimingAttribute = 'c'
+)
+
+// NetworkTiming represents the timing parameters a peer advertises for the
+// whole network. Durations are encoded as a uvarint count of milliseconds.
+type NetworkTiming struct {
+	attributes map[TimingAttribute]string
+}
+
+var _ Value = &NetworkTiming{}
+
+// networkTimingValidators provides a lookup table for validating the inner
+// elements of a NetworkTiming value
+var networkTimingValidators = map[TimingAttribute]stringValidator{
+	TimingFactTTL:     validateUvarint,
+	TimingLongFactTTL: validateUvarint,
+	TimingAlivePeriod: validateUvarint,
+	TimingChunkPeriod: validateUvarint,
+}
+
+// NewNetworkTiming creates a NetworkTiming value with the given parameters,
+// rounded to the nearest millisecond.
+func NewNetworkTiming(factTTL, longFactTTL, alivePeriod, chunkPeriod time.Duration) *NetworkTiming {
+	ret := &NetworkTiming{attributes: make(map[TimingAttribute]string, 4)}
+	for a, d := range map[TimingAttribute]time.Duration{
+		TimingFactTTL:     factTTL,
+		TimingLongFactTTL: longFactTTL,
+		TimingAlivePeriod: alivePeriod,
+		TimingChunkPeriod: chunkPeriod,
+	} {
+		ret.attributes[a] = string(binary.AppendUvarint(nil, uint64(max(d.Round(time.Millisecond)/time.Millisecond, 0))))
+	}
+	return ret
+}
+
+// Get returns the given TimingAttribute, and whether it was present.
+func (nt *NetworkTiming) Get(attr TimingAttribute) (time.Duration, bool) {
+	v, ok := nt.attributes[attr]
+	if !ok || validateUvarint(v) != nil {
+		return 0, false
+	}
+	ms, _ := binary.Uvarint([]byte(v))
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+func (nt *NetworkTiming) sortedAttrs() []TimingAttribute {
+	attrs := make([]TimingAttribute, 0, len(nt.attributes))
+	for a := range nt.attributes {
+		attrs = append(attrs, a)
+	}
+	slices.Sort(attrs)
+	return attrs
+}
+
+// MarshalBinary implements BinaryEncoder
+func (nt *NetworkTiming) MarshalBinary() ([]byte, error) {
+	// important to sort the attributes for equality checks to work properly
+	return marshalAttrMap("timing", nt.attributes, nt.sortedAttrs(), networkTimingValidators)
+}
+
+// DecodeFrom implements Decodable
+func (nt *NetworkTiming) DecodeFrom(_ int, reader io.Reader) error {
+	var err error
+	nt.attributes, err = decodeAttrMap("timing", reader, networkTimingValidators)
+	return err
+}
+
+func (nt *NetworkTiming) String() string {
+	if len(nt.attributes) == 0 {
+		return "(empty)"
+	}
+
+	ret := &strings.Builder{}
+	for i, a := range nt.sortedAttrs() {
+		if i > 0 {
+			ret.WriteRune(',')
+		}
+		if d, ok := nt.Get(a); ok {
+			fmt.Fprintf(ret, "%c:%v", a, d)
+		} else {
+			fmt.Fprintf(ret, "%c:%q", a, nt.attributes[a])
+		}
+	}
+	return ret.String()
+}
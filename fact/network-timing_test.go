@@ -0,0 +1,142 @@
+package fact
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkTiming_MarshalBinary(t *testing.T) {
+	tests := []struct {
+		name      string
+		nt        *NetworkTiming
+		want      []byte
+		assertion assert.ErrorAssertionFunc
+	}{
+		{
+			"empty",
+			&NetworkTiming{},
+			[]byte{0},
+			assert.NoError,
+		},
+		{
+			"all",
+			NewNetworkTiming(9*time.Second, time.Minute, 1500*time.Millisecond, 3*time.Second),
+			[]byte{
+				17, // content length
+				byte(TimingAlivePeriod), 2, 0xdc, 0x0b,
+				byte(TimingChunkPeriod), 2, 0xb8, 0x17,
+				byte(TimingLongFactTTL), 3, 0xe0, 0xd4, 0x03,
+				byte(TimingFactTTL), 2, 0xa8, 0x46,
+			},
+			assert.NoError,
+		},
+		{
+			"unknown attribute",
+			&NetworkTiming{map[TimingAttribute]string{'z': "foo"}},
+			[]byte{5, 'z', 3, 'f', 'o', 'o'},
+			assert.NoError,
+		},
+		{
+			"bad duration",
+			&NetworkTiming{map[TimingAttribute]string{TimingFactTTL: "\x80"}},
+			nil,
+			assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.nt.MarshalBinary()
+			tt.assertion(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNetworkTiming_DecodeFrom(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		want      map[TimingAttribute]string
+		assertion assert.ErrorAssertionFunc
+	}{
+		{
+			"empty",
+			[]byte{0},
+			map[TimingAttribute]string{},
+			assert.NoError,
+		},
+		{
+			"fact ttl",
+			[]byte{4, byte(TimingFactTTL), 2, 0xa8, 0x46},
+			map[TimingAttribute]string{TimingFactTTL: "\xa8\x46"},
+			assert.NoError,
+		},
+		{
+			"trailing garbage in duration",
+			[]byte{4, byte(TimingFactTTL), 2, 0x01, 0x02},
+			map[TimingAttribute]string{},
+			assert.Error,
+		},
+		{
+			"truncated",
+			[]byte{4, byte(TimingFactTTL)},
+			nil,
+			assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nt := &NetworkTiming{}
+			tt.assertion(t, nt.DecodeFrom(0, bytes.NewReader(tt.data)))
+			assert.Equal(t, tt.want, nt.attributes)
+		})
+	}
+}
+
+func TestNetworkTiming_Get(t *testing.T) {
+	nt := NewNetworkTiming(2*time.Minute, time.Hour, 30*time.Second, 5*time.Second)
+	got, ok := nt.Get(TimingFactTTL)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, got)
+	got, ok = nt.Get(TimingLongFactTTL)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, got)
+	got, ok = nt.Get(TimingAlivePeriod)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, got)
+	got, ok = nt.Get(TimingChunkPeriod)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, got)
+	_, ok = nt.Get('z')
+	assert.False(t, ok)
+	_, ok = (&NetworkTiming{}).Get(TimingFactTTL)
+	assert.False(t, ok)
+}
+
+func TestNetworkTiming_String(t *testing.T) {
+	assert.Equal(t, "(empty)", (&NetworkTiming{}).String())
+	assert.Equal(t, "a:30s,c:5s,l:1h0m0s,t:4m15s", NewNetworkTiming(255*time.Second, time.Hour, 30*time.Second, 5*time.Second).String())
+	assert.Equal(t, `z:"foo"`, (&NetworkTiming{map[TimingAttribute]string{'z': "foo"}}).String())
+}
+
+func TestNetworkTiming_Fact(t *testing.T) {
+	now := time.Now()
+	f := &Fact{
+		Attribute: AttributeNetworkTiming,
+		Subject:   &PeerSubject{Key: testutils.MustKey(t)},
+		Value:     NewNetworkTiming(9*time.Second, 9*time.Second, 1500*time.Millisecond, 3*time.Second),
+		Expires:   now.Add(9 * time.Second),
+	}
+	data, err := f.MarshalBinaryNow(now)
+	require.NoError(t, err)
+	got := &Fact{}
+	require.NoError(t, got.DecodeFrom(0, now, bytes.NewBuffer(data)))
+	assert.Equal(t, f, got)
+	assert.Equal(t, KeyOf(f), KeyOf(got))
+}
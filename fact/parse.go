@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/fastcat/wirelink/util"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // a decodeHinter is expected to initialize the Subject and Value fields of the
@@ -55,6 +57,26 @@ var decodeHints = map[Attribute]decodeHinter{
 		f.Value = &MemberMetadata{}
 		return 0
 	},
+	AttributeNetworkTiming: func(f *Fact) int {
+		f.Subject = &PeerSubject{}
+		f.Value = &NetworkTiming{}
+		return 0
+	},
+	AttributeDigest: func(f *Fact) int {
+		f.Subject = &PeerSubject{}
+		f.Value = &Digest{}
+		return 0
+	},
+	AttributeRetraction: func(f *Fact) int {
+		f.Subject = &PeerSubject{}
+		f.Value = &RetractionValue{}
+		return 0
+	},
+	AttributeInterest: func(f *Fact) int {
+		f.Subject = &PeerSubject{}
+		f.Value = &PeerValue{}
+		return wgtypes.KeyLen
+	},
 
 	AttributeSignedGroup: func(f *Fact) int {
 		f.Subject = &PeerSubject{}
@@ -217,6 +217,33 @@ func TestParseMember(t *testing.T) {
 	assert.IsType(t, &EmptyValue{}, f.Value)
 }
 
+func TestParseInterest(t *testing.T) {
+	now := time.Now()
+
+	key := testutils.MustKey(t)
+	peer := testutils.MustKey(t)
+
+	_, p := mustSerialize(t, &Fact{
+		Attribute: AttributeInterest,
+		Expires:   time.Time{},
+		Subject:   &PeerSubject{Key: key},
+		Value:     &PeerValue{Key: peer},
+	})
+	t.Logf("Interest packet: %v", p)
+
+	f := mustDeserialize(t, p, now)
+
+	assert.Equal(t, AttributeInterest, f.Attribute)
+
+	if assert.IsType(t, &PeerSubject{}, f.Subject) {
+		assert.Equal(t, key, f.Subject.(*PeerSubject).Key)
+	}
+
+	if assert.IsType(t, &PeerValue{}, f.Value) {
+		assert.Equal(t, peer, f.Value.(*PeerValue).Key)
+	}
+}
+
 func TestFact_DecodeFrom(t *testing.T) {
 	now := time.Now()
 
@@ -333,9 +360,10 @@ func FuzzDecodeFrom(f *testing.F) {
 			// lot of variable encoding we need to deal with
 			// TODO: this will fail if the fuzzer manages to hit the balanced case
 			simpleEquality := len(payload) == len(loop)
-			// member metadata is a dictionary and so original encoding order may not
-			// match output order
-			if ff.Attribute == AttributeMemberMetadata {
+			// member metadata and network timing are dictionaries and so original
+			// encoding order may not match output order, and retractions may
+			// contain either
+			if ff.Attribute == AttributeMemberMetadata || ff.Attribute == AttributeNetworkTiming || ff.Attribute == AttributeRetraction {
 				simpleEquality = false
 			}
 			if simpleEquality {
@@ -0,0 +1,73 @@
+package fact
+
+import (
+	"slices"
+)
+
+// ProtocolVersion is the version of the wirelink protocol this build speaks.
+// Peers that don't advertise a version are treated as version 0.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest protocol version this build can work with.
+const MinProtocolVersion = 0
+
+// ProtocolInfo describes the protocol version a peer speaks and the fact
+// attributes it understands.
+type ProtocolInfo struct {
+	Version    int
+	MinVersion int
+	// Capabilities is the sorted list of attributes the peer understands
+	Capabilities []Attribute
+}
+
+// LocalProtocol returns the ProtocolInfo for this build.
+func LocalProtocol() ProtocolInfo {
+	caps := make([]Attribute, 0, len(decodeHints))
+	for a := range decodeHints {
+		caps = append(caps, a)
+	}
+	slices.Sort(caps)
+	return ProtocolInfo{
+		Version:      ProtocolVersion,
+		MinVersion:   MinProtocolVersion,
+		Capabilities: caps,
+	}
+}
+
+// LegacyProtocol returns the ProtocolInfo assumed for peers that don't
+// advertise one.
+func LegacyProtocol() ProtocolInfo {
+	return ProtocolInfo{
+		// keep this sorted
+		Capabilities: []Attribute{
+			AttributeAlive,
+			AttributeAllowedCidrV6,
+			AttributeEndpointV6,
+			AttributeMemberMetadata,
+			AttributeSignedGroup,
+			AttributeAllowedCidrV4,
+			AttributeEndpointV4,
+			AttributeMember,
+		},
+	}
+}
+
+// Understands returns whether the peer can decode facts with the given
+// attribute.
+func (pi ProtocolInfo) Understands(attr Attribute) bool {
+	_, found := slices.BinarySearch(pi.Capabilities, attr)
+	return found
+}
+
+// Equal returns whether the two ProtocolInfos are the same.
+func (pi ProtocolInfo) Equal(other ProtocolInfo) bool {
+	return pi.Version == other.Version &&
+		pi.MinVersion == other.MinVersion &&
+		slices.Equal(pi.Capabilities, other.Capabilities)
+}
+
+// CompatibleWith returns whether peers speaking the two protocols can work
+// with each other.
+func (pi ProtocolInfo) CompatibleWith(other ProtocolInfo) bool {
+	return pi.Version >= other.MinVersion && other.Version >= pi.MinVersion
+}
@@ -0,0 +1,48 @@
+package fact
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalProtocol(t *testing.T) {
+	pi := LocalProtocol()
+	assert.Equal(t, ProtocolVersion, pi.Version)
+	assert.Equal(t, MinProtocolVersion, pi.MinVersion)
+	assert.True(t, slices.IsSorted(pi.Capabilities))
+	// we must understand everything legacy peers do
+	for _, a := range LegacyProtocol().Capabilities {
+		assert.True(t, pi.Understands(a), "should understand %c", a)
+	}
+	assert.True(t, pi.Understands(AttributeNetworkTiming))
+	assert.False(t, pi.Understands(AttributeUnknown))
+}
+
+func TestLegacyProtocol(t *testing.T) {
+	pi := LegacyProtocol()
+	assert.True(t, slices.IsSorted(pi.Capabilities))
+	assert.True(t, pi.Understands(AttributeSignedGroup))
+	assert.False(t, pi.Understands(AttributeNetworkTiming))
+}
+
+func TestProtocolInfo_CompatibleWith(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b ProtocolInfo
+		want bool
+	}{
+		{"same", ProtocolInfo{Version: 1}, ProtocolInfo{Version: 1}, true},
+		{"legacy", ProtocolInfo{Version: 1}, ProtocolInfo{}, true},
+		{"too old for us", ProtocolInfo{Version: 2, MinVersion: 2}, ProtocolInfo{Version: 1}, false},
+		{"too new for them", ProtocolInfo{Version: 1}, ProtocolInfo{Version: 3, MinVersion: 2}, false},
+		{"overlapping", ProtocolInfo{Version: 2, MinVersion: 1}, ProtocolInfo{Version: 3, MinVersion: 2}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.a.CompatibleWith(tt.b))
+			assert.Equal(t, tt.want, tt.b.CompatibleWith(tt.a))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package fact
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// retractable lists the attributes which can be retracted: transport and
+// bookkeeping attributes are never stored, so there is nothing to retract.
+var retractable = map[Attribute]bool{
+	AttributeEndpointV4:     true,
+	AttributeEndpointV6:     true,
+	AttributeAllowedCidrV4:  true,
+	AttributeAllowedCidrV6:  true,
+	AttributeMember:         true,
+	AttributeMemberMetadata: true,
+	AttributeNetworkTiming:  true,
+}
+
+// Retractable returns whether facts with the given attribute can be retracted
+func Retractable(attr Attribute) bool {
+	return retractable[attr]
+}
+
+// RetractionValue identifies a fact which its source no longer has, by the
+// attribute and value of the fact. The subject is the same as the subject of
+// the retraction.
+type RetractionValue struct {
+	Attribute Attribute
+	Value     Value
+}
+
+var _ Value = &RetractionValue{}
+
+// retractionSlack is how much longer a retraction lives than the fact it
+// retracts, as TTLs are sent in whole seconds, so copies of the fact on other
+// peers may expire a little after the original
+const retractionSlack = 2 * time.Second
+
+// Retract creates a fact retracting the given one. The retraction expires
+// shortly after the original would have, as after that there is nothing left
+// to retract.
+func Retract(f *Fact) *Fact {
+	return &Fact{
+		Attribute: AttributeRetraction,
+		Subject:   f.Subject,
+		Value:     &RetractionValue{Attribute: f.Attribute, Value: f.Value},
+		Expires:   f.Expires.Add(retractionSlack),
+	}
+}
+
+// RetractedKey returns the key of the fact the retraction r retracts, and
+// whether r is a valid retraction.
+func RetractedKey(r *Fact) (Key, bool) {
+	if r.Attribute != AttributeRetraction {
+		return Key{}, false
+	}
+	rv, ok := r.Value.(*RetractionValue)
+	if !ok {
+		return Key{}, false
+	}
+	return KeyOf(&Fact{Attribute: rv.Attribute, Subject: r.Subject, Value: rv.Value}), true
+}
+
+// Retracts returns whether the retraction r applies to the fact f: it must be
+// for the same attribute, subject, and value, and f must not expire after r.
+// A copy of f that expires later was sent after the retraction, and so
+// supersedes it.
+func Retracts(r, f *Fact) bool {
+	if f.Expires.After(r.Expires) {
+		return false
+	}
+	k, ok := RetractedKey(r)
+	return ok && k == KeyOf(f)
+}
+
+// MarshalBinary implements BinaryEncoder
+func (rv *RetractionValue) MarshalBinary() ([]byte, error) {
+	if !retractable[rv.Attribute] {
+		return nil, fmt.Errorf("cannot retract attribute %c", rv.Attribute)
+	}
+	value, err := rv.Value.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal retracted value: %w", err)
+	}
+	return append([]byte{byte(rv.Attribute)}, value...), nil
+}
+
+// DecodeFrom implements Decodable
+func (rv *RetractionValue) DecodeFrom(_ int, reader io.Reader) error {
+	var br io.ByteReader
+	var ok bool
+	if br, ok = reader.(io.ByteReader); !ok {
+		return errors.New("cannot decode without a ByteReader")
+	}
+	attrByte, err := br.ReadByte()
+	if err != nil {
+		return fmt.Errorf("unable to read retracted attribute: %w", err)
+	}
+	attr := Attribute(attrByte)
+	if !retractable[attr] {
+		return fmt.Errorf("cannot retract attribute 0x%02x", attrByte)
+	}
+	// the retracted value is encoded just as it would be in the original fact
+	tmp := &Fact{Attribute: attr}
+	valueLength := decodeHints[attr](tmp)
+	if err = tmp.Value.DecodeFrom(valueLength, reader); err != nil {
+		return fmt.Errorf("unable to decode retracted value for %v: %w", attr, err)
+	}
+	rv.Attribute = attr
+	rv.Value = tmp.Value
+	return nil
+}
+
+func (rv *RetractionValue) String() string {
+	return fmt.Sprintf("%c:%v", rv.Attribute, rv.Value)
+}
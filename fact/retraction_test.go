@@ -0,0 +1,101 @@
+package fact
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fastcat/wirelink/internal/testutils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetractionValue_Binary(t *testing.T) {
+	tests := []struct {
+		name string
+		rv   *RetractionValue
+	}{
+		{
+			"endpoint v4",
+			&RetractionValue{AttributeEndpointV4, &IPPortValue{IP: net.IPv4(192, 168, 0, 1).To4(), Port: 51820}},
+		},
+		{
+			"endpoint v6",
+			&RetractionValue{AttributeEndpointV6, &IPPortValue{IP: net.ParseIP("fe80::1"), Port: 51820}},
+		},
+		{
+			"allowed ip",
+			&RetractionValue{AttributeAllowedCidrV4, &IPNetValue{net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}}},
+		},
+		{
+			"member metadata",
+			&RetractionValue{AttributeMemberMetadata, (&MemberMetadata{}).With("foo", false)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.rv.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, byte(tt.rv.Attribute), data[0])
+			got := &RetractionValue{}
+			r := bytes.NewReader(data)
+			require.NoError(t, got.DecodeFrom(0, r))
+			assert.Zero(t, r.Len())
+			assert.Equal(t, tt.rv, got)
+		})
+	}
+}
+
+func TestRetractionValue_Invalid(t *testing.T) {
+	_, err := (&RetractionValue{AttributeAlive, &UUIDValue{}}).MarshalBinary()
+	assert.Error(t, err)
+	assert.Error(t, (&RetractionValue{}).DecodeFrom(0, bytes.NewReader([]byte{byte(AttributeSignedGroup)})))
+	assert.Error(t, (&RetractionValue{}).DecodeFrom(0, bytes.NewReader([]byte{byte(AttributeEndpointV4), 1, 2})))
+	assert.Error(t, (&RetractionValue{}).DecodeFrom(0, bytes.NewReader(nil)))
+}
+
+func TestRetracts(t *testing.T) {
+	now := time.Now()
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	ep := func(k [32]byte, port int, expires time.Time) *Fact {
+		return &Fact{
+			Attribute: AttributeEndpointV4,
+			Subject:   &PeerSubject{Key: k},
+			Value:     &IPPortValue{IP: net.IPv4(192, 168, 0, 1).To4(), Port: port},
+			Expires:   expires,
+		}
+	}
+	original := ep(k1, 1, now.Add(time.Minute))
+	r := Retract(original)
+	assert.Equal(t, AttributeRetraction, r.Attribute)
+
+	assert.True(t, Retracts(r, original))
+	assert.True(t, Retracts(r, ep(k1, 1, now.Add(time.Minute+time.Second))), "copies may expire a bit later")
+	assert.False(t, Retracts(r, ep(k1, 1, now.Add(2*time.Minute))), "later copy supersedes the retraction")
+	assert.False(t, Retracts(r, ep(k1, 2, now)), "different value")
+	assert.False(t, Retracts(r, ep(k2, 1, now)), "different subject")
+	assert.False(t, Retracts(original, original), "not a retraction")
+
+	k, ok := RetractedKey(r)
+	assert.True(t, ok)
+	assert.Equal(t, KeyOf(original), k)
+}
+
+func TestRetraction_Fact(t *testing.T) {
+	now := time.Now()
+	f := Retract(&Fact{
+		Attribute: AttributeAllowedCidrV6,
+		Subject:   &PeerSubject{Key: testutils.MustKey(t)},
+		Value:     &IPNetValue{net.IPNet{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(64, 128)}},
+		Expires:   now.Add(time.Minute),
+	})
+	data, err := f.MarshalBinaryNow(now)
+	require.NoError(t, err)
+	got := &Fact{}
+	require.NoError(t, got.DecodeFrom(0, now, bytes.NewBuffer(data)))
+	assert.Equal(t, f, got)
+	assert.Equal(t, KeyOf(f), KeyOf(got))
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/fastcat/wirelink/util"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // IPPortValue represents an IP:port pair as an Attribute of a Subject
@@ -164,3 +166,34 @@ func (u *UUIDValue) DecodeFrom(_ int, reader io.Reader) error {
 }
 
 // UUIDValue inherits its String(er) from UUID
+
+// PeerValue represents a peer, identified by its public key, as the value of a
+// fact
+type PeerValue struct {
+	wgtypes.Key
+}
+
+// *PeerValue must implement Value
+// same pointer criteria as for PeerSubject
+var _ Value = &PeerValue{}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (pv *PeerValue) MarshalBinary() ([]byte, error) {
+	return pv.Key[:], nil
+}
+
+// UnmarshalBinary implements BinaryUnmarshaler
+func (pv *PeerValue) UnmarshalBinary(data []byte) error {
+	if len(data) != wgtypes.KeyLen {
+		return fmt.Errorf("data len wrong for peer value")
+	}
+	copy(pv.Key[:], data)
+	return nil
+}
+
+// DecodeFrom implements Decodable
+func (pv *PeerValue) DecodeFrom(_ int, reader io.Reader) error {
+	return util.DecodeFrom(pv, wgtypes.KeyLen, reader)
+}
+
+// PeerValue inherits its String(er) from Key
@@ -25,3 +25,38 @@ type Value interface {
 
 // Attribute is a byte identifying what aspect of a Subject a Fact describes
 type Attribute byte
+
+// Name returns a human readable name for the attribute, or a hex
+// representation of it if it is not recognized.
+func (a Attribute) Name() string {
+	switch a {
+	case AttributeUnknown:
+		return "Unknown"
+	case AttributeAlive:
+		return "Alive"
+	case AttributeEndpointV4:
+		return "EndpointV4"
+	case AttributeEndpointV6:
+		return "EndpointV6"
+	case AttributeAllowedCidrV4:
+		return "AllowedCidrV4"
+	case AttributeAllowedCidrV6:
+		return "AllowedCidrV6"
+	case AttributeMember:
+		return "Member"
+	case AttributeMemberMetadata:
+		return "MemberMetadata"
+	case AttributeNetworkTiming:
+		return "NetworkTiming"
+	case AttributeDigest:
+		return "Digest"
+	case AttributeRetraction:
+		return "Retraction"
+	case AttributeInterest:
+		return "Interest"
+	case AttributeSignedGroup:
+		return "SignedGroup"
+	default:
+		return fmt.Sprintf("0x%02x", byte(a))
+	}
+}
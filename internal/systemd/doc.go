@@ -0,0 +1,3 @@
+// Package systemd implements the sd_notify protocol, used to tell systemd when
+// the service is ready, what it is doing, and that it is still making progress.
+package systemd
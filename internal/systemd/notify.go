@@ -0,0 +1,117 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier sends state updates to systemd. A nil Notifier is valid, and
+// silently does nothing, so callers need not check whether they are running
+// under systemd.
+type Notifier struct {
+	addr     *net.UnixAddr
+	watchdog time.Duration
+
+	mu         sync.Mutex
+	lastStatus string
+}
+
+// FromEnv creates a Notifier based on the environment systemd provides to
+// services, or returns nil if the process was not started with a notify
+// socket.
+func FromEnv() (*Notifier, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil, nil
+	}
+	// abstract namespace sockets are indicated with a leading @
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+	n := &Notifier{addr: &net.UnixAddr{Name: path, Net: "unixgram"}}
+
+	if usec := os.Getenv("WATCHDOG_USEC"); usec != "" {
+		// the watchdog settings are inherited by children, make sure they are
+		// meant for us
+		if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+			return n, nil
+		}
+		v, err := strconv.ParseUint(usec, 10, 63)
+		if err != nil || v == 0 {
+			return n, fmt.Errorf("invalid WATCHDOG_USEC %q", usec)
+		}
+		n.watchdog = time.Duration(v) * time.Microsecond
+	}
+	return n, nil
+}
+
+// Notify sends the given raw state assignments, e.g. `READY=1`
+func (n *Notifier) Notify(states ...string) error {
+	if n == nil {
+		return nil
+	}
+	conn, err := net.DialUnix(n.addr.Net, nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("unable to connect to systemd notify socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return fmt.Errorf("unable to send systemd notification: %w", err)
+	}
+	return nil
+}
+
+// Ready tells systemd the service has finished starting up, along with an
+// initial status
+func (n *Notifier) Ready(status string) error {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lastStatus = status
+	return n.Notify("READY=1", "STATUS="+status)
+}
+
+// Status updates the one-line status systemd shows for the service, if it
+// has changed since it was last sent
+func (n *Notifier) Status(status string) error {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if status == n.lastStatus {
+		return nil
+	}
+	n.lastStatus = status
+	return n.Notify("STATUS=" + status)
+}
+
+// WatchdogInterval returns how often systemd expects watchdog pings, or zero
+// if the watchdog is not enabled
+func (n *Notifier) WatchdogInterval() time.Duration {
+	if n == nil {
+		return 0
+	}
+	return n.watchdog
+}
+
+// Watchdog tells systemd that the service is still making progress, if the
+// watchdog is enabled
+func (n *Notifier) Watchdog() error {
+	if n.WatchdogInterval() == 0 {
+		return nil
+	}
+	return n.Notify("WATCHDOG=1")
+}
+
+// Stopping tells systemd that the service is shutting down
+func (n *Notifier) Stopping() error {
+	return n.Notify("STOPPING=1")
+}
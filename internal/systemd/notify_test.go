@@ -0,0 +1,136 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNotifySocket listens on a datagram socket the way systemd does and
+// points NOTIFY_SOCKET at it
+func fakeNotifySocket(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func readNotification(t *testing.T, conn *net.UnixConn) string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestFromEnv_unset(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	n, err := FromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, n)
+	// nil notifier is a no-op
+	assert.NoError(t, n.Ready("ok"))
+	assert.NoError(t, n.Status("ok"))
+	assert.NoError(t, n.Watchdog())
+	assert.NoError(t, n.Stopping())
+	assert.Zero(t, n.WatchdogInterval())
+}
+
+func TestNotifier(t *testing.T) {
+	conn := fakeNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	n, err := FromEnv()
+	require.NoError(t, err)
+	require.NotNil(t, n)
+	assert.Equal(t, 30*time.Second, n.WatchdogInterval())
+
+	require.NoError(t, n.Ready("starting"))
+	assert.Equal(t, "READY=1\nSTATUS=starting", readNotification(t, conn))
+
+	// unchanged status is not re-sent
+	require.NoError(t, n.Status("starting"))
+	require.NoError(t, n.Status("running"))
+	assert.Equal(t, "STATUS=running", readNotification(t, conn))
+
+	require.NoError(t, n.Watchdog())
+	assert.Equal(t, "WATCHDOG=1", readNotification(t, conn))
+
+	require.NoError(t, n.Stopping())
+	assert.Equal(t, "STOPPING=1", readNotification(t, conn))
+}
+
+func TestNotifier_watchdogOtherPID(t *testing.T) {
+	conn := fakeNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+
+	n, err := FromEnv()
+	require.NoError(t, err)
+	assert.Zero(t, n.WatchdogInterval())
+	require.NoError(t, n.Watchdog())
+	require.NoError(t, n.Stopping())
+	// the watchdog ping should not have been sent
+	assert.Equal(t, "STOPPING=1", readNotification(t, conn))
+}
+
+func TestFromEnv_badWatchdog(t *testing.T) {
+	fakeNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "soon")
+	t.Setenv("WATCHDOG_PID", "")
+	n, err := FromEnv()
+	assert.Error(t, err)
+	assert.NotNil(t, n, "should still be able to notify without the watchdog")
+}
+
+func TestReporter(t *testing.T) {
+	conn := fakeNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	n, err := FromEnv()
+	require.NoError(t, err)
+
+	r := NewReporter(n)
+	wg0, wg1 := r.Part("wg0"), r.Part("wg1")
+	assert.Equal(t, 30*time.Second, wg0.WatchdogInterval())
+
+	// not ready until every part has made progress
+	require.NoError(t, wg0.Progress("starting"))
+	require.NoError(t, wg0.Progress("running"))
+	require.NoError(t, wg1.Progress("starting"))
+	assert.Equal(t, "READY=1\nSTATUS=wg0: running; wg1: starting", readNotification(t, conn))
+	assert.Equal(t, "WATCHDOG=1", readNotification(t, conn))
+
+	// the watchdog is only pinged once every part has made progress again
+	require.NoError(t, wg0.Progress("running"))
+	require.NoError(t, wg0.Progress("running"))
+	require.NoError(t, wg1.Progress("running"))
+	assert.Equal(t, "STATUS=wg0: running; wg1: running", readNotification(t, conn))
+	assert.Equal(t, "WATCHDOG=1", readNotification(t, conn))
+
+	// stopping is only sent once
+	require.NoError(t, wg0.Stopping())
+	require.NoError(t, wg1.Stopping())
+	require.NoError(t, wg0.Progress("stopped"))
+	assert.Equal(t, "STOPPING=1", readNotification(t, conn))
+	assert.Equal(t, "STATUS=wg0: stopped; wg1: running", readNotification(t, conn))
+}
+
+func TestReporter_nil(t *testing.T) {
+	r := NewReporter(nil)
+	assert.Nil(t, r)
+	p := r.Part("wg0")
+	assert.Nil(t, p)
+	assert.NoError(t, p.Progress("ok"))
+	assert.NoError(t, p.Stopping())
+	assert.Zero(t, p.WatchdogInterval())
+}
@@ -0,0 +1,139 @@
+package systemd
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reporter combines the progress of several independent parts of a service,
+// such as the servers for each interface, into notifications for the service
+// as a whole: it is ready once every part has reported progress, the watchdog
+// is only pinged once every part has made progress since the last ping, and
+// the status includes the status of every part. A nil Reporter is valid, and
+// silently does nothing.
+type Reporter struct {
+	n *Notifier
+
+	mu       sync.Mutex
+	parts    []*Part
+	ready    bool
+	stopping bool
+}
+
+// Part is one part of a service whose progress is reported via a Reporter. A
+// nil Part is valid, and silently does nothing.
+type Part struct {
+	r    *Reporter
+	name string
+	// status is the last status the part reported, and progressed is whether
+	// it has reported progress since the last watchdog ping
+	status     string
+	started    bool
+	progressed bool
+}
+
+// NewReporter creates a Reporter sending notifications via n, or returns nil
+// if n is nil
+func NewReporter(n *Notifier) *Reporter {
+	if n == nil {
+		return nil
+	}
+	return &Reporter{n: n}
+}
+
+// Part adds a part to the reporter, whose status will be labeled with the given
+// name if there is more than one part. All the parts must be added before any
+// of them report progress.
+func (r *Reporter) Part(name string) *Part {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := &Part{r: r, name: name}
+	r.parts = append(r.parts, p)
+	return p
+}
+
+// WatchdogInterval returns how often systemd expects watchdog pings, or zero
+// if the watchdog is not enabled
+func (p *Part) WatchdogInterval() time.Duration {
+	if p == nil {
+		return 0
+	}
+	return p.r.n.WatchdogInterval()
+}
+
+// Progress records that the part is making progress, with its current status,
+// and sends any notifications that are now due
+func (p *Part) Progress(status string) error {
+	if p == nil {
+		return nil
+	}
+	r := p.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p.status = status
+	p.started = true
+	p.progressed = true
+
+	var started, progressed int
+	for _, o := range r.parts {
+		if o.started {
+			started++
+		}
+		if o.progressed {
+			progressed++
+		}
+	}
+	if started < len(r.parts) {
+		// still waiting for other parts to start
+		return nil
+	}
+
+	var err error
+	if !r.ready {
+		r.ready = true
+		err = r.n.Ready(r.status())
+	} else {
+		err = r.n.Status(r.status())
+	}
+	if progressed == len(r.parts) {
+		for _, o := range r.parts {
+			o.progressed = false
+		}
+		if wdErr := r.n.Watchdog(); err == nil {
+			err = wdErr
+		}
+	}
+	return err
+}
+
+// Stopping tells systemd that the service is shutting down, the first time
+// any part calls it
+func (p *Part) Stopping() error {
+	if p == nil {
+		return nil
+	}
+	r := p.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopping {
+		return nil
+	}
+	r.stopping = true
+	return r.n.Stopping()
+}
+
+// status combines the status of all the parts
+func (r *Reporter) status() string {
+	if len(r.parts) == 1 {
+		return r.parts[0].status
+	}
+	statuses := make([]string, 0, len(r.parts))
+	for _, p := range r.parts {
+		statuses = append(statuses, p.name+": "+p.status)
+	}
+	return strings.Join(statuses, "; ")
+}
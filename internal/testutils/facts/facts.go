@@ -94,6 +94,38 @@ func MemberMetadataFactEmpty(peer *wgtypes.Key, expires time.Time) *fact.Fact {
 	}
 }
 
+// ProtocolFact returns a member metadata fact with which the given peer
+// advertises the given protocol
+func ProtocolFact(peer *wgtypes.Key, expires time.Time, pi fact.ProtocolInfo) *fact.Fact {
+	return &fact.Fact{
+		Attribute: fact.AttributeMemberMetadata,
+		Subject:   &fact.PeerSubject{Key: *peer},
+		Expires:   expires,
+		Value:     (&fact.MemberMetadata{}).WithProtocol(pi),
+	}
+}
+
+// InterestFact returns a fact with which the subject asks for facts about the
+// given peer
+func InterestFact(subject, peer *wgtypes.Key, expires time.Time) *fact.Fact {
+	return &fact.Fact{
+		Attribute: fact.AttributeInterest,
+		Subject:   &fact.PeerSubject{Key: *subject},
+		Expires:   expires,
+		Value:     &fact.PeerValue{Key: *peer},
+	}
+}
+
+// NetworkTimingFact returns a network timing fact advertised by the given peer
+func NetworkTimingFact(peer *wgtypes.Key, expires time.Time, factTTL, longFactTTL, alivePeriod, chunkPeriod time.Duration) *fact.Fact {
+	return &fact.Fact{
+		Attribute: fact.AttributeNetworkTiming,
+		Subject:   &fact.PeerSubject{Key: *peer},
+		Expires:   expires,
+		Value:     fact.NewNetworkTiming(factTTL, longFactTTL, alivePeriod, chunkPeriod),
+	}
+}
+
 // AliveFact generates an alive fact for the peer, with a zero boot ID
 func AliveFact(peer *wgtypes.Key, expires time.Time) *fact.Fact {
 	return &fact.Fact{
@@ -0,0 +1,169 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Format is how log messages are written
+type Format string
+
+const (
+	// FormatText writes human readable lines, informational messages to
+	// stdout and errors to stderr
+	FormatText Format = "text"
+	// FormatJSON writes a JSON object per message to stdout
+	FormatJSON Format = "json"
+	// FormatJournal sends messages to the systemd journal using its native
+	// protocol, with the structured fields as journal fields
+	FormatJournal Format = "journald"
+)
+
+// Formats lists all the output formats
+var Formats = []Format{
+	FormatText,
+	FormatJSON,
+	FormatJournal,
+}
+
+// ParseFormat finds the format with the given name, ignoring case
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(string(f), name) {
+			return f, nil
+		}
+	}
+	return FormatText, fmt.Errorf("unrecognized log format %q", name)
+}
+
+type outputState struct {
+	format  Format
+	handler slog.Handler
+}
+
+var (
+	current   atomic.Pointer[outputState]
+	currentMu sync.Mutex
+)
+
+func init() {
+	current.Store(&outputState{FormatText, &textHandler{}})
+}
+
+// SetFormat changes how log messages are written. Changing to the same format
+// that is already in use does nothing.
+func SetFormat(f Format) error {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	prev := current.Load()
+	if prev.format == f {
+		return nil
+	}
+	var h slog.Handler
+	switch f {
+	case FormatText:
+		h = &textHandler{}
+	case FormatJSON:
+		h = newJSONHandler(os.Stdout)
+	case FormatJournal:
+		jh, err := newJournalHandler(journalSocket)
+		if err != nil {
+			return err
+		}
+		h = jh
+	default:
+		return fmt.Errorf("unrecognized log format %q", f)
+	}
+	current.Store(&outputState{f, h})
+	if c, ok := prev.handler.(io.Closer); ok {
+		c.Close()
+	}
+	return nil
+}
+
+// GetFormat returns the current log output format
+func GetFormat() Format {
+	return current.Load().format
+}
+
+func newJSONHandler(w io.Writer) slog.Handler {
+	// level filtering is done before records get to the handler
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+}
+
+func (l Level) slogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// output formats a message and sends it to the current handler. Callers are
+// responsible for checking whether the level is enabled.
+func output(l Level, attrs []slog.Attr, format string, a []any) {
+	msg := strings.TrimSuffix(fmt.Sprintf(format, a...), "\n")
+	r := slog.NewRecord(time.Now(), l.slogLevel(), msg, 0)
+	r.AddAttrs(attrs...)
+	//nolint:errcheck // nowhere to report errors writing logs
+	current.Load().handler.Handle(context.Background(), r)
+}
+
+// textHandler writes the traditional human readable output: just the message,
+// prefixed with the time since debug was enabled if debug logging is on, and
+// the subsystem for subsystem debug messages. Other fields are not printed.
+type textHandler struct {
+	// stdout and stderr default to the os values at the time of writing
+	stdout, stderr io.Writer
+}
+
+func (h *textHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var sb strings.Builder
+	if r.Level <= slog.LevelDebug || IsDebug() {
+		sb.WriteString(debugOffset())
+		sb.WriteByte(' ')
+	}
+	if r.Level <= slog.LevelDebug {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == KeySubsystem {
+				sb.WriteString("[" + a.Value.String() + "] ")
+				return false
+			}
+			return true
+		})
+	}
+	sb.WriteString(r.Message)
+	sb.WriteByte('\n')
+
+	var w io.Writer
+	if r.Level >= slog.LevelError {
+		w = h.stderr
+		if w == nil {
+			w = os.Stderr
+		}
+	} else {
+		w = h.stdout
+		if w == nil {
+			w = os.Stdout
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WithAttrs drops the attrs, as the text format doesn't print them
+func (h *textHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *textHandler) WithGroup(string) slog.Handler { return h }
@@ -0,0 +1,116 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useHandler swaps in the given handler for the duration of the test
+func useHandler(t *testing.T, f Format, h slog.Handler) {
+	saveState(t)
+	prev := current.Swap(&outputState{f, h})
+	t.Cleanup(func() { current.Store(prev) })
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, f := range Formats {
+		got, err := ParseFormat(strings.ToUpper(string(f)))
+		require.NoError(t, err)
+		assert.Equal(t, f, got)
+	}
+	_, err := ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestTextHandler(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	useHandler(t, FormatText, &textHandler{stdout: &stdout, stderr: &stderr})
+	SetLevel(LevelInfo)
+	Trust.SetDebug(true)
+
+	Info("hello %s\n", "world")
+	With(Peer("key"), PeerName("name")).Info("about a peer")
+	Error("oops")
+	Debug("hidden")
+	Trust.Debug("trust debug")
+	Endpoint.Debug("hidden")
+
+	out := strings.Split(stdout.String(), "\n")
+	require.Len(t, out, 4)
+	assert.Equal(t, "hello world", out[0])
+	assert.Equal(t, "about a peer", out[1], "fields should not be printed")
+	assert.Regexp(t, `^\S+ \[trust\] trust debug$`, out[2])
+	assert.Equal(t, "oops\n", stderr.String())
+}
+
+func TestJSONHandler(t *testing.T) {
+	var buf bytes.Buffer
+	useHandler(t, FormatJSON, newJSONHandler(&buf))
+	SetLevel(LevelInfo)
+	Endpoint.SetDebug(true)
+
+	With(Peer("key"), PeerName("name")).Info("peer %d", 1)
+	Endpoint.With(Peer("key2"), Attribute("EndpointV4")).Debug("trying")
+	Debug("hidden")
+
+	dec := json.NewDecoder(&buf)
+	var rec map[string]any
+	require.NoError(t, dec.Decode(&rec))
+	assert.Equal(t, "INFO", rec["level"])
+	assert.Equal(t, "peer 1", rec["msg"])
+	assert.Equal(t, "key", rec[KeyPeer])
+	assert.Equal(t, "name", rec[KeyPeerName])
+	ts, err := time.Parse(time.RFC3339Nano, rec["time"].(string))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), ts, time.Minute)
+
+	rec = nil
+	require.NoError(t, dec.Decode(&rec))
+	assert.Equal(t, "DEBUG", rec["level"])
+	assert.Equal(t, "endpoint", rec[KeySubsystem])
+	assert.Equal(t, "key2", rec[KeyPeer])
+	assert.Equal(t, "EndpointV4", rec[KeyAttribute])
+
+	assert.False(t, dec.More())
+}
+
+func TestJournalHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	jh, err := newJournalHandler(path)
+	require.NoError(t, err)
+	defer jh.Close()
+	jh.identifier = "wirelink"
+	useHandler(t, FormatJournal, jh)
+
+	With(Peer("key"), PeerName("two\nlines")).Error("failed: %d", 42)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+
+	var want bytes.Buffer
+	want.WriteString("MESSAGE=failed: 42\nPRIORITY=3\nSYSLOG_IDENTIFIER=wirelink\nPEER=key\nPEER_NAME\n")
+	require.NoError(t, binary.Write(&want, binary.LittleEndian, uint64(len("two\nlines"))))
+	want.WriteString("two\nlines\n")
+	assert.Equal(t, want.String(), string(buf[:n]))
+}
+
+func TestJournalFieldName(t *testing.T) {
+	assert.Equal(t, "PEER_NAME", journalFieldName("", "peer_name"))
+	assert.Equal(t, "GROUP_KEY", journalFieldName("group", "key"))
+	assert.Equal(t, "A_B", journalFieldName("", "_1a.b"))
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package log
+
+// write sends a message to journald, which only exists on linux, so there is no
+// fallback for messages too large for a datagram
+func (h *journalHandler) write(data []byte) error {
+	_, err := h.conn.Write(data)
+	return err
+}
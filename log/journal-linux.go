@@ -0,0 +1,49 @@
+//go:build linux
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// write sends a message to journald. Messages too large for a datagram, such as
+// a full dump of the server state, are passed as a sealed memfd instead, the
+// same way sd_journal_send does.
+func (h *journalHandler) write(data []byte) error {
+	_, err := h.conn.Write(data)
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+	fd, err := unix.MemfdCreate("journal-message", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return fmt.Errorf("unable to create memfd for large journal message: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), "journal-message")
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		return fmt.Errorf("unable to write large journal message: %w", err)
+	}
+	// journald only accepts memfds that can't be changed after they are sent
+	if _, err = unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS,
+		unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		return fmt.Errorf("unable to seal large journal message: %w", err)
+	}
+	// the conn is connected, which WriteMsgUnix refuses for datagrams
+	rc, err := h.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := unix.UnixRights(int(f.Fd()))
+	if ctlErr := rc.Write(func(s uintptr) bool {
+		err = unix.Sendmsg(int(s), nil, rights, nil, 0)
+		return err != unix.EAGAIN
+	}); ctlErr != nil {
+		return ctlErr
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package log
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalHandler_large(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	jh, err := newJournalHandler(path)
+	require.NoError(t, err)
+	defer jh.Close()
+	jh.identifier = "wirelink"
+	useHandler(t, FormatJournal, jh)
+
+	// much larger than any datagram the kernel will accept
+	big := strings.Repeat("x", 4*1024*1024)
+	Info("%s", big)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	require.NoError(t, err)
+	assert.Zero(t, n, "message should be sent via a file descriptor")
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	require.NoError(t, err)
+	require.Len(t, fds, 1)
+	f := os.NewFile(uintptr(fds[0]), "journal-message")
+	defer f.Close()
+
+	seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0)
+	require.NoError(t, err)
+	assert.NotZero(t, seals&unix.F_SEAL_WRITE, "memfd should be sealed")
+	// journald reads it from the start, but the offset is shared with the sender
+	content, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<30))
+	require.NoError(t, err)
+	want := "MESSAGE=" + big + "\nPRIORITY=6\nSYSLOG_IDENTIFIER=wirelink\n"
+	// don't print megabytes of x on failure
+	assert.Equal(t, len(want), len(content))
+	assert.True(t, string(content) == want, "content should match")
+}
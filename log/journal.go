@@ -0,0 +1,135 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// journalSocket is where journald listens for native protocol messages
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalHandler sends records to journald using its native datagram
+// protocol, so that fields can be filtered on with e.g.
+// `journalctl PEER_NAME=foo`
+type journalHandler struct {
+	conn       *net.UnixConn
+	identifier string
+	attrs      []slog.Attr
+	group      string
+}
+
+func newJournalHandler(path string) (*journalHandler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to journald: %w", err)
+	}
+	return &journalHandler{
+		conn:       conn,
+		identifier: filepath.Base(os.Args[0]),
+	}, nil
+}
+
+func (h *journalHandler) Close() error {
+	return h.conn.Close()
+}
+
+func (h *journalHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *journalHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", r.Message)
+	writeJournalField(&buf, "PRIORITY", journalPriority(r.Level))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", h.identifier)
+	for _, a := range h.attrs {
+		writeJournalAttr(&buf, h.group, a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeJournalAttr(&buf, h.group, a)
+		return true
+	})
+	return h.write(buf.Bytes())
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	ret := *h
+	ret.attrs = append(ret.attrs[:len(ret.attrs):len(ret.attrs)], attrs...)
+	return &ret
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	ret := *h
+	ret.group = journalFieldName(ret.group, name)
+	return &ret
+}
+
+// journalPriority maps slog levels to syslog priorities
+func journalPriority(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return "3"
+	case l >= slog.LevelWarn:
+		return "4"
+	case l >= slog.LevelInfo:
+		return "6"
+	default:
+		return "7"
+	}
+}
+
+func writeJournalAttr(buf *bytes.Buffer, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeJournalAttr(buf, journalFieldName(group, a.Key), ga)
+		}
+		return
+	}
+	name := journalFieldName(group, a.Key)
+	if name == "" {
+		return
+	}
+	writeJournalField(buf, name, a.Value.String())
+}
+
+// journalFieldName converts a field key to the form journald requires:
+// uppercase letters, digits, and underscores, not starting with an underscore
+// (those are reserved for trusted fields journald adds itself)
+func journalFieldName(group, key string) string {
+	if group != "" {
+		key = group + "_" + key
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	return strings.TrimLeft(name, "_0123456789")
+}
+
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	// values with newlines use a length prefixed binary form
+	buf.WriteByte('\n')
+	//nolint:errcheck // can't fail writing to a bytes.Buffer
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,57 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is the minimum severity of messages that will be logged
+type Level int32
+
+const (
+	// LevelDebug logs everything
+	LevelDebug Level = iota
+	// LevelInfo logs informational messages and errors, but not debug messages
+	// (except for subsystems which have debug enabled)
+	LevelInfo
+	// LevelError logs only errors (and debug messages for subsystems which have
+	// debug enabled)
+	LevelError
+)
+
+// LevelNames maps levels to their names for config and display
+var LevelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := LevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int32(l))
+}
+
+// ParseLevel finds the level with the given name, ignoring case
+func ParseLevel(name string) (Level, error) {
+	for l, n := range LevelNames {
+		if strings.EqualFold(n, name) {
+			return l, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unrecognized log level %q", name)
+}
+
+// SetLevel changes the minimum level of messages to log
+func SetLevel(l Level) {
+	prev := Level(level.Swap(int32(l)))
+	if l <= LevelDebug && prev > LevelDebug {
+		resetDebugReference()
+	}
+}
+
+// GetLevel returns the current minimum level of messages that will be logged
+func GetLevel() Level {
+	return Level(level.Load())
+}
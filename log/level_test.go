@@ -0,0 +1,74 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// saveState snapshots the global log settings and restores them at the end of
+// the test
+func saveState(t *testing.T) {
+	prevLevel := GetLevel()
+	prevSubs := make(map[Subsystem]bool)
+	for _, s := range Subsystems {
+		prevSubs[s] = s.IsDebugOverride()
+	}
+	t.Cleanup(func() {
+		SetLevel(prevLevel)
+		for s, enabled := range prevSubs {
+			s.SetDebug(enabled)
+		}
+	})
+}
+
+func TestParseLevel(t *testing.T) {
+	for l, name := range LevelNames {
+		got, err := ParseLevel(name)
+		require.NoError(t, err)
+		assert.Equal(t, l, got)
+		assert.Equal(t, name, l.String())
+	}
+	got, err := ParseLevel("ERROR")
+	require.NoError(t, err)
+	assert.Equal(t, LevelError, got)
+	_, err = ParseLevel("loud")
+	assert.Error(t, err)
+	assert.Equal(t, "Level(42)", Level(42).String())
+}
+
+func TestParseSubsystem(t *testing.T) {
+	for _, s := range Subsystems {
+		got, err := ParseSubsystem(string(s))
+		require.NoError(t, err)
+		assert.Equal(t, s, got)
+	}
+	_, err := ParseSubsystem("everything")
+	assert.Error(t, err)
+}
+
+func TestSubsystem_IsDebug(t *testing.T) {
+	saveState(t)
+
+	SetLevel(LevelInfo)
+	assert.False(t, IsDebug())
+	assert.False(t, Trust.IsDebug())
+	assert.False(t, Endpoint.IsDebug())
+
+	Endpoint.SetDebug(true)
+	assert.False(t, IsDebug())
+	assert.False(t, Trust.IsDebug())
+	assert.True(t, Endpoint.IsDebug())
+	assert.True(t, Endpoint.IsDebugOverride())
+
+	SetDebug(true)
+	assert.True(t, IsDebug())
+	assert.True(t, Trust.IsDebug())
+	assert.False(t, Trust.IsDebugOverride())
+
+	// unknown subsystems can't be enabled on their own
+	bogus := Subsystem("bogus")
+	bogus.SetDebug(true)
+	assert.False(t, bogus.IsDebugOverride())
+}
@@ -1,76 +1,71 @@
 // Package log is a bit of a ridiculous package to have, but the built in `log` package
-// always writes to stderr, and fancy structured logging isn't what this tool needs
+// always writes to stderr. Messages are printf style, but are emitted as
+// structured records via `log/slog`, so that the non-text output formats can
+// carry fields such as which peer a message is about.
 package log
 
 import (
-	"fmt"
-	"os"
+	"sync/atomic"
 	"time"
 )
 
-// TODO: copy efficient buffer management from core `log` package
-
 // Info writes a formatted string with an appended newline to Stdout.
 // errors are ignored.
 func Info(format string, a ...any) {
-	if format[len(format)-1] != '\n' {
-		format = format + "\n"
-	}
-	if debugEnabled {
-		// format = time.Now().Format(debugStampFormat) + " " + format
-		format = debugOffset() + " " + format
+	if GetLevel() > LevelInfo {
+		return
 	}
-	fmt.Printf(format, a...)
+	output(LevelInfo, nil, format, a)
 }
 
 // Error writes a formatted string with an appended newline to Stderr.
 // errors are ignored.
 func Error(format string, a ...any) {
-	if format[len(format)-1] != '\n' {
-		format = format + "\n"
-	}
-	if debugEnabled {
-		// format = time.Now().Format(debugStampFormat) + " " + format
-		format = debugOffset() + " " + format
-	}
-	fmt.Fprintf(os.Stderr, format, a...)
+	output(LevelError, nil, format, a)
 }
 
 var (
-	debugEnabled   bool
-	debugReference time.Time
+	level          atomic.Int32
+	debugReference atomic.Pointer[time.Time]
 )
 
+func init() {
+	level.Store(int32(LevelInfo))
+	resetDebugReference()
+}
+
 // similar to RFC3339
 // const debugStampFormat = "2006-01-02T15:04:05.999"
 
-// SetDebug controls whether Debug does anything
+// SetDebug controls whether Debug does anything. Disabling debug sets the
+// level back to LevelInfo.
 func SetDebug(enabled bool) {
-	debugEnabled = enabled
 	if enabled {
-		debugReference = time.Now()
+		SetLevel(LevelDebug)
+	} else {
+		SetLevel(LevelInfo)
 	}
 }
 
+func resetDebugReference() {
+	now := time.Now()
+	debugReference.Store(&now)
+}
+
 func debugOffset() string {
-	return time.Since(debugReference).Round(time.Millisecond).String()
+	return time.Since(*debugReference.Load()).Round(time.Millisecond).String()
 }
 
 // IsDebug returns whether debug logging is enabled
 func IsDebug() bool {
-	return debugEnabled
+	return GetLevel() <= LevelDebug
 }
 
 // Debug writes a formatted string with an appended newline to Stdout, if enabled.
 // errors are ignored.
 func Debug(format string, a ...any) {
-	if !debugEnabled {
+	if !IsDebug() {
 		return
 	}
-	if format[len(format)-1] != '\n' {
-		format = format + "\n"
-	}
-	// format = time.Now().Format(debugStampFormat) + " " + format
-	format = debugOffset() + " " + format
-	fmt.Printf(format, a...)
+	output(LevelDebug, nil, format, a)
 }
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"log/slog"
+	"slices"
+)
+
+// Keys for the structured fields attached to messages
+const (
+	// KeyPeer is the public key of the peer a message is about
+	KeyPeer = "peer"
+	// KeyPeerName is the name of the peer a message is about
+	KeyPeerName = "peer_name"
+	// KeyAttribute is the name of the fact attribute a message is about
+	KeyAttribute = "attribute"
+	// KeySubsystem is the subsystem that logged a debug message
+	KeySubsystem = "subsystem"
+)
+
+// Peer makes a field for the public key of the peer a message is about
+func Peer(key string) slog.Attr {
+	return slog.String(KeyPeer, key)
+}
+
+// PeerName makes a field for the name of the peer a message is about
+func PeerName(name string) slog.Attr {
+	return slog.String(KeyPeerName, name)
+}
+
+// Attribute makes a field for the name of the fact attribute a message is
+// about
+func Attribute(name string) slog.Attr {
+	return slog.String(KeyAttribute, name)
+}
+
+// Logger logs messages with a fixed set of structured fields attached. The
+// text output format ignores the fields, as the messages are expected to be
+// readable on their own.
+type Logger struct {
+	sub   Subsystem
+	attrs []slog.Attr
+}
+
+// With returns a Logger that adds the given fields to every message
+func With(attrs ...slog.Attr) *Logger {
+	return &Logger{attrs: attrs}
+}
+
+// With returns a Logger that adds the given fields to every message, in
+// addition to the receiver's fields
+func (l *Logger) With(attrs ...slog.Attr) *Logger {
+	return &Logger{sub: l.sub, attrs: append(slices.Clip(l.attrs), attrs...)}
+}
+
+func (l *Logger) allAttrs() []slog.Attr {
+	if l.sub == "" {
+		return l.attrs
+	}
+	return append([]slog.Attr{slog.String(KeySubsystem, string(l.sub))}, l.attrs...)
+}
+
+// Info logs a formatted informational message
+func (l *Logger) Info(format string, a ...any) {
+	if GetLevel() > LevelInfo {
+		return
+	}
+	output(LevelInfo, l.allAttrs(), format, a)
+}
+
+// Error logs a formatted error message
+func (l *Logger) Error(format string, a ...any) {
+	output(LevelError, l.allAttrs(), format, a)
+}
+
+// Debug logs a formatted debug message, if debug is enabled globally or for
+// the logger's subsystem
+func (l *Logger) Debug(format string, a ...any) {
+	if l.sub != "" {
+		if !l.sub.IsDebug() {
+			return
+		}
+	} else if !IsDebug() {
+		return
+	}
+	output(LevelDebug, l.allAttrs(), format, a)
+}
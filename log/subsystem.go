@@ -0,0 +1,92 @@
+package log
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Subsystem is an area of the code whose debug messages can be enabled
+// independently of the global log level, to avoid drowning in unrelated output
+type Subsystem string
+
+const (
+	// Trust covers decisions about which facts and peers to trust
+	Trust Subsystem = "trust"
+	// Endpoint covers selecting which endpoint to try for a peer
+	Endpoint Subsystem = "endpoint"
+	// PeerKnowledge covers tracking what each peer knows, and so what to send
+	// to it
+	PeerKnowledge Subsystem = "peerknowledge"
+	// Packet covers sending and parsing packets
+	Packet Subsystem = "packet"
+)
+
+// Subsystems lists all the known subsystems
+var Subsystems = []Subsystem{
+	Trust,
+	Endpoint,
+	PeerKnowledge,
+	Packet,
+}
+
+var subsystemDebug = func() map[Subsystem]*atomic.Bool {
+	ret := make(map[Subsystem]*atomic.Bool, len(Subsystems))
+	for _, s := range Subsystems {
+		ret[s] = new(atomic.Bool)
+	}
+	return ret
+}()
+
+// ParseSubsystem finds the subsystem with the given name, ignoring case
+func ParseSubsystem(name string) (Subsystem, error) {
+	for _, s := range Subsystems {
+		if strings.EqualFold(string(s), name) {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized log subsystem %q", name)
+}
+
+// SetDebug controls whether debug messages for the subsystem are logged even
+// if the global level is above LevelDebug
+func (s Subsystem) SetDebug(enabled bool) {
+	if flag, ok := subsystemDebug[s]; ok {
+		flag.Store(enabled)
+	}
+}
+
+// IsDebug returns whether debug messages for the subsystem will be logged,
+// either because the subsystem has debug enabled, or the global level is
+// LevelDebug
+func (s Subsystem) IsDebug() bool {
+	if IsDebug() {
+		return true
+	}
+	flag, ok := subsystemDebug[s]
+	return ok && flag.Load()
+}
+
+// IsDebugOverride returns whether debug has been enabled specifically for the
+// subsystem, ignoring the global level
+func (s Subsystem) IsDebugOverride() bool {
+	flag, ok := subsystemDebug[s]
+	return ok && flag.Load()
+}
+
+// Debug writes a formatted string with an appended newline to Stdout, tagged
+// with the subsystem, if debug is enabled for it.
+// errors are ignored.
+func (s Subsystem) Debug(format string, a ...any) {
+	if !s.IsDebug() {
+		return
+	}
+	output(LevelDebug, []slog.Attr{slog.String(KeySubsystem, string(s))}, format, a)
+}
+
+// With returns a Logger for the subsystem that adds the given fields to every
+// message
+func (s Subsystem) With(attrs ...slog.Attr) *Logger {
+	return &Logger{sub: s, attrs: attrs}
+}
@@ -0,0 +1,88 @@
+// Package metrics provides minimal counters and gauges, and exports them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Sample is a single value of a metric, for one set of label values
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// vec holds the samples of a metric, keyed by their label values
+type vec struct {
+	mu      sync.Mutex
+	samples map[string]*Sample
+}
+
+func (v *vec) update(labelValues []string, fn func(s *Sample)) {
+	key := strings.Join(labelValues, "\x00")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.samples[key]
+	if !ok {
+		if v.samples == nil {
+			v.samples = make(map[string]*Sample)
+		}
+		s = &Sample{LabelValues: slices.Clone(labelValues)}
+		v.samples[key] = s
+	}
+	fn(s)
+}
+
+func (v *vec) snapshot() []Sample {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	ret := make([]Sample, 0, len(v.samples))
+	for _, s := range v.samples {
+		ret = append(ret, Sample{LabelValues: s.LabelValues, Value: s.Value})
+	}
+	sortSamples(ret)
+	return ret
+}
+
+func (v *vec) value(labelValues []string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.samples[strings.Join(labelValues, "\x00")]; ok {
+		return s.Value
+	}
+	return 0
+}
+
+func sortSamples(samples []Sample) {
+	slices.SortFunc(samples, func(a, b Sample) int {
+		return cmp.Compare(strings.Join(a.LabelValues, "\x00"), strings.Join(b.LabelValues, "\x00"))
+	})
+}
+
+// Counter is a value that only increases, tracked separately for each
+// combination of label values. The zero value is ready to use.
+type Counter struct {
+	v vec
+}
+
+// Add increases the counter for the given label values by delta, which
+// must not be negative
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("counter cannot decrease")
+	}
+	c.v.update(labelValues, func(s *Sample) { s.Value += delta })
+}
+
+// Inc increases the counter for the given label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current value of the counter for the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.v.value(labelValues)
+}
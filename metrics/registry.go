@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metricType string
+
+const (
+	typeCounter metricType = "counter"
+	typeGauge   metricType = "gauge"
+)
+
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	labels  []string
+	collect func() []Sample
+}
+
+// Registry is a set of metrics to export together
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f *family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.families {
+		if existing.name == f.name {
+			panic(fmt.Sprintf("duplicate metric %s", f.name))
+		}
+	}
+	r.families = append(r.families, f)
+}
+
+// Counter registers a counter to be exported with the given name, help text,
+// and label names. Values must be updated with the same number of label
+// values as label names.
+func (r *Registry) Counter(name, help string, c *Counter, labels ...string) {
+	r.register(&family{name, help, typeCounter, labels, c.v.snapshot})
+}
+
+// GaugeFunc registers a gauge whose values are computed by calling fn each
+// time the metrics are exported
+func (r *Registry) GaugeFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(&family{name, help, typeGauge, labels, func() []Sample {
+		ret := fn()
+		sortSamples(ret)
+		return ret
+	}})
+}
+
+// WriteTo writes all the registered metrics in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := r.families
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.collect() {
+			bw.WriteString(f.name)
+			if len(f.labels) != 0 {
+				bw.WriteByte('{')
+				for i, l := range f.labels {
+					if i != 0 {
+						bw.WriteByte(',')
+					}
+					var lv string
+					if i < len(s.LabelValues) {
+						lv = s.LabelValues[i]
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", l, escapeLabelValue(lv))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP implements http.Handler, exporting the metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	//nolint:errcheck // nothing useful to do if the client went away
+	r.WriteTo(w)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return helpEscaper.Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
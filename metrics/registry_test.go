@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	var plain, labeled Counter
+	r := NewRegistry()
+	r.Counter("test_plain_total", "A plain counter", &plain)
+	r.Counter("test_labeled_total", "A labeled\ncounter", &labeled, "kind")
+	r.GaugeFunc("test_gauge", "A gauge", func() []Sample {
+		return []Sample{
+			{LabelValues: []string{"z", `a "quoted" \ value`}, Value: 0.5},
+			{LabelValues: []string{"a", "b"}, Value: 1},
+		}
+	}, "first", "second")
+
+	plain.Inc()
+	plain.Add(2)
+	labeled.Inc("b")
+	labeled.Inc("a")
+	labeled.Inc("b")
+	assert.Equal(t, 3.0, plain.Value())
+	assert.Equal(t, 2.0, labeled.Value("b"))
+	assert.Equal(t, 0.0, labeled.Value("c"))
+	assert.Panics(t, func() { plain.Add(-1) })
+
+	var sb strings.Builder
+	n, err := r.WriteTo(&sb)
+	require.NoError(t, err)
+	assert.Equal(t, int64(sb.Len()), n)
+	assert.Equal(t, `# HELP test_plain_total A plain counter
+# TYPE test_plain_total counter
+test_plain_total 3
+# HELP test_labeled_total A labeled\ncounter
+# TYPE test_labeled_total counter
+test_labeled_total{kind="a"} 1
+test_labeled_total{kind="b"} 2
+# HELP test_gauge A gauge
+# TYPE test_gauge gauge
+test_gauge{first="a",second="b"} 1
+test_gauge{first="z",second="a \"quoted\" \\ value"} 0.5
+`, sb.String())
+}
+
+func TestRegistry_duplicate(t *testing.T) {
+	var c Counter
+	r := NewRegistry()
+	r.Counter("dup", "", &c)
+	assert.Panics(t, func() { r.Counter("dup", "", &c) })
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	var c Counter
+	r := NewRegistry()
+	r.Counter("test_total", "Test", &c)
+	c.Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "test_total 1\n")
+}
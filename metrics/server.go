@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Path is the HTTP path on which metrics are exported
+const Path = "/metrics"
+
+// Server exports the metrics from a Registry over HTTP
+type Server struct {
+	listener net.Listener
+	http     *http.Server
+}
+
+// Listen opens a TCP listener on the given address for exporting the metrics
+// in the registry
+func Listen(addr string, registry *Registry) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for metrics on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(Path, registry)
+	return &Server{
+		listener: listener,
+		http: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// Addr returns the address on which the server is listening
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve handles requests until the context is cancelled, at which point it
+// shuts down the server. It only returns an error if serving fails for some
+// other reason.
+func (s *Server) Serve(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		//nolint:errcheck // if graceful shutdown fails, Serve still returns
+		s.http.Shutdown(shutdownCtx)
+	})
+	defer stop()
+	err := s.http.Serve(s.listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return fmt.Errorf("failed to serve metrics: %w", err)
+}
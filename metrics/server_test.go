@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	var c Counter
+	r := NewRegistry()
+	r.Counter("test_total", "Test", &c)
+	c.Inc()
+
+	s, err := Listen("127.0.0.1:0", r)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	resp, err := http.Get("http://" + s.Addr().String() + Path)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "test_total 1\n")
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -18,25 +18,23 @@ import (
 func DeviceFacts(
 	dev *wgtypes.Device,
 	now time.Time,
-	ttl time.Duration,
+	timing config.Timing,
 	config *config.Server,
 	env networking.Environment,
 ) (
 	ret []*fact.Fact,
 	err error,
 ) {
-	if ttl.Seconds() < 0 || ttl.Seconds() > 255 {
-		return nil, fmt.Errorf("ttl out of range")
+	if err = checkTTLs(timing); err != nil {
+		return nil, err
 	}
 
-	expiration := now.Add(ttl)
-
 	addAttr := func(attr fact.Attribute, value fact.Value) {
 		ret = append(ret, &fact.Fact{
 			Attribute: attr,
 			Subject:   &fact.PeerSubject{Key: dev.PublicKey},
 			Value:     value,
-			Expires:   expiration,
+			Expires:   now.Add(timing.TTL(attr)),
 		})
 	}
 
@@ -190,7 +190,7 @@ func TestDeviceFacts(t *testing.T) {
 			env := tt.args.env(t)
 			env.WithKnownInterfaces()
 			env.Test(t)
-			gotRet, err := DeviceFacts(tt.args.dev, now, tt.args.ttl, tt.args.config, env)
+			gotRet, err := DeviceFacts(tt.args.dev, now, config.Timing{FactTTL: tt.args.ttl, LongFactTTL: tt.args.ttl}, tt.args.config, env)
 			if tt.wantErr {
 				require.NotNil(t, err)
 			} else {
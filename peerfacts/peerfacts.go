@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/fastcat/wirelink/apply"
+	"github.com/fastcat/wirelink/config"
 	"github.com/fastcat/wirelink/fact"
 
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -13,25 +14,21 @@ import (
 // LocalFacts gets all the known facts about a local peer
 func LocalFacts(
 	peer *wgtypes.Peer,
-	ttl time.Duration,
+	timing config.Timing,
 	trustLocalAIPs bool,
 	trustLocalMembership bool,
 	now time.Time,
 ) (ret []*fact.Fact, err error) {
-	// NOTE: we can represent more than 255 seconds at the protocol level now,
-	// but longer than that is probably a bad idea for the time being
-	if ttl.Seconds() < 0 || ttl.Seconds() > 255 {
-		return nil, fmt.Errorf("ttl out of range")
+	if err = checkTTLs(timing); err != nil {
+		return nil, err
 	}
 
-	expiration := now.Add(ttl)
-
 	addAttr := func(attr fact.Attribute, value fact.Value) {
 		ret = append(ret, &fact.Fact{
 			Attribute: attr,
 			Subject:   &fact.PeerSubject{Key: peer.PublicKey},
 			Value:     value,
-			Expires:   expiration,
+			Expires:   now.Add(timing.TTL(attr)),
 		})
 	}
 
@@ -68,3 +65,13 @@ func LocalFacts(
 
 	return ret, nil
 }
+
+// checkTTLs verifies the TTLs in the timing can be represented on the wire
+func checkTTLs(timing config.Timing) error {
+	for _, ttl := range []time.Duration{timing.FactTTL, timing.LongFactTTL} {
+		if ttl < 0 || ttl > config.MaxFactTTL {
+			return fmt.Errorf("ttl out of range: %v", ttl)
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/fastcat/wirelink/config"
 	"github.com/fastcat/wirelink/fact"
 	"github.com/fastcat/wirelink/internal/testutils"
 	"github.com/fastcat/wirelink/internal/testutils/facts"
@@ -20,6 +21,9 @@ func TestLocalFacts(t *testing.T) {
 	now := time.Now()
 	ttl := time.Minute
 	expires := now.Add(ttl)
+	timing := config.Timing{FactTTL: ttl, LongFactTTL: ttl}
+	longTiming := config.Timing{FactTTL: ttl, LongFactTTL: time.Hour}
+	longExpires := now.Add(time.Hour)
 	longLongAgo := now.Add(time.Duration(-5-rand.Intn(10)) * time.Minute)
 
 	k1 := testutils.MustKey(t)
@@ -32,7 +36,7 @@ func TestLocalFacts(t *testing.T) {
 
 	type args struct {
 		peer                 *wgtypes.Peer
-		ttl                  time.Duration
+		timing               config.Timing
 		trustLocalAIPs       bool
 		trustLocalMembership bool
 		now                  time.Time
@@ -47,7 +51,7 @@ func TestLocalFacts(t *testing.T) {
 			"no local knowledge",
 			args{
 				&wgtypes.Peer{},
-				ttl,
+				timing,
 				true,
 				false,
 				now,
@@ -63,7 +67,7 @@ func TestLocalFacts(t *testing.T) {
 					LastHandshakeTime: longLongAgo,
 					Endpoint:          u1,
 				},
-				ttl,
+				timing,
 				false,
 				false,
 				now,
@@ -79,7 +83,7 @@ func TestLocalFacts(t *testing.T) {
 					LastHandshakeTime: now,
 					Endpoint:          u1,
 				},
-				ttl,
+				timing,
 				false,
 				false,
 				now,
@@ -97,7 +101,7 @@ func TestLocalFacts(t *testing.T) {
 					LastHandshakeTime: now,
 					Endpoint:          u2,
 				},
-				ttl,
+				timing,
 				false,
 				false,
 				now,
@@ -115,7 +119,7 @@ func TestLocalFacts(t *testing.T) {
 					Endpoint:   u1,
 					AllowedIPs: []net.IPNet{n1, n2, n3},
 				},
-				ttl,
+				timing,
 				true,
 				false,
 				now,
@@ -135,7 +139,7 @@ func TestLocalFacts(t *testing.T) {
 					Endpoint:          u1,
 					AllowedIPs:        []net.IPNet{n1, n2, n3},
 				},
-				ttl,
+				timing,
 				true,
 				false,
 				now,
@@ -155,7 +159,7 @@ func TestLocalFacts(t *testing.T) {
 					LastHandshakeTime: now,
 					AllowedIPs:        []net.IPNet{n1, n2, n3},
 				},
-				ttl,
+				timing,
 				false,
 				true,
 				now,
@@ -165,10 +169,43 @@ func TestLocalFacts(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"long-lived facts",
+			args{
+				&wgtypes.Peer{
+					PublicKey:         k1,
+					Endpoint:          u1,
+					LastHandshakeTime: now,
+					AllowedIPs:        []net.IPNet{n1},
+				},
+				longTiming,
+				true,
+				true,
+				now,
+			},
+			[]*fact.Fact{
+				facts.EndpointFactFull(u1, &k1, expires),
+				facts.AllowedIPFactFull(n1, &k1, longExpires),
+				facts.MemberMetadataFactEmpty(&k1, longExpires),
+			},
+			false,
+		},
+		{
+			"ttl out of range",
+			args{
+				&wgtypes.Peer{PublicKey: k1},
+				config.Timing{FactTTL: ttl, LongFactTTL: config.MaxFactTTL + time.Second},
+				true,
+				true,
+				now,
+			},
+			nil,
+			true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotRet, err := LocalFacts(tt.args.peer, tt.args.ttl, tt.args.trustLocalAIPs, tt.args.trustLocalMembership, tt.args.now)
+			gotRet, err := LocalFacts(tt.args.peer, tt.args.timing, tt.args.trustLocalAIPs, tt.args.trustLocalMembership, tt.args.now)
 			if tt.wantErr {
 				require.NotNil(t, err, "LocalFacts() error")
 			} else {
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fastcat/wirelink/apply"
+	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/control"
+	"github.com/fastcat/wirelink/detect"
+	"github.com/fastcat/wirelink/events"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal"
+	"github.com/fastcat/wirelink/log"
+	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// controlHandler adapts a LinkServer to the control.Handler interface
+type controlHandler struct {
+	s *LinkServer
+}
+
+var _ control.Handler = &controlHandler{}
+
+// ControlHandler returns a handler for answering queries on the control socket
+func (s *LinkServer) ControlHandler() control.Handler {
+	return &controlHandler{s}
+}
+
+// trustedAttributes lists the attributes whose acceptance is reported in
+// trust evaluations
+var trustedAttributes = []fact.Attribute{
+	fact.AttributeEndpointV4,
+	fact.AttributeEndpointV6,
+	fact.AttributeAllowedCidrV4,
+	fact.AttributeAllowedCidrV6,
+	fact.AttributeMember,
+	fact.AttributeMemberMetadata,
+	fact.AttributeNetworkTiming,
+}
+
+func (h *controlHandler) Status() (*control.Status, error) {
+	s := h.s
+	return &control.Status{
+		Version:          internal.Version,
+		Iface:            s.cfg().Iface,
+		PublicKey:        s.signer.PublicKey.String(),
+		Address:          s.addr.IP.String(),
+		Port:             s.addr.Port,
+		Router:           s.cfg().IsRouterNow,
+		AutoDetectRouter: s.cfg().AutoDetectRouter,
+		Chatty:           s.cfg().Chatty,
+		BootID:           s.bootID().String(),
+		Description:      s.Describe(),
+	}, nil
+}
+
+func (h *controlHandler) Facts() ([]control.Fact, error) {
+	s := h.s
+	var facts []*fact.Fact
+	if p := s.currentFacts.Load(); p != nil {
+		facts = fact.SortedCopy(*p)
+	}
+	ret := make([]control.Fact, 0, len(facts))
+	for _, f := range facts {
+		cf := control.Fact{
+			Attribute:     string(f.Attribute),
+			AttributeName: f.Attribute.Name(),
+			Subject:       f.Subject.String(),
+			Value:         f.Value.String(),
+			Expires:       f.Expires,
+		}
+		if ps, ok := f.Subject.(*fact.PeerSubject); ok {
+			cf.SubjectName = s.peerName(ps.Key)
+		}
+		ret = append(ret, cf)
+	}
+	return ret, nil
+}
+
+func (h *controlHandler) Peers() ([]control.Peer, error) {
+	s := h.s
+	now := time.Now()
+	ret := make([]control.Peer, 0)
+	seen := make(map[wgtypes.Key]bool)
+	// can't build the peers inside ForEach, looking up names needs the lock it
+	// holds
+	states := make(map[wgtypes.Key]*apply.PeerConfigState)
+	s.peerConfig.ForEach(func(k wgtypes.Key, pcs *apply.PeerConfigState) {
+		states[k] = pcs
+	})
+	for k, pcs := range states {
+		// TODO: don't rely on signer for this
+		if k == s.signer.PublicKey {
+			continue
+		}
+		seen[k] = true
+		ret = append(ret, h.peer(k, pcs, now))
+	}
+	// include configured peers we haven't seen yet
+	for k := range s.cfg().Peers {
+		if !seen[k] && k != s.signer.PublicKey {
+			ret = append(ret, h.peer(k, nil, now))
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].PublicKey < ret[j].PublicKey
+	})
+	return ret, nil
+}
+
+func (h *controlHandler) peer(k wgtypes.Key, pcs *apply.PeerConfigState, now time.Time) control.Peer {
+	s := h.s
+	_, configured := s.cfg().Peers[k]
+	p := control.Peer{
+		PublicKey:  k.String(),
+		Name:       s.peerName(k),
+		Configured: configured,
+		Healthy:    pcs.IsHealthy(),
+		Alive:      pcs.IsAlive(),
+		Basic:      pcs.IsBasic(),
+		AliveUntil: pcs.AliveUntil(),
+		State:      pcs.Describe(now),
+	}
+	if p.Name == p.PublicKey {
+		p.Name = ""
+	}
+	if bootID := pcs.BootID(); bootID != nil {
+		p.BootID = bootID.String()
+	}
+	return p
+}
+
+func (h *controlHandler) Trust() ([]control.TrustEvaluation, error) {
+	s := h.s
+	dev, err := s.dev.State()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load device state to evaluate trust: %w", err)
+	}
+	evaluator := s.trustEvaluator(dev)
+	ret := make([]control.TrustEvaluation, 0, len(dev.Peers))
+	for i := range dev.Peers {
+		peer := &dev.Peers[i]
+		te := control.TrustEvaluation{
+			PublicKey: peer.PublicKey.String(),
+			Name:      s.peerName(peer.PublicKey),
+			Router:    detect.IsPeerRouter(peer),
+		}
+		if te.Name == te.PublicKey {
+			te.Name = ""
+		}
+		if pc, ok := s.cfg().Peers[peer.PublicKey]; ok && pc.Trust != nil {
+			te.Configured = pc.Trust.String()
+		}
+		// evaluate trust as if the peer had sent us a fact about itself
+		source := net.UDPAddr{
+			IP:   autopeer.AutoAddress(peer.PublicKey),
+			Port: s.addr.Port,
+			Zone: s.addr.Zone,
+		}
+		probe := &fact.Fact{Subject: &fact.PeerSubject{Key: peer.PublicKey}}
+		level := evaluator.TrustLevel(probe, source)
+		if level != nil {
+			te.Level = level.String()
+		}
+		for _, attr := range trustedAttributes {
+			if trust.ShouldAccept(attr, true, level) {
+				te.Accepts = append(te.Accepts, attr.Name())
+			}
+		}
+		ret = append(ret, te)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].PublicKey < ret[j].PublicKey
+	})
+	return ret, nil
+}
+
+func (h *controlHandler) Device() (*control.Device, error) {
+	s := h.s
+	now := time.Now()
+	dev, err := s.dev.State()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load device state: %w", err)
+	}
+	var facts []*fact.Fact
+	if p := s.currentFacts.Load(); p != nil {
+		facts = *p
+	}
+	factsByPeer := groupFactsByPeer(facts)
+
+	ret := &control.Device{
+		Name:         dev.Name,
+		PublicKey:    dev.PublicKey.String(),
+		ListenPort:   dev.ListenPort,
+		FirewallMark: dev.FirewallMark,
+		Peers:        make([]control.DevicePeer, 0, len(dev.Peers)),
+	}
+	for i := range dev.Peers {
+		peer := &dev.Peers[i]
+		pcs, _ := s.peerConfig.Get(peer.PublicKey)
+		dp := control.DevicePeer{
+			PublicKey:           peer.PublicKey.String(),
+			Name:                s.peerName(peer.PublicKey),
+			State:               pcs.Describe(now),
+			LastHandshake:       peer.LastHandshakeTime,
+			ReceiveBytes:        peer.ReceiveBytes,
+			TransmitBytes:       peer.TransmitBytes,
+			PersistentKeepalive: peer.PersistentKeepaliveInterval,
+		}
+		if dp.Name == dp.PublicKey {
+			dp.Name = ""
+		}
+		if peer.Endpoint != nil {
+			dp.Endpoint = peer.Endpoint.String()
+		}
+		pc := s.cfg().Peers[peer.PublicKey]
+		if pc != nil && pc.Trust != nil {
+			dp.Trust = pc.Trust.String()
+		}
+
+		configAIPs := make(map[string]bool)
+		if pc != nil {
+			for _, aip := range pc.AllowedIPs {
+				configAIPs[aip.String()] = true
+			}
+		}
+		factAIPs := make(map[string]bool)
+		for _, f := range fact.SortedCopy(factsByPeer[peer.PublicKey]) {
+			switch f.Attribute {
+			case fact.AttributeAllowedCidrV4, fact.AttributeAllowedCidrV6:
+				if v, ok := f.Value.(*fact.IPNetValue); ok {
+					factAIPs[v.IPNet.String()] = true
+				}
+			case fact.AttributeEndpointV4, fact.AttributeEndpointV6:
+				dp.Endpoints = append(dp.Endpoints, control.EndpointFact{
+					Address:  f.Value.String(),
+					Expires:  f.Expires,
+					LastUsed: pcs.EndpointLastUsed(f.Value),
+				})
+			}
+		}
+		autoAIP := autopeer.AutoAddressNet(peer.PublicKey)
+		for _, aip := range peer.AllowedIPs {
+			cidr := aip.String()
+			var sources []string
+			if cidr == autoAIP.String() {
+				sources = append(sources, control.AllowedIPSourceAuto)
+			}
+			if configAIPs[cidr] {
+				sources = append(sources, control.AllowedIPSourceConfig)
+			}
+			if factAIPs[cidr] {
+				sources = append(sources, control.AllowedIPSourceFact)
+			}
+			dp.AllowedIPs = append(dp.AllowedIPs, control.AllowedIP{CIDR: cidr, Sources: sources})
+		}
+		ret.Peers = append(ret.Peers, dp)
+	}
+	// order like `wg show` does: most recent handshake first
+	slices.SortStableFunc(ret.Peers, func(a, b control.DevicePeer) int {
+		if c := b.LastHandshake.Compare(a.LastHandshake); c != 0 {
+			return c
+		}
+		return strings.Compare(a.PublicKey, b.PublicKey)
+	})
+	return ret, nil
+}
+
+func (h *controlHandler) Log(change *control.LogSettings) (*control.LogSettings, error) {
+	if change != nil {
+		// validate everything before changing anything
+		var level *log.Level
+		if change.Level != "" {
+			l, err := log.ParseLevel(change.Level)
+			if err != nil {
+				return nil, err
+			}
+			level = &l
+		}
+		subs := make(map[log.Subsystem]bool, len(change.Subsystems))
+		for name, enabled := range change.Subsystems {
+			sub, err := log.ParseSubsystem(name)
+			if err != nil {
+				return nil, err
+			}
+			subs[sub] = enabled
+		}
+		if level != nil {
+			log.SetLevel(*level)
+		}
+		for sub, enabled := range subs {
+			sub.SetDebug(enabled)
+		}
+		log.Info("Log settings changed: level=%v subsystems=%v", log.GetLevel(), subs)
+	}
+	ret := &control.LogSettings{
+		Level:      log.GetLevel().String(),
+		Subsystems: make(map[string]bool, len(log.Subsystems)),
+	}
+	for _, sub := range log.Subsystems {
+		ret.Subsystems[string(sub)] = sub.IsDebugOverride()
+	}
+	return ret, nil
+}
+
+// controlEventBuffer is how many events a control socket client may fall
+// behind before events are dropped for it
+const controlEventBuffer = 100
+
+func (h *controlHandler) Events() (*events.Subscription, error) {
+	return h.s.Events().Subscribe(controlEventBuffer), nil
+}
+
+func (h *controlHandler) Config() (*config.FileData, error) {
+	s := h.s
+	var facts []*fact.Fact
+	if p := s.currentFacts.Load(); p != nil {
+		facts = *p
+	}
+	ret := config.GenerateFromFacts(facts)
+	// peers with no metadata name may still have one in the local config
+	for i := range ret.Peers {
+		if ret.Peers[i].Name != "" {
+			continue
+		}
+		if k, err := wgtypes.ParseKey(ret.Peers[i].PublicKey); err == nil {
+			ret.Peers[i].Name = s.peerConfigName(k)
+		}
+	}
+	return ret, nil
+}
+
+func (h *controlHandler) Basic(peer string) (*config.WgQuick, error) {
+	s := h.s
+	key, err := wgtypes.ParseKey(peer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer key %q: %w", peer, err)
+	}
+	dev, err := s.dev.State()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load device state: %w", err)
+	}
+	var facts []*fact.Fact
+	if p := s.currentFacts.Load(); p != nil {
+		facts = *p
+	}
+	n := &config.BasicNetwork{
+		Device:      dev,
+		LocalRouter: s.cfg().IsRouterNow,
+		LocalNets:   s.interfaceCache.TunnelIPNets(),
+		Facts:       facts,
+		Peers:       s.cfg().Peers,
+		Name: func(k wgtypes.Key) string {
+			if k == dev.PublicKey {
+				return s.peerConfigName(k)
+			}
+			if name := s.peerName(k); name != k.String() {
+				return name
+			}
+			return ""
+		},
+	}
+	return n.GenerateBasic(key)
+}
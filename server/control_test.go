@@ -0,0 +1,346 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fastcat/wirelink/apply"
+	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/control"
+	"github.com/fastcat/wirelink/device"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal/mocks"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/internal/testutils/facts"
+	"github.com/fastcat/wirelink/log"
+	"github.com/fastcat/wirelink/signing"
+	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlHandler_Trust(t *testing.T) {
+	const wgIface = "wg0"
+	localPriv, _ := testutils.MustKeyPair(t)
+	trustedKey := testutils.MustKey(t)
+	otherKey := testutils.MustKey(t)
+
+	ctrl := &mocks.WgClient{}
+	ctrl.Test(t)
+	ctrl.On("Device", wgIface).Return(&wgtypes.Device{
+		Name: wgIface,
+		Peers: []wgtypes.Peer{
+			{PublicKey: trustedKey, AllowedIPs: []net.IPNet{autopeer.AutoAddressNet(trustedKey)}},
+			{PublicKey: otherKey, AllowedIPs: []net.IPNet{autopeer.AutoAddressNet(otherKey)}},
+		},
+	}, nil)
+	dev, err := device.New(ctrl, wgIface)
+	require.NoError(t, err)
+
+	s := &LinkServer{
+		config: buildConfig(wgIface).
+			withPeer(trustedKey, &config.Peer{Name: "trusted", Trust: new(trust.Membership)}).
+			Build(),
+		dev:        dev,
+		peerConfig: newPeerConfigSet(),
+		signer:     signing.New(localPriv),
+	}
+
+	got, err := s.ControlHandler().Trust()
+	require.NoError(t, err)
+	want := []control.TrustEvaluation{
+		{
+			PublicKey:  trustedKey.String(),
+			Name:       "trusted",
+			Configured: "Membership",
+			Level:      "Membership",
+			Accepts:    []string{"EndpointV4", "EndpointV6", "AllowedCidrV4", "AllowedCidrV6", "Member", "MemberMetadata", "NetworkTiming"},
+		},
+		{
+			PublicKey: otherKey.String(),
+			// having configured trust disables route based trust, so this peer
+			// only gets known peer trust
+			Level:   "Endpoint",
+			Accepts: []string{"EndpointV4", "EndpointV6"},
+		},
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].PublicKey < want[j].PublicKey })
+	assert.Equal(t, want, got)
+	ctrl.AssertExpectations(t)
+}
+
+func TestControlHandler_FactsAndPeers(t *testing.T) {
+	now := time.Now()
+	localPriv, localKey := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	k3 := testutils.MustKey(t)
+	ep := testutils.RandUDP4Addr(t)
+	expires := now.Add(DefaultFactTTL)
+
+	s := &LinkServer{
+		config: buildConfig("wg0").
+			withPeer(k1, &config.Peer{Name: "one"}).
+			withPeer(k2, &config.Peer{}).
+			Build(),
+		peerConfig: newPeerConfigSet(),
+		signer:     signing.New(localPriv),
+	}
+	s.peerConfig.Set(localKey, &apply.PeerConfigState{})
+	s.peerConfig.Set(k1, makePCS(t, true, true, false))
+	// a peer that is neither configured nor named must not deadlock the lookup
+	s.peerConfig.Set(k3, makePCS(t, false, false, false))
+	h := s.ControlHandler()
+
+	gotFacts, err := h.Facts()
+	require.NoError(t, err)
+	assert.Empty(t, gotFacts)
+
+	s.currentFacts.Store(&[]*fact.Fact{facts.EndpointFactFull(ep, &k1, expires)})
+	gotFacts, err = h.Facts()
+	require.NoError(t, err)
+	assert.Equal(t, []control.Fact{{
+		Attribute:     "e",
+		AttributeName: "EndpointV4",
+		Subject:       k1.String(),
+		SubjectName:   "one",
+		Value:         ep.String(),
+		Expires:       expires,
+	}}, gotFacts)
+
+	gotPeers, err := h.Peers()
+	require.NoError(t, err)
+	// local peer is excluded, unseen configured peer is included
+	require.Len(t, gotPeers, 3)
+	byKey := map[string]control.Peer{}
+	for _, p := range gotPeers {
+		byKey[p.PublicKey] = p
+	}
+	assert.Equal(t, "one", byKey[k1.String()].Name)
+	assert.True(t, byKey[k1.String()].Healthy)
+	assert.True(t, byKey[k1.String()].Alive)
+	assert.True(t, byKey[k1.String()].Configured)
+	assert.Equal(t, "", byKey[k2.String()].Name)
+	assert.False(t, byKey[k2.String()].Healthy)
+	assert.Equal(t, "???", byKey[k2.String()].State)
+	assert.Equal(t, "", byKey[k3.String()].Name)
+	assert.False(t, byKey[k3.String()].Configured)
+	assert.False(t, byKey[k3.String()].Healthy)
+}
+
+func TestControlHandler_Device(t *testing.T) {
+	const wgIface = "wg0"
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+	localPriv, localKey := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	ep1 := testutils.RandUDP4Addr(t)
+	ep2 := testutils.RandUDP4Addr(t)
+	configAIP := testutils.MakeIPv4Net(10, 0, 0, 1, 32)
+	factAIP := testutils.MakeIPv4Net(10, 1, 0, 0, 16)
+	deviceAIP := testutils.MakeIPv4Net(10, 2, 0, 0, 16)
+
+	ctrl := &mocks.WgClient{}
+	ctrl.Test(t)
+	ctrl.On("Device", wgIface).Return(&wgtypes.Device{
+		Name:       wgIface,
+		PublicKey:  localKey,
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{{
+			PublicKey:         k1,
+			Endpoint:          ep1,
+			LastHandshakeTime: now,
+			AllowedIPs: []net.IPNet{
+				autopeer.AutoAddressNet(k1),
+				configAIP,
+				factAIP,
+				deviceAIP,
+			},
+		}},
+	}, nil)
+	dev, err := device.New(ctrl, wgIface)
+	require.NoError(t, err)
+
+	s := &LinkServer{
+		config: buildConfig(wgIface).
+			withPeer(k1, &config.Peer{
+				Name:       "one",
+				Trust:      new(trust.Endpoint),
+				AllowedIPs: []net.IPNet{configAIP},
+			}).
+			Build(),
+		dev:        dev,
+		peerConfig: newPeerConfigSet(),
+		signer:     signing.New(localPriv),
+	}
+	peerFacts := []*fact.Fact{
+		facts.EndpointFactFull(ep1, &k1, expires),
+		facts.EndpointFactFull(ep2, &k1, expires),
+		facts.AllowedIPFactFull(factAIP, &k1, expires),
+	}
+	s.currentFacts.Store(&peerFacts)
+	pcs := (*apply.PeerConfigState)(nil).EnsureNotNil()
+	// mark the first endpoint as having been tried
+	usedAt := now.Add(-time.Minute)
+	require.NotNil(t, pcs.NextEndpoint("one", peerFacts[:1], usedAt, nil))
+	s.peerConfig.Set(k1, pcs)
+
+	autoAIP := autopeer.AutoAddressNet(k1)
+	got, err := s.ControlHandler().Device()
+	require.NoError(t, err)
+	require.Len(t, got.Peers, 1)
+	// state text includes time deltas, so just check the important part
+	assert.Contains(t, got.Peers[0].State, "unhealthy")
+	assert.Equal(t, &control.Device{
+		Name:       wgIface,
+		PublicKey:  localKey.String(),
+		ListenPort: 51820,
+		Peers: []control.DevicePeer{{
+			PublicKey:     k1.String(),
+			Name:          "one",
+			State:         got.Peers[0].State,
+			Trust:         "Endpoint",
+			Endpoint:      ep1.String(),
+			LastHandshake: now,
+			AllowedIPs: []control.AllowedIP{
+				{CIDR: autoAIP.String(), Sources: []string{control.AllowedIPSourceAuto}},
+				{CIDR: configAIP.String(), Sources: []string{control.AllowedIPSourceConfig}},
+				{CIDR: factAIP.String(), Sources: []string{control.AllowedIPSourceFact}},
+				{CIDR: deviceAIP.String()},
+			},
+			Endpoints: sortedEndpoints(
+				control.EndpointFact{Address: ep1.String(), Expires: expires, LastUsed: usedAt},
+				control.EndpointFact{Address: ep2.String(), Expires: expires},
+			),
+		}},
+	}, got)
+	ctrl.AssertExpectations(t)
+}
+
+// sortedEndpoints puts endpoints in the same order as fact.SortedCopy would
+func sortedEndpoints(eps ...control.EndpointFact) []control.EndpointFact {
+	sort.Slice(eps, func(i, j int) bool { return eps[i].Address < eps[j].Address })
+	return eps
+}
+
+func TestControlHandler_Log(t *testing.T) {
+	prevLevel := log.GetLevel()
+	defer log.SetLevel(prevLevel)
+	defer log.Trust.SetDebug(log.Trust.IsDebugOverride())
+
+	h := (&LinkServer{}).ControlHandler()
+
+	_, err := h.Log(&control.LogSettings{Level: "loud"})
+	assert.Error(t, err)
+	_, err = h.Log(&control.LogSettings{Subsystems: map[string]bool{"everything": true}})
+	assert.Error(t, err)
+	// failed changes must not be partially applied
+	_, err = h.Log(&control.LogSettings{Level: "error", Subsystems: map[string]bool{"everything": true}})
+	assert.Error(t, err)
+	assert.Equal(t, prevLevel, log.GetLevel())
+
+	got, err := h.Log(&control.LogSettings{Level: "error", Subsystems: map[string]bool{"trust": true}})
+	require.NoError(t, err)
+	assert.Equal(t, log.LevelError, log.GetLevel())
+	assert.True(t, log.Trust.IsDebug())
+	assert.Equal(t, "error", got.Level)
+	assert.True(t, got.Subsystems["trust"])
+	assert.False(t, got.Subsystems["endpoint"])
+
+	got2, err := h.Log(nil)
+	require.NoError(t, err)
+	assert.Equal(t, got, got2)
+}
+
+func TestControlHandler_Config(t *testing.T) {
+	expires := time.Now().Add(DefaultFactTTL)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	s := &LinkServer{
+		config:     buildConfig("wg0").withPeer(k2, &config.Peer{Name: "two"}).Build(),
+		peerConfig: newPeerConfigSet(),
+		signer:     &signing.Signer{},
+	}
+	h := s.ControlHandler()
+
+	got, err := h.Config()
+	require.NoError(t, err)
+	assert.Empty(t, got.Peers)
+
+	s.currentFacts.Store(&[]*fact.Fact{
+		facts.MemberMetadataFactFull(&k1, expires, "one", false),
+		facts.MemberFactFull(&k2, expires),
+	})
+	got, err = h.Config()
+	require.NoError(t, err)
+	names := map[string]string{}
+	for _, p := range got.Peers {
+		names[p.PublicKey] = p.Name
+	}
+	assert.Equal(t, map[string]string{k1.String(): "one", k2.String(): "two"}, names)
+}
+
+func TestControlHandler_Basic(t *testing.T) {
+	const wgIface = "wg0"
+	expires := time.Now().Add(DefaultFactTTL)
+	localPriv, localKey := testutils.MustKeyPair(t)
+	phone := testutils.MustKey(t)
+	leaf := testutils.MustKey(t)
+	phoneAIP := testutils.MakeIPv4Net(10, 0, 0, 2, 32)
+	leafAIP := testutils.MakeIPv4Net(10, 1, 0, 3, 32)
+
+	ctrl := &mocks.WgClient{}
+	ctrl.Test(t)
+	ctrl.On("Device", wgIface).Return(&wgtypes.Device{
+		Name:      wgIface,
+		PublicKey: localKey,
+		Peers: []wgtypes.Peer{
+			{PublicKey: phone, AllowedIPs: []net.IPNet{phoneAIP, autopeer.AutoAddressNet(phone)}},
+			{PublicKey: leaf, AllowedIPs: []net.IPNet{leafAIP}},
+		},
+	}, nil)
+	dev, err := device.New(ctrl, wgIface)
+	require.NoError(t, err)
+
+	cfg := buildConfig(wgIface).
+		withPeer(phone, &config.Peer{Name: "phone", Basic: true}).
+		withPeer(leaf, &config.Peer{Name: "leaf"}).
+		Build()
+	cfg.IsRouterNow = true
+	s := &LinkServer{
+		config:     cfg,
+		dev:        dev,
+		peerConfig: newPeerConfigSet(),
+		signer:     signing.New(localPriv),
+		interfaceCache: &interfaceCache{
+			tunnelIPNets: []net.IPNet{testutils.MakeIPv4Net(10, 0, 0, 1, 24)},
+		},
+	}
+	s.currentFacts.Store(&[]*fact.Fact{
+		facts.EndpointFactFull(&net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 51820}, &localKey, expires),
+	})
+	h := s.ControlHandler()
+
+	got, err := h.Basic(phone.String())
+	require.NoError(t, err)
+	assert.Equal(t, &config.WgQuick{
+		Interface: config.WgQuickInterface{Address: []string{"10.0.0.2/32"}},
+		Peers: []config.WgQuickPeer{{
+			PublicKey:           localKey.String(),
+			Endpoint:            "198.51.100.1:51820",
+			AllowedIPs:          []string{"10.0.0.0/24", "10.1.0.3/32"},
+			PersistentKeepalive: config.BasicKeepalive,
+		}},
+	}, got)
+
+	_, err = h.Basic(leaf.String())
+	assert.Error(t, err, "leaf is not basic")
+	_, err = h.Basic("bogus")
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/fastcat/wirelink/apply"
 	"github.com/fastcat/wirelink/config"
 	"github.com/fastcat/wirelink/fact"
 	"github.com/fastcat/wirelink/log"
@@ -16,33 +17,49 @@ import (
 
 func (s *LinkServer) collectFacts(dev *wgtypes.Device, now time.Time) (ret []*fact.Fact, err error) {
 	log.Debug("Collecting facts...")
+	timing := s.timing()
 
 	// facts about the local node
-	ret, err = peerfacts.DeviceFacts(dev, now, s.FactTTL, s.config, s.net)
+	ret, err = peerfacts.DeviceFacts(dev, now, timing, s.cfg(), s.net)
 	if err != nil {
 		return ret, err
 	}
 
 	// facts the local node knows about peers configured in the wireguard device
 	// TODO: find a better way to figure out if we should trust our local AIP list
-	localTrust := s.config.Peers.Trust(dev.PublicKey, trust.Untrusted)
-	useLocalAIPs := s.config.IsRouterNow || localTrust >= trust.AllowedIPs
-	useLocalMembership := s.config.IsRouterNow || localTrust >= trust.Membership
+	localTrust := s.cfg().Peers.Trust(dev.PublicKey, trust.Untrusted)
+	useLocalAIPs := s.cfg().IsRouterNow || localTrust >= trust.AllowedIPs
+	useLocalMembership := s.cfg().IsRouterNow || localTrust >= trust.Membership
 	log.Debug("Using local AIP/membership: %v/%v", useLocalAIPs, useLocalMembership)
 	for _, peer := range dev.Peers {
 		var pf []*fact.Fact
-		pf, err = peerfacts.LocalFacts(&peer, s.FactTTL, useLocalAIPs, useLocalMembership, now)
+		pf, err = peerfacts.LocalFacts(&peer, timing, useLocalAIPs, useLocalMembership, now)
 		if err != nil {
 			return ret, err
 		}
 		ret = append(ret, pf...)
 	}
 
-	expires := now.Add(s.FactTTL)
+	// static facts from the config are long-lived, except endpoints, which
+	// may come from DNS lookups that can change
+	expires := now.Add(timing.FactTTL)
+	longExpires := now.Add(timing.TTL(fact.AttributeMemberMetadata))
+
+	// peers trusted for membership are also trusted to set the network timing,
+	// and they advertise their configured timing, not any they have adopted
+	if useLocalMembership {
+		local := s.localTiming()
+		ret = append(ret, &fact.Fact{
+			Attribute: fact.AttributeNetworkTiming,
+			Subject:   &fact.PeerSubject{Key: dev.PublicKey},
+			Value:     fact.NewNetworkTiming(local.FactTTL, local.LongFactTTL, local.AlivePeriod, local.ChunkPeriod),
+			Expires:   longExpires,
+		})
+	}
 
 	// static facts from the config
 	// these may duplicate other known facts, higher layers will dedupe
-	for pk, pc := range s.config.Peers {
+	for pk, pc := range s.cfg().Peers {
 		// statically configured peers are always valid members
 
 		memberFactIdx := fact.SliceIndexOf(ret, func(f *fact.Fact) bool {
@@ -65,14 +82,14 @@ func (s *LinkServer) collectFacts(dev *wgtypes.Device, now time.Time) (ret []*fa
 				Attribute: fact.AttributeMemberMetadata,
 				Subject:   &fact.PeerSubject{Key: pk},
 				Value:     &fact.MemberMetadata{},
-				Expires:   expires,
+				Expires:   longExpires,
 			}
 			ret = append(ret, f)
 		}
 
 		f.Value = f.Value.(*fact.MemberMetadata).With(pc.Name, pc.Basic)
 		log.Debug("Collected member metadata: for %s: %v", pc.Name, f.Value)
-		ret = s.handlePeerConfigAllowedIPs(pk, pc, expires, ret)
+		ret = s.handlePeerConfigAllowedIPs(pk, pc, longExpires, ret)
 		// skip endpoint lookups for self
 		// if other peers need these as static facts, they would have it in their config
 		if pk != dev.PublicKey {
@@ -80,9 +97,70 @@ func (s *LinkServer) collectFacts(dev *wgtypes.Device, now time.Time) (ret []*fa
 		}
 	}
 
+	// tell peers which protocol we speak, so they only send us facts we understand
+	ret = addProtocolAdvert(dev.PublicKey, longExpires, ret)
+
+	// routers send facts about every peer to everyone, which leaves can ask them
+	// not to do
+	if s.cfg().Interest && !s.cfg().IsRouterNow {
+		ret = s.addInterests(dev.PublicKey, expires, ret)
+	}
+
 	return ret, err
 }
 
+// addInterests adds facts telling routers which peers we want to be told
+// about: configured peers, peers listed in the interest config, and peers we
+// have tried to reach.
+func (s *LinkServer) addInterests(self wgtypes.Key, expires time.Time, facts []*fact.Fact) []*fact.Fact {
+	interests := make(map[wgtypes.Key]bool)
+	for pk := range s.cfg().Peers {
+		interests[pk] = true
+	}
+	for _, pk := range s.cfg().InterestPeers {
+		interests[pk] = true
+	}
+	s.peerConfig.ForEach(func(pk wgtypes.Key, pcs *apply.PeerConfigState) {
+		if pcs.Contacted() {
+			interests[pk] = true
+		}
+	})
+	delete(interests, self)
+	for pk := range interests {
+		facts = append(facts, &fact.Fact{
+			Attribute: fact.AttributeInterest,
+			Subject:   &fact.PeerSubject{Key: self},
+			Value:     &fact.PeerValue{Key: pk},
+			Expires:   expires,
+		})
+	}
+	return facts
+}
+
+// addProtocolAdvert adds our protocol version and capabilities to the member
+// metadata about ourselves, creating it if needed.
+func addProtocolAdvert(self wgtypes.Key, expires time.Time, facts []*fact.Fact) []*fact.Fact {
+	idx := fact.SliceIndexOf(facts, func(f *fact.Fact) bool {
+		if f.Attribute != fact.AttributeMemberMetadata {
+			return false
+		}
+		fs, ok := f.Subject.(*fact.PeerSubject)
+		return ok && fs.Key == self
+	})
+	if idx < 0 {
+		facts = append(facts, &fact.Fact{
+			Attribute: fact.AttributeMemberMetadata,
+			Subject:   &fact.PeerSubject{Key: self},
+			Value:     &fact.MemberMetadata{},
+			Expires:   expires,
+		})
+		idx = len(facts) - 1
+	}
+	f := facts[idx]
+	f.Value = f.Value.(*fact.MemberMetadata).WithProtocol(fact.LocalProtocol())
+	return facts
+}
+
 func (s *LinkServer) handlePeerConfigAllowedIPs(
 	pk wgtypes.Key,
 	pc *config.Peer,
@@ -123,7 +201,7 @@ func (s *LinkServer) handlePeerConfigEndpoints(
 
 	// only do static lookups for dead peers
 	if pcs, ok := s.peerConfig.Get(pk); ok && (pcs.IsAlive() || pcs.IsHealthy()) {
-		log.Debug("Skipping static lookup for OK peer %s", s.peerName(pk))
+		log.With(log.Peer(pk.String())).Debug("Skipping static lookup for OK peer %s", s.peerName(pk))
 		return facts
 	}
 
@@ -24,8 +24,12 @@ import (
 func TestLinkServer_collectFacts(t *testing.T) {
 	now := time.Now()
 	expires := now.Add(DefaultFactTTL)
+	longExpires := now.Add(config.DefaultLongFactTTL)
 	k1 := testutils.MustKey(t)
 	k2 := testutils.MustKey(t)
+	k3 := testutils.MustKey(t)
+	k4 := testutils.MustKey(t)
+	k5 := testutils.MustKey(t)
 	ifWg := fmt.Sprintf("wg%d", rand.Int())
 	ifEth := fmt.Sprintf("eth%d", rand.Int())
 	ipn1 := testutils.RandIPNet(t, net.IPv4len, []byte{100}, nil, 24)
@@ -64,7 +68,10 @@ func TestLinkServer_collectFacts(t *testing.T) {
 				&peerConfigSet{},
 			},
 			args{&wgtypes.Device{}},
-			[]*fact.Fact{},
+			[]*fact.Fact{
+				// should always advertise the protocol
+				factutils.ProtocolFact(&wgtypes.Key{}, longExpires, fact.LocalProtocol()),
+			},
 			false,
 		},
 		{
@@ -106,13 +113,16 @@ func TestLinkServer_collectFacts(t *testing.T) {
 				// should know the local endpoint
 				factutils.EndpointFactFull(&net.UDPAddr{IP: ipn2.IP, Port: p1}, &k1, expires),
 				// should know the local AIP
-				factutils.AllowedIPFactFull(applyMask(ipn1), &k1, expires),
+				factutils.AllowedIPFactFull(applyMask(ipn1), &k1, longExpires),
 				// should know the remote endpoint
 				factutils.EndpointFactFull(ep1, &k2, expires),
 				// should know the remote AIP
-				factutils.AllowedIPFactFull(ipn3, &k2, expires),
+				factutils.AllowedIPFactFull(ipn3, &k2, longExpires),
 				// should know the remote as a member
-				factutils.MemberMetadataFactEmpty(&k2, expires),
+				factutils.MemberMetadataFactEmpty(&k2, longExpires),
+				// should advertise the timing as a router
+				factutils.NetworkTimingFact(&k1, longExpires, DefaultFactTTL, config.DefaultLongFactTTL, DefaultAlivePeriod, DefaultChunkPeriod),
+				factutils.ProtocolFact(&k1, longExpires, fact.LocalProtocol()),
 			},
 			false,
 		},
@@ -150,13 +160,14 @@ func TestLinkServer_collectFacts(t *testing.T) {
 			args{&wgtypes.Device{}},
 			[]*fact.Fact{
 				// member
-				factutils.MemberMetadataFactFull(&k1, expires, "", false),
+				factutils.MemberMetadataFactFull(&k1, longExpires, "", false),
 				// ipv4 and ipv6 endpoints
 				factutils.EndpointFactFull(ep1, &k1, expires),
 				factutils.EndpointFactFull(ep2, &k1, expires),
 				// ipv4 and ipv6 aips
-				factutils.AllowedIPFactFull(ipn1, &k1, expires),
-				factutils.AllowedIPFactFull(ipn4, &k1, expires),
+				factutils.AllowedIPFactFull(ipn1, &k1, longExpires),
+				factutils.AllowedIPFactFull(ipn4, &k1, longExpires),
+				factutils.ProtocolFact(&wgtypes.Key{}, longExpires, fact.LocalProtocol()),
 			},
 			false,
 		},
@@ -184,7 +195,8 @@ func TestLinkServer_collectFacts(t *testing.T) {
 			args{&wgtypes.Device{}},
 			[]*fact.Fact{
 				// member
-				factutils.MemberMetadataFactFull(&k1, expires, "k1", false),
+				factutils.MemberMetadataFactFull(&k1, longExpires, "k1", false),
+				factutils.ProtocolFact(&wgtypes.Key{}, longExpires, fact.LocalProtocol()),
 			},
 			false,
 		},
@@ -212,7 +224,8 @@ func TestLinkServer_collectFacts(t *testing.T) {
 			args{&wgtypes.Device{}},
 			[]*fact.Fact{
 				// member
-				factutils.MemberMetadataFactFull(&k1, expires, "", true),
+				factutils.MemberMetadataFactFull(&k1, longExpires, "", true),
+				factutils.ProtocolFact(&wgtypes.Key{}, longExpires, fact.LocalProtocol()),
 			},
 			false,
 		},
@@ -252,7 +265,99 @@ func TestLinkServer_collectFacts(t *testing.T) {
 			}},
 			[]*fact.Fact{
 				// member
-				factutils.MemberMetadataFactFull(&k1, expires, "k1", true),
+				factutils.MemberMetadataFactFull(&k1, longExpires, "k1", true),
+				factutils.NetworkTimingFact(&k2, longExpires, DefaultFactTTL, config.DefaultLongFactTTL, DefaultAlivePeriod, DefaultChunkPeriod),
+				factutils.ProtocolFact(&k2, longExpires, fact.LocalProtocol()),
+			},
+			false,
+		},
+		{
+			"protocol on static self metadata",
+			fields{
+				&config.Server{
+					Peers: config.Peers{
+						k1: &config.Peer{
+							Name: "k1",
+						},
+					},
+				},
+				func(t *testing.T) *mocks.Environment {
+					ret := &mocks.Environment{}
+					return ret
+				},
+				&peerConfigSet{
+					psm: &sync.Mutex{},
+					peerStates: map[wgtypes.Key]*apply.PeerConfigState{
+						k1: {},
+					},
+				},
+			},
+			args{&wgtypes.Device{PublicKey: k1}},
+			[]*fact.Fact{
+				{
+					Attribute: fact.AttributeMemberMetadata,
+					Subject:   &fact.PeerSubject{Key: k1},
+					Expires:   longExpires,
+					Value:     (&fact.MemberMetadata{}).With("k1", false).WithProtocol(fact.LocalProtocol()),
+				},
+			},
+			false,
+		},
+		{
+			"leaf interests",
+			fields{
+				&config.Server{
+					Interest:      true,
+					InterestPeers: []wgtypes.Key{k3},
+					Peers: config.Peers{
+						k2: &config.Peer{Name: "k2"},
+					},
+				},
+				func(t *testing.T) *mocks.Environment {
+					ret := &mocks.Environment{}
+					return ret
+				},
+				&peerConfigSet{
+					psm: &sync.Mutex{},
+					peerStates: map[wgtypes.Key]*apply.PeerConfigState{
+						// handshake means we have contacted it
+						k4: (*apply.PeerConfigState)(nil).Update(
+							&wgtypes.Peer{PublicKey: k4, LastHandshakeTime: now},
+							"k4", false, time.Time{}, nil, now, nil, true,
+						),
+						// never contacted
+						k5: {},
+					},
+				},
+			},
+			args{&wgtypes.Device{PublicKey: k1}},
+			[]*fact.Fact{
+				factutils.MemberMetadataFactFull(&k2, longExpires, "k2", false),
+				factutils.ProtocolFact(&k1, longExpires, fact.LocalProtocol()),
+				factutils.InterestFact(&k1, &k2, expires),
+				factutils.InterestFact(&k1, &k3, expires),
+				factutils.InterestFact(&k1, &k4, expires),
+			},
+			false,
+		},
+		{
+			"no interests as router",
+			fields{
+				&config.Server{
+					Interest:      true,
+					IsRouterNow:   true,
+					InterestPeers: []wgtypes.Key{k3},
+				},
+				func(t *testing.T) *mocks.Environment {
+					ret := &mocks.Environment{}
+					return ret
+				},
+				&peerConfigSet{psm: &sync.Mutex{}},
+			},
+			args{&wgtypes.Device{PublicKey: k1}},
+			[]*fact.Fact{
+				factutils.NetworkTimingFact(&k1, longExpires, DefaultFactTTL, config.DefaultLongFactTTL, DefaultAlivePeriod, DefaultChunkPeriod),
+				factutils.ProtocolFact(&k1, longExpires, fact.LocalProtocol()),
 			},
 			false,
 		},
@@ -266,7 +371,6 @@ func TestLinkServer_collectFacts(t *testing.T) {
 				config:     tt.fields.config,
 				net:        env,
 				peerConfig: tt.fields.peerConfig,
-				FactTTL:    DefaultFactTTL,
 			}
 			gotRet, err := s.collectFacts(tt.args.dev, now)
 			if tt.wantErr {
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"slices"
+
+	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/dns"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/log"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DNSZone returns the peer names and addresses to answer DNS queries from,
+// based on the config and the currently accepted facts. Each peer is named by
+// its configured name and the name in its membership metadata, and has its
+// automatic IPv6 link local address and any single host allowed IPs.
+func (s *LinkServer) DNSZone() dns.Zone {
+	var facts []*fact.Fact
+	if p := s.currentFacts.Load(); p != nil {
+		facts = *p
+	}
+	hosts := make(map[wgtypes.Key]*dns.Host)
+	host := func(k wgtypes.Key) *dns.Host {
+		h, ok := hosts[k]
+		if !ok {
+			h = &dns.Host{Key: k, Addrs: []net.IP{autopeer.AutoAddress(k)}}
+			if name := s.peerConfigName(k); name != "" {
+				h.Names = append(h.Names, name)
+			}
+			hosts[k] = h
+		}
+		return h
+	}
+
+	// TODO: don't rely on signer for this
+	host(s.signer.PublicKey)
+	for k := range s.cfg().Peers {
+		host(k)
+	}
+	for _, f := range fact.SortedCopy(facts) {
+		ps, ok := f.Subject.(*fact.PeerSubject)
+		if !ok {
+			continue
+		}
+		h := host(ps.Key)
+		switch f.Attribute {
+		case fact.AttributeAllowedCidrV4, fact.AttributeAllowedCidrV6:
+			if v, ok := f.Value.(*fact.IPNetValue); ok {
+				if ones, bits := v.Mask.Size(); ones == bits {
+					h.Addrs = append(h.Addrs, v.IP)
+				}
+			}
+		case fact.AttributeMemberMetadata:
+			if mm, ok := f.Value.(*fact.MemberMetadata); ok {
+				mm.ForEach(func(a fact.MemberAttribute, v string) {
+					if a == fact.MemberName && v != "" && !slices.Contains(h.Names, v) {
+						h.Names = append(h.Names, v)
+					}
+				})
+			}
+		}
+	}
+
+	ret := make(dns.Zone, 0, len(hosts))
+	for _, h := range hosts {
+		ret = append(ret, *h)
+	}
+	slices.SortFunc(ret, func(a, b dns.Host) int {
+		return bytes.Compare(a.Key[:], b.Key[:])
+	})
+	return ret
+}
+
+// updateHostsFile rewrites the block in the hosts file, if enabled, to match
+// the current facts
+func (s *LinkServer) updateHostsFile() {
+	if s.hostsFile == nil {
+		return
+	}
+	// the error message includes the random temporary file name, so only log
+	// when it starts and stops failing
+	err := s.hostsFile.Update(s.DNSZone())
+	if failing := err != nil; failing != s.hostsFileFailing {
+		if failing {
+			log.Error("Unable to update hosts file: %v", err)
+		} else {
+			log.Info("Updated hosts file %s", s.hostsFile.Path())
+		}
+		s.hostsFileFailing = failing
+	}
+}
+
+// removeHostsFile removes our block from the hosts file, if enabled
+func (s *LinkServer) removeHostsFile() {
+	if s.hostsFile == nil {
+		return
+	}
+	if err := s.hostsFile.Remove(); err != nil {
+		log.Error("Unable to remove entries from hosts file: %v", err)
+	}
+}
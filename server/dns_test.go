@@ -0,0 +1,128 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/dns"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/internal/testutils/facts"
+	"github.com/fastcat/wirelink/signing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestLinkServer_DNSZone(t *testing.T) {
+	expires := time.Now().Add(DefaultFactTTL)
+	localPriv, localKey := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	host1 := testutils.MakeIPv4Net(10, 0, 0, 1, 32)
+	subnet := testutils.MakeIPv4Net(10, 1, 0, 0, 24)
+
+	s := &LinkServer{
+		config: buildConfig("wg0").
+			withPeer(localKey, &config.Peer{Name: "self-name"}).
+			withPeer(k1, &config.Peer{Name: "one"}).
+			Build(),
+		signer: signing.New(localPriv),
+	}
+	s.currentFacts.Store(&[]*fact.Fact{
+		facts.AllowedIPFactFull(host1, &k1, expires),
+		facts.AllowedIPFactFull(subnet, &k2, expires),
+		facts.MemberMetadataFactFull(&k1, expires, "one", false),
+		facts.MemberMetadataFactFull(&k2, expires, "two", false),
+	})
+
+	zone := s.DNSZone()
+	require.Len(t, zone, 3)
+	hosts := make(map[wgtypes.Key]dns.Host)
+	for _, h := range zone {
+		hosts[h.Key] = h
+	}
+
+	self := hosts[localKey]
+	assert.Equal(t, []string{"self-name"}, self.Names)
+	assert.Equal(t, []net.IP{autopeer.AutoAddress(localKey)}, self.Addrs)
+
+	one := hosts[k1]
+	// the metadata name matches the config one, so it isn't repeated
+	assert.Equal(t, []string{"one"}, one.Names)
+	assert.Equal(t, []net.IP{autopeer.AutoAddress(k1), host1.IP}, one.Addrs)
+
+	two := hosts[k2]
+	assert.Equal(t, []string{"two"}, two.Names)
+	// subnets aren't addresses of the peer
+	assert.Equal(t, []net.IP{autopeer.AutoAddress(k2)}, two.Addrs)
+
+	addrs, found := zone.Lookup("two.wg.")
+	assert.True(t, found)
+	assert.Equal(t, []net.IP{autopeer.AutoAddress(k2)}, addrs)
+}
+
+func TestLinkServer_hostsFile(t *testing.T) {
+	expires := time.Now().Add(DefaultFactTTL)
+	localPriv, _ := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	path := filepath.Join(t.TempDir(), "hosts")
+	original := "127.0.0.1\tlocalhost\n"
+	require.NoError(t, os.WriteFile(path, []byte(original), 0o644))
+
+	s := &LinkServer{
+		config:    buildConfig("wg0").Build(),
+		signer:    signing.New(localPriv),
+		hostsFile: dns.NewHostsFile(path, "wg0"),
+	}
+	s.currentFacts.Store(&[]*fact.Fact{
+		facts.AllowedIPFactFull(testutils.MakeIPv4Net(10, 0, 0, 1, 32), &k1, expires),
+		facts.MemberMetadataFactFull(&k1, expires, "one", false),
+	})
+
+	s.updateHostsFile()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original+"# BEGIN wirelink wg0\n10.0.0.1\tone.wg one\n# END wirelink wg0\n", string(content))
+
+	// stopping cleanly removes the entries
+	s.Stop()
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, string(content))
+}
+
+func TestLinkServer_hostsFileError(t *testing.T) {
+	localPriv, _ := testutils.MustKeyPair(t)
+	dir := filepath.Join(t.TempDir(), "etc")
+	path := filepath.Join(dir, "hosts")
+
+	s := &LinkServer{
+		config:    buildConfig("wg0").Build(),
+		signer:    signing.New(localPriv),
+		hostsFile: dns.NewHostsFile(path, "wg0"),
+	}
+	s.currentFacts.Store(&[]*fact.Fact{})
+
+	// the directory doesn't exist, so the update fails, and is remembered so it
+	// is only logged once
+	s.updateHostsFile()
+	assert.True(t, s.hostsFileFailing)
+	s.updateHostsFile()
+	assert.True(t, s.hostsFileFailing)
+
+	// once it can be written, the error is cleared
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	s.updateHostsFile()
+	assert.False(t, s.hostsFileFailing)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "# BEGIN wirelink wg0\n# END wirelink wg0\n", string(content))
+}
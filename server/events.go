@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/fastcat/wirelink/events"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/log"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Events returns the bus on which the server publishes notable changes to the
+// state of the network
+func (s *LinkServer) Events() *events.Bus {
+	return &s.eventBus
+}
+
+// peerEvent builds an event concerning the given peer, with its message
+// formatted from the remaining args
+func (s *LinkServer) peerEvent(t events.Type, peer wgtypes.Key, format string, args ...any) events.Event {
+	return events.Event{
+		Type:     t,
+		Peer:     peer.String(),
+		PeerName: s.peerName(peer),
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// emit logs the event's message and publishes it to subscribers
+func (s *LinkServer) emit(e events.Event) {
+	var attrs []slog.Attr
+	if e.Peer != "" {
+		attrs = append(attrs, log.Peer(e.Peer), log.PeerName(e.PeerName))
+	}
+	if e.Attribute != "" {
+		attrs = append(attrs, log.Attribute(e.Attribute))
+	}
+	log.With(attrs...).Info("%s", e.Message)
+	s.eventBus.Publish(e)
+}
+
+// factExpiredEvent builds an event for the expiration of the given fact
+func (s *LinkServer) factExpiredEvent(fk fact.Key) events.Event {
+	desc := fk.FancyString(s.peerNamer)
+	e := events.Event{
+		Type:      events.TypeFactExpired,
+		Attribute: fk.Attribute.Name(),
+		Fact:      desc,
+		Message:   fmt.Sprintf("Expiring critical fact: %s", desc),
+	}
+	if f, err := fk.ToFact(); err == nil {
+		if ps, ok := f.Subject.(*fact.PeerSubject); ok {
+			e.Peer = ps.Key.String()
+			e.PeerName = s.peerName(ps.Key)
+		}
+	}
+	return e
+}
+
+func ipNetStrings(ipns []net.IPNet) []string {
+	if len(ipns) == 0 {
+		return nil
+	}
+	ret := make([]string, 0, len(ipns))
+	for _, ipn := range ipns {
+		ret = append(ret, ipn.String())
+	}
+	return ret
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/apply"
+	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/device"
+	"github.com/fastcat/wirelink/events"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal/mocks"
+	"github.com/fastcat/wirelink/internal/networking"
+	netmocks "github.com/fastcat/wirelink/internal/networking/mocks"
+	"github.com/fastcat/wirelink/internal/testutils"
+	factutils "github.com/fastcat/wirelink/internal/testutils/facts"
+	"github.com/fastcat/wirelink/signing"
+	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func drainEvents(sub *events.Subscription) []events.Event {
+	var ret []events.Event
+	for {
+		select {
+		case e := <-sub.C():
+			ret = append(ret, e)
+		default:
+			return ret
+		}
+	}
+}
+
+func TestLinkServer_events_addPeer(t *testing.T) {
+	now := time.Now()
+	wgIface := fmt.Sprintf("wg%d", rand.Int())
+	localKey := testutils.MustKey(t)
+	controllerKey := testutils.MustKey(t)
+	leafKey := testutils.MustKey(t)
+
+	dev := &wgtypes.Device{Name: wgIface, PublicKey: localKey}
+	ctrl := &mocks.WgClient{}
+	ctrl.Test(t)
+	ctrl.On("Device", wgIface).Once().Return(dev, nil)
+	ctrl.On("ConfigureDevice", wgIface, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:         leafKey,
+			AllowedIPs:        []net.IPNet{autopeer.AutoAddressNet(leafKey)},
+			ReplaceAllowedIPs: true,
+		}},
+	}).Return(nil)
+	d, err := device.New(ctrl, wgIface)
+	require.NoError(t, err)
+	env := &netmocks.Environment{}
+	env.Test(t)
+	env.On("Interfaces").Once().Return([]networking.Interface{}, nil)
+	ic, err := newInterfaceCache(env, wgIface)
+	require.NoError(t, err)
+
+	s := &LinkServer{
+		config: buildConfig(wgIface).withPeer(controllerKey, &config.Peer{
+			Trust: new(trust.Membership),
+		}).Build(),
+		dev:            d,
+		peerKnowledge:  newPKS(nil),
+		peerConfig:     newPeerConfigSet(),
+		signer:         &signing.Signer{PublicKey: localKey},
+		interfaceCache: ic,
+	}
+	s.newBootID()
+
+	sub := s.Events().Subscribe(10)
+	defer sub.Close()
+	s.configurePeersOnce(
+		[]*fact.Fact{factutils.MemberFactFull(&leafKey, now.Add(DefaultFactTTL))},
+		dev,
+		now.Add(-time.Hour),
+		now,
+	)
+	ctrl.AssertExpectations(t)
+
+	got := drainEvents(sub)
+	require.Len(t, got, 2)
+	assert.Equal(t, events.TypePeerAdded, got[0].Type)
+	assert.Equal(t, leafKey.String(), got[0].Peer)
+	// the new peer isn't healthy yet, so it gets restricted to just its
+	// automatic address
+	assert.Equal(t, events.TypeAllowedIPsRestrict, got[1].Type)
+	aip := autopeer.AutoAddressNet(leafKey)
+	assert.Equal(t, []string{aip.String()}, got[1].AllowedIPs)
+	assert.Contains(t, got[1].Message, "IPv6-LL")
+}
+
+func TestLinkServer_publishPeerStateChanges(t *testing.T) {
+	now := time.Now()
+	key := testutils.MustKey(t)
+	boot1, boot2 := uuid.New(), uuid.New()
+	withBoot := func(pcs *apply.PeerConfigState, bootID uuid.UUID) *apply.PeerConfigState {
+		return pcs.Update(
+			&wgtypes.Peer{PublicKey: key, LastHandshakeTime: now, Endpoint: testutils.RandUDP4Addr(t)},
+			"", true, now.Add(DefaultFactTTL), &bootID, now, nil, true,
+		)
+	}
+
+	tests := []struct {
+		name       string
+		prev, next *apply.PeerConfigState
+		want       []events.Type
+	}{
+		{"no change", makePCS(t, true, true, false), makePCS(t, true, true, false), nil},
+		{"new peer unhealthy", nil, makePCS(t, false, false, false), nil},
+		{"came up", makePCS(t, false, false, false), makePCS(t, true, true, false), []events.Type{events.TypePeerHealth}},
+		{"went down", makePCS(t, true, true, false), makePCS(t, true, false, false), []events.Type{events.TypePeerHealth}},
+		{"first boot", makePCS(t, true, true, false), withBoot(nil, boot1), nil},
+		{"rebooted", withBoot(nil, boot1), withBoot(nil, boot2), []events.Type{events.TypeBootID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &LinkServer{
+				config:     buildConfig("wg0").Build(),
+				peerConfig: newPeerConfigSet(),
+				signer:     &signing.Signer{},
+			}
+			sub := s.Events().Subscribe(10)
+			defer sub.Close()
+			s.publishPeerStateChanges(key, tt.prev, tt.next, now)
+			var got []events.Type
+			for _, e := range drainEvents(sub) {
+				got = append(got, e.Type)
+				assert.Equal(t, key.String(), e.Peer)
+				if e.Type == events.TypePeerHealth {
+					assert.Equal(t, new(tt.next.IsHealthy()), e.Healthy)
+					assert.Equal(t, new(tt.next.IsAlive()), e.Alive)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLinkServer_newBootID_event(t *testing.T) {
+	s := &LinkServer{}
+	sub := s.Events().Subscribe(1)
+	defer sub.Close()
+	s.newBootID()
+	got := drainEvents(sub)
+	require.Len(t, got, 1)
+	assert.Equal(t, events.TypeBootID, got[0].Type)
+	assert.Equal(t, s.bootID().String(), got[0].BootID)
+	assert.Empty(t, got[0].Peer)
+}
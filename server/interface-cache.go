@@ -2,6 +2,7 @@ package server
 
 import (
 	"net"
+	"slices"
 	"sync"
 
 	"github.com/fastcat/wirelink/internal/networking"
@@ -61,11 +62,8 @@ func (ic *interfaceCache) Dirty() {
 	ic.mu.Unlock()
 }
 
-// WillTunnel heuristically checks if an IP is likely to route via the tunnel.
-// An IP that matches a non-tunnel interface subnet is expected not to tunnel.
-// An IP that doesn't match those but does match a tunnel subnet is expected to
-// tunnel. Any other IP is expected to not tunnel.
-func (ic *interfaceCache) WillTunnel(ip net.IP) bool {
+// rlock takes the read lock, first refreshing the data if it is dirty
+func (ic *interfaceCache) rlock() {
 	ic.mu.RLock()
 	if ic.dirty {
 		ic.mu.RUnlock()
@@ -74,6 +72,21 @@ func (ic *interfaceCache) WillTunnel(ip net.IP) bool {
 		ic.mu.Unlock()
 		ic.mu.RLock()
 	}
+}
+
+// TunnelIPNets returns a copy of the IPNets assigned to the tunnel
+func (ic *interfaceCache) TunnelIPNets() []net.IPNet {
+	ic.rlock()
+	defer ic.mu.RUnlock()
+	return slices.Clone(ic.tunnelIPNets)
+}
+
+// WillTunnel heuristically checks if an IP is likely to route via the tunnel.
+// An IP that matches a non-tunnel interface subnet is expected not to tunnel.
+// An IP that doesn't match those but does match a tunnel subnet is expected to
+// tunnel. Any other IP is expected to not tunnel.
+func (ic *interfaceCache) WillTunnel(ip net.IP) bool {
+	ic.rlock()
 
 	isTunnel := false
 	for _, ipn := range ic.tunnelIPNets {
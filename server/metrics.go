@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/fastcat/wirelink/apply"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/metrics"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// serverCounters holds the counters the server updates as it runs. The zero
+// value is ready to use.
+type serverCounters struct {
+	packetsReceived      metrics.Counter
+	packetsSent          metrics.Counter
+	signedGroupsReceived metrics.Counter
+	signedGroupsSent     metrics.Counter
+	decodeErrors         metrics.Counter
+	signatureErrors      metrics.Counter
+	// factsAccepted and factsRejected are labeled by attribute name
+	factsAccepted metrics.Counter
+	factsRejected metrics.Counter
+	// endpointSwitches is labeled by peer key and name
+	endpointSwitches metrics.Counter
+	configureErrors  metrics.Counter
+}
+
+// Metrics returns a registry exporting the server's metrics
+func (s *LinkServer) Metrics() *metrics.Registry {
+	c := &s.counters
+	r := metrics.NewRegistry()
+	r.Counter("wirelink_packets_received_total", "Packets received from peers", &c.packetsReceived)
+	r.Counter("wirelink_packets_sent_total", "Packets sent to peers", &c.packetsSent)
+	r.Counter("wirelink_signed_groups_received_total", "Signed fact groups received and verified", &c.signedGroupsReceived)
+	r.Counter("wirelink_signed_groups_sent_total", "Signed fact groups prepared for sending", &c.signedGroupsSent)
+	r.Counter("wirelink_decode_errors_total", "Received packets or signed groups that could not be decoded", &c.decodeErrors)
+	r.Counter("wirelink_signature_errors_total", "Received signed groups that failed verification", &c.signatureErrors)
+	r.Counter("wirelink_facts_accepted_total", "Received facts accepted by the trust model", &c.factsAccepted, "attribute")
+	r.Counter("wirelink_facts_rejected_total", "Received facts rejected by the trust model", &c.factsRejected, "attribute")
+	r.GaugeFunc("wirelink_facts", "Currently known facts", s.factCountSamples, "attribute")
+	r.GaugeFunc("wirelink_peer_healthy", "Whether the peer has a recent handshake", func() []metrics.Sample {
+		return s.peerStateSamples((*apply.PeerConfigState).IsHealthy)
+	}, "peer", "name")
+	r.GaugeFunc("wirelink_peer_alive", "Whether the peer has recently sent us an alive fact", func() []metrics.Sample {
+		return s.peerStateSamples((*apply.PeerConfigState).IsAlive)
+	}, "peer", "name")
+	r.Counter("wirelink_endpoint_switches_total", "Times a new endpoint was tried for the peer", &c.endpointSwitches, "peer", "name")
+	r.Counter("wirelink_configure_device_errors_total", "Failed attempts to configure the wireguard device", &c.configureErrors)
+	return r
+}
+
+func (s *LinkServer) factCountSamples() []metrics.Sample {
+	facts := s.currentFacts.Load()
+	if facts == nil {
+		return nil
+	}
+	counts := make(map[fact.Attribute]int)
+	for _, f := range *facts {
+		counts[f.Attribute]++
+	}
+	ret := make([]metrics.Sample, 0, len(counts))
+	for a, n := range counts {
+		ret = append(ret, metrics.Sample{LabelValues: []string{a.Name()}, Value: float64(n)})
+	}
+	return ret
+}
+
+func (s *LinkServer) peerStateSamples(get func(*apply.PeerConfigState) bool) []metrics.Sample {
+	// can't look up peer names inside ForEach, it holds the lock that needs
+	states := make(map[wgtypes.Key]*apply.PeerConfigState)
+	s.peerConfig.ForEach(func(k wgtypes.Key, pcs *apply.PeerConfigState) {
+		states[k] = pcs
+	})
+	ret := make([]metrics.Sample, 0, len(states))
+	for k, pcs := range states {
+		// TODO: don't rely on signer for this
+		if k == s.signer.PublicKey {
+			continue
+		}
+		var v float64
+		if get(pcs) {
+			v = 1
+		}
+		ret = append(ret, metrics.Sample{LabelValues: []string{k.String(), s.peerName(k)}, Value: v})
+	}
+	return ret
+}
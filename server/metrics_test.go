@@ -0,0 +1,66 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal/networking"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/internal/testutils/facts"
+	"github.com/fastcat/wirelink/signing"
+)
+
+func TestLinkServer_Metrics(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+	localPriv, localKey := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+
+	s := &LinkServer{
+		config: buildConfig("wg0").
+			withPeer(k1, &config.Peer{Name: "one"}).
+			Build(),
+		peerConfig: newPeerConfigSet(),
+		signer:     signing.New(localPriv),
+	}
+	s.peerConfig.Set(localKey, makePCS(t, true, true, false))
+	s.peerConfig.Set(k1, makePCS(t, true, true, false))
+	s.peerConfig.Set(k2, makePCS(t, false, false, false))
+	s.currentFacts.Store(&[]*fact.Fact{
+		facts.EndpointFactFull(testutils.RandUDP4Addr(t), &k1, expires),
+		facts.EndpointFactFull(testutils.RandUDP4Addr(t), &k2, expires),
+		facts.MemberFactFull(&k2, expires),
+	})
+
+	// a garbage packet should count as received and as a decode error
+	rfs, err := s.parsePacket(&networking.UDPPacket{Time: now, Data: []byte{0xff}, Addr: testutils.RandUDP4Addr(t)})
+	require.NoError(t, err)
+	assert.Empty(t, rfs)
+	s.counters.factsAccepted.Inc(fact.AttributeMember.Name())
+
+	var sb strings.Builder
+	_, err = s.Metrics().WriteTo(&sb)
+	require.NoError(t, err)
+	out := sb.String()
+
+	for _, line := range []string{
+		"wirelink_packets_received_total 1",
+		"wirelink_decode_errors_total 1",
+		`wirelink_facts_accepted_total{attribute="Member"} 1`,
+		`wirelink_facts{attribute="EndpointV4"} 2`,
+		`wirelink_facts{attribute="Member"} 1`,
+		`wirelink_peer_healthy{peer="` + k1.String() + `",name="one"} 1`,
+		`wirelink_peer_alive{peer="` + k2.String() + `",name="` + k2.String() + `"} 0`,
+		"# TYPE wirelink_endpoint_switches_total counter",
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+	assert.NotContains(t, out, localKey.String(), "local peer should not be reported")
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/log"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// localTiming returns the timing from the local config, with the defaults for
+// anything it doesn't set, e.g. in tests that don't parse it from config data
+func (s *LinkServer) localTiming() config.Timing {
+	var t config.Timing
+	if cfg := s.cfg(); cfg != nil {
+		t = cfg.Timing
+	}
+	def := config.DefaultTiming()
+	if t.FactTTL == 0 {
+		t.FactTTL = def.FactTTL
+	}
+	// long-lived facts never live less than the rest
+	if t.LongFactTTL == 0 {
+		t.LongFactTTL = def.LongFactTTL
+	}
+	t.LongFactTTL = max(t.LongFactTTL, t.FactTTL)
+	if t.ChunkPeriod == 0 {
+		t.ChunkPeriod = def.ChunkPeriod
+	}
+	if t.AlivePeriod == 0 {
+		t.AlivePeriod = def.AlivePeriod
+	}
+	if t.MaxChunk == 0 {
+		t.MaxChunk = def.MaxChunk
+	}
+	return t
+}
+
+// timing returns the timing currently in effect: the network timing adopted
+// from a trusted peer if there is one, else the local config.
+func (s *LinkServer) timing() config.Timing {
+	if t := s.networkTiming.Load(); t != nil {
+		return *t
+	}
+	return s.localTiming()
+}
+
+// timingAdvert is a validated network timing advertisement from a peer
+type timingAdvert struct {
+	source wgtypes.Key
+	timing config.Timing
+}
+
+// updateNetworkTiming looks for network timing facts from other peers and, if
+// we are not a router, adopts the timing they advertise. If several peers
+// advertise different timings, the one with the lowest key wins, so that all
+// leaves make the same choice.
+func (s *LinkServer) updateNetworkTiming(self wgtypes.Key, facts []*fact.Fact) {
+	if s.cfg().IsRouterNow {
+		if prev := s.networkTiming.Swap(nil); prev != nil {
+			log.Info("Reverting to local timing as a router: %s", describeTiming(s.localTiming()))
+		}
+		return
+	}
+
+	adverts, problems := s.timingAdverts(self, facts)
+	if len(adverts) > 0 {
+		chosen := adverts[0]
+		for _, a := range adverts[1:] {
+			if a.timing != chosen.timing {
+				problems = append(problems, fmt.Sprintf("Network timing from %s (%s) disagrees with %s (%s), using the latter",
+					s.peerName(a.source), describeTiming(a.timing), s.peerName(chosen.source), describeTiming(chosen.timing)))
+			}
+		}
+	}
+	// these would be repeated every chunk, so only log them when they change
+	if report := strings.Join(problems, "\n"); report != s.timingProblems {
+		for _, p := range problems {
+			log.Error("%s", p)
+		}
+		s.timingProblems = report
+	}
+	if len(adverts) == 0 {
+		// keep whatever we last adopted: the timing facts will usually expire
+		// because the network is changing, which is not a reason to retune
+		return
+	}
+	chosen := adverts[0]
+
+	current := s.timing()
+	if chosen.timing == current {
+		return
+	}
+	log.Info("Adopting network timing from %s: %s", s.peerName(chosen.source), describeTiming(chosen.timing))
+	if local := s.localTiming(); chosen.timing != local {
+		log.Info("Local timing config (%s) does not match the network", describeTiming(local))
+	}
+	s.networkTiming.Store(&chosen.timing)
+}
+
+// timingAdverts collects the valid timing advertisements from peers other
+// than self, sorted by peer key, using the latest one from each peer. Invalid
+// advertisements are described in problems.
+func (s *LinkServer) timingAdverts(self wgtypes.Key, facts []*fact.Fact) (adverts []timingAdvert, problems []string) {
+	latest := make(map[wgtypes.Key]*fact.Fact)
+	for _, f := range facts {
+		if f.Attribute != fact.AttributeNetworkTiming {
+			continue
+		}
+		ps, ok := f.Subject.(*fact.PeerSubject)
+		if !ok || ps.Key == self {
+			continue
+		}
+		if prev, ok := latest[ps.Key]; !ok || prev.Expires.Before(f.Expires) {
+			latest[ps.Key] = f
+		}
+	}
+
+	adverts = make([]timingAdvert, 0, len(latest))
+	for k, f := range latest {
+		nt, ok := f.Value.(*fact.NetworkTiming)
+		if !ok {
+			continue
+		}
+		// anything the peer doesn't advertise stays as we have it configured
+		t := s.localTiming()
+		if d, ok := nt.Get(fact.TimingFactTTL); ok {
+			t.FactTTL = d
+		}
+		if d, ok := nt.Get(fact.TimingLongFactTTL); ok {
+			t.LongFactTTL = d
+		}
+		if d, ok := nt.Get(fact.TimingAlivePeriod); ok {
+			t.AlivePeriod = d
+		}
+		if d, ok := nt.Get(fact.TimingChunkPeriod); ok {
+			t.ChunkPeriod = d
+		}
+		if err := t.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("Ignoring invalid network timing from %s: %v", s.peerName(k), err))
+			continue
+		}
+		// adopting a timing that trips the watchdog would restart us forever
+		if err := s.checkWatchdog(t); err != nil {
+			problems = append(problems, fmt.Sprintf("Ignoring network timing from %s: %v", s.peerName(k), err))
+			continue
+		}
+		adverts = append(adverts, timingAdvert{k, t})
+	}
+	slices.SortFunc(adverts, func(a, b timingAdvert) int {
+		return bytes.Compare(a.source[:], b.source[:])
+	})
+	// map iteration order is random, keep the problem report stable
+	slices.Sort(problems)
+	return adverts, problems
+}
+
+// checkWatchdog returns an error if the systemd watchdog could expire between
+// chunks with the given timing
+func (s *LinkServer) checkWatchdog(t config.Timing) error {
+	if wd := s.progress.WatchdogInterval(); wd != 0 && wd < 2*t.ChunkPeriod {
+		return fmt.Errorf("%s %v is too long for the systemd watchdog interval %v", config.ChunkPeriodFlag, t.ChunkPeriod, wd)
+	}
+	return nil
+}
+
+func describeTiming(t config.Timing) string {
+	return fmt.Sprintf("%s=%v %s=%v %s=%v %s=%v",
+		config.FactTTLFlag, t.FactTTL,
+		config.LongFactTTLFlag, t.LongFactTTL,
+		config.AlivePeriodFlag, t.AlivePeriod,
+		config.ChunkPeriodFlag, t.ChunkPeriod,
+	)
+}
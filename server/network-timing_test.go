@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal/systemd"
+	"github.com/fastcat/wirelink/internal/testutils"
+	factutils "github.com/fastcat/wirelink/internal/testutils/facts"
+	"github.com/fastcat/wirelink/signing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestLinkServer_updateNetworkTiming(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+	localPriv, localKey := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	// make sure k1 sorts first
+	if bytes.Compare(k1[:], k2[:]) > 0 {
+		k1, k2 = k2, k1
+	}
+
+	fast := config.Timing{
+		FactTTL:     9 * time.Second,
+		LongFactTTL: time.Minute,
+		ChunkPeriod: 3 * time.Second,
+		AlivePeriod: 1500 * time.Millisecond,
+		MaxChunk:    DefaultMaxChunk,
+	}
+	slow := config.DefaultTiming()
+	slow.ChunkPeriod = 10 * time.Second
+	timingFact := func(k wgtypes.Key, t config.Timing, expires time.Time) *fact.Fact {
+		return factutils.NetworkTimingFact(&k, expires, t.FactTTL, t.LongFactTTL, t.AlivePeriod, t.ChunkPeriod)
+	}
+
+	tests := []struct {
+		name    string
+		router  bool
+		adopted *config.Timing
+		facts   []*fact.Fact
+		want    config.Timing
+	}{
+		{"no adverts", false, nil, nil, config.DefaultTiming()},
+		{"adopt", false, nil, []*fact.Fact{timingFact(k1, fast, expires)}, fast},
+		{"ignore self", false, nil, []*fact.Fact{timingFact(localKey, fast, expires)}, config.DefaultTiming()},
+		{"keep adopted", false, &fast, nil, fast},
+		{"router", true, nil, []*fact.Fact{timingFact(k1, fast, expires)}, config.DefaultTiming()},
+		{"router reverts", true, &fast, nil, config.DefaultTiming()},
+		{
+			"ignore invalid",
+			false,
+			nil,
+			[]*fact.Fact{factutils.NetworkTimingFact(&k1, expires, 5*time.Second, 5*time.Second, time.Second, time.Second)},
+			config.DefaultTiming(),
+		},
+		{
+			"lowest key wins",
+			false,
+			nil,
+			[]*fact.Fact{timingFact(k2, slow, expires), timingFact(k1, fast, expires)},
+			fast,
+		},
+		{
+			"latest from a peer wins",
+			false,
+			nil,
+			[]*fact.Fact{timingFact(k1, slow, expires), timingFact(k1, fast, expires.Add(-time.Second))},
+			slow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &LinkServer{
+				config:     &config.Server{IsRouterNow: tt.router},
+				peerConfig: newPeerConfigSet(),
+				signer:     signing.New(localPriv),
+			}
+			if tt.adopted != nil {
+				s.networkTiming.Store(tt.adopted)
+			}
+			s.updateNetworkTiming(localKey, tt.facts)
+			assert.Equal(t, tt.want, s.timing())
+		})
+	}
+}
+
+func TestLinkServer_updateNetworkTiming_watchdog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "12000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	notifier, err := systemd.FromEnv()
+	require.NoError(t, err)
+
+	expires := time.Now().Add(DefaultFactTTL)
+	localPriv, localKey := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	// make sure k1 sorts first
+	if bytes.Compare(k1[:], k2[:]) > 0 {
+		k1, k2 = k2, k1
+	}
+	// the default chunk period is fine for a 12s watchdog, a 10s one is not
+	def := config.DefaultTiming()
+	slow := def
+	slow.ChunkPeriod = 10 * time.Second
+	fast := def
+	fast.ChunkPeriod = 3 * time.Second
+	timingFact := func(k wgtypes.Key, t config.Timing) *fact.Fact {
+		return factutils.NetworkTimingFact(&k, expires, t.FactTTL, t.LongFactTTL, t.AlivePeriod, t.ChunkPeriod)
+	}
+
+	tests := []struct {
+		name  string
+		facts []*fact.Fact
+		want  config.Timing
+	}{
+		{"reject slow", []*fact.Fact{timingFact(k1, slow)}, def},
+		{"adopt fast", []*fact.Fact{timingFact(k1, fast)}, fast},
+		{"skip slow", []*fact.Fact{timingFact(k1, slow), timingFact(k2, fast)}, fast},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &LinkServer{
+				config:     &config.Server{},
+				peerConfig: newPeerConfigSet(),
+				signer:     signing.New(localPriv),
+				progress:   systemd.NewReporter(notifier).Part("wg0"),
+			}
+			s.updateNetworkTiming(localKey, tt.facts)
+			assert.Equal(t, tt.want, s.timing())
+		})
+	}
+}
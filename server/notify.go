@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/fastcat/wirelink/apply"
+	"github.com/fastcat/wirelink/log"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// notifyChunkProcessed reports progress to systemd after each chunk, which
+// makes the service ready after the first one, and updates the status and
+// pings the watchdog after every one, so that a wedged pipeline stops the pings
+func (s *LinkServer) notifyChunkProcessed() {
+	if s.progress == nil {
+		return
+	}
+	if err := s.progress.Progress(s.statusSummary()); err != nil {
+		log.Debug("Unable to notify systemd of progress: %v", err)
+	}
+}
+
+func (s *LinkServer) notifyStopping() {
+	if err := s.progress.Stopping(); err != nil {
+		log.Debug("Unable to notify systemd of stopping: %v", err)
+	}
+}
+
+// statusSummary gives a one-line summary of the peer and fact counts
+func (s *LinkServer) statusSummary() string {
+	var peers, healthy, alive int
+	s.peerConfig.ForEach(func(k wgtypes.Key, pcs *apply.PeerConfigState) {
+		// TODO: don't rely on signer for this
+		if k == s.signer.PublicKey {
+			return
+		}
+		peers++
+		if pcs.IsHealthy() {
+			healthy++
+		}
+		if pcs.IsAlive() {
+			alive++
+		}
+	})
+	var facts int
+	if f := s.currentFacts.Load(); f != nil {
+		facts = len(*f)
+	}
+	return fmt.Sprintf("%d peers, %d healthy, %d alive, %d facts", peers, healthy, alive, facts)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fastcat/wirelink/fact"
+	"github.com/fastcat/wirelink/internal/systemd"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/internal/testutils/facts"
+	"github.com/fastcat/wirelink/signing"
+)
+
+func TestLinkServer_notifyChunkProcessed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "60000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	read := func() string {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	notifier, err := systemd.FromEnv()
+	require.NoError(t, err)
+	localPriv, localKey := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	s := &LinkServer{
+		config:     buildConfig("wg0").Build(),
+		peerConfig: newPeerConfigSet(),
+		signer:     signing.New(localPriv),
+		progress:   systemd.NewReporter(notifier).Part("wg0"),
+	}
+	s.peerConfig.Set(localKey, makePCS(t, true, true, false))
+	s.peerConfig.Set(k1, makePCS(t, true, true, false))
+	s.peerConfig.Set(k2, makePCS(t, true, false, false))
+
+	s.notifyChunkProcessed()
+	assert.Equal(t, "READY=1\nSTATUS=2 peers, 2 healthy, 1 alive, 0 facts", read())
+	assert.Equal(t, "WATCHDOG=1", read())
+
+	// status is only re-sent when it changes, the watchdog always is
+	s.notifyChunkProcessed()
+	assert.Equal(t, "WATCHDOG=1", read())
+
+	s.currentFacts.Store(&[]*fact.Fact{facts.MemberFactFull(&k1, time.Now().Add(DefaultFactTTL))})
+	s.notifyChunkProcessed()
+	assert.Equal(t, "STATUS=2 peers, 2 healthy, 1 alive, 1 facts", read())
+	assert.Equal(t, "WATCHDOG=1", read())
+
+	s.notifyStopping()
+	assert.Equal(t, "STOPPING=1", read())
+}
@@ -2,13 +2,16 @@ package server
 
 import (
 	"fmt"
+	"log/slog"
 	"net"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/fastcat/wirelink/apply"
+	"github.com/fastcat/wirelink/autopeer"
 	"github.com/fastcat/wirelink/detect"
+	"github.com/fastcat/wirelink/events"
 	"github.com/fastcat/wirelink/fact"
 	"github.com/fastcat/wirelink/log"
 	"github.com/fastcat/wirelink/trust"
@@ -73,7 +76,7 @@ func (s *LinkServer) collectPeerFlags(
 	validPeers[dev.PublicKey] = true
 
 	// statically configured peers are all valid
-	for k := range s.config.Peers {
+	for k := range s.cfg().Peers {
 		validPeers[k] = true
 	}
 
@@ -89,14 +92,15 @@ func (s *LinkServer) collectPeerFlags(
 		// if we have no info about a local peer, flag it for deletion
 		if !ok && !validPeers[peer.PublicKey] {
 			removePeer[peer.PublicKey] = true
-			log.Debug("Flagging peer %s for removal: not valid", peer.PublicKey)
+			log.Trust.With(log.Peer(peer.PublicKey.String())).Debug("Flagging peer %s for removal: not valid", peer.PublicKey)
 		}
 		// alive check uses 0 for the maxTTL, as we just care whether the alive fact
 		// is still valid now
 		newAlive, aliveUntil, bootID := s.peerKnowledge.peerAlive(peer.PublicKey)
-		ps, _ := s.peerConfig.Get(peer.PublicKey)
-		ps = ps.Update(peer, s.peerConfigName(peer.PublicKey), newAlive, aliveUntil, bootID, now, peerFacts, false)
+		prev, _ := s.peerConfig.Get(peer.PublicKey)
+		ps := prev.Update(peer, s.peerConfigName(peer.PublicKey), newAlive, aliveUntil, bootID, now, peerFacts, false)
 		s.peerConfig.Set(peer.PublicKey, ps)
+		s.publishPeerStateChanges(peer.PublicKey, prev, ps, now)
 	}
 	// do the same, slightly fake for the local peer
 	{
@@ -111,7 +115,7 @@ func (s *LinkServer) collectPeerFlags(
 			},
 			s.peerConfigName(dev.PublicKey),
 			true,
-			now.Add(s.FactTTL),
+			now.Add(s.timing().FactTTL),
 			&bootID,
 			now,
 			factsByPeer[dev.PublicKey],
@@ -133,7 +137,7 @@ func (s *LinkServer) collectPeerFlags(
 		} else {
 			// TODO: maybe only flag this if localPeer[peer], to reduce log noise in some corner cases
 			removePeer[peer] = true
-			log.Debug("Flagging peer %s for removal from %s: no membership", peer, dev.PublicKey)
+			log.Trust.With(log.Peer(peer.String())).Debug("Flagging peer %s for removal from %s: no membership", peer, dev.PublicKey)
 		}
 	}
 
@@ -146,6 +150,27 @@ func (s *LinkServer) collectPeerFlags(
 	return localPeers, removePeer, validPeers
 }
 
+// publishPeerStateChanges publishes events for any changes in the health or
+// boot id of a peer. The corresponding log messages come from
+// PeerConfigState.Update.
+func (s *LinkServer) publishPeerStateChanges(
+	peer wgtypes.Key,
+	prev, next *apply.PeerConfigState,
+	now time.Time,
+) {
+	if prev.IsHealthy() != next.IsHealthy() || prev.IsAlive() != next.IsAlive() {
+		e := s.peerEvent(events.TypePeerHealth, peer, "Peer %s is now %s", s.peerName(peer), next.Describe(now))
+		e.Healthy, e.Alive = new(next.IsHealthy()), new(next.IsAlive())
+		s.eventBus.Publish(e)
+	}
+	// don't report the first boot id we see as a reboot
+	if prevBoot, nextBoot := prev.BootID(), next.BootID(); prevBoot != nil && nextBoot != nil && *prevBoot != *nextBoot {
+		e := s.peerEvent(events.TypeBootID, peer, "Peer %s rebooted", s.peerName(peer))
+		e.BootID = nextBoot.String()
+		s.eventBus.Publish(e)
+	}
+}
+
 func (s *LinkServer) configurePeersOnce(newFacts []*fact.Fact, dev *wgtypes.Device, startTime, now time.Time) {
 	factsByPeer := groupFactsByPeer(newFacts)
 
@@ -158,9 +183,9 @@ func (s *LinkServer) configurePeersOnce(newFacts []*fact.Fact, dev *wgtypes.Devi
 	// longer than the fact ttl so that we don't remove config until we have a
 	// reasonable shot at having received everything from the network, or if we
 	// are a router or a source of allowed IPs
-	startedAndNotRouter := now.Sub(startTime) > s.FactTTL && !s.config.IsRouterNow
+	startedAndNotRouter := now.Sub(startTime) > s.timing().FactTTL && !s.cfg().IsRouterNow
 
-	selfTrust := s.config.Peers.Trust(dev.PublicKey, trust.Untrusted)
+	selfTrust := s.cfg().Peers.Trust(dev.PublicKey, trust.Untrusted)
 
 	// deconfigure also requires that we are not listed as an AIP trust source
 	allowDeconfigure := startedAndNotRouter && selfTrust < trust.AllowedIPs
@@ -169,7 +194,7 @@ func (s *LinkServer) configurePeersOnce(newFacts []*fact.Fact, dev *wgtypes.Devi
 		factGroup, ok := factsByPeer[peer.PublicKey]
 		if !ok {
 			// should never get here
-			log.Error("BUG detected: updating unknown peer: %s", s.peerName(peer.PublicKey))
+			s.peerLog(peer.PublicKey).Error("BUG detected: updating unknown peer: %s", s.peerName(peer.PublicKey))
 			return
 		}
 
@@ -204,11 +229,11 @@ func (s *LinkServer) configurePeersOnce(newFacts []*fact.Fact, dev *wgtypes.Devi
 		}
 		// should not be possible to have peer in valid and remove sets
 		if removePeer[peer] {
-			log.Error("BUG detected: have peer both valid and to-delete: %s", s.peerName(peer))
+			s.peerLog(peer).Error("BUG detected: have peer both valid and to-delete: %s", s.peerName(peer))
 			continue
 		}
 
-		log.Info("Adding new local peer %s", s.peerName(peer))
+		s.emit(s.peerEvent(events.TypePeerAdded, peer, "Adding new local peer %s", s.peerName(peer)))
 		updatePeer(&wgtypes.Peer{PublicKey: peer}, true)
 	}
 
@@ -216,7 +241,7 @@ func (s *LinkServer) configurePeersOnce(newFacts []*fact.Fact, dev *wgtypes.Devi
 	allowDelete := startedAndNotRouter && selfTrust < trust.Membership
 	// if we are a trusted source of Membership, then we shouldn't have any
 	// peers to remove
-	if s.config.IsRouterNow || selfTrust >= trust.Membership {
+	if s.cfg().IsRouterNow || selfTrust >= trust.Membership {
 		for peer, r := range removePeer {
 			if !r ||
 				// during tests we may remove previously valid peers,
@@ -225,7 +250,7 @@ func (s *LinkServer) configurePeersOnce(newFacts []*fact.Fact, dev *wgtypes.Devi
 				!localPeers[peer] {
 				continue
 			}
-			log.Error("BUG detected: trust source wants to remove peer: %s (%v)", s.peerName(peer))
+			s.peerLog(peer).Error("BUG detected: trust source wants to remove peer: %s (%v)", s.peerName(peer))
 			allowDelete = false
 		}
 	}
@@ -246,17 +271,18 @@ func (s *LinkServer) peerHealthyEnough(now time.Time, key wgtypes.Key) bool {
 	// don't trust a peer's info if its alive packet is nearly expired
 	isHealthy := pcs.IsHealthy()
 	aliveFor := now.Sub(pcs.AliveSince())
-	aliveForMin := s.FactTTL + s.ChunkPeriod
+	timing := s.timing()
+	aliveForMin := timing.FactTTL + timing.ChunkPeriod
 	stillAliveFor := pcs.AliveUntil().Sub(now)
-	stillAliveForMin := s.ChunkPeriod * 3 / 2
+	stillAliveForMin := timing.ChunkPeriod * 3 / 2
 	if !isHealthy ||
 		aliveFor < aliveForMin ||
 		stillAliveFor <= stillAliveForMin {
-		log.Debug("Maybe not safe to delete peers: %s is not healthy (!%v {%v} || %v < %v || %v <= %v)",
+		log.Trust.With(log.Peer(key.String())).Debug("Maybe not safe to delete peers: %s is not healthy (!%v {%v} || %v < %v || %v <= %v)",
 			key, isHealthy, pcs.IsAlive(), aliveFor, aliveForMin, stillAliveFor, stillAliveForMin)
 		return false
 	}
-	log.Debug("Healthy enough: %s: %v >= %v && %v > %v",
+	log.Trust.With(log.Peer(key.String())).Debug("Healthy enough: %s: %v >= %v && %v > %v",
 		key, aliveFor, aliveForMin, stillAliveFor, stillAliveForMin)
 	return true
 }
@@ -277,14 +303,14 @@ func (s *LinkServer) deletePeers(
 ) (err error) {
 	doDelPeers := false
 	anyMemberTrust := false
-	for pk, pc := range s.config.Peers {
+	for pk, pc := range s.cfg().Peers {
 		if pc.Trust == nil || *pc.Trust < trust.Membership {
 			continue
 		}
 		anyMemberTrust = true
 		if s.peerHealthyEnough(now, pk) {
 			doDelPeers = true
-			log.Debug("Safe to delete peers from %s: %s is healthy", dev.PublicKey, pk)
+			log.Trust.With(log.Peer(pk.String())).Debug("Safe to delete peers from %s: %s is healthy", dev.PublicKey, pk)
 			break
 		}
 	}
@@ -294,14 +320,14 @@ func (s *LinkServer) deletePeers(
 		for _, peer := range dev.Peers {
 			if detect.IsPeerRouter(&peer) && s.peerHealthyEnough(now, peer.PublicKey) {
 				doDelPeers = true
-				log.Debug("Safe to delete peers from %s: %s is healthy (router)", dev.PublicKey, peer)
+				log.Trust.With(log.Peer(peer.PublicKey.String())).Debug("Safe to delete peers from %s: %s is healthy (router)", dev.PublicKey, peer)
 				break
 			}
 		}
 	}
 
 	if !doDelPeers {
-		log.Debug("Not safe to delete peers from %s", dev.PublicKey)
+		log.Trust.Debug("Not safe to delete peers from %s", dev.PublicKey)
 		return err
 	}
 
@@ -311,7 +337,7 @@ func (s *LinkServer) deletePeers(
 			continue
 		}
 		// don't delete statically configured peers, they'd just get re-added
-		if s.config.Peers.Has(peer.PublicKey) {
+		if s.cfg().Peers.Has(peer.PublicKey) {
 			continue
 		}
 		// don't delete routers if we have no other sources of membership trust
@@ -319,7 +345,7 @@ func (s *LinkServer) deletePeers(
 		if detect.IsPeerRouter(&peer) && !anyMemberTrust {
 			continue
 		}
-		log.Info("Removing peer: %s", s.peerName(peer.PublicKey))
+		s.emit(s.peerEvent(events.TypePeerRemoved, peer.PublicKey, "Removing peer: %s", s.peerName(peer.PublicKey)))
 		cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{
 			PublicKey: peer.PublicKey,
 			Remove:    true,
@@ -331,6 +357,7 @@ func (s *LinkServer) deletePeers(
 	if len(cfg.Peers) != 0 {
 		err = s.dev.ConfigureDevice(cfg)
 		if err != nil {
+			s.counters.configureErrors.Inc()
 			log.Error("Unable to delete peers: %v", err)
 		}
 	}
@@ -343,8 +370,8 @@ func (s *LinkServer) readyForAllowedIPs(
 	state *apply.PeerConfigState,
 	peer *wgtypes.Peer,
 ) bool {
-	return now.Add(s.ChunkPeriod/2).Before(state.AliveUntil()) ||
-		s.config.Peers.IsBasic(peer.PublicKey) ||
+	return now.Add(s.timing().ChunkPeriod/2).Before(state.AliveUntil()) ||
+		s.cfg().Peers.IsBasic(peer.PublicKey) ||
 		state.IsBasic()
 }
 
@@ -357,7 +384,10 @@ func (s *LinkServer) configurePeer(
 ) (state *apply.PeerConfigState, err error) {
 	now := time.Now()
 	peerName := s.peerName(peer.PublicKey)
-	state = inputState.EnsureNotNil()
+	peerFields := []slog.Attr{log.Peer(peer.PublicKey.String()), log.PeerName(peerName)}
+	// work on a copy so that readers of the peerConfigSet don't see the
+	// endpoint usage change under them
+	state = inputState.Clone().EnsureNotNil()
 
 	var pcfg *wgtypes.PeerConfig
 	logged := false
@@ -372,11 +402,16 @@ func (s *LinkServer) configurePeer(
 		if s.readyForAllowedIPs(now, state, peer) {
 			pcfg = apply.EnsureAllowedIPs(peer, facts, pcfg, allowDeconfigure)
 			if pcfg != nil && (len(pcfg.AllowedIPs) > 0 || pcfg.ReplaceAllowedIPs) {
+				var e events.Event
 				if pcfg.ReplaceAllowedIPs {
-					log.Info("Resetting AIPs on peer %s: %d -> %d", peerName, len(peer.AllowedIPs), len(pcfg.AllowedIPs))
+					e = s.peerEvent(events.TypeAllowedIPsReset, peer.PublicKey,
+						"Resetting AIPs on peer %s: %d -> %d", peerName, len(peer.AllowedIPs), len(pcfg.AllowedIPs))
 				} else {
-					log.Info("Adding AIPs to peer %s: %d", peerName, len(pcfg.AllowedIPs))
+					e = s.peerEvent(events.TypeAllowedIPsAdd, peer.PublicKey,
+						"Adding AIPs to peer %s: %d", peerName, len(pcfg.AllowedIPs))
 				}
+				e.AllowedIPs = ipNetStrings(pcfg.AllowedIPs)
+				s.emit(e)
 				logged = true
 			}
 		}
@@ -388,7 +423,10 @@ func (s *LinkServer) configurePeer(
 		if allowDeconfigure {
 			pcfg = apply.OnlyAutoIP(peer, pcfg)
 			if pcfg != nil && pcfg.ReplaceAllowedIPs {
-				log.Info("Restricting peer to be IPv6-LL only: %s", peerName)
+				e := s.peerEvent(events.TypeAllowedIPsRestrict, peer.PublicKey,
+					"Restricting peer to be IPv6-LL only: %s", peerName)
+				e.AllowedIPs = ipNetStrings(pcfg.AllowedIPs)
+				s.emit(e)
 				logged = true
 			}
 		}
@@ -396,12 +434,15 @@ func (s *LinkServer) configurePeer(
 		if state.TimeForNextEndpoint() {
 			nextEndpoint := state.NextEndpoint(peerName, facts, now, s.isUsablePeerEndpointLocked)
 			if nextEndpoint == nil {
-				log.Debug("Time for new EP for %s, but none known", peerName)
+				log.Endpoint.With(peerFields...).Debug("Time for new EP for %s, but none known", peerName)
 			} else if util.UDPEqualIPPort(nextEndpoint, peer.Endpoint) {
 				// don't poke the config if it already has the same endpoint, e.g. there is only one known to try
-				log.Debug("Time for new EP for %s, but no alternate known", peerName)
+				log.Endpoint.With(peerFields...).Debug("Time for new EP for %s, but no alternate known", peerName)
 			} else {
-				log.Info("Trying EP for %s: %v", peerName, nextEndpoint)
+				e := s.peerEvent(events.TypeEndpoint, peer.PublicKey, "Trying EP for %s: %v", peerName, nextEndpoint)
+				e.Endpoint = nextEndpoint.String()
+				s.emit(e)
+				s.counters.endpointSwitches.Inc(peer.PublicKey.String(), peerName)
 				logged = true
 				if pcfg == nil {
 					pcfg = &wgtypes.PeerConfig{PublicKey: peer.PublicKey}
@@ -417,7 +458,9 @@ func (s *LinkServer) configurePeer(
 	var addedAIP bool
 	pcfg, addedAIP = apply.EnsurePeerAutoIP(peer, pcfg)
 	if addedAIP {
-		log.Info("Adding IPv6-LL to %s", peerName)
+		e := s.peerEvent(events.TypeAllowedIPsAdd, peer.PublicKey, "Adding IPv6-LL to %s", peerName)
+		e.AllowedIPs = ipNetStrings([]net.IPNet{autopeer.AutoAddressNet(peer.PublicKey)})
+		s.emit(e)
 		logged = true
 	}
 
@@ -437,10 +480,11 @@ func (s *LinkServer) configurePeer(
 		Peers: []wgtypes.PeerConfig{*pcfg},
 	})
 	if err != nil {
-		log.Error("Failed to configure peer %s: %+v: %v", peerName, *pcfg, err)
+		s.counters.configureErrors.Inc()
+		log.With(peerFields...).Error("Failed to configure peer %s: %+v: %v", peerName, *pcfg, err)
 		return state, err
 	} else if !logged {
-		log.Info("WAT: applied unknown peer config change to %s: %+v", peerName, *pcfg)
+		log.With(peerFields...).Info("WAT: applied unknown peer config change to %s: %+v", peerName, *pcfg)
 	}
 
 	return state, err
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/fastcat/wirelink/config"
 	"github.com/fastcat/wirelink/fact"
 	"github.com/fastcat/wirelink/log"
 
@@ -24,19 +25,54 @@ func keyOf(f *fact.Fact, peer wgtypes.Key) peerKnowledgeKey {
 	}
 }
 
+// outboundFact records when we sent a fact to a peer, and its expiration
+type outboundFact struct {
+	expires time.Time
+	sentAt  time.Time
+}
+
+// digestState tracks the exchange of digests with a peer
+type digestState struct {
+	// lastSent is when we last sent the peer a digest
+	lastSent time.Time
+	// retryAt is the earliest we will act on another mismatched digest from the
+	// peer, and retryDelay is how long we waited before that
+	retryAt    time.Time
+	retryDelay time.Duration
+}
+
 type peerKnowledgeSet struct {
 	access sync.RWMutex
 	// data maps a PKK (fact key + source peer) to its expiration time for that peer
 	data    map[peerKnowledgeKey]time.Time
 	bootIDs map[wgtypes.Key]uuid.UUID
-	pl      *peerLookup
+	// protocols maps a peer to the protocol info it advertised about itself, and
+	// protocolsConfirmed records which of those adverts have been followed by an
+	// alive fact from the same boot, and so are known to be from that boot
+	protocols          map[wgtypes.Key]fact.ProtocolInfo
+	protocolsConfirmed map[wgtypes.Key]bool
+	// inbound maps a PKK to the expiration of the fact we received from that
+	// peer, and outbound to when we sent the fact to that peer, for digests
+	inbound  map[peerKnowledgeKey]time.Time
+	outbound map[peerKnowledgeKey]outboundFact
+	digests  map[wgtypes.Key]*digestState
+	// interests maps a peer to the peers it asked us to tell it about, and when
+	// each of those requests expires
+	interests map[wgtypes.Key]map[wgtypes.Key]time.Time
+	pl        *peerLookup
 }
 
 func newPKS(pl *peerLookup) *peerKnowledgeSet {
 	return &peerKnowledgeSet{
-		data:    make(map[peerKnowledgeKey]time.Time),
-		bootIDs: make(map[wgtypes.Key]uuid.UUID),
-		pl:      pl,
+		data:               make(map[peerKnowledgeKey]time.Time),
+		bootIDs:            make(map[wgtypes.Key]uuid.UUID),
+		protocols:          make(map[wgtypes.Key]fact.ProtocolInfo),
+		protocolsConfirmed: make(map[wgtypes.Key]bool),
+		inbound:            make(map[peerKnowledgeKey]time.Time),
+		outbound:           make(map[peerKnowledgeKey]outboundFact),
+		digests:            make(map[wgtypes.Key]*digestState),
+		interests:          make(map[wgtypes.Key]map[wgtypes.Key]time.Time),
+		pl:                 pl,
 	}
 }
 
@@ -47,6 +83,10 @@ func newPKS(pl *peerLookup) *peerKnowledgeSet {
 // invalid or the info was otherwise rejected (e.g. an older expiration than
 // what we already knew the peer knows).
 func (pks *peerKnowledgeSet) received(rf *ReceivedFact) bool {
+	// digests are about what the peer knows, they aren't knowledge themselves
+	if rf.fact.Attribute == fact.AttributeDigest {
+		return false
+	}
 	peer, ok := pks.pl.GetPeer(rf.source.IP)
 	if !ok {
 		return false
@@ -66,17 +106,48 @@ func (pks *peerKnowledgeSet) received(rf *ReceivedFact) bool {
 		// note that this is intentionally different from how the alive logging elsewhere works
 		if !oldIDOk || !uvOk || oldID != uv.UUID {
 			// TODO: use peername here
-			log.Debug("Detected bootID change from %v, pruning knowledge", k.peer)
+			log.PeerKnowledge.With(log.Peer(k.peer.String())).Debug("Detected bootID change from %v, pruning knowledge", k.peer)
 			// boot id changed, prune everything we think this peer knows
 			for dk := range pks.data {
 				if dk.peer == k.peer {
 					delete(pks.data, dk)
 				}
 			}
+			for dk := range pks.outbound {
+				if dk.peer == k.peer {
+					delete(pks.outbound, dk)
+				}
+			}
+			// if it actually rebooted, it will send us everything again, but don't
+			// forget what it sent us before its first alive fact
+			if oldIDOk {
+				for dk := range pks.inbound {
+					if dk.peer == k.peer {
+						delete(pks.inbound, dk)
+					}
+				}
+			}
+			// it may have been upgraded or downgraded too, so forget its advert if
+			// it was from the old boot. a restarted peer sends its advert and alive
+			// fact together, but they may arrive in different chunks, and if the
+			// advert came first it is from the new boot and must be kept.
+			if pks.protocolsConfirmed[k.peer] {
+				delete(pks.protocols, k.peer)
+			}
+			// and it will tell us again what it is interested in
+			delete(pks.interests, k.peer)
 		}
 		if uvOk {
 			pks.bootIDs[k.peer] = uv.UUID
 		}
+		if _, ok := pks.protocols[k.peer]; ok {
+			pks.protocolsConfirmed[k.peer] = true
+		} else {
+			delete(pks.protocolsConfirmed, k.peer)
+		}
+	} else if t, ok := pks.inbound[k]; !ok || rf.fact.Expires.After(t) {
+		// alive facts are sent on their own schedule, so leave them out of digests
+		pks.inbound[k] = rf.fact.Expires
 	}
 	t, ok := pks.data[k]
 	if !ok || rf.fact.Expires.After(t) {
@@ -86,6 +157,109 @@ func (pks *peerKnowledgeSet) received(rf *ReceivedFact) bool {
 	return false
 }
 
+// receivedProtocol records the protocol info a peer advertises in member
+// metadata about itself, which it is always authoritative about, regardless of
+// whether we trust the fact otherwise. This should be called after received
+// for all the facts in a chunk, so that any boot ID change doesn't prune the
+// new info.
+//
+// Returns the peer, its protocol info, and whether that info changed.
+func (pks *peerKnowledgeSet) receivedProtocol(rf *ReceivedFact) (peer wgtypes.Key, pi fact.ProtocolInfo, changed bool) {
+	if rf.fact.Attribute != fact.AttributeMemberMetadata {
+		return
+	}
+	peer, ok := pks.pl.GetPeer(rf.source.IP)
+	if !ok {
+		return
+	}
+	if ps, ok := rf.fact.Subject.(*fact.PeerSubject); !ok || ps.Key != peer {
+		return
+	}
+	mm, ok := rf.fact.Value.(*fact.MemberMetadata)
+	if !ok {
+		return
+	}
+	if pi, ok = mm.Protocol(); !ok {
+		return
+	}
+
+	pks.access.Lock()
+	defer pks.access.Unlock()
+	// we don't know which boot this is from until we get an alive fact after it
+	pks.protocolsConfirmed[peer] = false
+	old, ok := pks.protocols[peer]
+	if ok && old.Equal(pi) {
+		return peer, pi, false
+	}
+	pks.protocols[peer] = pi
+	return peer, pi, true
+}
+
+// receivedInterest records a peer's interest in facts about another peer,
+// which only the peer itself can tell us. Like receivedProtocol, this should be
+// called after received for all the facts in a chunk.
+//
+// Returns the peer, the peer it is interested in, and whether that interest is
+// new.
+func (pks *peerKnowledgeSet) receivedInterest(rf *ReceivedFact, now time.Time) (peer, interest wgtypes.Key, added bool) {
+	if rf.fact.Attribute != fact.AttributeInterest || now.After(rf.fact.Expires) {
+		return
+	}
+	peer, ok := pks.pl.GetPeer(rf.source.IP)
+	if !ok {
+		return
+	}
+	if ps, ok := rf.fact.Subject.(*fact.PeerSubject); !ok || ps.Key != peer {
+		return
+	}
+	pv, ok := rf.fact.Value.(*fact.PeerValue)
+	if !ok {
+		return
+	}
+
+	pks.access.Lock()
+	defer pks.access.Unlock()
+	pi := pks.interests[peer]
+	if pi == nil {
+		pi = make(map[wgtypes.Key]time.Time)
+		pks.interests[peer] = pi
+	}
+	e, ok := pi[pv.Key]
+	if !ok || rf.fact.Expires.After(e) {
+		pi[pv.Key] = rf.fact.Expires
+	}
+	return peer, pv.Key, !ok || !now.Before(e)
+}
+
+// peerInterests returns the set of peers the peer wants facts about, or nil if
+// it hasn't told us, in which case it wants facts about every peer.
+func (pks *peerKnowledgeSet) peerInterests(peer wgtypes.Key, now time.Time) map[wgtypes.Key]bool {
+	pks.access.RLock()
+	defer pks.access.RUnlock()
+	var ret map[wgtypes.Key]bool
+	for k, e := range pks.interests[peer] {
+		if now.Before(e) {
+			if ret == nil {
+				ret = make(map[wgtypes.Key]bool)
+			}
+			ret[k] = true
+		}
+	}
+	return ret
+}
+
+// peerProtocol returns the protocol info the peer advertised, or the legacy
+// protocol if it hasn't advertised any.
+func (pks *peerKnowledgeSet) peerProtocol(peer wgtypes.Key) fact.ProtocolInfo {
+	pks.access.RLock()
+	pi, ok := pks.protocols[peer]
+	pks.access.RUnlock()
+	if !ok {
+		return fact.LegacyProtocol()
+	}
+	return pi
+}
+
 // sent records that we sent a fact to a peer, and thus we assume that peer now
 // knows it until it expires.
 //
@@ -98,6 +272,14 @@ func (pks *peerKnowledgeSet) sent(peer *wgtypes.Peer, f *fact.Fact) bool {
 	}
 	pks.access.Lock()
 	defer pks.access.Unlock()
+	if f.Attribute != fact.AttributeAlive {
+		o := pks.outbound[k]
+		if f.Expires.After(o.expires) {
+			o.expires = f.Expires
+		}
+		o.sentAt = time.Now()
+		pks.outbound[k] = o
+	}
 	t, ok := pks.data[k]
 	if !ok || f.Expires.After(t) {
 		pks.data[k] = f.Expires
@@ -116,6 +298,26 @@ func (pks *peerKnowledgeSet) expire() (count int) {
 			count++
 		}
 	}
+	for key, value := range pks.inbound {
+		if now.After(value) {
+			delete(pks.inbound, key)
+		}
+	}
+	for key, value := range pks.outbound {
+		if now.After(value.expires) {
+			delete(pks.outbound, key)
+		}
+	}
+	for peer, pi := range pks.interests {
+		for key, value := range pi {
+			if now.After(value) {
+				delete(pi, key)
+			}
+		}
+		if len(pi) == 0 {
+			delete(pks.interests, peer)
+		}
+	}
 	return count
 }
 
@@ -199,3 +401,125 @@ func (pks *peerKnowledgeSet) peerBootID(peer wgtypes.Key) *uuid.UUID {
 	}
 	return nil
 }
+
+// digestDue returns whether it is time to send the peer a digest, and if so
+// records that one is being sent.
+func (pks *peerKnowledgeSet) digestDue(peer wgtypes.Key, now time.Time, period time.Duration) bool {
+	pks.access.Lock()
+	defer pks.access.Unlock()
+	ds := pks.digests[peer]
+	if ds == nil {
+		ds = &digestState{}
+		pks.digests[peer] = ds
+	}
+	if now.Before(ds.lastSent.Add(period)) {
+		return false
+	}
+	ds.lastSent = now
+	return true
+}
+
+// digestFor summarizes the facts we have received from the peer, leaving out
+// ones that will expire within margin, as the peer may not include them when it
+// checks the digest.
+func (pks *peerKnowledgeSet) digestFor(peer wgtypes.Key, now time.Time, margin time.Duration) *fact.Digest {
+	pks.access.RLock()
+	defer pks.access.RUnlock()
+	cutoff := now.Add(margin)
+	count := 0
+	for k, e := range pks.inbound {
+		if k.peer == peer && e.After(cutoff) {
+			count++
+		}
+	}
+	d := fact.NewDigest(fact.DigestBucketCount(count))
+	for k, e := range pks.inbound {
+		if k.peer == peer && e.After(cutoff) {
+			d.Add(k.Key, e.Sub(now))
+		}
+	}
+	return d
+}
+
+// receivedDigest compares a digest from a peer of the facts it has received
+// from self against what we have sent it, and forgets that the peer knows the
+// facts in any buckets that don't match, so that they will be sent again.
+// Buckets with facts sent within grace are skipped, as those may still be in
+// flight. Repeated mismatches back off from minDelay up to maxDelay, since
+// they may be because the peer still has facts we no longer send.
+//
+// Returns the peer and the number of facts forgotten.
+func (pks *peerKnowledgeSet) receivedDigest(
+	rf *ReceivedFact,
+	self wgtypes.Key,
+	now time.Time,
+	timing config.Timing,
+) (peer wgtypes.Key, forgotten int) {
+	if rf.fact.Attribute != fact.AttributeDigest || now.After(rf.fact.Expires) {
+		return
+	}
+	if ps, ok := rf.fact.Subject.(*fact.PeerSubject); !ok || ps.Key != self {
+		return
+	}
+	d, ok := rf.fact.Value.(*fact.Digest)
+	if !ok || len(d.Buckets) == 0 {
+		return
+	}
+	peer, ok = pks.pl.GetPeer(rf.source.IP)
+	if !ok {
+		return
+	}
+
+	// same margin the peer uses in digestFor
+	margin := timing.ChunkPeriod
+	grace := 2 * timing.ChunkPeriod
+	// TTLs are sent in whole seconds, and the peer may have sat on the facts
+	// for a chunk before building the digest
+	tolerance := grace + time.Second
+
+	pks.access.Lock()
+	defer pks.access.Unlock()
+
+	ds := pks.digests[peer]
+	if ds == nil {
+		ds = &digestState{}
+		pks.digests[peer] = ds
+	}
+
+	expected := fact.NewDigest(len(d.Buckets))
+	recent := make(map[int]bool)
+	cutoff := now.Add(margin)
+	for k, o := range pks.outbound {
+		if k.peer != peer || !o.expires.After(cutoff) {
+			continue
+		}
+		expected.Add(k.Key, o.expires.Sub(now))
+		if o.sentAt.After(now.Add(-grace)) {
+			recent[expected.Bucket(k.Key)] = true
+		}
+	}
+
+	mismatched := make(map[int]bool)
+	for _, b := range d.Mismatched(expected, tolerance) {
+		if !recent[b] {
+			mismatched[b] = true
+		}
+	}
+	if len(mismatched) == 0 {
+		ds.retryDelay = 0
+		return
+	}
+	if now.Before(ds.retryAt) {
+		return
+	}
+	ds.retryDelay = min(max(2*ds.retryDelay, timing.AlivePeriod), timing.FactTTL/2)
+	ds.retryAt = now.Add(ds.retryDelay)
+
+	for k := range pks.outbound {
+		if k.peer == peer && mismatched[expected.Bucket(k.Key)] {
+			delete(pks.data, k)
+			forgotten++
+		}
+	}
+	return peer, forgotten
+}
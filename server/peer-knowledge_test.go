@@ -1,6 +1,7 @@
 package server
 
 import (
+	"maps"
 	"net"
 	"testing"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/config"
 	"github.com/fastcat/wirelink/fact"
 	"github.com/fastcat/wirelink/internal/testutils"
 	"github.com/fastcat/wirelink/internal/testutils/facts"
@@ -146,11 +148,9 @@ func Test_peerKnowledgeSet_received(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			pl := newPeerLookup()
 			pl.addKeys(tt.args.keys...)
-			pks := &peerKnowledgeSet{
-				data:    tt.fields.data,
-				bootIDs: tt.fields.bootIDs,
-				pl:      pl,
-			}
+			pks := newPKS(pl)
+			pks.data = tt.fields.data
+			pks.bootIDs = tt.fields.bootIDs
 			assert.Equal(t, tt.want, pks.received(tt.args.rf))
 			assert.Equal(t, tt.wantFields.data, pks.data)
 			assert.Equal(t, tt.wantFields.bootIDs, pks.bootIDs)
@@ -178,10 +178,9 @@ func Test_peerKnowledgeSet_sent(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			pks := &peerKnowledgeSet{
-				data:    tt.fields.data,
-				bootIDs: tt.fields.bootIDs,
-			}
+			pks := newPKS(nil)
+			pks.data = tt.fields.data
+			pks.bootIDs = tt.fields.bootIDs
 			assert.Equal(t, tt.want, pks.sent(tt.args.peer, tt.args.f))
 			assert.Equal(t, tt.wantFields.data, pks.data)
 			assert.Equal(t, tt.wantFields.bootIDs, pks.bootIDs)
@@ -321,6 +320,18 @@ func Test_peerKnowledgeSet_peerKnows(t *testing.T) {
 }
 
 func Test_peerKnowledgeSet_peerNeeds(t *testing.T) {
+	now := time.Now()
+	k1 := testutils.MustKey(t)
+	k1p := &wgtypes.Peer{PublicKey: k1}
+	ep1 := testutils.RandUDP4Addr(t)
+	ipn1 := testutils.RandIPNet(t, net.IPv4len, nil, nil, 24)
+	timing := config.Timing{FactTTL: 4 * time.Minute, LongFactTTL: time.Hour, ChunkPeriod: 5 * time.Second}
+	epFact := facts.EndpointFactFull(ep1, &k1, now.Add(timing.FactTTL))
+	aipFact := facts.AllowedIPFactFull(ipn1, &k1, now.Add(timing.LongFactTTL))
+	knows := func(f *fact.Fact, expires time.Time) map[peerKnowledgeKey]time.Time {
+		return map[peerKnowledgeKey]time.Time{keyOf(f, k1): expires}
+	}
+
 	type fields struct {
 		data    map[peerKnowledgeKey]time.Time
 		bootIDs map[wgtypes.Key]uuid.UUID
@@ -336,7 +347,42 @@ func Test_peerKnowledgeSet_peerNeeds(t *testing.T) {
 		args   args
 		want   bool
 	}{
-		// TODO: Add test cases.
+		{
+			"empty needs everything",
+			fields{map[peerKnowledgeKey]time.Time{}, nil},
+			args{k1p, epFact, resendWindow(timing, epFact.Attribute)},
+			true,
+		},
+		{
+			"short-lived fact about to be forgotten",
+			fields{knows(epFact, now.Add(time.Minute)), nil},
+			args{k1p, epFact, resendWindow(timing, epFact.Attribute)},
+			true,
+		},
+		{
+			"short-lived fact remembered",
+			fields{knows(epFact, now.Add(3*time.Minute)), nil},
+			args{k1p, epFact, resendWindow(timing, epFact.Attribute)},
+			false,
+		},
+		{
+			"long-lived fact remembered",
+			fields{knows(aipFact, now.Add(45*time.Minute)), nil},
+			args{k1p, aipFact, resendWindow(timing, aipFact.Attribute)},
+			false,
+		},
+		{
+			"long-lived fact halfway to forgotten",
+			fields{knows(aipFact, now.Add(20*time.Minute)), nil},
+			args{k1p, aipFact, resendWindow(timing, aipFact.Attribute)},
+			true,
+		},
+		{
+			"long-lived fact known as long as local",
+			fields{knows(aipFact, aipFact.Expires), nil},
+			args{k1p, aipFact, time.Hour},
+			false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -450,3 +496,362 @@ func Test_peerKnowledgeSet_peerBootID(t *testing.T) {
 		})
 	}
 }
+
+func Test_peerKnowledgeSet_receivedProtocol(t *testing.T) {
+	expires := time.Now().Add(DefaultFactTTL)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	k1source := net.UDPAddr{IP: autopeer.AutoAddress(k1)}
+	ep1 := testutils.RandUDP4Addr(t)
+	local := fact.LocalProtocol()
+	legacy := fact.LegacyProtocol()
+
+	tests := []struct {
+		name        string
+		protocols   map[wgtypes.Key]fact.ProtocolInfo
+		f           *fact.Fact
+		wantChanged bool
+		want        fact.ProtocolInfo
+	}{
+		{
+			"new advert",
+			map[wgtypes.Key]fact.ProtocolInfo{},
+			facts.ProtocolFact(&k1, expires, local),
+			true,
+			local,
+		},
+		{
+			"same advert",
+			map[wgtypes.Key]fact.ProtocolInfo{k1: local},
+			facts.ProtocolFact(&k1, expires, local),
+			false,
+			local,
+		},
+		{
+			"changed advert",
+			map[wgtypes.Key]fact.ProtocolInfo{k1: local},
+			facts.ProtocolFact(&k1, expires, fact.ProtocolInfo{Version: 2, MinVersion: 1}),
+			true,
+			fact.ProtocolInfo{Version: 2, MinVersion: 1, Capabilities: []fact.Attribute{}},
+		},
+		{
+			"advert about another peer",
+			map[wgtypes.Key]fact.ProtocolInfo{},
+			facts.ProtocolFact(&k2, expires, local),
+			false,
+			legacy,
+		},
+		{
+			"metadata without protocol",
+			map[wgtypes.Key]fact.ProtocolInfo{},
+			facts.MemberMetadataFactFull(&k1, expires, "k1", false),
+			false,
+			legacy,
+		},
+		{
+			"other attribute",
+			map[wgtypes.Key]fact.ProtocolInfo{},
+			facts.EndpointFactFull(ep1, &k1, expires),
+			false,
+			legacy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl := newPeerLookup()
+			pl.addKeys(k1, k2)
+			pks := newPKS(pl)
+			pks.protocols = tt.protocols
+			_, _, changed := pks.receivedProtocol(&ReceivedFact{fact: tt.f, source: k1source})
+			assert.Equal(t, tt.wantChanged, changed)
+			assert.Equal(t, tt.want, pks.peerProtocol(k1))
+		})
+	}
+}
+
+func Test_peerKnowledgeSet_rebootForgetsProtocol(t *testing.T) {
+	expires := time.Now().Add(DefaultFactTTL)
+	k1 := testutils.MustKey(t)
+	k1source := net.UDPAddr{IP: autopeer.AutoAddress(k1)}
+	pl := newPeerLookup()
+	pl.addKeys(k1)
+	pks := newPKS(pl)
+
+	boot1 := uuid.Must(uuid.NewRandom())
+	pks.received(&ReceivedFact{fact: facts.AliveFactFull(&k1, expires, boot1), source: k1source})
+	pks.receivedProtocol(&ReceivedFact{fact: facts.ProtocolFact(&k1, expires, fact.LocalProtocol()), source: k1source})
+	assert.Equal(t, fact.LocalProtocol(), pks.peerProtocol(k1))
+	// the next alive fact shows the advert is from this boot
+	pks.received(&ReceivedFact{fact: facts.AliveFactFull(&k1, expires, boot1), source: k1source})
+	assert.Equal(t, fact.LocalProtocol(), pks.peerProtocol(k1))
+
+	pks.received(&ReceivedFact{fact: facts.AliveFactFull(&k1, expires, uuid.Must(uuid.NewRandom())), source: k1source})
+	assert.Equal(t, fact.LegacyProtocol(), pks.peerProtocol(k1))
+}
+
+func Test_peerKnowledgeSet_rebootKeepsNewProtocol(t *testing.T) {
+	expires := time.Now().Add(DefaultFactTTL)
+	k1 := testutils.MustKey(t)
+	k1source := net.UDPAddr{IP: autopeer.AutoAddress(k1)}
+	pl := newPeerLookup()
+	pl.addKeys(k1)
+	pks := newPKS(pl)
+	legacy := fact.LegacyProtocol()
+	legacy.Version++
+
+	boot1 := uuid.Must(uuid.NewRandom())
+	pks.received(&ReceivedFact{fact: facts.AliveFactFull(&k1, expires, boot1), source: k1source})
+	pks.receivedProtocol(&ReceivedFact{fact: facts.ProtocolFact(&k1, expires, legacy), source: k1source})
+	pks.received(&ReceivedFact{fact: facts.AliveFactFull(&k1, expires, boot1), source: k1source})
+
+	// after a restart, the new advert arrives in an earlier chunk than the alive
+	// fact sent with it
+	pks.receivedProtocol(&ReceivedFact{fact: facts.ProtocolFact(&k1, expires, fact.LocalProtocol()), source: k1source})
+	pks.received(&ReceivedFact{fact: facts.AliveFactFull(&k1, expires, uuid.Must(uuid.NewRandom())), source: k1source})
+	assert.Equal(t, fact.LocalProtocol(), pks.peerProtocol(k1))
+}
+
+func Test_peerKnowledgeSet_receivedInterest(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	k3 := testutils.MustKey(t)
+	k1source := net.UDPAddr{IP: autopeer.AutoAddress(k1)}
+	ep1 := testutils.RandUDP4Addr(t)
+
+	tests := []struct {
+		name      string
+		interests map[wgtypes.Key]map[wgtypes.Key]time.Time
+		f         *fact.Fact
+		wantAdded bool
+		want      map[wgtypes.Key]bool
+	}{
+		{
+			"new interest",
+			map[wgtypes.Key]map[wgtypes.Key]time.Time{},
+			facts.InterestFact(&k1, &k2, expires),
+			true,
+			map[wgtypes.Key]bool{k2: true},
+		},
+		{
+			"refreshed interest",
+			map[wgtypes.Key]map[wgtypes.Key]time.Time{k1: {k2: now.Add(time.Second)}},
+			facts.InterestFact(&k1, &k2, expires),
+			false,
+			map[wgtypes.Key]bool{k2: true},
+		},
+		{
+			"added interest",
+			map[wgtypes.Key]map[wgtypes.Key]time.Time{k1: {k2: expires}},
+			facts.InterestFact(&k1, &k3, expires),
+			true,
+			map[wgtypes.Key]bool{k2: true, k3: true},
+		},
+		{
+			"renewed expired interest",
+			map[wgtypes.Key]map[wgtypes.Key]time.Time{k1: {k2: now.Add(-time.Second), k3: expires}},
+			facts.InterestFact(&k1, &k2, expires),
+			true,
+			map[wgtypes.Key]bool{k2: true, k3: true},
+		},
+		{
+			"expired fact",
+			map[wgtypes.Key]map[wgtypes.Key]time.Time{},
+			facts.InterestFact(&k1, &k2, now.Add(-time.Second)),
+			false,
+			nil,
+		},
+		{
+			"interest of another peer",
+			map[wgtypes.Key]map[wgtypes.Key]time.Time{},
+			facts.InterestFact(&k2, &k3, expires),
+			false,
+			nil,
+		},
+		{
+			"other attribute",
+			map[wgtypes.Key]map[wgtypes.Key]time.Time{},
+			facts.EndpointFactFull(ep1, &k1, expires),
+			false,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl := newPeerLookup()
+			pl.addKeys(k1, k2, k3)
+			pks := newPKS(pl)
+			pks.interests = tt.interests
+			_, _, added := pks.receivedInterest(&ReceivedFact{fact: tt.f, source: k1source}, now)
+			assert.Equal(t, tt.wantAdded, added)
+			assert.Equal(t, tt.want, pks.peerInterests(k1, now))
+		})
+	}
+}
+
+func Test_peerKnowledgeSet_expireInterests(t *testing.T) {
+	now := time.Now()
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	k3 := testutils.MustKey(t)
+	pks := newPKS(newPeerLookup())
+	pks.interests = map[wgtypes.Key]map[wgtypes.Key]time.Time{
+		k1: {k2: now.Add(-time.Millisecond), k3: now.Add(DefaultFactTTL)},
+		k2: {k3: now.Add(-time.Millisecond)},
+	}
+	pks.expire()
+	assert.Equal(t, map[wgtypes.Key]map[wgtypes.Key]time.Time{
+		k1: {k3: now.Add(DefaultFactTTL)},
+	}, pks.interests)
+}
+
+func Test_peerKnowledgeSet_rebootForgetsInterests(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	k1source := net.UDPAddr{IP: autopeer.AutoAddress(k1)}
+	pl := newPeerLookup()
+	pl.addKeys(k1)
+	pks := newPKS(pl)
+
+	pks.received(&ReceivedFact{fact: facts.AliveFactFull(&k1, expires, uuid.Must(uuid.NewRandom())), source: k1source})
+	pks.receivedInterest(&ReceivedFact{fact: facts.InterestFact(&k1, &k2, expires), source: k1source}, now)
+	assert.Equal(t, map[wgtypes.Key]bool{k2: true}, pks.peerInterests(k1, now))
+
+	pks.received(&ReceivedFact{fact: facts.AliveFactFull(&k1, expires, uuid.Must(uuid.NewRandom())), source: k1source})
+	assert.Nil(t, pks.peerInterests(k1, now))
+}
+
+func Test_peerKnowledgeSet_digestDue(t *testing.T) {
+	now := time.Now()
+	k1 := testutils.MustKey(t)
+	pks := newPKS(newPeerLookup())
+	assert.True(t, pks.digestDue(k1, now, DefaultAlivePeriod))
+	assert.False(t, pks.digestDue(k1, now.Add(DefaultAlivePeriod/2), DefaultAlivePeriod))
+	assert.True(t, pks.digestDue(k1, now.Add(DefaultAlivePeriod), DefaultAlivePeriod))
+}
+
+func Test_peerKnowledgeSet_digests(t *testing.T) {
+	now := time.Now()
+	// far enough out that everything we sent is past the grace period
+	later := now.Add(time.Minute)
+	expires := now.Add(DefaultFactTTL)
+	timing := config.DefaultTiming()
+
+	localKey := testutils.MustKey(t)
+	remoteKey := testutils.MustKey(t)
+	localSource := net.UDPAddr{IP: autopeer.AutoAddress(localKey)}
+	remoteSource := net.UDPAddr{IP: autopeer.AutoAddress(remoteKey)}
+	remote := &wgtypes.Peer{PublicKey: remoteKey}
+
+	sentFacts := make([]*fact.Fact, 8)
+	for i := range sentFacts {
+		k := testutils.MustKey(t)
+		sentFacts[i] = facts.EndpointFactFull(testutils.RandUDP4Addr(t), &k, expires)
+	}
+	lost := sentFacts[3]
+
+	tests := []struct {
+		name          string
+		lose          bool
+		wantForgotten bool
+	}{
+		{"all received", false, false},
+		{"one lost", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localPL := newPeerLookup()
+			localPL.addKeys(remoteKey)
+			local := newPKS(localPL)
+			remotePL := newPeerLookup()
+			remotePL.addKeys(localKey)
+			remotePKS := newPKS(remotePL)
+
+			for _, f := range sentFacts {
+				local.sent(remote, f)
+				if tt.lose && f == lost {
+					continue
+				}
+				remotePKS.received(&ReceivedFact{fact: f, source: localSource})
+			}
+
+			digest := &ReceivedFact{
+				fact: &fact.Fact{
+					Attribute: fact.AttributeDigest,
+					Subject:   &fact.PeerSubject{Key: localKey},
+					Value:     remotePKS.digestFor(localKey, later, timing.ChunkPeriod),
+					Expires:   later.Add(timing.AlivePeriod),
+				},
+				source: remoteSource,
+			}
+			peer, forgotten := local.receivedDigest(digest, localKey, later, timing)
+			if !tt.wantForgotten {
+				assert.Zero(t, forgotten)
+				for _, f := range sentFacts {
+					assert.True(t, local.peerKnows(remote, f, 0))
+				}
+				return
+			}
+			assert.Equal(t, remoteKey, peer)
+			assert.NotZero(t, forgotten)
+			assert.False(t, local.peerKnows(remote, lost, 0), "should re-send the lost fact")
+
+			// a repeated mismatch backs off
+			for _, f := range sentFacts {
+				local.sent(remote, f)
+			}
+			_, forgotten = local.receivedDigest(digest, localKey, later.Add(timing.AlivePeriod/2), timing)
+			assert.Zero(t, forgotten)
+			_, forgotten = local.receivedDigest(digest, localKey, later.Add(timing.AlivePeriod), timing)
+			assert.NotZero(t, forgotten)
+		})
+	}
+}
+
+func Test_peerKnowledgeSet_receivedDigest_ignored(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+	timing := config.DefaultTiming()
+	localKey := testutils.MustKey(t)
+	remoteKey := testutils.MustKey(t)
+	remoteSource := net.UDPAddr{IP: autopeer.AutoAddress(remoteKey)}
+
+	pl := newPeerLookup()
+	pl.addKeys(remoteKey)
+	pks := newPKS(pl)
+	pks.sent(&wgtypes.Peer{PublicKey: remoteKey}, facts.EndpointFactFull(testutils.RandUDP4Addr(t), &localKey, expires))
+
+	digestFact := func(subject wgtypes.Key, expires time.Time) *ReceivedFact {
+		return &ReceivedFact{
+			fact: &fact.Fact{
+				Attribute: fact.AttributeDigest,
+				Subject:   &fact.PeerSubject{Key: subject},
+				Value:     fact.NewDigest(1),
+				Expires:   expires,
+			},
+			source: remoteSource,
+		}
+	}
+	later := now.Add(time.Minute)
+	// sanity check that the empty digest would otherwise cause a re-send
+	_, forgotten := newPKSWith(pl, pks).receivedDigest(digestFact(localKey, expires), localKey, later, timing)
+	assert.NotZero(t, forgotten)
+
+	_, forgotten = newPKSWith(pl, pks).receivedDigest(digestFact(remoteKey, expires), localKey, later, timing)
+	assert.Zero(t, forgotten, "digest for another peer")
+	_, forgotten = newPKSWith(pl, pks).receivedDigest(digestFact(localKey, now), localKey, later, timing)
+	assert.Zero(t, forgotten, "expired digest")
+	_, forgotten = newPKSWith(pl, pks).receivedDigest(digestFact(localKey, expires), localKey, now, timing)
+	assert.Zero(t, forgotten, "recently sent facts may be in flight")
+}
+
+// newPKSWith makes a copy of the knowledge in pks
+func newPKSWith(pl *peerLookup, pks *peerKnowledgeSet) *peerKnowledgeSet {
+	ret := newPKS(pl)
+	maps.Copy(ret.data, pks.data)
+	maps.Copy(ret.outbound, pks.outbound)
+	return ret
+}
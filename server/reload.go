@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/log"
+)
+
+// ReloadConfig swaps a new configuration into the running server. The fact set,
+// peer state, and boot id are all kept, so peers don't need to resend
+// everything and the startup grace period before deconfiguring peers is not
+// restarted. Settings that can't be changed without a restart are kept at their
+// current values, with an error logged.
+func (s *LinkServer) ReloadConfig(newConfig *config.Server) error {
+	s.configMu.Lock()
+	old := s.config
+	if newConfig.Iface != old.Iface {
+		s.configMu.Unlock()
+		return fmt.Errorf("cannot change interface from %s to %s without restarting", old.Iface, newConfig.Iface)
+	}
+	// the listen port was defaulted when the server was created
+	if newConfig.Port <= 0 {
+		newConfig.Port = old.Port
+	} else if newConfig.Port != old.Port {
+		log.Error("Changing the port requires a restart, keeping %d", old.Port)
+		newConfig.Port = old.Port
+	}
+	if newConfig.ControlSocket != old.ControlSocket {
+		log.Error("Changing the control socket requires a restart, keeping %q", old.ControlSocket)
+		newConfig.ControlSocket = old.ControlSocket
+	}
+	if newConfig.MetricsAddress != old.MetricsAddress {
+		log.Error("Changing the metrics address requires a restart, keeping %q", old.MetricsAddress)
+		newConfig.MetricsAddress = old.MetricsAddress
+	}
+	if newConfig.DNSAddress != old.DNSAddress {
+		log.Error("Changing the DNS address requires a restart, keeping %q", old.DNSAddress)
+		newConfig.DNSAddress = old.DNSAddress
+	}
+	if newConfig.HostsFile != old.HostsFile {
+		log.Error("Changing the hosts file requires a restart, keeping %q", old.HostsFile)
+		newConfig.HostsFile = old.HostsFile
+	}
+	if newConfig.Timing != old.Timing {
+		log.Error("Changing the timing requires a restart, keeping %+v", old.Timing)
+		newConfig.Timing = old.Timing
+	}
+	if newConfig.PeersDir != old.PeersDir {
+		// the peers are still read from the new one, but changes to it are missed
+		log.Error("Changing the peer directory requires a restart to watch it for changes")
+	}
+	// keep the detected router state until we re-detect it below
+	if newConfig.AutoDetectRouter {
+		newConfig.IsRouterNow = old.IsRouterNow
+	}
+
+	added, removed, changed := old.Peers.Diff(newConfig.Peers)
+	s.config = newConfig
+	s.configMu.Unlock()
+
+	for _, k := range added {
+		s.peerLog(k).Info("Config reload: added peer %s: %s", s.peerName(k), newConfig.Peers[k])
+	}
+	for _, k := range removed {
+		// the peer name may only be in the old config
+		name := old.Peers.Name(k)
+		if name == "" {
+			name = s.peerName(k)
+		}
+		log.With(log.Peer(k.String()), log.PeerName(name)).Info("Config reload: removed peer %s", name)
+	}
+	for _, k := range changed {
+		s.peerLog(k).Info("Config reload: changed peer %s: %s -> %s", s.peerName(k), old.Peers[k], newConfig.Peers[k])
+	}
+
+	if newConfig.AutoDetectRouter {
+		dev, err := s.dev.State()
+		if err != nil {
+			return fmt.Errorf("unable to load device state to detect router mode: %w", err)
+		}
+		s.UpdateRouterState(dev, true)
+	}
+
+	log.Info("Config reloaded: %s", s.Describe())
+	return nil
+}
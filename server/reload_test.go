@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/config"
+	"github.com/fastcat/wirelink/device"
+	"github.com/fastcat/wirelink/internal/mocks"
+	"github.com/fastcat/wirelink/internal/testutils"
+	"github.com/fastcat/wirelink/signing"
+	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkServer_ReloadConfig(t *testing.T) {
+	const wgIface = "wg0"
+	localPriv, localKey := testutils.MustKeyPair(t)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	routerKey := testutils.MustKey(t)
+
+	tests := []struct {
+		name      string
+		old       *config.Server
+		new       *config.Server
+		device    *wgtypes.Device
+		assertion require.ErrorAssertionFunc
+		check     func(t *testing.T, s *LinkServer)
+	}{
+		{
+			"iface change",
+			buildConfig(wgIface).Build(),
+			buildConfig("wg1").Build(),
+			nil,
+			require.Error,
+			func(t *testing.T, s *LinkServer) {
+				assert.Equal(t, wgIface, s.cfg().Iface)
+			},
+		},
+		{
+			"peers and fixed settings",
+			&config.Server{
+				Iface:         wgIface,
+				Port:          51821,
+				ControlSocket: "/run/wirelink/wg0.sock",
+				IsRouterNow:   true,
+				Peers:         config.Peers{k1: &config.Peer{Name: "one"}},
+			},
+			&config.Server{
+				Iface:         wgIface,
+				Port:          1234,
+				ControlSocket: "/tmp/other.sock",
+				Chatty:        true,
+				Peers: config.Peers{
+					k1: &config.Peer{Name: "one", Trust: new(trust.Membership)},
+					k2: &config.Peer{Name: "two"},
+				},
+			},
+			nil,
+			require.NoError,
+			func(t *testing.T, s *LinkServer) {
+				cfg := s.cfg()
+				assert.Equal(t, 51821, cfg.Port)
+				assert.Equal(t, "/run/wirelink/wg0.sock", cfg.ControlSocket)
+				assert.True(t, cfg.Chatty)
+				// not auto-detecting, so this comes from the new config
+				assert.False(t, cfg.IsRouterNow)
+				assert.Equal(t, trust.Membership, cfg.Peers.Trust(k1, trust.Untrusted))
+				assert.Equal(t, "two", cfg.Peers.Name(k2))
+			},
+		},
+		{
+			"default port",
+			&config.Server{Iface: wgIface, Port: 51821},
+			&config.Server{Iface: wgIface},
+			nil,
+			require.NoError,
+			func(t *testing.T, s *LinkServer) {
+				assert.Equal(t, 51821, s.cfg().Port)
+			},
+		},
+		{
+			"timing",
+			&config.Server{Iface: wgIface, Timing: config.DefaultTiming()},
+			&config.Server{Iface: wgIface, Timing: config.Timing{
+				FactTTL:     time.Minute,
+				ChunkPeriod: 10 * time.Second,
+				AlivePeriod: 20 * time.Second,
+				MaxChunk:    10,
+			}},
+			nil,
+			require.NoError,
+			func(t *testing.T, s *LinkServer) {
+				assert.Equal(t, config.DefaultTiming(), s.cfg().Timing)
+			},
+		},
+		{
+			"redetect router",
+			&config.Server{Iface: wgIface, AutoDetectRouter: true, IsRouterNow: true},
+			&config.Server{Iface: wgIface, AutoDetectRouter: true},
+			&wgtypes.Device{
+				Name:      wgIface,
+				PublicKey: localKey,
+				Peers: []wgtypes.Peer{{
+					PublicKey: routerKey,
+					AllowedIPs: []net.IPNet{
+						autopeer.AutoAddressNet(routerKey),
+						testutils.MakeIPv4Net(192, 0, 2, 0, 24),
+					},
+				}},
+			},
+			require.NoError,
+			func(t *testing.T, s *LinkServer) {
+				// someone else is the router, so we aren't
+				assert.False(t, s.cfg().IsRouterNow)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := &mocks.WgClient{}
+			ctrl.Test(t)
+			if tt.device == nil {
+				tt.device = &wgtypes.Device{Name: wgIface, PublicKey: localKey}
+			}
+			ctrl.On("Device", wgIface).Return(tt.device, nil)
+			dev, err := device.New(ctrl, wgIface)
+			require.NoError(t, err)
+			s := &LinkServer{
+				config:        tt.old,
+				dev:           dev,
+				peerConfig:    newPeerConfigSet(),
+				peerKnowledge: newPKS(newPeerLookup()),
+				signer:        signing.New(localPriv),
+			}
+			s.newBootID()
+			bootID := s.bootID()
+			pks := s.peerKnowledge
+
+			tt.assertion(t, s.ReloadConfig(tt.new))
+			tt.check(t, s)
+			// reloading must not reset runtime state
+			assert.Equal(t, bootID, s.bootID())
+			assert.Same(t, pks, s.peerKnowledge)
+			ctrl.AssertExpectations(t)
+		})
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/fastcat/wirelink/internal/networking"
 	"github.com/fastcat/wirelink/log"
 	"github.com/fastcat/wirelink/trust"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // parsePacket handles a UDP packet, parsing it into any valid ReceivedFacts
@@ -20,10 +22,12 @@ func (s *LinkServer) parsePacket(packet *networking.UDPPacket) ([]*ReceivedFact,
 	if packet.Err != nil {
 		return nil, fmt.Errorf("failed to read from UDP socket, giving up: %w", packet.Err)
 	}
+	s.counters.packetsReceived.Inc()
 
 	pp := &fact.Fact{}
 	err := pp.DecodeFrom(len(packet.Data), packet.Time, bytes.NewReader(packet.Data))
 	if err != nil {
+		s.counters.decodeErrors.Inc()
 		log.Error("Unable to decode fact: %v %v", err, packet.Data)
 		return nil, nil
 	}
@@ -59,6 +63,7 @@ func (s *LinkServer) processSignedGroup(
 	}
 
 	if !autopeer.AutoAddress(ps.Key).Equal(source.IP) {
+		s.counters.signatureErrors.Inc()
 		return nil, fmt.Errorf("SignedGroup source %v does not match key %v", source.IP, ps.Key)
 	}
 	// TODO: check the key is locally known/trusted
@@ -66,6 +71,7 @@ func (s *LinkServer) processSignedGroup(
 
 	valid, err := s.signer.VerifyFrom(pv.Nonce, pv.Tag, pv.InnerBytes, &ps.Key)
 	if err != nil {
+		s.counters.signatureErrors.Inc()
 		return nil, fmt.Errorf("failed to validate SignedGroup signature from %s: %w", s.peerName(ps.Key), err)
 	} else if !valid {
 		// should never get here, verification errors should always make an error
@@ -74,9 +80,11 @@ func (s *LinkServer) processSignedGroup(
 
 	inner, err := pv.ParseInner(now)
 	if err != nil {
+		s.counters.decodeErrors.Inc()
 		return nil, fmt.Errorf("unable to parse SignedGroup inner: %w", err)
 	}
-	// log.Debug("Received SGF of length %d/%d from %v", len(pv.InnerBytes), len(inner), source)
+	s.counters.signedGroupsReceived.Inc()
+	log.Packet.Debug("Received SGF of length %d/%d from %v", len(pv.InnerBytes), len(inner), source)
 	ret := make([]*ReceivedFact, len(inner))
 	for i := range inner {
 		ret[i] = &ReceivedFact{fact: inner[i], source: *source}
@@ -99,7 +107,8 @@ func (s *LinkServer) chunkReceived(
 	// TODO: using a ticker here is not ideal, as we can't reset its phase to
 	// match when we send a chunk downstream, but using a timer involves more
 	// boilerplate
-	chunkTicker := time.NewTicker(s.ChunkPeriod)
+	chunkPeriod := s.timing().ChunkPeriod
+	chunkTicker := time.NewTicker(chunkPeriod)
 	defer chunkTicker.Stop()
 
 	if ready != nil {
@@ -133,6 +142,13 @@ func (s *LinkServer) chunkReceived(
 
 		case <-chunkTicker.C:
 			sendBuffer = true
+			// pick up any change in the chunk period from adopting the network
+			// timing on the next tick
+			if p := s.timing().ChunkPeriod; p != chunkPeriod {
+				log.Info("Chunk period changed: %v -> %v", chunkPeriod, p)
+				chunkPeriod = p
+				chunkTicker.Reset(chunkPeriod)
+			}
 		}
 
 		if sendBuffer {
@@ -143,8 +159,11 @@ func (s *LinkServer) chunkReceived(
 
 			// make a new boot ID if we were suspended, and thus peer may have sent us
 			// stuff we didn't receive
+			// if we just adopted a much shorter chunk period, this may trigger a
+			// bootID change, which is fine as it gets peers to re-send everything
+			// with the new timing
 			now := time.Now()
-			if now.Before(lastChunk) || now.Sub(lastChunk) > s.ChunkPeriod*2 {
+			if now.Before(lastChunk) || now.Sub(lastChunk) > s.timing().ChunkPeriod*2 {
 				log.Info("Detected wall clock discontinuity, updating bootID: %v -> %v", lastChunk, now)
 				s.newBootID()
 			}
@@ -186,6 +205,60 @@ func pruneRemovedLocalFacts(chunk, lastLocal, newLocal []*fact.Fact) []*fact.Fac
 	return filtered
 }
 
+// retractRemovedLocalFacts creates retractions for the facts we used to have
+// locally but no longer do, so that peers drop them instead of waiting for them
+// to expire. Endpoints we see for other peers are left to expire, as other
+// peers may still see them.
+func retractRemovedLocalFacts(self wgtypes.Key, lastLocal, newLocal []*fact.Fact, now time.Time) []*fact.Fact {
+	current := make(map[fact.Key]bool, len(newLocal))
+	for _, f := range newLocal {
+		current[fact.KeyOf(f)] = true
+	}
+	var ret []*fact.Fact
+	for _, f := range lastLocal {
+		if !fact.Retractable(f.Attribute) || !f.Expires.After(now) || current[fact.KeyOf(f)] {
+			continue
+		}
+		switch f.Attribute {
+		case fact.AttributeEndpointV4, fact.AttributeEndpointV6:
+			if ps, ok := f.Subject.(*fact.PeerSubject); !ok || ps.Key != self {
+				continue
+			}
+		}
+		log.Debug("Retracting removed local fact: %v", f)
+		ret = append(ret, fact.Retract(f))
+	}
+	return ret
+}
+
+// applyRetractions removes the facts that have been retracted, returning the
+// remaining facts, and the keys of the ones that were removed.
+func applyRetractions(facts []*fact.Fact) (remaining []*fact.Fact, retracted map[fact.Key]bool) {
+	retractions := make(map[fact.Key]*fact.Fact)
+	for _, f := range facts {
+		if k, ok := fact.RetractedKey(f); ok {
+			if r, ok := retractions[k]; !ok || f.Expires.After(r.Expires) {
+				retractions[k] = f
+			}
+		}
+	}
+	if len(retractions) == 0 {
+		return facts, nil
+	}
+	remaining = make([]*fact.Fact, 0, len(facts))
+	retracted = make(map[fact.Key]bool)
+	for _, f := range facts {
+		k := fact.KeyOf(f)
+		if r, ok := retractions[k]; ok && fact.Retracts(r, f) {
+			log.With(factFields(f)...).Debug("Dropping retracted fact: %v", f)
+			retracted[k] = true
+			continue
+		}
+		remaining = append(remaining, f)
+	}
+	return remaining, retracted
+}
+
 type chunkState struct {
 	s              *LinkServer
 	currentFacts   []*fact.Fact
@@ -204,6 +277,9 @@ func (s *chunkState) processChunk(chunk []*ReceivedFact) ([]*fact.Fact, error) {
 	}
 	s.lastLocalFacts = newLocalFacts
 	s.currentFacts = uniqueFacts
+	s.s.currentFacts.Store(&uniqueFacts)
+	s.s.updateHostsFile()
+	s.s.notifyChunkProcessed()
 	return uniqueFacts, nil
 }
 
@@ -245,6 +321,7 @@ func (s *LinkServer) processOneChunk(
 		// eventually re-send them and we'll re-add them, but it might cause
 		// service disruptions
 		newFactsChunk = pruneRemovedLocalFacts(newFactsChunk, lastLocalFacts, newLocalFacts)
+		newFactsChunk = append(newFactsChunk, retractRemovedLocalFacts(dev.PublicKey, lastLocalFacts, newLocalFacts, now)...)
 	} else {
 		// something went wrong keep original even though we appended the new data to the combined chunk
 		newLocalFacts = lastLocalFacts
@@ -252,52 +329,67 @@ func (s *LinkServer) processOneChunk(
 
 	s.pl.addPeers(dev.Peers...)
 
-	// TODO: we can cache the config trust to avoid some re-computation
-	evaluators := []trust.Evaluator{
-		config.CreateTrustEvaluator(s.config.Peers),
+	evaluator := s.trustEvaluator(dev)
+
+	for _, rf := range chunk {
+		// add to what the peer knows, even if we otherwise discard the information
+		s.peerKnowledge.received(rf)
 	}
-	// only use route-based trust if we don't have any static trust config
-	haveConfiguredTrust := false
-	for _, p := range s.config.Peers {
-		if p.Trust != nil {
-			haveConfiguredTrust = true
-			break
+	// peers may advertise their protocol or interests or send digests in the
+	// same chunk as a new boot ID, so this has to come after all the above
+	local := fact.LocalProtocol()
+	timing := s.timing()
+	for _, rf := range chunk {
+		if peer, n := s.peerKnowledge.receivedDigest(rf, dev.PublicKey, now, timing); n > 0 {
+			log.PeerKnowledge.With(log.Peer(peer.String())).Debug("Peer %s is missing facts, re-sending %d", s.peerName(peer), n)
+		}
+		if peer, pi, changed := s.peerKnowledge.receivedProtocol(rf); changed {
+			if !local.CompatibleWith(pi) {
+				log.Error("Peer %s speaks protocol version %d (min %d), which is incompatible with ours (%d, min %d)",
+					s.peerName(peer), pi.Version, pi.MinVersion, local.Version, local.MinVersion)
+			} else {
+				log.Info("Peer %s speaks protocol version %d", s.peerName(peer), pi.Version)
+			}
+		}
+		if peer, interest, added := s.peerKnowledge.receivedInterest(rf, now); added {
+			log.PeerKnowledge.With(log.Peer(peer.String())).Debug("Peer %s wants facts about %s", s.peerName(peer), s.peerName(interest))
 		}
 	}
-	if !haveConfiguredTrust {
-		evaluators = append(evaluators, trust.CreateRouteBasedTrust(dev.Peers))
-	}
-	// always let known peers tell us endpoints
-	evaluators = append(evaluators, trust.CreateKnownPeerTrust(dev.Peers))
-
-	evaluator := trust.CreateComposite(trust.FirstOnly, evaluators...)
 
 	// add all the new not-expired and _trusted_ facts
 	for _, rf := range chunk {
-		// add to what the peer knows, even if we otherwise discard the information
-		s.peerKnowledge.received(rf)
-
+		switch rf.fact.Attribute {
+		case fact.AttributeInterest, fact.AttributeDigest:
+			// these are only for us, and were handled above, they aren't facts to
+			// accept or reject
+			continue
+		}
 		if now.After(rf.fact.Expires) {
 			continue
 		}
 
 		if !s.isValidFact(rf.fact) {
-			log.Error("dropping invalid fact: %v from %v", rf.fact, rf.source)
+			log.With(factFields(rf.fact)...).Error("dropping invalid fact: %v from %v", rf.fact, rf.source)
 			continue
 		}
 
 		level := evaluator.TrustLevel(rf.fact, rf.source)
 		known := evaluator.IsKnown(rf.fact.Subject)
-		if trust.ShouldAccept(rf.fact.Attribute, known, level) {
+		if trust.ShouldAccept(trust.ThresholdAttribute(rf.fact), known, level) {
 			newFactsChunk = append(newFactsChunk, rf.fact)
-			// 	log.Debug("Accepting %v", rf)
-			// } else {
-			// 	log.Debug("Rejecting %v", rf)
+			s.counters.factsAccepted.Inc(rf.fact.Attribute.Name())
+			log.Trust.With(factFields(rf.fact)...).Debug("Accepting %v from %v", rf.fact, rf.source)
+		} else {
+			s.counters.factsRejected.Inc(rf.fact.Attribute.Name())
+			log.Trust.With(factFields(rf.fact)...).Debug("Rejecting %v from %v at %v", rf.fact, rf.source, level)
 		}
 	}
 	uniqueFacts = fact.MergeList(newFactsChunk)
 	// at this point, ignore any prior error we got
 	err = nil
+	uniqueFacts, retracted := applyRetractions(uniqueFacts)
+
+	s.updateNetworkTiming(dev.PublicKey, uniqueFacts)
 
 	// compare original vs new facts, act on some changes there
 	expiredFacts, newFacts := fact.KeysDifference(currentFacts, uniqueFacts)
@@ -318,8 +410,11 @@ func (s *LinkServer) processOneChunk(
 	for _, fk := range expiredFacts {
 		switch fk.Attribute {
 		case fact.AttributeAllowedCidrV4, fact.AttributeAllowedCidrV6, fact.AttributeMember, fact.AttributeMemberMetadata:
-			log.Info("Expiring critical fact: %s", fk.FancyString(s.peerNamer))
-			expiredCritical++
+			s.emit(s.factExpiredEvent(fk))
+			// retracted facts are gone on purpose, no need for a refresh
+			if !retracted[fk] {
+				expiredCritical++
+			}
 		}
 	}
 	if expiredCritical != 0 {
@@ -331,6 +426,30 @@ func (s *LinkServer) processOneChunk(
 	return uniqueFacts, newLocalFacts, err
 }
 
+// trustEvaluator builds the composite trust evaluator used to decide which
+// received facts to accept, based on the config and the current device state
+func (s *LinkServer) trustEvaluator(dev *wgtypes.Device) trust.Evaluator {
+	// TODO: we can cache the config trust to avoid some re-computation
+	evaluators := []trust.Evaluator{
+		config.CreateTrustEvaluator(s.cfg().Peers),
+	}
+	// only use route-based trust if we don't have any static trust config
+	haveConfiguredTrust := false
+	for _, p := range s.cfg().Peers {
+		if p.Trust != nil {
+			haveConfiguredTrust = true
+			break
+		}
+	}
+	if !haveConfiguredTrust {
+		evaluators = append(evaluators, trust.CreateRouteBasedTrust(dev.Peers))
+	}
+	// always let known peers tell us endpoints
+	evaluators = append(evaluators, trust.CreateKnownPeerTrust(dev.Peers))
+
+	return trust.CreateComposite(trust.FirstOnly, evaluators...)
+}
+
 func (s *LinkServer) isValidFact(f *fact.Fact) bool {
 	switch f.Attribute {
 	case fact.AttributeEndpointV4, fact.AttributeEndpointV6:
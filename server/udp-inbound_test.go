@@ -445,7 +445,7 @@ func TestLinkServer_chunkReceived(t *testing.T) {
 				ic, err := newInterfaceCache(env, "")
 				require.NoError(t, err)
 				s := &LinkServer{
-					ChunkPeriod:    tt.args.chunkPeriod,
+					config:         &config.Server{Timing: config.Timing{ChunkPeriod: tt.args.chunkPeriod}},
 					interfaceCache: ic,
 				}
 				s.bootIDValue.Store(origBootID)
@@ -462,7 +462,9 @@ func TestLinkServer_chunkReceived(t *testing.T) {
 					if tt.wantBootIDChange {
 						<-ready
 						// make the next tick seem late
-						s.ChunkPeriod /= 10
+						timing := s.timing()
+						timing.ChunkPeriod /= 10
+						s.networkTiming.Store(&timing)
 					}
 					for i, p := range tt.packets {
 						// sleep so the clock changes
@@ -646,7 +648,7 @@ func TestLinkServer_chunkReceived_slow(t *testing.T) {
 				ic, err := newInterfaceCache(env, "")
 				require.NoError(t, err)
 				s := &LinkServer{
-					ChunkPeriod:    tt.args.chunkPeriod,
+					config:         &config.Server{Timing: config.Timing{ChunkPeriod: tt.args.chunkPeriod}},
 					interfaceCache: ic,
 				}
 				// for this test, use the same limited buffer for the incoming packets as
@@ -817,6 +819,190 @@ func Test_pruneRemovedLocalFacts(t *testing.T) {
 	}
 }
 
+func Test_retractRemovedLocalFacts(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+
+	self := testutils.MustKey(t)
+	k1 := testutils.MustKey(t)
+	ep1 := testutils.RandUDP4Addr(t)
+	ep2 := testutils.RandUDP4Addr(t)
+	aip := testutils.RandIPNet(t, net.IPv4len, []byte{100}, nil, 24)
+
+	type args struct {
+		lastLocal []*fact.Fact
+		newLocal  []*fact.Fact
+	}
+	tests := []struct {
+		name string
+		args args
+		want []*fact.Fact
+	}{
+		{
+			"empty",
+			args{},
+			nil,
+		},
+		{
+			"retained",
+			args{
+				[]*fact.Fact{facts.EndpointFactFull(ep1, &self, expires)},
+				[]*fact.Fact{facts.EndpointFactFull(ep1, &self, expires)},
+			},
+			nil,
+		},
+		{
+			"removed own endpoint",
+			args{
+				[]*fact.Fact{facts.EndpointFactFull(ep1, &self, expires), facts.EndpointFactFull(ep2, &self, expires)},
+				[]*fact.Fact{facts.EndpointFactFull(ep2, &self, expires)},
+			},
+			[]*fact.Fact{fact.Retract(facts.EndpointFactFull(ep1, &self, expires))},
+		},
+		{
+			"removed peer endpoint",
+			args{
+				[]*fact.Fact{facts.EndpointFactFull(ep1, &k1, expires)},
+				nil,
+			},
+			nil,
+		},
+		{
+			"removed peer aip and membership",
+			args{
+				[]*fact.Fact{facts.AllowedIPFactFull(aip, &k1, expires), facts.MemberMetadataFactFull(&k1, expires, "k1", false)},
+				nil,
+			},
+			[]*fact.Fact{
+				fact.Retract(facts.AllowedIPFactFull(aip, &k1, expires)),
+				fact.Retract(facts.MemberMetadataFactFull(&k1, expires, "k1", false)),
+			},
+		},
+		{
+			"expired",
+			args{
+				[]*fact.Fact{facts.EndpointFactFull(ep1, &self, now.Add(-time.Second))},
+				nil,
+			},
+			nil,
+		},
+		{
+			"alive",
+			args{
+				[]*fact.Fact{facts.AliveFact(&self, expires)},
+				nil,
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retractRemovedLocalFacts(self, tt.args.lastLocal, tt.args.newLocal, now))
+		})
+	}
+}
+
+func TestLinkServer_processOneChunk_controlFacts(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+	wgIface := fmt.Sprintf("wg%d", rand.Int())
+	localPriv, localKey := testutils.MustKeyPair(t)
+	remoteKey := testutils.MustKey(t)
+	otherKey := testutils.MustKey(t)
+	source := net.UDPAddr{IP: autopeer.AutoAddress(remoteKey), Port: rand.Intn(65535)}
+
+	ctrl := &mocks.WgClient{}
+	ctrl.Test(t)
+	ctrl.On("Device", wgIface).Return(&wgtypes.Device{
+		Name:      wgIface,
+		PublicKey: localKey,
+		Peers:     []wgtypes.Peer{{PublicKey: remoteKey, AllowedIPs: []net.IPNet{autopeer.AutoAddressNet(remoteKey)}}},
+	}, nil)
+	env := &netmocks.Environment{}
+	env.Test(t)
+	env.WithKnownInterfaces()
+	dev, err := device.New(ctrl, wgIface)
+	require.NoError(t, err)
+	ic, err := newInterfaceCache(env, wgIface)
+	require.NoError(t, err)
+	pl := newPeerLookup()
+	s := &LinkServer{
+		config:         &config.Server{Iface: wgIface, IsRouterNow: true},
+		net:            env,
+		dev:            dev,
+		pl:             pl,
+		peerKnowledge:  newPKS(pl),
+		peerConfig:     newPeerConfigSet(),
+		signer:         signing.New(localPriv),
+		interfaceCache: ic,
+	}
+
+	interest := facts.InterestFact(&remoteKey, &otherKey, expires)
+	digest := &fact.Fact{
+		Attribute: fact.AttributeDigest,
+		Subject:   &fact.PeerSubject{Key: localKey},
+		Value:     newPKS(newPeerLookup()).digestFor(localKey, now, DefaultChunkPeriod),
+		Expires:   now.Add(DefaultAlivePeriod),
+	}
+	chunk := []*ReceivedFact{{fact: interest, source: source}, {fact: digest, source: source}}
+
+	uniqueFacts, _, err := s.processOneChunk(nil, nil, chunk, now)
+	require.NoError(t, err)
+	// they are used, but aren't facts to keep, and aren't rejected by trust
+	assert.Equal(t, map[wgtypes.Key]bool{otherKey: true}, s.peerKnowledge.peerInterests(remoteKey, now))
+	assert.NotContains(t, uniqueFacts, interest)
+	assert.NotContains(t, uniqueFacts, digest)
+	assert.Zero(t, s.counters.factsRejected.Value(fact.AttributeInterest.Name()))
+	assert.Zero(t, s.counters.factsRejected.Value(fact.AttributeDigest.Name()))
+}
+
+func Test_applyRetractions(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+
+	k1 := testutils.MustKey(t)
+	ep1 := testutils.RandUDP4Addr(t)
+	ep2 := testutils.RandUDP4Addr(t)
+
+	stale := facts.EndpointFactFull(ep1, &k1, expires)
+	retraction := fact.Retract(stale)
+	other := facts.EndpointFactFull(ep2, &k1, expires)
+	fresh := facts.EndpointFactFull(ep1, &k1, expires.Add(time.Minute))
+
+	tests := []struct {
+		name          string
+		facts         []*fact.Fact
+		wantRemaining []*fact.Fact
+		wantRetracted map[fact.Key]bool
+	}{
+		{
+			"no retractions",
+			[]*fact.Fact{stale, other},
+			[]*fact.Fact{stale, other},
+			nil,
+		},
+		{
+			"retracted",
+			[]*fact.Fact{stale, retraction, other},
+			[]*fact.Fact{retraction, other},
+			map[fact.Key]bool{fact.KeyOf(stale): true},
+		},
+		{
+			"re-added later",
+			[]*fact.Fact{fresh, retraction},
+			[]*fact.Fact{fresh, retraction},
+			map[fact.Key]bool{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRemaining, gotRetracted := applyRetractions(tt.facts)
+			assert.Equal(t, tt.wantRemaining, gotRemaining)
+			assert.Equal(t, tt.wantRetracted, gotRetracted)
+		})
+	}
+}
+
 func TestLinkServer_processOneChunk(t *testing.T) {
 	now := time.Now()
 	expires := now.Add(DefaultFactTTL)
@@ -830,6 +1016,8 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 		Port: rand.Intn(65535),
 	}
 	alternateEndpoint := testutils.RandUDP4Addr(t)
+	// the local device has no key in these tests
+	selfProtocol := facts.ProtocolFact(&wgtypes.Key{}, now.Add(config.DefaultLongFactTTL), fact.LocalProtocol())
 
 	rf := func(f *fact.Fact) *ReceivedFact {
 		return &ReceivedFact{
@@ -880,8 +1068,8 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 				nil,
 			},
 			args{},
-			[]*fact.Fact{},
-			nil,
+			[]*fact.Fact{selfProtocol},
+			[]*fact.Fact{selfProtocol},
 			require.NoError,
 		},
 		{
@@ -897,9 +1085,8 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 				[]*fact.Fact{},
 				[]*ReceivedFact{},
 			},
-			[]*fact.Fact{},
-			// this won't come back as non-nil unless something had to get append()ed to it
-			nil,
+			[]*fact.Fact{selfProtocol},
+			[]*fact.Fact{selfProtocol},
 			require.NoError,
 		},
 		{
@@ -923,9 +1110,10 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 				},
 			},
 			[]*fact.Fact{
+				selfProtocol,
 				facts.EndpointFactFull(alternateEndpoint, &remoteKey, expires),
 			},
-			nil,
+			[]*fact.Fact{selfProtocol},
 			require.NoError,
 		},
 		{
@@ -952,9 +1140,11 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 			},
 			[]*fact.Fact{
 				facts.EndpointFactFull(alternateEndpoint, &remoteKey, expires),
+				selfProtocol,
 			},
 			[]*fact.Fact{
 				facts.EndpointFactFull(alternateEndpoint, &remoteKey, expires),
+				selfProtocol,
 			},
 			require.NoError,
 		},
@@ -985,8 +1175,38 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 				},
 				chunk: []*ReceivedFact{},
 			},
-			[]*fact.Fact{},
-			nil,
+			[]*fact.Fact{selfProtocol},
+			[]*fact.Fact{selfProtocol},
+			require.NoError,
+		},
+		{
+			"retraction from peer",
+			fields{
+				&config.Server{Iface: wgIface},
+				&netmocks.Environment{},
+				mockDevice(&wgtypes.Device{
+					Peers: []wgtypes.Peer{
+						{
+							PublicKey:  remoteKey,
+							AllowedIPs: []net.IPNet{autopeer.AutoAddressNet(remoteKey)},
+						},
+					},
+				}),
+				nil,
+			},
+			args{
+				currentFacts: []*fact.Fact{
+					facts.EndpointFactFull(alternateEndpoint, &remoteKey, expires),
+				},
+				chunk: []*ReceivedFact{
+					rf(fact.Retract(facts.EndpointFactFull(alternateEndpoint, &remoteKey, expires))),
+				},
+			},
+			[]*fact.Fact{
+				selfProtocol,
+				fact.Retract(facts.EndpointFactFull(alternateEndpoint, &remoteKey, expires)),
+			},
+			[]*fact.Fact{selfProtocol},
 			require.NoError,
 		},
 		{
@@ -1017,8 +1237,8 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 					rf(facts.AllowedIPFactFull(testutils.RandIPNet(t, net.IPv4len, []byte{100}, nil, 32), &remoteKey, expires)),
 				},
 			},
-			[]*fact.Fact{},
-			nil,
+			[]*fact.Fact{selfProtocol},
+			[]*fact.Fact{selfProtocol},
 			require.NoError,
 		},
 	}
@@ -1038,8 +1258,6 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 				dev:            dev,
 				pl:             newPeerLookup(),
 				peerKnowledge:  tt.fields.peerKnowledge,
-				FactTTL:        DefaultFactTTL,
-				ChunkPeriod:    DefaultChunkPeriod,
 				interfaceCache: ic,
 			}
 			if s.peerKnowledge == nil {
@@ -1051,7 +1269,8 @@ func TestLinkServer_processOneChunk(t *testing.T) {
 			tt.assertion(t, err)
 			ctrl.AssertExpectations(t)
 			tt.fields.net.AssertExpectations(t)
-			assert.Equal(t, tt.wantUniqueFacts, gotUniqueFacts)
+			// unique facts come out of a map, so their order is random
+			assert.ElementsMatch(t, tt.wantUniqueFacts, gotUniqueFacts)
 			assert.Equal(t, tt.wantNewLocalFacts, gotNewLocalFacts)
 		})
 	}
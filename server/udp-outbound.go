@@ -10,6 +10,7 @@ import (
 
 	"github.com/fastcat/wirelink/apply"
 	"github.com/fastcat/wirelink/autopeer"
+	"github.com/fastcat/wirelink/config"
 	"github.com/fastcat/wirelink/detect"
 	"github.com/fastcat/wirelink/fact"
 	"github.com/fastcat/wirelink/log"
@@ -28,7 +29,7 @@ func (s *LinkServer) broadcastFactUpdatesOnce(newFacts []*fact.Fact) error {
 	}
 
 	filteredFacts := s.factsToSend(newFacts, dev)
-	_, errs := s.broadcastFacts(dev.PublicKey, dev.Peers, filteredFacts, now, s.ChunkPeriod-time.Second)
+	_, errs := s.broadcastFacts(dev.PublicKey, dev.Peers, filteredFacts, now, s.timing().ChunkPeriod-time.Second)
 	if errs != nil {
 		// don't print more than a handful of errors
 		if len(errs) > 5 {
@@ -60,7 +61,7 @@ func (s *LinkServer) shouldSend(f *fact.Fact, self wgtypes.Key) bool {
 				// don't share info about dead peers: filtering this out from trust
 				// sources will result in offline peers being cleared from leaf configs
 				// when the offline one ages out, reducing noise
-				log.Debug("Don't send %s/%q: offline", s.peerName(ps.Key), f.Attribute)
+				log.PeerKnowledge.With(factFields(f)...).Debug("Don't send %s/%q: offline", s.peerName(ps.Key), f.Attribute)
 				return false
 			}
 		}
@@ -80,25 +81,25 @@ func (s *LinkServer) shouldSendTo(p *wgtypes.Peer) sendLevel {
 	// don't try to send info to the peer if the wireguard interface doesn't have
 	// an endpoint for it: this will just get rejected by the kernel
 	if p.Endpoint == nil {
-		log.Debug("Don't send to %s: no wg endpoint", s.peerName(p.PublicKey))
+		log.PeerKnowledge.With(log.Peer(p.PublicKey.String())).Debug("Don't send to %s: no wg endpoint", s.peerName(p.PublicKey))
 		return sendNothing
 	}
 
 	// send everything to trusted peers and routers
 	// NOTE: this detects _current_ routers, not peers that are authorized to become
 	// routers in the future based on trusted facts that have not yet been applied
-	if s.config.Peers.Trust(p.PublicKey, trust.Untrusted) >= trust.AllowedIPs || detect.IsPeerRouter(p) {
+	if s.cfg().Peers.Trust(p.PublicKey, trust.Untrusted) >= trust.AllowedIPs || detect.IsPeerRouter(p) {
 		return sendFacts
 	}
 
 	// similarly always send if the peer is designated as an exchange point
-	if s.config.Peers.IsFactExchanger(p.PublicKey) {
+	if s.cfg().Peers.IsFactExchanger(p.PublicKey) {
 		return sendFacts
 	}
 
 	// if neither end is special or chatty, just send pings to keep the connection alive
-	if !s.config.Chatty && !s.config.IsRouterNow {
-		log.Debug("Don't send to %s: not special, not chatty, not router", s.peerName(p.PublicKey))
+	if !s.cfg().Chatty && !s.cfg().IsRouterNow {
+		log.PeerKnowledge.With(log.Peer(p.PublicKey.String())).Debug("Don't send to %s: not special, not chatty, not router", s.peerName(p.PublicKey))
 		return sendPing
 	}
 
@@ -118,7 +119,27 @@ func (s *LinkServer) shouldSendTo(p *wgtypes.Peer) sendLevel {
 }
 
 func (s *LinkServer) prepareFactsForPeer(p *wgtypes.Peer, facts []*fact.Fact, ga *fact.GroupAccumulator) {
+	timing := s.timing()
+	protocol := s.peerKnowledge.peerProtocol(p.PublicKey)
+	interests := s.peerKnowledge.peerInterests(p.PublicKey, time.Now())
 	for _, f := range facts {
+		// don't send peers facts they can't decode: for facts inside a signed
+		// group, that would make them drop the whole group
+		if !protocol.Understands(f.Attribute) {
+			continue
+		}
+		// retractions include the retracted value, which the peer must be able to
+		// decode too, e.g. network timing for peers that understand retractions
+		// but not timing
+		if rv, ok := f.Value.(*fact.RetractionValue); ok && !protocol.Understands(rv.Attribute) {
+			continue
+		}
+		// if the peer told us which peers it wants facts about, don't send it
+		// facts about any others, except for membership and timing, which apply
+		// to the whole network
+		if interests != nil && !interested(interests, f) {
+			continue
+		}
 		// don't tell peers most things about themselves: they won't accept it
 		// unless we are a router, and mostly it wouldn't be useful anyways.
 		switch f.Attribute {
@@ -135,7 +156,7 @@ func (s *LinkServer) prepareFactsForPeer(p *wgtypes.Peer, facts []*fact.Fact, ga
 			}
 		}
 		// don't tell peers other things they already know
-		if !s.peerKnowledge.peerNeeds(p, f, s.FactTTL/2+s.ChunkPeriod) {
+		if !s.peerKnowledge.peerNeeds(p, f, resendWindow(timing, f.Attribute)) {
 			// log.Debug("Peer %s already knows %v", s.peerName(p.PublicKey), f)
 			continue
 		}
@@ -143,7 +164,7 @@ func (s *LinkServer) prepareFactsForPeer(p *wgtypes.Peer, facts []*fact.Fact, ga
 		if err != nil {
 			log.Error("Unable to add fact to group: %v", err)
 		} else {
-			log.Debug("Peer %s needs %v", s.peerName(p.PublicKey), f)
+			log.PeerKnowledge.With(log.Peer(p.PublicKey.String()), log.Attribute(f.Attribute.Name())).Debug("Peer %s needs %v", s.peerName(p.PublicKey), f)
 			// assume we will successfully send and peer will accept the info
 			// if these assumptions are wrong, re-sending more often is unlikely to help
 			s.peerKnowledge.sent(p, f)
@@ -151,14 +172,31 @@ func (s *LinkServer) prepareFactsForPeer(p *wgtypes.Peer, facts []*fact.Fact, ga
 	}
 }
 
+// interested returns whether a peer with the given interests wants the fact
+func interested(interests map[wgtypes.Key]bool, f *fact.Fact) bool {
+	switch trust.ThresholdAttribute(f) {
+	case fact.AttributeMember, fact.AttributeMemberMetadata, fact.AttributeNetworkTiming:
+		return true
+	}
+	ps, ok := f.Subject.(*fact.PeerSubject)
+	return !ok || interests[ps.Key]
+}
+
+// resendWindow is how long before a peer would forget a fact that we should
+// send it again: about halfway through its TTL, which depends on its attribute,
+// plus time for the send to happen.
+func resendWindow(timing config.Timing, attr fact.Attribute) time.Duration {
+	return timing.TTL(attr)/2 + timing.ChunkPeriod
+}
+
 func (s *LinkServer) addPingFor(p *wgtypes.Peer, ping *fact.Fact, ga *fact.GroupAccumulator) {
 	var addedPing bool
 	var addPingErr error
 	// we want alive facts to live for the normal FactTTL, but we want to send them every AlivePeriod
 	// so the "forgetting window" is the difference between those
 	// we don't need to add the extra ChunkPeriod+1 buffer in this case
-	if s.peerKnowledge.peerNeeds(p, ping, s.FactTTL-s.AlivePeriod) {
-		log.Debug("Peer %s needs ping", s.peerName(p.PublicKey))
+	if timing := s.timing(); s.peerKnowledge.peerNeeds(p, ping, timing.FactTTL-timing.AlivePeriod) {
+		log.PeerKnowledge.With(log.Peer(p.PublicKey.String())).Debug("Peer %s needs ping", s.peerName(p.PublicKey))
 		addPingErr = ga.AddFact(ping)
 		addedPing = true
 	} else {
@@ -167,7 +205,7 @@ func (s *LinkServer) addPingFor(p *wgtypes.Peer, ping *fact.Fact, ga *fact.Group
 		// so that we don't send another packet again quite so soon
 		addedPing, addPingErr = ga.AddFactIfRoom(ping)
 		if addedPing {
-			log.Debug("Opportunistically sending ping to %s", s.peerName(p.PublicKey))
+			log.PeerKnowledge.With(log.Peer(p.PublicKey.String())).Debug("Opportunistically sending ping to %s", s.peerName(p.PublicKey))
 		}
 	}
 	if addPingErr != nil {
@@ -179,6 +217,30 @@ func (s *LinkServer) addPingFor(p *wgtypes.Peer, ping *fact.Fact, ga *fact.Group
 	}
 }
 
+// addDigestFor periodically sends the peer a digest of the facts we have
+// received from it, so that it can re-send any that were lost.
+func (s *LinkServer) addDigestFor(p *wgtypes.Peer, ga *fact.GroupAccumulator, now time.Time) {
+	if !s.peerKnowledge.peerProtocol(p.PublicKey).Understands(fact.AttributeDigest) {
+		return
+	}
+	timing := s.timing()
+	if !s.peerKnowledge.digestDue(p.PublicKey, now, timing.AlivePeriod) {
+		return
+	}
+	digest := &fact.Fact{
+		Attribute: fact.AttributeDigest,
+		Subject:   &fact.PeerSubject{Key: p.PublicKey},
+		Value:     s.peerKnowledge.digestFor(p.PublicKey, now, timing.ChunkPeriod),
+		// the next digest will replace this one
+		Expires: now.Add(timing.AlivePeriod),
+	}
+	if err := ga.AddFact(digest); err != nil {
+		log.Error("Unable to add digest fact to group: %v", err)
+		return
+	}
+	log.PeerKnowledge.With(log.Peer(p.PublicKey.String())).Debug("Sending %s digest %v", s.peerName(p.PublicKey), digest.Value)
+}
+
 // broadcastFacts tries to send every fact to every peer
 // it returns the number of sends performed
 func (s *LinkServer) broadcastFacts(
@@ -198,7 +260,7 @@ func (s *LinkServer) broadcastFacts(
 		Subject:   &fact.PeerSubject{Key: self},
 		Attribute: fact.AttributeAlive,
 		Value:     &fact.UUIDValue{UUID: s.bootID()},
-		Expires:   now.Add(s.FactTTL),
+		Expires:   now.Add(s.timing().FactTTL),
 	}
 
 	for i := range peers {
@@ -216,6 +278,7 @@ func (s *LinkServer) broadcastFacts(
 			s.prepareFactsForPeer(p, facts, ga)
 		}
 
+		s.addDigestFor(p, ga, now)
 		s.addPingFor(p, ping, ga)
 
 		signedGroupFacts, err := ga.MakeSignedGroups(s.signer, &p.PublicKey)
@@ -224,7 +287,8 @@ func (s *LinkServer) broadcastFacts(
 			continue
 		}
 
-		// log.Debug("Sending %d SGFs to %s", len(signedGroupFacts), s.peerName(p.PublicKey))
+		log.Packet.Debug("Sending %d SGFs to %s", len(signedGroupFacts), s.peerName(p.PublicKey))
+		s.counters.signedGroupsSent.Add(float64(len(signedGroupFacts)))
 		for j := range signedGroupFacts {
 			sgf := signedGroupFacts[j]
 			sg.Go(func() error {
@@ -289,5 +353,6 @@ func (s *LinkServer) sendFact(peer *wgtypes.Peer, f *fact.Fact, now time.Time) e
 		return fmt.Errorf("sent %d instead of %d", sent, len(wpb))
 	}
 	// else
+	s.counters.packetsSent.Inc()
 	return nil
 }
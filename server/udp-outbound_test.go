@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"net"
 	"reflect"
+	"slices"
 	"testing"
 	"time"
 
@@ -482,9 +483,6 @@ func TestLinkServer_broadcastFacts(t *testing.T) {
 				signer:        tt.fields.signer,
 
 				peerConfig: newPeerConfigSet(),
-
-				FactTTL:     DefaultFactTTL,
-				ChunkPeriod: DefaultChunkPeriod,
 			}
 			s.bootIDValue.Store(tt.fields.bootID)
 			gotPacketsSent, gotSendErrors := s.broadcastFacts(tt.args.self, tt.args.peers, tt.args.facts, tt.args.now, tt.args.timeout)
@@ -615,3 +613,139 @@ func TestLinkServer_shouldSend(t *testing.T) {
 		})
 	}
 }
+
+func TestLinkServer_prepareFactsForPeer(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(DefaultFactTTL)
+	localPriv, localKey := testutils.MustKeyPair(t)
+	remoteKey := testutils.MustKey(t)
+	k1 := testutils.MustKey(t)
+	k2 := testutils.MustKey(t)
+	ep1 := testutils.RandUDP4Addr(t)
+	ep2 := testutils.RandUDP4Addr(t)
+
+	endpoint := facts.EndpointFactFull(ep1, &k1, expires)
+	timing := facts.NetworkTimingFact(&localKey, expires, DefaultFactTTL, DefaultFactTTL, DefaultAlivePeriod, DefaultChunkPeriod)
+	endpoint2 := facts.EndpointFactFull(ep2, &k2, expires)
+	member2 := facts.MemberMetadataFactFull(&k2, expires, "k2", false)
+	retractEndpoint := fact.Retract(endpoint2)
+	retractTiming := fact.Retract(timing)
+	all := []*fact.Fact{endpoint, timing, endpoint2, member2, retractEndpoint, retractTiming}
+	// a peer that understands retractions but not network timing
+	noTiming := fact.LegacyProtocol()
+	noTiming.Version = fact.ProtocolVersion
+	noTiming.Capabilities = append(noTiming.Capabilities, fact.AttributeRetraction)
+	slices.Sort(noTiming.Capabilities)
+
+	tests := []struct {
+		name      string
+		protocol  *fact.ProtocolInfo
+		interests map[wgtypes.Key]time.Time
+		wantSent  []*fact.Fact
+		wantSkip  []*fact.Fact
+	}{
+		{
+			"legacy peer",
+			nil,
+			nil,
+			[]*fact.Fact{endpoint, endpoint2, member2},
+			[]*fact.Fact{timing, retractEndpoint, retractTiming},
+		},
+		{
+			"current peer",
+			new(fact.LocalProtocol()),
+			nil,
+			all,
+			nil,
+		},
+		{
+			"peer without capabilities",
+			&fact.ProtocolInfo{Version: fact.ProtocolVersion},
+			nil,
+			nil,
+			all,
+		},
+		{
+			"peer without timing",
+			&noTiming,
+			nil,
+			[]*fact.Fact{endpoint, endpoint2, member2, retractEndpoint},
+			[]*fact.Fact{timing, retractTiming},
+		},
+		{
+			"interested peer",
+			new(fact.LocalProtocol()),
+			map[wgtypes.Key]time.Time{k1: expires},
+			[]*fact.Fact{endpoint, timing, member2, retractTiming},
+			[]*fact.Fact{endpoint2, retractEndpoint},
+		},
+		{
+			"expired interest",
+			new(fact.LocalProtocol()),
+			map[wgtypes.Key]time.Time{k1: now.Add(-time.Second)},
+			all,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &LinkServer{
+				config:        &config.Server{},
+				peerConfig:    newPeerConfigSet(),
+				signer:        signing.New(localPriv),
+				peerKnowledge: newPKS(newPeerLookup()),
+			}
+			if tt.protocol != nil {
+				s.peerKnowledge.protocols[remoteKey] = *tt.protocol
+			}
+			if tt.interests != nil {
+				s.peerKnowledge.interests[remoteKey] = tt.interests
+			}
+			p := &wgtypes.Peer{PublicKey: remoteKey}
+			s.prepareFactsForPeer(p, all, fact.NewAccumulator(fact.UDPMaxSafePayload, now))
+			for _, f := range tt.wantSent {
+				assert.True(t, s.peerKnowledge.peerKnows(p, f, 0), "should send %v", f)
+			}
+			for _, f := range tt.wantSkip {
+				assert.False(t, s.peerKnowledge.peerKnows(p, f, 0), "should not send %v", f)
+			}
+		})
+	}
+}
+
+func TestLinkServer_addDigestFor(t *testing.T) {
+	now := time.Now()
+	localPriv, _ := testutils.MustKeyPair(t)
+	remoteKey := testutils.MustKey(t)
+
+	tests := []struct {
+		name       string
+		protocol   *fact.ProtocolInfo
+		wantGroups []int
+	}{
+		{"legacy peer", nil, []int{0, 0}},
+		{"current peer", new(fact.LocalProtocol()), []int{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &LinkServer{
+				config:        &config.Server{},
+				peerConfig:    newPeerConfigSet(),
+				signer:        signing.New(localPriv),
+				peerKnowledge: newPKS(newPeerLookup()),
+			}
+			if tt.protocol != nil {
+				s.peerKnowledge.protocols[remoteKey] = *tt.protocol
+			}
+			p := &wgtypes.Peer{PublicKey: remoteKey}
+			// the second digest isn't due yet
+			for _, want := range tt.wantGroups {
+				ga := fact.NewAccumulator(fact.SignedGroupMaxSafeInnerLength, now)
+				s.addDigestFor(p, ga, now)
+				groups, err := ga.MakeSignedGroups(s.signer, &remoteKey)
+				require.NoError(t, err)
+				assert.Len(t, groups, want)
+			}
+		})
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/sync/errgroup"
@@ -16,10 +16,13 @@ import (
 	"github.com/fastcat/wirelink/autopeer"
 	"github.com/fastcat/wirelink/config"
 	"github.com/fastcat/wirelink/device"
+	"github.com/fastcat/wirelink/dns"
+	"github.com/fastcat/wirelink/events"
 	"github.com/fastcat/wirelink/fact"
 	"github.com/fastcat/wirelink/internal"
 	"github.com/fastcat/wirelink/internal/channels"
 	"github.com/fastcat/wirelink/internal/networking"
+	"github.com/fastcat/wirelink/internal/systemd"
 	"github.com/fastcat/wirelink/log"
 	"github.com/fastcat/wirelink/signing"
 
@@ -30,11 +33,14 @@ import (
 // sending/receiving on a socket
 type LinkServer struct {
 	bootIDValue atomic.Value
-	config      *config.Server
-	net         networking.Environment
-	conn        networking.UDPConn
-	addr        net.UDPAddr
-	dev         *device.Device
+	// config should only be accessed via cfg(), as it may be swapped by a reload.
+	// It is never modified in place, as readers don't hold configMu while using it.
+	config   *config.Server
+	configMu sync.RWMutex
+	net      networking.Environment
+	conn     networking.UDPConn
+	addr     net.UDPAddr
+	dev      *device.Device
 
 	eg     *errgroup.Group
 	ctx    context.Context
@@ -48,33 +54,53 @@ type LinkServer struct {
 	peerConfig    *peerConfigSet
 	signer        *signing.Signer
 
+	// currentFacts is a snapshot of the most recently computed fact set, for
+	// queries from outside the processing pipeline
+	currentFacts atomic.Pointer[[]*fact.Fact]
+
+	// eventBus publishes notable state changes to any interested subscribers
+	eventBus events.Bus
+	// counters track activity for the metrics exporter
+	counters serverCounters
+	// progress reports readiness and progress to systemd, if we are running
+	// under it, combined with any other servers in the process
+	progress *systemd.Part
+
 	// channel for asking it to print out its current info. if a chan is passed,
 	// it will be closed when the print is complete
 	printRequested chan chan<- struct{}
 
-	// TODO: these should not be exported like this
-	// this is temporary to simplify acceptance tests
-
-	FactTTL     time.Duration
-	ChunkPeriod time.Duration
-	AlivePeriod time.Duration
+	// networkTiming is the timing adopted from a trusted peer, if any, which
+	// overrides the timing from the local config
+	networkTiming atomic.Pointer[config.Timing]
+	// timingProblems is the last reported set of network timing problems, only
+	// used from the fact processing goroutine
+	timingProblems string
 
 	interfaceCache *interfaceCache
+
+	// hostsFile is where to keep entries for peer names, if enabled. It is only
+	// updated from the fact processing goroutine.
+	hostsFile *dns.HostsFile
+	// hostsFileFailing is whether the last hosts file update failed, so that a
+	// persistent failure is only logged once
+	hostsFileFailing bool
 }
 
-// MaxChunk is the max number of packets to receive before processing them
-const MaxChunk = 100
+// DefaultMaxChunk is the default max number of packets to receive before
+// processing them
+const DefaultMaxChunk = config.DefaultMaxChunk
 
 // DefaultChunkPeriod is the default max time to wait between processing chunks
 // of received packets and expiring old ones
 // TODO: set this based on TTL instead
-const DefaultChunkPeriod = 5 * time.Second
+const DefaultChunkPeriod = config.DefaultChunkPeriod
 
 // DefaultAlivePeriod is how often we send "I'm here" facts to peers
-const DefaultAlivePeriod = 30 * time.Second
+const DefaultAlivePeriod = config.DefaultAlivePeriod
 
 // DefaultFactTTL is the default TTL we apply to any locally generated Facts
-const DefaultFactTTL = 255 * time.Second
+const DefaultFactTTL = config.DefaultFactTTL
 
 // Create prepares a new server object, but does not start it yet.
 // Will take ownership of the wg client and close it when the server is closed.
@@ -128,19 +154,46 @@ func Create(
 		signer:         signing.New(devState.PrivateKey),
 		printRequested: make(chan chan<- struct{}, 1),
 
-		FactTTL:     DefaultFactTTL,
-		ChunkPeriod: DefaultChunkPeriod,
-		AlivePeriod: DefaultAlivePeriod,
-
 		interfaceCache: ic,
 	}
+	if config.HostsFile != "" {
+		ret.hostsFile = dns.NewHostsFile(config.HostsFile, config.Iface)
+	}
 	ret.newBootID()
 
 	return ret, nil
 }
 
+// ReportProgress sets where the server reports its readiness and progress to
+// systemd. It must be called before Start.
+func (s *LinkServer) ReportProgress(p *systemd.Part) {
+	s.progress = p
+}
+
+// cfg returns the current server configuration
+func (s *LinkServer) cfg() *config.Server {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config
+}
+
+// setRouterNow swaps in a copy of the config with the new router state
+func (s *LinkServer) setRouterNow(value bool) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	c := *s.config
+	c.IsRouterNow = value
+	s.config = &c
+}
+
 func (s *LinkServer) newBootID() {
-	s.bootIDValue.Store(uuid.Must(uuid.NewRandom()))
+	id := uuid.Must(uuid.NewRandom())
+	s.bootIDValue.Store(id)
+	s.eventBus.Publish(events.Event{
+		Type:    events.TypeBootID,
+		BootID:  id.String(),
+		Message: fmt.Sprintf("Local bootID is now %s", id),
+	})
 }
 
 func (s *LinkServer) bootID() uuid.UUID {
@@ -177,6 +230,11 @@ func (s *LinkServer) Start() (err error) {
 
 	s.UpdateRouterState(device, false)
 
+	// network timing adverts are checked when they are adopted
+	if err := s.checkWatchdog(s.localTiming()); err != nil {
+		log.Error("Local timing config: %v, expect spurious restarts", err)
+	}
+
 	// ok, network resources are initialized, start all the goroutines!
 
 	packets := make(chan *networking.UDPPacket, 1)
@@ -184,11 +242,12 @@ func (s *LinkServer) Start() (err error) {
 		return s.conn.ReadPackets(s.ctx, fact.UDPMaxSafePayload*2, packets)
 	})
 
-	received := make(chan *ReceivedFact, MaxChunk)
+	maxChunk := s.localTiming().MaxChunk
+	received := make(chan *ReceivedFact, maxChunk)
 	s.eg.Go(channels.FiltererMany(packets, s.parsePacket, received))
 
 	newFacts := make(chan []*ReceivedFact, 1)
-	s.eg.Go(func() error { return s.chunkReceived(received, newFacts, MaxChunk, nil) })
+	s.eg.Go(func() error { return s.chunkReceived(received, newFacts, maxChunk, nil) })
 
 	factsRefreshed := make(chan []*fact.Fact, 1)
 	factsRefreshedForBroadcast := make(chan []*fact.Fact, 1)
@@ -238,11 +297,15 @@ func (s *LinkServer) RequestStop() {
 // them, but leaves open some resources associated with the local device so that
 // final state can be inspected
 func (s *LinkServer) Stop() {
+	if s.cancel != nil {
+		s.notifyStopping()
+	}
 	s.RequestStop()
 	if s.eg != nil {
 		//nolint:errcheck // we know this is going to be a cancellation error
 		s.eg.Wait()
 	}
+	s.removeHostsFile()
 
 	if s.conn != nil {
 		if err := s.conn.Close(); err != nil {
@@ -311,19 +374,19 @@ func (s *LinkServer) Port() int {
 // Describe returns a textual summary of the server
 func (s *LinkServer) Describe() string {
 	nodeTypeDesc := "leaf"
-	if s.config.IsRouterNow {
+	if s.cfg().IsRouterNow {
 		nodeTypeDesc = "router"
 	}
-	if s.config.AutoDetectRouter {
+	if s.cfg().AutoDetectRouter {
 		nodeTypeDesc += " (auto)"
 	}
 	nodeModeDesc := "quiet"
-	if s.config.Chatty {
+	if s.cfg().Chatty {
 		nodeModeDesc = "chatty"
 	}
 	return fmt.Sprintf("Version %s on {%s} [%v]:%v (%s, %s)",
 		internal.Version,
-		s.config.Iface,
+		s.cfg().Iface,
 		s.addr.IP,
 		s.addr.Port,
 		nodeTypeDesc,
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/fastcat/wirelink/autopeer"
 	"github.com/fastcat/wirelink/config"
@@ -71,6 +72,52 @@ func TestCreate(t *testing.T) {
 			},
 			require.NoError,
 		},
+		{
+			"timing",
+			args{
+				func(t *testing.T) *mocks.WgClient {
+					ret := &mocks.WgClient{}
+					ret.On("Device", wgIface).Return(
+						&wgtypes.Device{
+							Name:       wgIface,
+							ListenPort: p,
+							PrivateKey: privateKey,
+							PublicKey:  publicKey,
+						},
+						nil,
+					)
+					return ret
+				},
+				&config.Server{
+					Iface: wgIface,
+					Timing: config.Timing{
+						FactTTL:     time.Minute,
+						ChunkPeriod: 10 * time.Second,
+						AlivePeriod: 20 * time.Second,
+						MaxChunk:    10,
+					},
+				},
+			},
+			&LinkServer{
+				config: &config.Server{
+					Iface: wgIface,
+					Port:  p + 1,
+					Timing: config.Timing{
+						FactTTL:     time.Minute,
+						ChunkPeriod: 10 * time.Second,
+						AlivePeriod: 20 * time.Second,
+						MaxChunk:    10,
+					},
+				},
+				addr: net.UDPAddr{
+					IP:   autopeer.AutoAddress(publicKey),
+					Port: p + 1,
+					Zone: wgIface,
+				},
+				signer: signing.New(privateKey),
+			},
+			require.NoError,
+		},
 		// TODO: pre-selected port
 		// TODO: error paths
 	}
@@ -100,6 +147,7 @@ func TestCreate(t *testing.T) {
 				assert.NotNil(t, got.peerConfig)
 				assert.Equal(t, tt.want.signer, got.signer)
 				assert.NotNil(t, got.printRequested)
+				assert.Equal(t, tt.want.localTiming(), got.localTiming())
 			}
 			ctrl.AssertExpectations(t)
 		})
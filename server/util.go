@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -14,7 +15,7 @@ import (
 )
 
 func (s *LinkServer) peerConfigName(peer wgtypes.Key) string {
-	return s.config.Peers.Name(peer)
+	return s.cfg().Peers.Name(peer)
 }
 
 func (s *LinkServer) peerName(peer wgtypes.Key) string {
@@ -34,6 +35,27 @@ func (s *LinkServer) peerName(peer wgtypes.Key) string {
 	return peer.String()
 }
 
+// peerFields returns the structured log fields identifying the given peer
+func (s *LinkServer) peerFields(peer wgtypes.Key) []slog.Attr {
+	return []slog.Attr{log.Peer(peer.String()), log.PeerName(s.peerName(peer))}
+}
+
+// factFields returns the structured log fields describing the given fact. It
+// doesn't look up the subject peer's name, as it is used on the hot path of
+// processing received facts.
+func factFields(f *fact.Fact) []slog.Attr {
+	ret := []slog.Attr{log.Attribute(f.Attribute.Name())}
+	if ps, ok := f.Subject.(*fact.PeerSubject); ok {
+		ret = append(ret, log.Peer(ps.Key.String()))
+	}
+	return ret
+}
+
+// peerLog returns a logger that tags its messages with the given peer
+func (s *LinkServer) peerLog(peer wgtypes.Key) *log.Logger {
+	return log.With(s.peerFields(peer)...)
+}
+
 // peerNamer is meant to be passed as the subjectFormatter to Fact.FancyString
 // or FactKey.FancyString.
 func (s *LinkServer) peerNamer(fs fact.Subject) string {
@@ -98,9 +120,9 @@ func groupFactsByPeer(facts []*fact.Fact) map[wgtypes.Key][]*fact.Fact {
 // if `s.config.AutoDetectRouter` is true.
 // The possible error return is for future use cases, it always returns `nil` for now
 func (s *LinkServer) UpdateRouterState(dev *wgtypes.Device, logChanges bool) {
-	if s.config.AutoDetectRouter {
+	if s.cfg().AutoDetectRouter {
 		newValue := detect.IsDeviceRouter(dev)
-		if newValue != s.config.IsRouterNow {
+		if newValue != s.cfg().IsRouterNow {
 			if logChanges {
 				newState := "leaf"
 				if newValue {
@@ -108,7 +130,7 @@ func (s *LinkServer) UpdateRouterState(dev *wgtypes.Device, logChanges bool) {
 				}
 				log.Info("Detected we are now a %s", newState)
 			}
-			s.config.IsRouterNow = newValue
+			s.setRouterNow(newValue)
 		}
 	}
 }
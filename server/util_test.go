@@ -225,3 +225,13 @@ func TestLinkServer_UpdateRouterState(t *testing.T) {
 		})
 	}
 }
+
+func TestLinkServer_setRouterNow(t *testing.T) {
+	old := &config.Server{Iface: "wg0"}
+	s := &LinkServer{config: old}
+	s.setRouterNow(true)
+	assert.True(t, s.cfg().IsRouterNow)
+	assert.Equal(t, "wg0", s.cfg().Iface)
+	// readers may still be using the old config
+	assert.False(t, old.IsRouterNow, "should not modify the config in place")
+}
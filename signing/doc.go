@@ -1,3 +1,4 @@
 // Package signing provides code for signing and verifying signatures using the
-// XChaCha20-Poly1305-Curve25519 construction.
+// XChaCha20-Poly1305-Curve25519 construction, and Ed25519 signatures that
+// anyone can verify, using a key derived from the wireguard private key.
 package signing
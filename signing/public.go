@@ -0,0 +1,35 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+)
+
+// publicKeyContext separates the Ed25519 key derived from the wireguard
+// private key from any other use of that key
+const publicKeyContext = "wirelink ed25519 signing key v1\x00"
+
+// ed25519Key derives an Ed25519 key from the wireguard private key. Curve25519
+// keys can't make signatures others can verify, so this is used for those.
+func (s *Signer) ed25519Key() ed25519.PrivateKey {
+	seed := sha256.Sum256(append([]byte(publicKeyContext), s.privateKey[:]...))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// PublicSigningKey returns the Ed25519 public key that verifies signatures from
+// Sign. It is distinct from the wireguard public key.
+func (s *Signer) PublicSigningKey() ed25519.PublicKey {
+	return s.ed25519Key().Public().(ed25519.PublicKey)
+}
+
+// Sign makes an Ed25519 signature of the data. Unlike SignFor, the signature
+// is not tied to a specific peer: anyone with the PublicSigningKey can verify
+// it.
+func (s *Signer) Sign(data []byte) []byte {
+	return ed25519.Sign(s.ed25519Key(), data)
+}
+
+// Verify checks a signature made by Sign
+func Verify(key ed25519.PublicKey, data, signature []byte) bool {
+	return len(key) == ed25519.PublicKeySize && ed25519.Verify(key, data, signature)
+}
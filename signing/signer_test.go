@@ -66,3 +66,21 @@ func TestSignErrors(t *testing.T) {
 	_, err = signer.sharedKey(&badPub)
 	assert.Error(t, err)
 }
+
+func TestSignPublic(t *testing.T) {
+	key1, _ := testutils.MustKeyPair(t)
+	key2, _ := testutils.MustKeyPair(t)
+	signer1 := New(key1)
+	signer2 := New(key2)
+
+	pub1 := signer1.PublicSigningKey()
+	assert.Equal(t, pub1, New(key1).PublicSigningKey(), "key derivation should be stable")
+	assert.NotEqual(t, pub1, signer2.PublicSigningKey())
+
+	data := []byte("some data")
+	sig := signer1.Sign(data)
+	assert.True(t, Verify(pub1, data, sig))
+	assert.False(t, Verify(signer2.PublicSigningKey(), data, sig))
+	assert.False(t, Verify(pub1, []byte("other data"), sig))
+	assert.False(t, Verify(pub1[:10], data, sig), "short keys should not panic")
+}
@@ -74,6 +74,17 @@ type Evaluator interface {
 
 //go:generate go run github.com/vektra/mockery/v2 --testonly --inpackage --name Evaluator
 
+// ThresholdAttribute returns the attribute whose trust threshold applies to
+// the fact: a retraction needs the same trust as the fact it retracts.
+func ThresholdAttribute(f *fact.Fact) fact.Attribute {
+	if f.Attribute == fact.AttributeRetraction {
+		if rv, ok := f.Value.(*fact.RetractionValue); ok {
+			return rv.Attribute
+		}
+	}
+	return f.Attribute
+}
+
 // ShouldAccept checks whether a fact Attribute should be accepted, given the
 // trust level of the source, and whether the peer is already locally
 // configured
@@ -96,7 +107,7 @@ func ShouldAccept(attr fact.Attribute, known bool, level *Level) bool {
 	case fact.AttributeAllowedCidrV4, fact.AttributeAllowedCidrV6:
 		threshold = AllowedIPs
 
-	case fact.AttributeMember, fact.AttributeMemberMetadata:
+	case fact.AttributeMember, fact.AttributeMemberMetadata, fact.AttributeNetworkTiming:
 		threshold = Membership
 
 	default:
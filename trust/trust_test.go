@@ -42,6 +42,7 @@ func TestShouldAccept(t *testing.T) {
 		fact.AttributeAllowedCidrV6,
 		fact.AttributeMember,
 		fact.AttributeMemberMetadata,
+		fact.AttributeNetworkTiming,
 	}
 	invalidAttrs := []fact.Attribute{
 		fact.AttributeUnknown,
@@ -49,6 +50,12 @@ func TestShouldAccept(t *testing.T) {
 		fact.AttributeAlive,
 		// signed group is a transport structure and never directly evaluated for trust
 		fact.AttributeSignedGroup,
+		// digests are only for the peer they summarize
+		fact.AttributeDigest,
+		// retractions are evaluated as the attribute they retract
+		fact.AttributeRetraction,
+		// interests are only for the peer that sends them
+		fact.AttributeInterest,
 	}
 	epAttrs := []fact.Attribute{
 		fact.AttributeEndpointV4,
@@ -61,6 +68,7 @@ func TestShouldAccept(t *testing.T) {
 	memberAttr := []fact.Attribute{
 		fact.AttributeMember,
 		fact.AttributeMemberMetadata,
+		fact.AttributeNetworkTiming,
 	}
 	allLevels := []Level{Untrusted, Endpoint, AllowedIPs, Membership, DelegateTrust}
 
@@ -84,3 +92,23 @@ func TestShouldAccept(t *testing.T) {
 		})
 	}
 }
+
+func TestThresholdAttribute(t *testing.T) {
+	ep := &fact.Fact{
+		Attribute: fact.AttributeEndpointV4,
+		Subject:   &fact.PeerSubject{},
+		Value:     &fact.IPPortValue{},
+	}
+	aip := &fact.Fact{
+		Attribute: fact.AttributeAllowedCidrV4,
+		Subject:   &fact.PeerSubject{},
+		Value:     &fact.IPNetValue{},
+	}
+	assert.Equal(t, fact.AttributeEndpointV4, ThresholdAttribute(ep))
+	assert.Equal(t, fact.AttributeEndpointV4, ThresholdAttribute(fact.Retract(ep)))
+	assert.Equal(t, fact.AttributeAllowedCidrV4, ThresholdAttribute(fact.Retract(aip)))
+	assert.Equal(t, fact.AttributeRetraction, ThresholdAttribute(&fact.Fact{Attribute: fact.AttributeRetraction, Value: &fact.EmptyValue{}}))
+	// a retraction needs the same trust as what it retracts
+	assert.False(t, ShouldAccept(ThresholdAttribute(fact.Retract(aip)), true, new(Endpoint)))
+	assert.True(t, ShouldAccept(ThresholdAttribute(fact.Retract(aip)), true, new(AllowedIPs)))
+}
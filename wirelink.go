@@ -23,7 +23,7 @@ func main() {
 		}
 		return
 	}
-	if cmd.Server == nil {
+	if !cmd.Runnable() {
 		// --dump or such
 		return
 	}